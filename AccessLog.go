@@ -0,0 +1,136 @@
+package toolkit
+
+import (
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// AccessLogConfig configures the access log entry written once per request. Enable it with WithAccessLog
+type AccessLogConfig struct {
+	// Headers are the request headers added to the entry
+	Headers []string
+	// RequestBody adds the start of the request body to the entry. Meant for debugging environments
+	RequestBody bool
+	// ResponseBody adds the start of the response body to the entry, unless the response is compressed. Meant for debugging environments
+	ResponseBody bool
+	// MaxBodySize is how many bytes of the bodies are captured. Defaults to 4KB
+	MaxBodySize int
+}
+
+// WithAccessLog writes a single entry for every request once its response has been written, containing the method, path, status, latency,
+// request and response sizes, and user agent. In the GCP log format they're written as the `httpRequest` field shown in the Cloud Logging console
+func WithAccessLog(accessLog AccessLogConfig) Option {
+	return func(config *Config) {
+		if accessLog.MaxBodySize <= 0 {
+			accessLog.MaxBodySize = 4 << 10
+		}
+		config.AccessLog = &accessLog
+	}
+}
+
+// WithoutAccessLog stops writing the access log entries
+func WithoutAccessLog() Option {
+	return func(config *Config) {
+		config.AccessLog = nil
+	}
+}
+
+// captureBuffer keeps the first bytes written to it, and counts the total
+type captureBuffer struct {
+	data  []byte
+	limit int
+	total int
+}
+
+func (this *captureBuffer) Write(p []byte) (int, error) {
+	if remaining := this.limit - len(this.data); remaining > 0 {
+		this.data = append(this.data, p[:min(remaining, len(p))]...)
+	}
+	this.total += len(p)
+	return len(p), nil
+}
+
+// capturingBody copies what is read from the request body into a captureBuffer
+type capturingBody struct {
+	io.ReadCloser
+	capture *captureBuffer
+}
+
+func (this capturingBody) Read(p []byte) (int, error) {
+	n, err := this.ReadCloser.Read(p)
+	_, _ = this.capture.Write(p[:n])
+	return n, err
+}
+
+// startAccessLog sets up the capture of the request and response bodies, if enabled
+func (this FunctionContext) startAccessLog() {
+	if config.AccessLog.RequestBody && this.Request.Body != nil {
+		this.state.requestCapture = &captureBuffer{limit: config.AccessLog.MaxBodySize}
+		this.Request.Body = capturingBody{ReadCloser: this.Request.Body, capture: this.state.requestCapture}
+	}
+	if config.AccessLog.ResponseBody {
+		this.state.writer.capture = &captureBuffer{limit: config.AccessLog.MaxBodySize}
+	}
+}
+
+// writeAccessLog writes the access log entry of the request. Server errors are logged at the ERROR level, client errors at WARN, and anything else at INFO
+func (this FunctionContext) writeAccessLog(status int, bytes int) {
+	accessLog := config.AccessLog
+	latency := time.Since(this.state.start)
+	requestSize := this.Request.ContentLength
+	if requestSize < 0 && this.state.requestCapture != nil {
+		requestSize = int64(this.state.requestCapture.total)
+	}
+
+	level := zerolog.InfoLevel
+	if status >= 500 {
+		level = zerolog.ErrorLevel
+	} else if status >= 400 {
+		level = zerolog.WarnLevel
+	}
+	e := this.Logger.WithLevel(level).Ctx(this.Context)
+	if config.TracerProvider != nil {
+		e = this.spanEvent(e)
+	}
+	if config.GcpLogFormat {
+		request := zerolog.Dict().
+			Str("requestMethod", this.Request.Method).
+			Str("requestUrl", this.Request.URL.String()).
+			Int("status", status).
+			Str("responseSize", strconv.Itoa(bytes)).
+			Str("userAgent", this.Request.UserAgent()).
+			Str("remoteIp", this.Request.RemoteAddr).
+			Str("latency", strconv.FormatFloat(latency.Seconds(), 'f', 9, 64)+"s")
+		if requestSize >= 0 {
+			request = request.Str("requestSize", strconv.FormatInt(requestSize, 10))
+		}
+		e = e.Dict("httpRequest", request)
+	} else {
+		e = e.Str("method", this.Request.Method).
+			Str("path", this.Request.URL.Path).
+			Int("status", status).
+			Float64("latencyMs", float64(latency.Microseconds())/1000).
+			Int64("requestSize", requestSize).
+			Int("responseSize", bytes).
+			Str("userAgent", this.Request.UserAgent())
+	}
+	if len(accessLog.Headers) > 0 {
+		headers := zerolog.Dict()
+		for _, name := range accessLog.Headers {
+			if value := this.Request.Header.Get(name); value != "" {
+				headers = headers.Str(name, value)
+			}
+		}
+		e = e.Dict("requestHeaders", headers)
+	}
+	if this.state.requestCapture != nil {
+		e = e.Str("requestBody", string(this.state.requestCapture.data))
+	}
+	if capture := this.state.writer.capture; capture != nil && this.Response.Header().Get("Content-Encoding") == "" {
+		e = e.Str("responseBody", string(capture.data))
+	}
+	e.Msgf(this.spanIdLogField+"%v %v %v %v", this.Request.Method, this.Request.URL.Path, status, latency.Round(time.Microsecond))
+}
@@ -0,0 +1,254 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiKeyRefreshInterval is how long the keys of a SecretManagerKeyStore are cached
+const apiKeyRefreshInterval = 5 * time.Minute
+
+// ApiKey is an API key and the metadata of the client it was issued to
+type ApiKey struct {
+	// Id identifies the key in the logs without revealing it. Defaults to the start of the key's SHA-256 hash
+	Id     string            `json:"id"`
+	Key    string            `json:"key"`
+	Owner  string            `json:"owner"`
+	Scopes []string          `json:"scopes"`
+	Labels map[string]string `json:"labels"`
+}
+
+// KeyStore looks up API keys. Lookup returns false if the key doesn't exist, and an error if the store can't be read
+type KeyStore interface {
+	Lookup(ctx context.Context, key string) (ApiKey, bool, error)
+}
+
+// keyId returns the id of a key without one: the first 12 characters of the hex SHA-256 hash of the key
+func keyId(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:6])
+}
+
+// StaticKeyStore is a KeyStore with a fixed list of keys. Create it with StaticKeys or EnvKeys
+type StaticKeyStore struct {
+	keys []ApiKey
+}
+
+// StaticKeys creates a KeyStore with the given keys
+func StaticKeys(keys ...ApiKey) *StaticKeyStore {
+	for i := range keys {
+		if keys[i].Id == "" {
+			keys[i].Id = keyId(keys[i].Key)
+		}
+	}
+	return &StaticKeyStore{keys: keys}
+}
+
+// EnvKeys creates a KeyStore with the keys of the environment variable, a comma separated list of `<owner>:<key>:<scopes>` entries whose scopes are separated by spaces,
+// e.g. `billing:k-7f3a9:orders:read orders:write,reports:k-81bc2:orders:read`. The owner and scopes are optional
+func EnvKeys(variable string) *StaticKeyStore {
+	var keys []ApiKey
+	for _, entry := range strings.Split(os.Getenv(variable), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		switch len(parts) {
+		case 1:
+			keys = append(keys, ApiKey{Key: parts[0]})
+		case 2:
+			keys = append(keys, ApiKey{Owner: parts[0], Key: parts[1]})
+		default:
+			keys = append(keys, ApiKey{Owner: parts[0], Key: parts[1], Scopes: strings.Fields(parts[2])})
+		}
+	}
+	return StaticKeys(keys...)
+}
+
+// Lookup compares the key with every key of the store in constant time
+func (this *StaticKeyStore) Lookup(_ context.Context, key string) (ApiKey, bool, error) {
+	return findKey(this.keys, key)
+}
+
+// findKey compares the hashes of the key and of every key in the list, so the time taken doesn't reveal how much of a key matched, or which key did
+func findKey(keys []ApiKey, key string) (ApiKey, bool, error) {
+	hash := sha256.Sum256([]byte(key))
+	var found ApiKey
+	match := 0
+	for _, candidate := range keys {
+		candidateHash := sha256.Sum256([]byte(candidate.Key))
+		if subtle.ConstantTimeCompare(hash[:], candidateHash[:]) == 1 {
+			found = candidate
+			match = 1
+		}
+	}
+	return found, match == 1, nil
+}
+
+// SecretManagerKeyStore is a KeyStore reading the keys from a Secret Manager secret containing a json array of ApiKey objects, e.g.
+// `[{"key": "k-7f3a9", "owner": "billing", "scopes": ["orders:read"]}]`. The keys are cached for 5 minutes, so added and revoked keys are picked up without a deployment
+type SecretManagerKeyStore struct {
+	// Secret is the name of the secret, e.g. `api-keys` or `projects/<project>/secrets/api-keys/versions/3`
+	Secret string
+	// Endpoint is the address of the Secret Manager API
+	Endpoint  string
+	mutex     sync.Mutex
+	keys      []ApiKey
+	fetchedAt time.Time
+}
+
+// NewSecretManagerKeyStore creates a KeyStore reading the keys from the latest version of the secret
+func NewSecretManagerKeyStore(secret string) *SecretManagerKeyStore {
+	return &SecretManagerKeyStore{Secret: secret, Endpoint: secretManagerEndpoint}
+}
+
+// Lookup reads the keys from the secret if they aren't cached, and compares the key with every one of them in constant time.
+// If the secret can't be read, the keys read before are used for another 5 minutes, so requests don't wait for a failing API one after the other
+func (this *SecretManagerKeyStore) Lookup(ctx context.Context, key string) (ApiKey, bool, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if time.Since(this.fetchedAt) >= apiKeyRefreshInterval {
+		payload, err := accessSecret(ctx, this.Endpoint, this.Secret)
+		var keys []ApiKey
+		if err == nil {
+			err = codec.Unmarshal(payload, &keys)
+		}
+		switch {
+		case err == nil:
+			this.keys = StaticKeys(keys...).keys
+			this.fetchedAt = time.Now()
+		case this.keys == nil:
+			return ApiKey{}, false, fmt.Errorf("failed to read the API keys: %w", err)
+		default:
+			this.fetchedAt = time.Now()
+		}
+	}
+	return findKey(this.keys, key)
+}
+
+// FirestoreKeyStore is a KeyStore looking up keys in a Firestore collection. The id of a key's document is the hex SHA-256 hash of the key,
+// so the keys themselves aren't stored, and the document has the `owner`, `scopes` (an array) and `labels` (a map) fields of the key.
+// Documents with a `disabled` field set to true are rejected
+type FirestoreKeyStore struct {
+	Collection string
+	// Database is the id of the Firestore database. Defaults to `(default)`
+	Database string
+	// Endpoint is the address of the Firestore API, which can be set to an emulator
+	Endpoint string
+}
+
+// NewFirestoreKeyStore creates a KeyStore looking up keys in the collection of the default database of the function's project
+func NewFirestoreKeyStore(collection string) *FirestoreKeyStore {
+	endpoint := "https://firestore.googleapis.com"
+	if host := os.Getenv("FIRESTORE_EMULATOR_HOST"); host != "" {
+		endpoint = "http://" + host
+	}
+	return &FirestoreKeyStore{Collection: collection, Database: "(default)", Endpoint: endpoint}
+}
+
+// Lookup reads the document of the key's hash
+func (this *FirestoreKeyStore) Lookup(ctx context.Context, key string) (ApiKey, bool, error) {
+	hash := sha256.Sum256([]byte(key))
+	id := hex.EncodeToString(hash[:])
+	var document firestoreJsonDocument
+	address := this.Endpoint + "/v1/projects/" + projectId() + "/databases/" + url.PathEscape(this.Database) + "/documents/" + this.Collection + "/" + id
+	err := googleApi(ctx, http.MethodGet, address, nil, &document)
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) && statusErr.status == http.StatusNotFound {
+		return ApiKey{}, false, nil
+	}
+	if err != nil {
+		return ApiKey{}, false, fmt.Errorf("failed to look up the API key: %w", err)
+	}
+	fields, err := decodeFirestoreJsonFields(document.Fields)
+	if err != nil {
+		return ApiKey{}, false, fmt.Errorf("invalid API key document: %w", err)
+	}
+	if disabled, _ := fields["disabled"].(bool); disabled {
+		return ApiKey{}, false, nil
+	}
+	apiKey := ApiKey{Id: id[:12], Key: key, Labels: map[string]string{}}
+	apiKey.Owner, _ = fields["owner"].(string)
+	scopes, _ := fields["scopes"].([]interface{})
+	for _, scope := range scopes {
+		apiKey.Scopes = append(apiKey.Scopes, fmt.Sprint(scope))
+	}
+	labels, _ := fields["labels"].(map[string]interface{})
+	for name, value := range labels {
+		apiKey.Labels[name] = fmt.Sprint(value)
+	}
+	return apiKey, true, nil
+}
+
+// ApiKeyConfig configures RequireApiKey
+type ApiKeyConfig struct {
+	Store KeyStore
+	// Header is the header carrying the key. Defaults to X-API-Key
+	Header string
+	// QueryParameter is a query parameter the key can be sent in instead of the header, e.g. `key`. Keys aren't read from the query if it's empty
+	QueryParameter string
+	// Scopes are the scopes the key needs to call the function
+	Scopes []string
+}
+
+type apiKeyKey struct{}
+
+// RequireApiKey is a middleware which rejects requests with a 401 response unless they have a key of the store, and with a 403 response if the key lacks one of the Scopes.
+// The handler gets a ctx whose principal is the owner of the key (or its id), with the key's scopes in the `scope` claim, and the key available through ctx.ApiKey.
+// Requests get a 503 response if the store fails. Panics if no Store is configured
+func RequireApiKey(apiKeys ApiKeyConfig) Middleware {
+	if apiKeys.Store == nil {
+		panic("RequireApiKey needs a Store")
+	}
+	if apiKeys.Header == "" {
+		apiKeys.Header = "X-API-Key"
+	}
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx FunctionContext) error {
+			key := ctx.Request.Header.Get(apiKeys.Header)
+			if key == "" && apiKeys.QueryParameter != "" {
+				key = ctx.Request.URL.Query().Get(apiKeys.QueryParameter)
+			}
+			if key == "" {
+				return Unauthorized("Missing API key").WithInternal("no %v header", apiKeys.Header)
+			}
+			apiKey, found, err := apiKeys.Store.Lookup(ctx.Context, key)
+			if err != nil {
+				return ServiceUnavailable("Failed to verify the API key").WithCause(err)
+			}
+			if !found {
+				return Unauthorized("Invalid API key").WithInternal("unknown key %v", keyId(key))
+			}
+			for _, scope := range apiKeys.Scopes {
+				if !slices.Contains(apiKey.Scopes, scope) {
+					return Forbidden("The API key lacks the "+scope+" scope").WithInternal("key %v of %v", apiKey.Id, apiKey.Owner)
+				}
+			}
+			principal := apiKey.Owner
+			if principal == "" {
+				principal = apiKey.Id
+			}
+			ctx = ctx.WithPrincipal(principal, map[string]interface{}{"sub": principal, "keyId": apiKey.Id, "scope": apiKey.Scopes})
+			ctx.Context = context.WithValue(ctx.Context, apiKeyKey{}, apiKey)
+			return next(ctx)
+		}
+	}
+}
+
+// ApiKey returns the key a request was authenticated with by RequireApiKey, and false for other requests
+func (this FunctionContext) ApiKey() (ApiKey, bool) {
+	apiKey, ok := this.Context.Value(apiKeyKey{}).(ApiKey)
+	return apiKey, ok
+}
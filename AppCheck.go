@@ -0,0 +1,116 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// appCheckIssuer prefixes the issuer of App Check tokens, which ends with the project number
+const appCheckIssuer = "https://firebaseappcheck.googleapis.com/"
+
+// AppCheckConfig configures how RequireAppCheck verifies the Firebase App Check tokens of requests
+type AppCheckConfig struct {
+	// ProjectId is the Firebase project the tokens must be issued for. Defaults to the project the function runs in
+	ProjectId string
+	// AppIds are the only Firebase apps whose tokens are accepted, e.g. `1:1234567890:web:0a1b2c3d4e5f`. Any app of the project is accepted if it's empty
+	AppIds []string
+	// Consume marks every token as consumed with the App Check API and rejects the tokens which already were, to protect against replays.
+	// Clients must send limited use tokens, and the function's service account needs the Firebase App Check Token Verifier role
+	Consume bool
+	// KeysUrl is the address of the keys App Check signs tokens with
+	KeysUrl string
+	// Endpoint is the address of the App Check API
+	Endpoint string
+}
+
+// AppCheckToken is the verified App Check token of a request
+type AppCheckToken struct {
+	// AppId is the Firebase app the request was sent from
+	AppId    string
+	IssuedAt time.Time
+	Expiry   time.Time
+}
+
+type appCheckKey struct{}
+
+// RequireAppCheck is a middleware which rejects requests with a 401 response unless their X-Firebase-AppCheck header is a valid App Check token of the project,
+// and with a 403 response if it was issued to an app which isn't one of the AppIds. The response has a detail whose code is the reason of the denial, e.g. `appcheck.invalid`.
+// Requests get a 503 response if the keys or the API can't be fetched
+func RequireAppCheck(appCheck AppCheckConfig) Middleware {
+	if appCheck.ProjectId == "" {
+		appCheck.ProjectId = projectId()
+	}
+	if appCheck.KeysUrl == "" {
+		appCheck.KeysUrl = appCheckIssuer + "v1/jwks"
+	}
+	if appCheck.Endpoint == "" {
+		appCheck.Endpoint = "https://firebaseappcheck.googleapis.com"
+	}
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx FunctionContext) error {
+			token := ctx.Request.Header.Get("X-Firebase-AppCheck")
+			if token == "" {
+				return appCheck.deny(http.StatusUnauthorized, "missing", "The request has no App Check token")
+			}
+			claims, err := verifyJwt(ctx.Context, token, keySet(appCheck.KeysUrl))
+			if err == nil {
+				err = validateClaims(claims, nil, "projects/"+appCheck.ProjectId)
+			}
+			if issuer, _ := claims["iss"].(string); err == nil && !strings.HasPrefix(issuer, appCheckIssuer) {
+				err = errors.New("token wasn't issued by App Check")
+			}
+			appId, _ := claims["sub"].(string)
+			if err == nil && appId == "" {
+				err = errors.New("token has no subject")
+			}
+			if err == nil && appCheck.Consume {
+				err = appCheck.consume(ctx, token)
+			}
+			if err != nil {
+				var statusErr *httpStatusError
+				if errors.As(err, &statusErr) {
+					return ServiceUnavailable("Failed to verify the App Check token").WithCause(err)
+				}
+				return appCheck.deny(http.StatusUnauthorized, "invalid", "The App Check token is invalid").WithCause(err)
+			}
+			if len(appCheck.AppIds) > 0 && !slices.Contains(appCheck.AppIds, appId) {
+				return appCheck.deny(http.StatusForbidden, "app_not_allowed", "The app isn't allowed to call the function").WithInternal("App Check token of app %v", appId)
+			}
+			issuedAt, _ := claims["iat"].(float64)
+			expiry, _ := claims["exp"].(float64)
+			verified := AppCheckToken{AppId: appId, IssuedAt: time.Unix(int64(issuedAt), 0), Expiry: time.Unix(int64(expiry), 0)}
+			ctx.Context = context.WithValue(ctx.Context, appCheckKey{}, verified)
+			return next(ctx.WithField("appId", appId))
+		}
+	}
+}
+
+// AppCheck returns the App Check token of a request verified by RequireAppCheck, and false for other requests
+func (this FunctionContext) AppCheck() (AppCheckToken, bool) {
+	token, ok := this.Context.Value(appCheckKey{}).(AppCheckToken)
+	return token, ok
+}
+
+// consume marks the token as consumed, failing if it already was
+func (this AppCheckConfig) consume(ctx FunctionContext, token string) error {
+	var response struct {
+		AlreadyConsumed bool `json:"alreadyConsumed"`
+	}
+	address := this.Endpoint + "/v1beta/projects/" + this.ProjectId + ":verifyAppCheckToken"
+	if err := googleApi(ctx.Context, http.MethodPost, address, map[string]interface{}{"appCheckToken": token}, &response); err != nil {
+		return err
+	}
+	if response.AlreadyConsumed {
+		return errors.New("token has already been consumed")
+	}
+	return nil
+}
+
+// deny creates the error of a request denied for the given reason
+func (this AppCheckConfig) deny(status int, reason string, message string) *ResponseError {
+	return NewResponseError(status, message, ErrorDetail{Field: "X-Firebase-AppCheck", Code: "appcheck." + reason, Message: message})
+}
@@ -0,0 +1,82 @@
+package toolkit
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// scopeClaims are the claims listing the scopes of a principal: the OAuth2 `scope`, Azure AD's `scp` and Auth0's `permissions`
+var scopeClaims = []string{"scope", "scp", "permissions"}
+
+// roleClaims are the claims listing the roles of a principal
+var roleClaims = []string{"roles", "role", "groups"}
+
+// Scopes returns the scopes granted to the principal, from its `scope`, `scp` or `permissions` claims
+func (this Principal) Scopes() []string {
+	return this.claimsStrings(scopeClaims)
+}
+
+// Roles returns the roles of the principal, from its `roles`, `role` or `groups` claims
+func (this Principal) Roles() []string {
+	return this.claimsStrings(roleClaims)
+}
+
+func (this Principal) claimsStrings(names []string) []string {
+	var values []string
+	for _, name := range names {
+		values = append(values, this.ClaimStrings(name)...)
+	}
+	return values
+}
+
+// RequireScopes is a middleware which only runs the handler for principals granted all the scopes, e.g. `tk.RequireScopes("orders:write")`.
+// It goes after the middleware which authenticates the request, e.g. RequireJWT or RequireApiKey. Requests without a principal get a 401 response,
+// and principals lacking a scope get a 403 response listing the missing scopes. Denials are logged with the `actor` and `requiredScopes` fields, for auditing
+func RequireScopes(scopes ...string) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx FunctionContext) error {
+			principal, ok := ctx.Principal()
+			if !ok {
+				return Unauthorized("Authentication required").WithInternal("no principal for scopes %v", strings.Join(scopes, ", "))
+			}
+			granted := principal.Scopes()
+			var details []ErrorDetail
+			for _, scope := range scopes {
+				if !slices.Contains(granted, scope) {
+					details = append(details, ErrorDetail{Field: "scope", Code: "missing_scope", Message: scope})
+				}
+			}
+			if len(details) > 0 {
+				ctx.WithFields(map[string]interface{}{"actor": principal.Id, "requiredScopes": scopes}).Warnf("Access denied to %v: missing scopes", principal.Id)
+				return NewResponseError(http.StatusForbidden, "Missing required scopes", details...).WithInternal("%v lacks scopes of %v", principal.Id, strings.Join(scopes, ", "))
+			}
+			return next(ctx)
+		}
+	}
+}
+
+// RequireRole is a middleware which only runs the handler for principals with one of the roles, e.g. `tk.RequireRole("admin")`.
+// It goes after the middleware which authenticates the request. Requests without a principal get a 401 response, and principals without the roles get a 403 response.
+// Denials are logged with the `actor` and `requiredRoles` fields, for auditing
+func RequireRole(roles ...string) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx FunctionContext) error {
+			principal, ok := ctx.Principal()
+			if !ok {
+				return Unauthorized("Authentication required").WithInternal("no principal for roles %v", strings.Join(roles, ", "))
+			}
+			for _, role := range principal.Roles() {
+				if slices.Contains(roles, role) {
+					return next(ctx)
+				}
+			}
+			ctx.WithFields(map[string]interface{}{"actor": principal.Id, "requiredRoles": roles}).Warnf("Access denied to %v: missing role", principal.Id)
+			details := make([]ErrorDetail, len(roles))
+			for i, role := range roles {
+				details[i] = ErrorDetail{Field: "role", Code: "missing_role", Message: role}
+			}
+			return NewResponseError(http.StatusForbidden, "Missing required role", details...).WithInternal("%v has none of the roles %v", principal.Id, strings.Join(roles, ", "))
+		}
+	}
+}
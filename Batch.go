@@ -0,0 +1,173 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MaxBatchSize is the largest number of sub-requests a single batch request may contain
+var MaxBatchSize = 50
+
+// BatchRequest is a single sub-request inside a batch request body
+type BatchRequest struct {
+	Id      string            `json:"id"`
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// BatchResponseEntry is the response to a single sub-request of a batch request
+type BatchResponseEntry struct {
+	Id     string          `json:"id"`
+	Status int             `json:"status"`
+	SpanId string          `json:"spanId"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// Batch routes the sub-requests of a batch request to the handlers registered on it. Create it with NewBatch
+type Batch struct {
+	routes map[string]func(ctx FunctionContext)
+}
+
+// NewBatch creates an empty Batch router
+func NewBatch() *Batch {
+	return &Batch{routes: map[string]func(ctx FunctionContext){}}
+}
+
+// Handle registers the handler for sub-requests with the given method and path
+func (this *Batch) Handle(method string, path string, handler func(ctx FunctionContext)) *Batch {
+	this.routes[method+" "+path] = handler
+	return this
+}
+
+// batchRecorder is an http.ResponseWriter which keeps the response of a sub-request in memory
+type batchRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (this *batchRecorder) Header() http.Header {
+	return this.header
+}
+
+func (this *batchRecorder) Write(buf []byte) (int, error) {
+	if this.status == 0 {
+		this.status = http.StatusOK
+	}
+	return this.body.Write(buf)
+}
+
+func (this *batchRecorder) WriteHeader(status int) {
+	if this.status == 0 {
+		this.status = status
+	}
+}
+
+// ProcessBatch decodes the request body as an array of BatchRequest objects, runs each of them concurrently through the handlers registered on the batch,
+// and sends a 207 response containing a BatchResponseEntry per sub-request. Every sub-request is given its own span id derived from this ctx's span id
+func (this FunctionContext) ProcessBatch(batch *Batch) {
+	var requests []BatchRequest
+	body, err := this.RawBody()
+	if err == nil {
+		err = codec.Unmarshal(body, &requests)
+	}
+	if err != nil {
+		this.withSkip(1).FailResponse(http.StatusBadRequest, "Batch request body must be an array of requests")
+		return
+	}
+	if len(requests) > MaxBatchSize {
+		this.withSkip(1).FailResponse(http.StatusBadRequest, "Batch request cannot contain more than "+strconv.Itoa(MaxBatchSize)+" requests")
+		return
+	}
+
+	entries := make([]BatchResponseEntry, len(requests))
+	var wg sync.WaitGroup
+	for i, request := range requests {
+		wg.Add(1)
+		go func(i int, request BatchRequest) {
+			defer wg.Done()
+			entries[i] = this.runBatchRequest(batch, this.SpanId+"-"+strconv.Itoa(i+1), request)
+		}(i, request)
+	}
+	wg.Wait()
+
+	this.withSkip(1).Debugf("Responding with status 207 (%v sub-requests)", len(entries))
+	this.writeJson(http.StatusMultiStatus, entries)
+}
+
+func (this FunctionContext) runBatchRequest(batch *Batch, spanId string, request BatchRequest) BatchResponseEntry {
+	recorder := &batchRecorder{header: http.Header{}}
+	rq, err := http.NewRequestWithContext(this.Context, request.Method, request.Path, bytes.NewReader(request.Body))
+	if err != nil {
+		this.subCtx(spanId, recorder, this.Request).withSkip(2).FailResponse(http.StatusBadRequest, "Invalid request path "+request.Path)
+	} else {
+		rq.Header = this.Request.Header.Clone()
+		for name, value := range request.Headers {
+			rq.Header.Set(name, value)
+		}
+		ctx := this.subCtx(spanId, recorder, rq)
+		if handler, ok := batch.routes[request.Method+" "+rq.URL.Path]; ok {
+			if runBatchHandler(ctx, handler) && recorder.status != http.StatusInternalServerError {
+				//  The handler had already responded when it panicked, so its partial response is replaced
+				recorder.status = http.StatusInternalServerError
+				recorder.body.Reset()
+			}
+		} else {
+			ctx.withSkip(2).FailResponse(http.StatusNotFound, "No handler for "+request.Method+" "+rq.URL.Path)
+		}
+	}
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+
+	entry := BatchResponseEntry{Id: request.Id, Status: recorder.status, SpanId: spanId}
+	if recorder.body.Len() > 0 {
+		if json.Valid(recorder.body.Bytes()) {
+			entry.Body = recorder.body.Bytes()
+		} else {
+			entry.Body, _ = codec.Marshal(recorder.body.String())
+		}
+	}
+	return entry
+}
+
+// runBatchHandler runs the handler of a sub-request, returning true if it panicked. Its panics are recovered like Recover does,
+// since they'd otherwise crash the instance: the sub-requests run in their own goroutines, which Handle doesn't guard
+func runBatchHandler(ctx FunctionContext, handler func(ctx FunctionContext)) (panicked bool) {
+	defer func() {
+		//  Recover passes on the panics of Fatal, whose response has already been written
+		_ = recover()
+	}()
+	panicked = true
+	defer ctx.Recover()
+	handler(ctx)
+	return false
+}
+
+// subCtx creates a ctx for a sub-request of this ctx's request. Its log messages carry both span ids
+func (this FunctionContext) subCtx(spanId string, w http.ResponseWriter, r *http.Request) FunctionContext {
+	logger := this.Logger.With().Str("subSpanId", "["+spanId+"]").Logger()
+	spanIdLogField := "[" + spanId + "] "
+	if isLocalDeployment || config.GcpLogFormat {
+		spanIdLogField = ""
+	}
+	writer := &trackingWriter{ResponseWriter: w}
+	return FunctionContext{
+		SpanId:          spanId,
+		TraceId:         this.TraceId,
+		RequestId:       this.RequestId,
+		spanIdLogField:  spanIdLogField,
+		Logger:          &logger,
+		Response:        writer,
+		Request:         r,
+		Context:         r.Context(),
+		stackFrameLevel: 1,
+		state:           &requestState{writer: writer, start: time.Now(), trace: this.state.trace},
+	}
+}
@@ -0,0 +1,50 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// MaxBodySize is the largest request body RawBody will read, in bytes
+var MaxBodySize int64 = 10 << 20
+
+// ErrBodyTooLarge is returned by RawBody when the request body is larger than MaxBodySize
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// RawBody reads the whole request body and caches it, so it can be read again by other helpers (e.g. verifying a signature and then binding it to a struct).
+// After calling it, ctx.Request.Body can also be read again from the start
+func (this FunctionContext) RawBody() ([]byte, error) {
+	if !this.state.bodyRead {
+		this.state.bodyRead = true
+		if this.Request.Body != nil {
+			body, err := io.ReadAll(io.LimitReader(this.Request.Body, MaxBodySize+1))
+			if err == nil && int64(len(body)) > MaxBodySize {
+				err = ErrBodyTooLarge
+			}
+			this.state.body, this.state.bodyErr = body, err
+		}
+	}
+	this.Request.Body = io.NopCloser(bytes.NewReader(this.state.body))
+	return this.state.body, this.state.bodyErr
+}
+
+// BindJson decodes the request body into the given object. If the body can't be read or isn't valid json, a 400 (or 413) response is sent and false is returned.
+// The body stays available through RawBody afterward
+func (this FunctionContext) BindJson(obj interface{}) bool {
+	body, err := this.RawBody()
+	if errors.Is(err, ErrBodyTooLarge) {
+		this.withSkip(1).FailResponse(http.StatusRequestEntityTooLarge, "Request body is too large")
+		return false
+	}
+	if err != nil {
+		this.withSkip(1).ErrResponse(http.StatusBadRequest, err, "Failed to read request body")
+		return false
+	}
+	if err := codec.Unmarshal(body, obj); err != nil {
+		this.withSkip(1).FailResponse(http.StatusBadRequest, "Request body is not valid json: "+err.Error())
+		return false
+	}
+	return true
+}
@@ -0,0 +1,69 @@
+package toolkit
+
+import (
+	"encoding/csv"
+	"mime"
+	"net/http"
+)
+
+// DefaultCSVFilename is the name of the attachments sent by OkResponseCSV. Use OkResponseCSVFile to name a single export differently
+var DefaultCSVFilename = "export.csv"
+
+// lazyResponseWriter writes the status code and headers of a streamed response right before the first bytes of the body,
+// so that the handler can still send an error response if it fails before producing any output
+type lazyResponseWriter struct {
+	ctx         FunctionContext
+	contentType string
+	out         *responseStream
+}
+
+func (this *lazyResponseWriter) Write(buf []byte) (int, error) {
+	if this.out == nil {
+		this.out = this.ctx.startStream(http.StatusOK, this.contentType)
+	}
+	return this.out.Write(buf)
+}
+
+// OkResponseCSV sends a 200 text/csv response as an attachment named DefaultCSVFilename. The header row is written first, followed by the rows written by the given function.
+// Rows are streamed to the client as they are written. If the function returns an error before any output was sent, a 500 response is sent instead
+func (this FunctionContext) OkResponseCSV(headers []string, rows func(w *csv.Writer) error) {
+	this.withSkip(1).OkResponseCSVFile(DefaultCSVFilename, headers, rows)
+}
+
+// OkResponseCSVFile sends a 200 text/csv response as an attachment with the given filename, see OkResponseCSV
+func (this FunctionContext) OkResponseCSVFile(filename string, headers []string, rows func(w *csv.Writer) error) {
+	this.Response.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	output := &lazyResponseWriter{ctx: this, contentType: "text/csv; charset=utf-8"}
+	writer := csv.NewWriter(output)
+
+	err := writer.Write(headers)
+	if err == nil {
+		err = rows(writer)
+	}
+	if err == nil {
+		writer.Flush()
+		err = writer.Error()
+	}
+
+	if err != nil {
+		if output.out == nil {
+			this.Response.Header().Del("Content-Disposition")
+			this.withSkip(1).ErrResponse(http.StatusInternalServerError, err, "Failed to generate CSV")
+			return
+		}
+		this.withSkip(1).Errorf("Failed to write CSV response %v: %v", filename, err)
+		this.finishResponse(err)
+		return
+	}
+	if output.out == nil {
+		//  Only happens when there are no headers and no rows
+		output.Write(nil)
+	}
+	if err := output.out.Close(); err != nil {
+		this.withSkip(1).Errorf("Failed to write CSV response %v: %v", filename, err)
+		this.finishResponse(err)
+		return
+	}
+	this.finishResponse(nil)
+	this.withSkip(1).Debugf("Responded with status 200, CSV file %v", filename)
+}
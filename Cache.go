@@ -0,0 +1,59 @@
+package toolkit
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// addVary adds the given header names to the Vary header of the response, skipping the ones which are already in it
+func addVary(header http.Header, names ...string) {
+	existing := map[string]bool{}
+	var values []string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name != "" && !existing[http.CanonicalHeaderKey(name)] {
+				existing[http.CanonicalHeaderKey(name)] = true
+				values = append(values, name)
+			}
+		}
+	}
+	for _, name := range names {
+		if !existing[http.CanonicalHeaderKey(name)] {
+			existing[http.CanonicalHeaderKey(name)] = true
+			values = append(values, name)
+		}
+	}
+	header.Set("Vary", strings.Join(values, ", "))
+}
+
+// WithCacheControl sets the Cache-Control and Expires headers of the response, allowing it to be cached for maxAge.
+// Public responses can be cached by CDNs and shared caches, private ones only by the client. Returns the ctx so it can be chained with a response method
+func (this FunctionContext) WithCacheControl(maxAge time.Duration, public bool) FunctionContext {
+	visibility := "private"
+	if public {
+		visibility = "public"
+	}
+	seconds := int(maxAge.Seconds())
+	header := this.Response.Header()
+	header.Set("Cache-Control", visibility+", max-age="+strconv.Itoa(seconds))
+	header.Set("Expires", time.Now().Add(time.Duration(seconds)*time.Second).UTC().Format(http.TimeFormat))
+	return this
+}
+
+// WithNoStore sets the Cache-Control header of the response so it's never cached. Returns the ctx so it can be chained with a response method
+func (this FunctionContext) WithNoStore() FunctionContext {
+	header := this.Response.Header()
+	header.Set("Cache-Control", "no-store")
+	header.Del("Expires")
+	return this
+}
+
+// WithVary adds the given request header names to the Vary header of the response, for responses which are cached and depend on those headers.
+// Returns the ctx so it can be chained with a response method
+func (this FunctionContext) WithVary(names ...string) FunctionContext {
+	addVary(this.Response.Header(), names...)
+	return this
+}
@@ -0,0 +1,111 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+)
+
+// EventCtx creates a context for a function triggered by a CloudEvent, e.g. a 2nd gen Cloud Function registered with functions.CloudEvent.
+// It works like a ctx created by FuncCtx: the span id is the event's id, the trace is continued from the event's traceparent extension, and the logs include
+// the event's id, type and source. Finish the handler with Ack, Nack or Drop, whose result is returned to the functions framework
+func EventCtx(ctx context.Context, e event.Event) FunctionContext {
+	r, _ := http.NewRequestWithContext(ctx, http.MethodPost, "/", bytes.NewReader(e.Data()))
+	r.Header.Set("Content-Type", e.DataContentType())
+	r.Header.Set("ce-id", e.ID())
+	r.Header.Set("ce-type", e.Type())
+	r.Header.Set("ce-source", e.Source())
+	r.Header.Set("ce-specversion", e.SpecVersion())
+	if subject := e.Subject(); subject != "" {
+		r.Header.Set("ce-subject", subject)
+	}
+	if traceparent, ok := e.Extensions()["traceparent"].(string); ok {
+		r.Header.Set("traceparent", traceparent)
+	}
+	r.Header.Set(RequestIdHeader, e.ID())
+
+	fctx := newFuncCtx(&eventWriter{header: http.Header{}}, r, eventSpanId(e.ID()))
+	fctx.state.event = &e
+	return fctx.WithFields(map[string]interface{}{"eventId": e.ID(), "eventType": e.Type(), "eventSource": e.Source()})
+}
+
+var errNotAnEvent = errors.New("the ctx was not created by EventCtx")
+
+// eventSpanId makes a span id from the event's id, which is usually a number or uuid
+func eventSpanId(id string) string {
+	id = strings.Map(func(r rune) rune {
+		if r < 0x21 || r > 0x7e {
+			return -1
+		}
+		return r
+	}, id)
+	if len(id) > 64 {
+		id = id[:64]
+	}
+	return id
+}
+
+// eventWriter is the response writer of event contexts. Nothing is sent back, only the status is kept for the metrics and access log
+type eventWriter struct {
+	header http.Header
+}
+
+func (this *eventWriter) Header() http.Header {
+	return this.header
+}
+
+func (this *eventWriter) Write(buf []byte) (int, error) {
+	return len(buf), nil
+}
+
+func (this *eventWriter) WriteHeader(code int) {}
+
+// Event returns the CloudEvent of a ctx created by EventCtx, and false for contexts of http requests
+func (this FunctionContext) Event() (event.Event, bool) {
+	if this.state.event == nil {
+		return event.Event{}, false
+	}
+	return *this.state.event, true
+}
+
+// BindEvent decodes the data of the CloudEvent into the given object, according to the event's content type
+func (this FunctionContext) BindEvent(obj interface{}) error {
+	if this.state.event == nil {
+		return errNotAnEvent
+	}
+	return this.state.event.DataAs(obj)
+}
+
+// Ack finishes the handling of the event successfully. Return its result from the handler: `return ctx.Ack()`
+func (this FunctionContext) Ack() error {
+	this.withSkip(1).Debug("Event processed")
+	this.writeResponse(http.StatusOK, "", nil)
+	return nil
+}
+
+// Nack logs the error and finishes the handling of the event as failed, returning the error so the event is delivered again, if the trigger retries failed events.
+// Return its result from the handler: `return ctx.Nack(err)`
+func (this FunctionContext) Nack(err error) error {
+	this.withSkip(1).ErrorErr(err, "Failed to process event, it will be retried")
+	this.reportToReporters(err, "Failed to process event", http.StatusInternalServerError, false)
+	this.state.mutex.Lock()
+	this.state.err = err
+	this.state.mutex.Unlock()
+	this.writeResponse(http.StatusInternalServerError, "", nil)
+	return err
+}
+
+// Drop logs the error at the WARN level and finishes the handling of the event without retrying it, for events which can never be processed (e.g. invalid data).
+// Return its result from the handler: `return ctx.Drop(err)`
+func (this FunctionContext) Drop(err error) error {
+	this.withSkip(1).Warnf("Dropping event which can't be processed: %v", err)
+	this.state.mutex.Lock()
+	this.state.err = err
+	this.state.mutex.Unlock()
+	this.writeResponse(http.StatusOK, "", nil)
+	return nil
+}
@@ -0,0 +1,133 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// cloudMonitoringBatchSize is the maximum number of time series Cloud Monitoring accepts in a single request
+const cloudMonitoringBatchSize = 200
+
+// CloudMonitoringExporter writes the toolkit metrics to Cloud Monitoring as custom metrics (`custom.googleapis.com/<name>`), using the function's service account
+type CloudMonitoringExporter struct {
+	// ProjectId is the project the metrics are written to. Defaults to the project the function runs in
+	ProjectId string
+	// Endpoint is the address of the Cloud Monitoring API
+	Endpoint string
+	// instanceId identifies the instance writing the time series, as every instance keeps its own cumulative values
+	instanceId string
+}
+
+// NewCloudMonitoringExporter creates an exporter writing to the project the function runs in
+func NewCloudMonitoringExporter() *CloudMonitoringExporter {
+	instanceId := ""
+	if !isLocalDeployment {
+		instanceId, _ = metadata(context.Background(), "instance/id")
+	}
+	if instanceId == "" {
+		instanceId = randomHex(8)
+	}
+	return &CloudMonitoringExporter{
+		ProjectId:  projectId(),
+		Endpoint:   "https://monitoring.googleapis.com",
+		instanceId: instanceId,
+	}
+}
+
+// WithCloudMonitoring writes the metrics to Cloud Monitoring every MetricsExportInterval. Call FlushMetrics or ShutdownTelemetry before the instance stops to write the latest values
+func WithCloudMonitoring() Option {
+	return WithMetricExporter(NewCloudMonitoringExporter())
+}
+
+type monitoringTimeSeries struct {
+	Metric     monitoringType    `json:"metric"`
+	Resource   monitoringType    `json:"resource"`
+	MetricKind string            `json:"metricKind"`
+	ValueType  string            `json:"valueType"`
+	Points     []monitoringPoint `json:"points"`
+}
+
+type monitoringType struct {
+	Type   string `json:"type"`
+	Labels Labels `json:"labels,omitempty"`
+}
+
+type monitoringPoint struct {
+	Interval struct {
+		StartTime string `json:"startTime"`
+		EndTime   string `json:"endTime"`
+	} `json:"interval"`
+	Value map[string]interface{} `json:"value"`
+}
+
+// ExportMetrics writes the metric points to Cloud Monitoring, in batches of up to 200 time series
+func (this *CloudMonitoringExporter) ExportMetrics(ctx context.Context, points []MetricPoint) error {
+	if this.ProjectId == "" {
+		return errors.New("cloud monitoring project id is unknown")
+	}
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	resource := monitoringType{Type: "generic_task", Labels: Labels{
+		"project_id": this.ProjectId,
+		"location":   region,
+		"namespace":  "function_toolkit",
+		"job":        os.Getenv("K_SERVICE"),
+		"task_id":    this.instanceId,
+	}}
+	if resource.Labels["location"] == "" {
+		resource.Labels["location"] = "global"
+	}
+
+	series := make([]monitoringTimeSeries, 0, len(points))
+	for _, point := range points {
+		var value map[string]interface{}
+		valueType := "DOUBLE"
+		if point.Kind == MetricKindCounter {
+			value = map[string]interface{}{"doubleValue": point.Value}
+		} else {
+			valueType = "DISTRIBUTION"
+			counts := make([]string, len(point.BucketCounts))
+			for i, count := range point.BucketCounts {
+				counts[i] = formatUint(count)
+			}
+			mean := 0.0
+			if point.Count > 0 {
+				mean = point.Sum / float64(point.Count)
+			}
+			value = map[string]interface{}{"distributionValue": map[string]interface{}{
+				"count":         formatUint(point.Count),
+				"mean":          mean,
+				"bucketOptions": map[string]interface{}{"explicitBuckets": map[string]interface{}{"bounds": point.Buckets}},
+				"bucketCounts":  counts,
+			}}
+		}
+		sample := monitoringPoint{Value: value}
+		sample.Interval.StartTime = point.StartTime.UTC().Format(time.RFC3339Nano)
+		sample.Interval.EndTime = now
+		series = append(series, monitoringTimeSeries{
+			Metric:     monitoringType{Type: "custom.googleapis.com/" + point.Name, Labels: point.Labels},
+			Resource:   resource,
+			MetricKind: "CUMULATIVE",
+			ValueType:  valueType,
+			Points:     []monitoringPoint{sample},
+		})
+	}
+
+	var errs []error
+	for start := 0; start < len(series); start += cloudMonitoringBatchSize {
+		end := min(start+cloudMonitoringBatchSize, len(series))
+		url := this.Endpoint + "/v3/projects/" + this.ProjectId + "/timeSeries"
+		if err := googleApi(ctx, http.MethodPost, url, map[string]interface{}{"timeSeries": series[start:end]}, nil); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// formatUint formats an int64 value the way the json mapping of the Google APIs expects 64 bit integers, as a string
+func formatUint(value uint64) string {
+	return strconv.FormatUint(value, 10)
+}
@@ -0,0 +1,179 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TaskQueue enqueues http tasks on a Cloud Tasks queue using the function's service account.
+// The tasks are sent with an OIDC token of ServiceAccount, so they can call functions which require authentication
+type TaskQueue struct {
+	// Queue is the full name of the queue, e.g. `projects/<project>/locations/<location>/queues/<queue>`
+	Queue string
+	// ServiceAccount is the email of the service account the OIDC token is issued for. Defaults to the function's service account
+	ServiceAccount string
+	// Audience of the OIDC token. Defaults to the url of the task
+	Audience string
+	// Endpoint is the address of the Cloud Tasks API
+	Endpoint string
+}
+
+// NewTaskQueue creates a TaskQueue for the given queue of the project the function runs in
+func NewTaskQueue(location string, queue string) *TaskQueue {
+	serviceAccount := ""
+	if !isLocalDeployment {
+		serviceAccount, _ = metadata(context.Background(), "instance/service-accounts/default/email")
+	}
+	return &TaskQueue{
+		Queue:          "projects/" + projectId() + "/locations/" + location + "/queues/" + queue,
+		ServiceAccount: serviceAccount,
+		Endpoint:       "https://cloudtasks.googleapis.com",
+	}
+}
+
+// Task is an http task to enqueue. The payload is sent as the json body of a POST request to the url
+type Task struct {
+	Url     string
+	Payload interface{}
+	// Name is the id of the task within the queue, which Cloud Tasks uses to deduplicate tasks. Generated by Cloud Tasks if empty
+	Name string
+	// ScheduleTime is when the task should be run, immediately if it's zero
+	ScheduleTime time.Time
+	// Headers are added to the request, together with the trace headers of the ctx
+	Headers map[string]string
+}
+
+type cloudTask struct {
+	Name         string `json:"name,omitempty"`
+	ScheduleTime string `json:"scheduleTime,omitempty"`
+	HttpRequest  struct {
+		Url        string            `json:"url"`
+		HttpMethod string            `json:"httpMethod"`
+		Headers    map[string]string `json:"headers"`
+		Body       string            `json:"body,omitempty"`
+		OidcToken  *struct {
+			ServiceAccountEmail string `json:"serviceAccountEmail"`
+			Audience            string `json:"audience"`
+		} `json:"oidcToken,omitempty"`
+	} `json:"httpRequest"`
+}
+
+// Enqueue adds the task to the queue, and returns the full name Cloud Tasks gave it. The result is logged at the DEBUG level, or at the WARN level if it failed
+func (this *TaskQueue) Enqueue(ctx FunctionContext, task Task) (string, error) {
+	var body cloudTask
+	if task.Name != "" {
+		body.Name = this.Queue + "/tasks/" + task.Name
+	}
+	if !task.ScheduleTime.IsZero() {
+		body.ScheduleTime = task.ScheduleTime.UTC().Format(time.RFC3339Nano)
+	}
+	body.HttpRequest.Url = task.Url
+	body.HttpRequest.HttpMethod = http.MethodPost
+	body.HttpRequest.Headers = map[string]string{"Content-Type": "application/json"}
+	outgoing := ctx.OutgoingHeaders()
+	for name := range outgoing {
+		body.HttpRequest.Headers[name] = outgoing.Get(name)
+	}
+	for name, value := range task.Headers {
+		body.HttpRequest.Headers[name] = value
+	}
+	if task.Payload != nil {
+		payload, err := codec.Marshal(task.Payload)
+		if err != nil {
+			ctx.withSkip(1).Warnf("Failed to serialize task for %v: %v", task.Url, err)
+			return "", err
+		}
+		body.HttpRequest.Body = base64.StdEncoding.EncodeToString(payload)
+	}
+	if this.ServiceAccount != "" {
+		audience := this.Audience
+		if audience == "" {
+			audience = task.Url
+		}
+		body.HttpRequest.OidcToken = &struct {
+			ServiceAccountEmail string `json:"serviceAccountEmail"`
+			Audience            string `json:"audience"`
+		}{this.ServiceAccount, audience}
+	}
+	var created struct {
+		Name string `json:"name"`
+	}
+	err := googleApi(ctx.Context, http.MethodPost, this.Endpoint+"/v2/"+this.Queue+"/tasks", map[string]interface{}{"task": body}, &created)
+	if err != nil {
+		ctx.withSkip(1).Warnf("Failed to enqueue task for %v on %v: %v", task.Url, this.Queue, err)
+		return "", err
+	}
+	ctx.withSkip(1).Debugf("Enqueued task %v for %v", created.Name, task.Url)
+	return created.Name, nil
+}
+
+// TaskInfo describes the Cloud Tasks task a request was sent for, read from its X-CloudTasks-* headers
+type TaskInfo struct {
+	// Queue is the short name of the queue
+	Queue string
+	// Name is the short name of the task
+	Name string
+	// RetryCount is the number of times the task has been retried, not counting attempts which didn't get a response
+	RetryCount int
+	// ExecutionCount is the number of times the task got a response, either success or failure
+	ExecutionCount int
+	// ETA is the time the task was scheduled for
+	ETA time.Time
+	// PreviousResponse is the status code of the previous attempt, 0 for the first attempt
+	PreviousResponse int
+	// RetryReason describes why the task was retried, empty for the first attempt
+	RetryReason string
+}
+
+// TaskInfo returns the task the request was sent for by Cloud Tasks. false is returned if the request doesn't have valid Cloud Tasks headers
+func (this FunctionContext) TaskInfo() (TaskInfo, bool) {
+	header := this.Request.Header
+	info := TaskInfo{
+		Queue:       header.Get("X-CloudTasks-QueueName"),
+		Name:        header.Get("X-CloudTasks-TaskName"),
+		RetryReason: header.Get("X-CloudTasks-TaskRetryReason"),
+	}
+	if info.Queue == "" || info.Name == "" {
+		return TaskInfo{}, false
+	}
+	var err error
+	if info.RetryCount, err = strconv.Atoi(header.Get("X-CloudTasks-TaskRetryCount")); err != nil {
+		return TaskInfo{}, false
+	}
+	if info.ExecutionCount, err = strconv.Atoi(header.Get("X-CloudTasks-TaskExecutionCount")); err != nil {
+		return TaskInfo{}, false
+	}
+	if eta := header.Get("X-CloudTasks-TaskETA"); eta != "" {
+		seconds, err := strconv.ParseFloat(eta, 64)
+		if err != nil {
+			return TaskInfo{}, false
+		}
+		info.ETA = time.Unix(0, int64(seconds*float64(time.Second)))
+	}
+	if previous := header.Get("X-CloudTasks-TaskPreviousResponse"); previous != "" {
+		info.PreviousResponse, _ = strconv.Atoi(strings.TrimSpace(previous))
+	}
+	return info, true
+}
+
+// RequireTask is a middleware which rejects requests with a 403 response unless they were sent by Cloud Tasks, from one of the given queues if any are given.
+// Cloud Tasks doesn't sign its headers, so the function should also require authentication with the OIDC token of the tasks
+func RequireTask(queues ...string) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx FunctionContext) error {
+			info, ok := ctx.TaskInfo()
+			if !ok {
+				return Forbidden("Not a Cloud Tasks request")
+			}
+			if len(queues) > 0 && !slices.Contains(queues, info.Queue) {
+				return Forbidden("Not a Cloud Tasks request").WithInternal("task %v is from unexpected queue %v", info.Name, info.Queue)
+			}
+			return next(ctx)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package toolkit
+
+import (
+	"encoding/json"
+
+	"github.com/rs/zerolog"
+)
+
+// Codec serializes and deserializes json. Register a faster implementation (e.g. jsoniter or sonic) with SetJSONCodec
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// StdCodec is the default Codec, backed by encoding/json
+type StdCodec struct{}
+
+// Marshal calls json.Marshal
+func (this StdCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal calls json.Unmarshal
+func (this StdCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// codec is used for every json (de)serialization done by the toolkit
+var codec Codec = StdCodec{}
+
+// SetJSONCodec replaces the codec used to serialize responses, deserialize request bodies, and serialize objects added to log messages.
+// It should be called once, before handling any requests
+func SetJSONCodec(c Codec) {
+	codec = c
+	zerolog.InterfaceMarshalFunc = c.Marshal
+}
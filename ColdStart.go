@@ -0,0 +1,47 @@
+package toolkit
+
+import (
+	"sync/atomic"
+	"time"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instanceStart is roughly when the instance started, as the toolkit is initialised with the rest of the function's packages
+var instanceStart = time.Now()
+
+var coldStart struct {
+	claimed  atomic.Bool
+	finished atomic.Bool
+}
+
+// IsColdStart reports whether the instance is still handling its first request (until its response has been written), i.e. whether the caller is paying for the instance's startup
+func IsColdStart() bool {
+	return !coldStart.finished.Load()
+}
+
+// ResetColdStart makes the next request be treated as a cold start again. Mainly useful in tests
+func ResetColdStart() {
+	instanceStart = time.Now()
+	coldStart.claimed.Store(false)
+	coldStart.finished.Store(false)
+}
+
+// claimColdStart returns true for the first request handled by the instance, and how long the instance took to initialise before receiving it
+func claimColdStart() (bool, time.Duration) {
+	if !coldStart.claimed.CompareAndSwap(false, true) {
+		return false, 0
+	}
+	initDuration := time.Since(instanceStart)
+	Counter("cold_starts_total").Inc()
+	Histogram("init_duration_ms").Observe(float64(initDuration.Microseconds()) / 1000)
+	return true, initDuration
+}
+
+// annotateColdStart marks the span of the first request as a cold start
+func annotateColdStart(span trace.Span, cold bool) {
+	if span != nil && cold {
+		span.SetAttributes(semconv.FaaSColdstart(true))
+	}
+}
@@ -0,0 +1,152 @@
+package toolkit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// compressibleTypes are the Content-Type prefixes of the responses which are compressed
+var compressibleTypes = []string{"application/json", "application/problem+json", "application/xml", "application/javascript", "text/"}
+
+// encoder is implemented by both gzip.Writer and brotli.Writer
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+func newEncoder(encoding string, w io.Writer) encoder {
+	if encoding == "br" {
+		return brotli.NewWriter(w)
+	}
+	return gzip.NewWriter(w)
+}
+
+// negotiateEncoding picks the best compression supported by both the toolkit and the given Accept-Encoding header. Returns an empty string if there is none
+func negotiateEncoding(acceptEncoding string) string {
+	best, bestQ := "", 0.
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "br" && name != "gzip" {
+			continue
+		}
+		//  Prefer brotli when both have the same weight
+		if q > bestQ || (q == bestQ && q > 0 && name == "br") {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// responseEncoding returns the encoding a response with the given Content-Type should be compressed with, or an empty string if it shouldn't be compressed
+func (this FunctionContext) responseEncoding(contentType string) string {
+	if !config.Compression || this.Response.Header().Get("Content-Encoding") != "" {
+		return ""
+	}
+	compressible := false
+	for _, prefix := range compressibleTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			compressible = true
+			break
+		}
+	}
+	if !compressible {
+		return ""
+	}
+	return negotiateEncoding(this.Request.Header.Get("Accept-Encoding"))
+}
+
+// compressBody compresses the body of a response if it's larger than the configured threshold and the client supports it, setting the matching headers
+func (this FunctionContext) compressBody(contentType string, body []byte) []byte {
+	if len(body) == 0 || len(body) < config.CompressionMinSize {
+		return body
+	}
+	encoding := this.responseEncoding(contentType)
+	if encoding == "" {
+		return body
+	}
+	var buffer bytes.Buffer
+	writer := newEncoder(encoding, &buffer)
+	if _, err := writer.Write(body); err != nil {
+		return body
+	}
+	if err := writer.Close(); err != nil {
+		return body
+	}
+	header := this.Response.Header()
+	header.Set("Content-Encoding", encoding)
+	addVary(header, "Accept-Encoding")
+	header.Del("Content-Length")
+	return buffer.Bytes()
+}
+
+// responseStream writes the body of a streamed response, compressing it when the client supports it. The body is discarded for HEAD requests
+type responseStream struct {
+	ctx     FunctionContext
+	encoder encoder
+	flusher http.Flusher
+}
+
+// startStream writes the status code and headers of a streamed response, and returns a writer for its body. The stream must be closed once the body is written
+func (this FunctionContext) startStream(code int, contentType string) *responseStream {
+	stream := &responseStream{ctx: this}
+	stream.flusher, _ = this.Response.(http.Flusher)
+	header := this.Response.Header()
+	header.Set("Content-Type", contentType)
+	if encoding := this.responseEncoding(contentType); encoding != "" {
+		header.Set("Content-Encoding", encoding)
+		addVary(header, "Accept-Encoding")
+		header.Del("Content-Length")
+		stream.encoder = newEncoder(encoding, this.Response)
+	}
+	this.Response.WriteHeader(code)
+	return stream
+}
+
+func (this *responseStream) Write(buf []byte) (int, error) {
+	if this.ctx.Request.Method == http.MethodHead {
+		return len(buf), nil
+	}
+	if this.encoder != nil {
+		return this.encoder.Write(buf)
+	}
+	return this.ctx.Response.Write(buf)
+}
+
+// Flush sends everything written so far to the client
+func (this *responseStream) Flush() error {
+	if this.encoder != nil && this.ctx.Request.Method != http.MethodHead {
+		if err := this.encoder.Flush(); err != nil {
+			return err
+		}
+	}
+	if this.flusher != nil {
+		this.flusher.Flush()
+	}
+	return nil
+}
+
+// Close finishes the compressed stream and flushes it
+func (this *responseStream) Close() error {
+	if this.encoder != nil && this.ctx.Request.Method != http.MethodHead {
+		if err := this.encoder.Close(); err != nil {
+			return err
+		}
+	}
+	if this.flusher != nil {
+		this.flusher.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package toolkit
+
+import (
+	"io"
+	"net/netip"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Config contains the settings shared by every FunctionContext. Change them by calling Configure when your function starts
+type Config struct {
+	// ProblemJson makes the error responses use the RFC 7807 `application/problem+json` format instead of ErrorResponseStruct
+	ProblemJson bool
+	// Compression enables gzip/brotli compression of responses, negotiated through the Accept-Encoding header
+	Compression bool
+	// CompressionMinSize is the smallest response body, in bytes, which is compressed. Streamed responses are always compressed
+	CompressionMinSize int
+	// ResponseMeta adds a `meta` object containing the handler duration, versions and region to success responses
+	ResponseMeta bool
+	// AppVersion is the version of your function reported in the response metadata
+	AppVersion string
+	// CORS configures the Cross-Origin Resource Sharing headers, nil when CORS is disabled
+	CORS *CORSConfig
+	// GcpLogFormat writes logs in the Cloud Logging structured format. Enabled by default when the function is deployed
+	GcpLogFormat bool
+	// DisableCaller stops adding the location of the logging call to log messages, which saves a runtime.Caller call per message
+	DisableCaller bool
+	// LogWriter is where the logs are written as json, nil to write them to stdout
+	LogWriter io.Writer
+	// LogSampling configures which log messages are dropped, nil when every message is written
+	LogSampling *LogSampling
+	// LogBuffering configures the buffering of DEBUG and INFO messages until the outcome of the request is known, nil when messages are written immediately
+	LogBuffering *LogBuffering
+	// AccessLog configures the access log entry written for every request, nil when it's disabled
+	AccessLog *AccessLogConfig
+	// ErrorReporting configures how errors are reported to Google Cloud Error Reporting, nil when they aren't reported
+	ErrorReporting *ErrorReportingConfig
+	// ErrorReporters are sent the errors of 5xx responses and panics
+	ErrorReporters []ErrorReporter
+	// Warmup configures how warmup requests are recognised, nil when they're passed to the handler
+	Warmup *WarmupConfig
+	// Timeout is the deadline of the request's context, 0 when the request has no deadline of its own
+	Timeout time.Duration
+	// TracerProvider creates the OpenTelemetry spans of requests, nil when tracing is disabled
+	TracerProvider trace.TracerProvider
+	// Formatter builds the bodies of json success and error responses
+	Formatter ResponseFormatter
+	// TrustedProxies are the proxies whose addresses ClientIP skips in the X-Forwarded-For header, e.g. a load balancer in front of the function
+	TrustedProxies []netip.Prefix
+	// CookieSecrets protect signed and encrypted cookies. The first one protects new cookies, the others are accepted while they're rotated
+	CookieSecrets []string
+}
+
+// Option changes a setting of the toolkit Config
+type Option func(config *Config)
+
+var config = Config{Formatter: DefaultResponseFormatter{}}
+
+// Configure applies the given options to the toolkit config. It should be called once, before handling any requests (e.g. in an init function)
+func Configure(options ...Option) {
+	for _, option := range options {
+		option(&config)
+	}
+}
+
+// WithProblemJson enables or disables RFC 7807 `application/problem+json` error responses
+func WithProblemJson(enabled bool) Option {
+	return func(config *Config) {
+		config.ProblemJson = enabled
+	}
+}
+
+// WithCompression enables gzip/brotli compression of json, text and streamed responses whose body is at least minSize bytes long
+func WithCompression(minSize int) Option {
+	return func(config *Config) {
+		config.Compression = true
+		config.CompressionMinSize = minSize
+	}
+}
+
+// WithoutCompression disables response compression
+func WithoutCompression() Option {
+	return func(config *Config) {
+		config.Compression = false
+	}
+}
+
+// WithResponseFormatter replaces the formatter used to build the bodies of json success and error responses
+func WithResponseFormatter(formatter ResponseFormatter) Option {
+	return func(config *Config) {
+		config.Formatter = formatter
+	}
+}
+
+// WithResponseMeta adds a `meta` object to success responses containing the time spent handling the request, the toolkit version,
+// the given version of your function, and the region it's deployed in
+func WithResponseMeta(appVersion string) Option {
+	return func(config *Config) {
+		config.ResponseMeta = true
+		config.AppVersion = appVersion
+	}
+}
+
+// WithoutResponseMeta stops adding the `meta` object to success responses
+func WithoutResponseMeta() Option {
+	return func(config *Config) {
+		config.ResponseMeta = false
+	}
+}
+
+// WithCaller enables or disables adding the file and line of the logging call to every log message. Enabled by default
+func WithCaller(enabled bool) Option {
+	return func(config *Config) {
+		config.DisableCaller = !enabled
+	}
+}
+
+// WithLogWriter writes the logs as json to the given writers instead of stdout, e.g. a file, a buffer in tests, or a custom log shipper.
+// Every entry is written to each of the writers. Call it without writers to write the logs to stdout again
+func WithLogWriter(writers ...io.Writer) Option {
+	return func(config *Config) {
+		switch len(writers) {
+		case 0:
+			config.LogWriter = nil
+		case 1:
+			config.LogWriter = writers[0]
+		default:
+			config.LogWriter = zerolog.MultiLevelWriter(writers...)
+		}
+	}
+}
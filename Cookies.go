@@ -0,0 +1,149 @@
+package toolkit
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WithCookieSecrets sets the secrets signed and encrypted cookies are protected with. The first secret protects new cookies,
+// and the others are still accepted so that secrets can be rotated without logging out every browser
+func WithCookieSecrets(secrets ...string) Option {
+	return func(config *Config) {
+		config.CookieSecrets = secrets
+	}
+}
+
+// errNoCookieSecret is returned when a signed or encrypted cookie is set before WithCookieSecrets is configured
+var errNoCookieSecret = errors.New("no cookie secret is configured, see WithCookieSecrets")
+
+// SetSignedCookie adds the cookie to the response with an HMAC-SHA256 signature, so that GetSignedCookie can check the browser didn't change its value or expiry.
+// The value can still be read by the browser, use SetEncryptedCookie to hide it. Must be called before any of the response methods
+func (this FunctionContext) SetSignedCookie(cookie http.Cookie) error {
+	if len(config.CookieSecrets) == 0 {
+		return errNoCookieSecret
+	}
+	expiry := cookieExpiry(cookie)
+	value := base64.RawURLEncoding.EncodeToString([]byte(cookie.Value)) + "." + expiry
+	cookie.Value = value + "." + base64.RawURLEncoding.EncodeToString(cookieSignature(config.CookieSecrets[0], cookie.Name, value))
+	http.SetCookie(this.Response, &cookie)
+	return nil
+}
+
+// GetSignedCookie returns the value of a cookie set by SetSignedCookie, and false if the request doesn't have it, or its signature or expiry isn't valid
+func (this FunctionContext) GetSignedCookie(name string) (string, bool) {
+	cookie, err := this.Request.Cookie(name)
+	if err != nil {
+		return "", false
+	}
+	cut := strings.LastIndexByte(cookie.Value, '.')
+	if cut < 0 {
+		return "", false
+	}
+	value, encoded := cookie.Value[:cut], cookie.Value[cut+1:]
+	signature, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", false
+	}
+	valid := false
+	for _, secret := range config.CookieSecrets {
+		valid = valid || hmac.Equal(signature, cookieSignature(secret, name, value))
+	}
+	encodedValue, expiry, _ := strings.Cut(value, ".")
+	if !valid || cookieExpired(expiry) {
+		return "", false
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(encodedValue)
+	if err != nil {
+		return "", false
+	}
+	return string(decoded), true
+}
+
+// SetEncryptedCookie adds the cookie to the response with its value encrypted by AES-256-GCM, so that the browser can neither read nor change it.
+// Must be called before any of the response methods
+func (this FunctionContext) SetEncryptedCookie(cookie http.Cookie) error {
+	if len(config.CookieSecrets) == 0 {
+		return errNoCookieSecret
+	}
+	aead, err := cookieCipher(config.CookieSecrets[0])
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	expiry := cookieExpiry(cookie)
+	sealed := aead.Seal(nonce, nonce, []byte(cookie.Value), []byte(cookie.Name+"|"+expiry))
+	cookie.Value = base64.RawURLEncoding.EncodeToString(sealed) + "." + expiry
+	http.SetCookie(this.Response, &cookie)
+	return nil
+}
+
+// GetEncryptedCookie returns the decrypted value of a cookie set by SetEncryptedCookie, and false if the request doesn't have it, or it can't be decrypted or has expired
+func (this FunctionContext) GetEncryptedCookie(name string) (string, bool) {
+	cookie, err := this.Request.Cookie(name)
+	if err != nil {
+		return "", false
+	}
+	encoded, expiry, found := strings.Cut(cookie.Value, ".")
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if !found || err != nil || cookieExpired(expiry) {
+		return "", false
+	}
+	for _, secret := range config.CookieSecrets {
+		aead, err := cookieCipher(secret)
+		if err != nil || len(sealed) < aead.NonceSize() {
+			continue
+		}
+		nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+		if plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(name+"|"+expiry)); err == nil {
+			return string(plaintext), true
+		}
+	}
+	return "", false
+}
+
+// cookieExpiry returns the unix time at which the cookie expires, or 0 for cookies which last until the browser is closed
+func cookieExpiry(cookie http.Cookie) string {
+	switch {
+	case cookie.MaxAge > 0:
+		return strconv.FormatInt(time.Now().Add(time.Duration(cookie.MaxAge)*time.Second).Unix(), 10)
+	case !cookie.Expires.IsZero():
+		return strconv.FormatInt(cookie.Expires.Unix(), 10)
+	default:
+		return "0"
+	}
+}
+
+// cookieExpired returns true if the expiry of a cookie's value isn't valid or has passed, so that browsers can't keep using a cookie after it expired
+func cookieExpired(expiry string) bool {
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	return err != nil || (unix != 0 && time.Now().Unix() > unix)
+}
+
+// cookieSignature signs the value of a cookie along with its name, so that a signed value can't be moved to another cookie
+func cookieSignature(secret string, name string, value string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(name + "|" + value))
+	return mac.Sum(nil)
+}
+
+// cookieCipher creates the AES-256-GCM cipher of a secret, whose key is derived from the secret so that it differs from the signing key
+func cookieCipher(secret string) (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte("cookie encryption|" + secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,140 @@
+package toolkit
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig configures the Cross-Origin Resource Sharing headers added to responses. Enable it with WithCORS
+type CORSConfig struct {
+	// AllowedOrigins are the origins allowed to call the function. Use "*" to allow any origin, or a "*." prefix in the host to allow subdomains, e.g. "https://*.example.com"
+	AllowedOrigins []string
+	// AllowedMethods are the methods allowed in cross-origin requests. Defaults to GET, HEAD and POST
+	AllowedMethods []string
+	// AllowedHeaders are the request headers allowed in cross-origin requests. Use "*" to allow any header
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers the browser can read
+	ExposedHeaders []string
+	// AllowCredentials allows cross-origin requests to include cookies and authorization headers
+	AllowCredentials bool
+	// MaxAge is how long browsers can cache preflight responses
+	MaxAge time.Duration
+}
+
+// WithCORS enables CORS. The headers are added to every response of an allowed origin, and preflight requests are answered by ctx.HandlePreflight
+func WithCORS(cors CORSConfig) Option {
+	return func(config *Config) {
+		config.CORS = &cors
+	}
+}
+
+// WithoutCORS disables CORS
+func WithoutCORS() Option {
+	return func(config *Config) {
+		config.CORS = nil
+	}
+}
+
+func (this *CORSConfig) originAllowed(origin string) bool {
+	for _, allowed := range this.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		if scheme, host, ok := strings.Cut(allowed, "://*."); ok {
+			if strings.HasPrefix(origin, scheme+"://") && strings.HasSuffix(strings.ToLower(origin), "."+strings.ToLower(host)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (this *CORSConfig) methods() []string {
+	if len(this.AllowedMethods) == 0 {
+		return []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	}
+	return this.AllowedMethods
+}
+
+func (this *CORSConfig) methodAllowed(method string) bool {
+	for _, allowed := range this.methods() {
+		if strings.EqualFold(allowed, method) {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *CORSConfig) headersAllowed(requested string) bool {
+	for _, name := range strings.Split(requested, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		allowed := false
+		for _, header := range this.AllowedHeaders {
+			if header == "*" || strings.EqualFold(header, name) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// applyCORS adds the CORS headers for the request's origin to the response, if the origin is allowed
+func (this FunctionContext) applyCORS() {
+	cors := config.CORS
+	origin := this.Request.Header.Get("Origin")
+	header := this.Response.Header()
+	addVary(header, "Origin")
+	if origin == "" || !cors.originAllowed(origin) {
+		return
+	}
+	if len(cors.AllowedOrigins) == 1 && cors.AllowedOrigins[0] == "*" && !cors.AllowCredentials {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	if cors.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if len(cors.ExposedHeaders) > 0 {
+		header.Set("Access-Control-Expose-Headers", strings.Join(cors.ExposedHeaders, ", "))
+	}
+}
+
+// HandlePreflight answers CORS preflight requests. Returns true if the request was a preflight request, in which case a response has been sent and the handler should return.
+// Does nothing if CORS isn't enabled
+func (this FunctionContext) HandlePreflight() bool {
+	cors := config.CORS
+	requestedMethod := this.Request.Header.Get("Access-Control-Request-Method")
+	if cors == nil || this.Request.Method != http.MethodOptions || requestedMethod == "" {
+		return false
+	}
+
+	origin := this.Request.Header.Get("Origin")
+	requestedHeaders := this.Request.Header.Get("Access-Control-Request-Headers")
+	if !cors.originAllowed(origin) || !cors.methodAllowed(requestedMethod) || !cors.headersAllowed(requestedHeaders) {
+		this.withSkip(1).FailResponse(http.StatusForbidden, "Cross-origin request not allowed")
+		return true
+	}
+
+	header := this.Response.Header()
+	header.Set("Access-Control-Allow-Methods", strings.Join(cors.methods(), ", "))
+	if requestedHeaders != "" {
+		header.Set("Access-Control-Allow-Headers", requestedHeaders)
+	}
+	if cors.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(int(cors.MaxAge.Seconds())))
+	}
+	addVary(header, "Access-Control-Request-Method", "Access-Control-Request-Headers")
+	this.withSkip(1).Debugf("Answering preflight request from %v for %v", origin, requestedMethod)
+	this.writeResponse(http.StatusNoContent, "", nil)
+	return true
+}
@@ -0,0 +1,74 @@
+package toolkit
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+// ETag computes a strong ETag for the json serialization of the given object
+func ETag(obj interface{}) (string, error) {
+	bytes, err := codec.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+	return etagOf(bytes), nil
+}
+
+func etagOf(bytes []byte) string {
+	sum := sha256.Sum256(bytes)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+// etagListContains checks if the given If-Match/If-None-Match header value contains the etag. Weak validators are only matched when `weak` is true
+func etagListContains(header string, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// OkResponseJsonWithETag works like OkResponseJson, but also sets an ETag header computed over the serialized data (the span id isn't included).
+// If the request's If-None-Match header matches the ETag, a 304 response without a body is sent instead
+func (this FunctionContext) OkResponseJsonWithETag(obj interface{}) {
+	obj, err := this.filterFields(obj)
+	if err != nil {
+		this.withSkip(1).FailResponse(http.StatusBadRequest, "Invalid fields parameter: "+err.Error())
+		return
+	}
+	etag, err := ETag(obj)
+	if err != nil {
+		this.withSkip(1).ErrResponse(http.StatusInternalServerError, err, "Failed to serialize response")
+		return
+	}
+	this.Response.Header().Set("ETag", etag)
+
+	if ifNoneMatch := this.Request.Header.Get("If-None-Match"); ifNoneMatch != "" && etagListContains(ifNoneMatch, etag, true) {
+		this.withSkip(1).Debug("Responding with status 304")
+		this.writeResponse(http.StatusNotModified, "", nil)
+		return
+	}
+	this.withSkip(1).Debug("Responding with status 200")
+	this.writeJson(200, config.Formatter.FormatSuccess(this, obj))
+}
+
+// CheckIfMatch compares the request's If-Match header to the current ETag of the resource (see ETag), for optimistic concurrency control.
+// If the header is set and doesn't match, a 412 response is sent and false is returned. Requests without an If-Match header always pass
+func (this FunctionContext) CheckIfMatch(currentETag string) bool {
+	ifMatch := this.Request.Header.Get("If-Match")
+	if ifMatch == "" || etagListContains(ifMatch, currentETag, false) {
+		return true
+	}
+	this.withSkip(1).FailResponse(http.StatusPreconditionFailed, "Resource has been modified")
+	return false
+}
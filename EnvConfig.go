@@ -0,0 +1,281 @@
+package toolkit
+
+import (
+	"context"
+	"encoding"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// configSecretScheme prefixes the values which are references to Secret Manager secrets, e.g. `sm://projects/my-project/secrets/db-password`
+const configSecretScheme = "sm://"
+
+// DefaultConfigSecretTimeout is how long LoadConfig waits for a secret, when ConfigLoader doesn't set a SecretTimeout
+const DefaultConfigSecretTimeout = 30 * time.Second
+
+// ConfigError is returned by LoadConfig when variables are missing or have invalid values
+type ConfigError struct {
+	// Missing are the names of the required variables which aren't set
+	Missing []string
+	// Invalid describes the variables whose value can't be parsed
+	Invalid []string
+}
+
+func (this *ConfigError) Error() string {
+	var problems []string
+	if len(this.Missing) > 0 {
+		problems = append(problems, "missing environment variables "+strings.Join(this.Missing, ", "))
+	}
+	return "invalid configuration: " + strings.Join(append(problems, this.Invalid...), "; ")
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// configSecrets caches the payloads of the secrets referenced by the configs, by endpoint and reference
+var configSecrets sync.Map
+
+// ConfigLoader populates config structs from environment variables, see LoadConfig
+type ConfigLoader struct {
+	// Endpoint is the address of the Secret Manager API
+	Endpoint string
+	// SecretTimeout is how long reading a secret may take, so that a stalled API doesn't block the function's start forever. Defaults to DefaultConfigSecretTimeout
+	SecretTimeout time.Duration
+	// DotEnvFiles are loaded into the environment before the variables are read when the function runs locally, later files overriding earlier ones.
+	// Variables which are already set are never overridden, and missing files are skipped
+	DotEnvFiles []string
+}
+
+// LoadConfig populates the struct pointed to by config from the environment variables named by the `env` tags of its fields, e.g. `env:"DB_DSN,required"`.
+// Fields without the tag are left alone, and the `default` tag is used when a variable isn't set or is empty. Strings, booleans, numbers, durations like `30s`,
+// encoding.TextUnmarshaler implementations and slices of them, separated by commas, are supported. Nested structs are populated too, and the names of their variables are prefixed by their `envPrefix` tag.
+// Values starting with `sm://` are references to Secret Manager secrets, e.g. `sm://projects/my-project/secrets/db-password` or `sm://db-password/versions/3`,
+// which are replaced by the payload of the secret. Secrets are read once and cached, using the latest version unless one is given.
+// When the function runs locally, the variables of the `.env` and `.env.local` files of the working directory are loaded first, see ConfigLoader.DotEnvFiles.
+// Every missing or invalid variable is listed in the returned *ConfigError, so call it from an init function and panic if it fails
+func LoadConfig(config interface{}) error {
+	return ConfigLoader{Endpoint: secretManagerEndpoint, DotEnvFiles: []string{".env", ".env.local"}}.Load(config)
+}
+
+// Load populates the struct pointed to by config, see LoadConfig
+func (this ConfigLoader) Load(config interface{}) error {
+	value := reflect.ValueOf(config)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("LoadConfig requires a pointer to a struct, got %T", config))
+	}
+	configErr := &ConfigError{}
+	if isLocalDeployment {
+		if err := loadDotEnv(this.DotEnvFiles); err != nil {
+			configErr.Invalid = append(configErr.Invalid, err.Error())
+		}
+	}
+	this.loadStruct(value.Elem(), "", configErr)
+	if len(configErr.Missing) > 0 || len(configErr.Invalid) > 0 {
+		return configErr
+	}
+	return nil
+}
+
+// loadStruct populates the fields of the struct from the variables with the given prefix
+func (this ConfigLoader) loadStruct(value reflect.Value, prefix string, configErr *ConfigError) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		target := value.Field(i)
+		tag, tagged := field.Tag.Lookup("env")
+		if !tagged {
+			nestedPrefix, nested := field.Tag.Lookup("envPrefix")
+			if target.Kind() == reflect.Pointer && target.Type().Elem().Kind() == reflect.Struct && nested {
+				if target.IsNil() {
+					target.Set(reflect.New(target.Type().Elem()))
+				}
+				target = target.Elem()
+			}
+			if target.Kind() == reflect.Struct && !isConfigValue(target.Type()) {
+				this.loadStruct(target, prefix+nestedPrefix, configErr)
+			}
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		name = prefix + name
+		text := os.Getenv(name)
+		if text == "" {
+			text = field.Tag.Get("default")
+		}
+		if text == "" {
+			if options == "required" {
+				configErr.Missing = append(configErr.Missing, name)
+			}
+			continue
+		}
+		if reference, isSecret := strings.CutPrefix(text, configSecretScheme); isSecret {
+			payload, err := this.secret(reference)
+			if err != nil {
+				configErr.Invalid = append(configErr.Invalid, fmt.Sprintf("%v: %v", name, err))
+				continue
+			}
+			//  The payload is kept out of the error, which is usually logged or panicked with
+			if err = setConfigValue(target, payload); err != nil {
+				configErr.Invalid = append(configErr.Invalid, fmt.Sprintf("%v: the value of the secret %v isn't a valid %v", name, reference, target.Type()))
+			}
+			continue
+		}
+		if err := setConfigValue(target, text); err != nil {
+			configErr.Invalid = append(configErr.Invalid, fmt.Sprintf("%v: %v", name, err))
+		}
+	}
+}
+
+// secret returns the payload of the referenced secret, reading it from Secret Manager if it isn't cached
+func (this ConfigLoader) secret(reference string) (string, error) {
+	endpoint := this.Endpoint
+	if endpoint == "" {
+		endpoint = secretManagerEndpoint
+	}
+	key := endpoint + "|" + secretVersion(reference)
+	if payload, ok := configSecrets.Load(key); ok {
+		return payload.(string), nil
+	}
+	timeout := this.SecretTimeout
+	if timeout <= 0 {
+		timeout = DefaultConfigSecretTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	payload, err := accessSecret(ctx, endpoint, reference)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the secret %v: %w", reference, err)
+	}
+	configSecrets.Store(key, string(payload))
+	return string(payload), nil
+}
+
+// loadDotEnv sets the variables of the files which aren't set yet, the values of later files overriding those of earlier ones
+func loadDotEnv(files []string) error {
+	values := map[string]string{}
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err = parseDotEnv(string(content), values); err != nil {
+			return fmt.Errorf("%v: %w", file, err)
+		}
+	}
+	for name, value := range values {
+		if _, set := os.LookupEnv(name); !set {
+			_ = os.Setenv(name, value)
+		}
+	}
+	return nil
+}
+
+// parseDotEnv adds the `NAME=value` lines of a .env file to the values. Lines may start with `export`, and values may be single quoted,
+// or double quoted with escaped newlines and quotes. Comments start with a `#` at the start of a line or after a space
+func parseDotEnv(content string, values map[string]string) error {
+	for number, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, found := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !found || name == "" || strings.ContainsAny(name, " \t") {
+			return fmt.Errorf("line %v isn't a NAME=value assignment", number+1)
+		}
+		switch {
+		case len(value) >= 2 && value[0] == '\'' && strings.LastIndexByte(value, '\'') > 0:
+			value = value[1:strings.LastIndexByte(value, '\'')]
+		case len(value) >= 2 && value[0] == '"' && strings.LastIndexByte(value, '"') > 0:
+			unquoted, err := strconv.Unquote(value[:strings.LastIndexByte(value, '"')+1])
+			if err != nil {
+				return fmt.Errorf("line %v has an invalid quoted value", number+1)
+			}
+			value = unquoted
+		default:
+			if comment := strings.Index(value, " #"); comment >= 0 {
+				value = strings.TrimSpace(value[:comment])
+			}
+		}
+		values[name] = value
+	}
+	return nil
+}
+
+// isConfigValue returns true for the struct types which are parsed from a single variable instead of being nested
+func isConfigValue(t reflect.Type) bool {
+	return reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+// setConfigValue parses the text into the target, splitting it on commas for slices
+func setConfigValue(target reflect.Value, text string) error {
+	if target.CanAddr() && target.Addr().Type().Implements(textUnmarshalerType) {
+		return target.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text))
+	}
+	if target.Type() == durationType {
+		duration, err := time.ParseDuration(text)
+		if err != nil {
+			return fmt.Errorf("%q isn't a duration", text)
+		}
+		target.SetInt(int64(duration))
+		return nil
+	}
+	switch target.Kind() {
+	case reflect.String:
+		target.SetString(text)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(text)
+		if err != nil {
+			return fmt.Errorf("%q isn't a boolean", text)
+		}
+		target.SetBool(parsed)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(text, 10, target.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q isn't an integer", text)
+		}
+		target.SetInt(parsed)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(text, 10, target.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q isn't a positive integer", text)
+		}
+		target.SetUint(parsed)
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(text, target.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q isn't a number", text)
+		}
+		target.SetFloat(parsed)
+	case reflect.Slice:
+		parts := strings.Split(text, ",")
+		slice := reflect.MakeSlice(target.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			if err := setConfigValue(slice.Index(i), strings.TrimSpace(part)); err != nil {
+				return err
+			}
+		}
+		target.Set(slice)
+	case reflect.Pointer:
+		value := reflect.New(target.Type().Elem())
+		if err := setConfigValue(value.Elem(), text); err != nil {
+			return err
+		}
+		target.Set(value)
+	default:
+		panic(fmt.Sprintf("LoadConfig doesn't support fields of type %v", target.Type()))
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package toolkit
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+
+	"github.com/rs/zerolog"
+)
+
+// errorChain walks the given error and every error it wraps (including errors joined with errors.Join), depth first
+func errorChain(err error) []map[string]string {
+	var chain []map[string]string
+	var walk func(err error)
+	walk = func(err error) {
+		if err == nil {
+			return
+		}
+		chain = append(chain, map[string]string{"type": fmt.Sprintf("%T", err), "message": err.Error()})
+		switch wrapped := err.(type) {
+		case interface{ Unwrap() error }:
+			walk(wrapped.Unwrap())
+		case interface{ Unwrap() []error }:
+			for _, inner := range wrapped.Unwrap() {
+				walk(inner)
+			}
+		}
+	}
+	walk(err)
+	return chain
+}
+
+// stackTrace returns the call stack starting `skip` frames above its caller, formatted as `function file:line` entries
+func stackTrace(skip int) []string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(skip+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var stack []string
+	for {
+		frame, more := frames.Next()
+		stack = append(stack, frame.Function+" "+frame.File+":"+strconv.Itoa(frame.Line))
+		if !more {
+			break
+		}
+	}
+	return stack
+}
+
+// errorEvent adds the error, its chain of wrapped errors, and the current stack trace to the log event
+func (this FunctionContext) errorEvent(e *zerolog.Event, err error) *zerolog.Event {
+	return e.Err(err).Interface("errorChain", errorChain(err)).Strs("stack", stackTrace(this.stackFrameLevel+1))
+}
+
+// ErrorErr logs a message to the console at the ERROR level, together with the error, the chain of errors it wraps, and the stack trace of the caller
+func (this FunctionContext) ErrorErr(err error, message string) {
+	this.event(this.reportError(this.errorEvent(this.Logger.Error(), err), err, fmt.Sprintf("%v: %v", message, err))).Msg(this.spanIdLogField + message)
+}
+
+// errorf logs the formatted message at the ERROR level like ErrorErrf, with the error's chain and the stack trace, but without repeating the error in the report
+func (this FunctionContext) errorf(err error, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	this.event(this.reportError(this.errorEvent(this.Logger.Error(), err), err, message)).Msg(this.spanIdLogField + message)
+}
+
+// ErrorErrf formats a message with the given format and logs it like ErrorErr
+func (this FunctionContext) ErrorErrf(err error, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	this.event(this.reportError(this.errorEvent(this.Logger.Error(), err), err, fmt.Sprintf("%v: %v", message, err))).Msg(this.spanIdLogField + message)
+}
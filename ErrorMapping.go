@@ -0,0 +1,61 @@
+package toolkit
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+)
+
+type errorMapping struct {
+	matches func(err error) bool
+	status  int
+	message string
+}
+
+var errorMappings struct {
+	mutex    sync.RWMutex
+	mappings []errorMapping
+}
+
+// MapError maps errors which are, or wrap, the target error (e.g. `sql.ErrNoRows`) to the given status code and client message.
+// The mapping is used by Handle for returned errors, and by ErrResponse when it's called with a 0 status. Mappings are checked in the order they were added
+func MapError(target error, status int, message string) {
+	addErrorMapping(errorMapping{matches: func(err error) bool { return errors.Is(err, target) }, status: status, message: message})
+}
+
+// MapErrorType maps errors of type T, or wrapping one, to the given status code and client message, like MapError
+func MapErrorType[T error](status int, message string) {
+	addErrorMapping(errorMapping{matches: func(err error) bool {
+		var target T
+		return errors.As(err, &target)
+	}, status: status, message: message})
+}
+
+func addErrorMapping(mapping errorMapping) {
+	errorMappings.mutex.Lock()
+	defer errorMappings.mutex.Unlock()
+	errorMappings.mappings = append(errorMappings.mappings, mapping)
+}
+
+// ResetErrorMappings removes every mapping added with MapError and MapErrorType. Used in tests
+func ResetErrorMappings() {
+	errorMappings.mutex.Lock()
+	defer errorMappings.mutex.Unlock()
+	errorMappings.mappings = nil
+}
+
+// mappedStatus returns the status code and client message of the first mapping matching the error
+func mappedStatus(err error) (int, string, bool) {
+	errorMappings.mutex.RLock()
+	defer errorMappings.mutex.RUnlock()
+	for _, mapping := range errorMappings.mappings {
+		if mapping.matches(err) {
+			message := mapping.message
+			if message == "" {
+				message = http.StatusText(mapping.status)
+			}
+			return mapping.status, message, true
+		}
+	}
+	return 0, "", false
+}
@@ -0,0 +1,84 @@
+package toolkit
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// ErrorReport describes an error reported to the ErrorReporters, together with the request it occurred in
+type ErrorReport struct {
+	Err     error
+	Message string
+	// Status is the status code of the response sent for the error, or 500 for panics
+	Status    int
+	SpanId    string
+	TraceId   string
+	RequestId string
+	Request   *http.Request
+	// Principal is the user the request was made by, nil if it wasn't authenticated
+	Principal *Principal
+	// Fingerprint groups recurrences of the same failure, and matches the fingerprint field of the logged error
+	Fingerprint string
+	// Panic is true if the error was recovered from a panic in the handler
+	Panic bool
+	Time  time.Time
+}
+
+// ErrorReporter sends errors to an error tracking service, e.g. Sentry or Rollbar. ReportError is called on the request's goroutine, so it shouldn't block
+type ErrorReporter interface {
+	ReportError(ctx context.Context, report ErrorReport)
+}
+
+// WithErrorReporter adds a reporter which is sent the errors of ErrResponse with a 5xx status, panics recovered by the toolkit, and errors passed to ctx.ReportError
+func WithErrorReporter(reporter ErrorReporter) Option {
+	return func(config *Config) {
+		config.ErrorReporters = append(config.ErrorReporters, reporter)
+	}
+}
+
+// WithoutErrorReporters removes every reporter added with WithErrorReporter
+func WithoutErrorReporters() Option {
+	return func(config *Config) {
+		config.ErrorReporters = nil
+	}
+}
+
+// ReportError sends the error to every reporter added with WithErrorReporter, without logging it or writing a response
+func (this FunctionContext) ReportError(err error, message string) {
+	this.reportToReporters(err, message, http.StatusInternalServerError, false)
+}
+
+func (this FunctionContext) reportToReporters(err error, message string, status int, panicked bool) {
+	if len(config.ErrorReporters) == 0 {
+		return
+	}
+	this.state.mutex.Lock()
+	principal := this.state.principal
+	this.state.mutex.Unlock()
+	report := ErrorReport{
+		Err:         err,
+		Message:     message,
+		Status:      status,
+		SpanId:      this.SpanId,
+		TraceId:     this.TraceId,
+		RequestId:   this.RequestId,
+		Request:     this.Request,
+		Principal:   principal,
+		Fingerprint: errorFingerprint(err, message, callerFunction(this.stackFrameLevel+1)),
+		Panic:       panicked,
+		Time:        time.Now(),
+	}
+	for _, reporter := range config.ErrorReporters {
+		this.runReporter(reporter, report)
+	}
+}
+
+func (this FunctionContext) runReporter(reporter ErrorReporter, report ErrorReport) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			this.Logger.Error().Msgf(this.spanIdLogField+"Error reporter panicked: %v", recovered)
+		}
+	}()
+	reporter.ReportError(this.Context, report)
+}
@@ -0,0 +1,134 @@
+package toolkit
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// ErrorReportingConfig configures how errors are sent to Google Cloud Error Reporting. Enable it with WithErrorReporting
+type ErrorReportingConfig struct {
+	// Service is the name errors are grouped under. Defaults to the K_SERVICE or FUNCTION_TARGET environment variable
+	Service string
+	// Version is the version of the service. Defaults to the K_REVISION environment variable
+	Version string
+	// API reports the errors by calling the Error Reporting API, instead of adding the Error Reporting fields to the log entries.
+	// Needed when the logs aren't written in the GCP log format or aren't sent to Cloud Logging
+	API bool
+	// Endpoint is the address of the Error Reporting API
+	Endpoint string
+}
+
+const reportedErrorEventType = "type.googleapis.com/google.devtools.clouderrorreporting.v1beta1.ReportedErrorEvent"
+
+// WithErrorReporting reports ERROR messages, and the errors of ErrResponse with a 5xx status, to Google Cloud Error Reporting together with their stack trace,
+// so they're grouped and alerted on automatically. By default the Error Reporting fields are added to the log entries, which requires the GCP log format
+func WithErrorReporting(reporting ErrorReportingConfig) Option {
+	return func(config *Config) {
+		if reporting.Service == "" {
+			reporting.Service = firstEnv("K_SERVICE", "FUNCTION_TARGET", "FUNCTION_NAME")
+		}
+		if reporting.Version == "" {
+			reporting.Version = os.Getenv("K_REVISION")
+		}
+		if reporting.Endpoint == "" {
+			reporting.Endpoint = "https://clouderrorreporting.googleapis.com"
+		}
+		config.ErrorReporting = &reporting
+	}
+}
+
+// WithoutErrorReporting stops reporting errors to Error Reporting
+func WithoutErrorReporting() Option {
+	return func(config *Config) {
+		config.ErrorReporting = nil
+	}
+}
+
+// firstEnv returns the value of the first of the environment variables which is set
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// withoutErrorReport returns a copy of this ctx whose ERROR messages aren't reported if skip is true. Used for errors of 4xx responses
+func (this FunctionContext) withoutErrorReport(skip bool) FunctionContext {
+	this.skipErrorReport = skip
+	return this
+}
+
+// reportError adds the fingerprint to an ERROR message logged by the caller of its caller, and reports it either by adding the Error Reporting fields to the log event,
+// or by calling the API. The fingerprint is made from the error if it isn't nil, otherwise from the message
+func (this FunctionContext) reportError(e *zerolog.Event, err error, message string) *zerolog.Event {
+	e = e.Str(FingerprintFieldName, errorFingerprint(err, message, callerFunction(this.stackFrameLevel+1)))
+	reporting := config.ErrorReporting
+	if reporting == nil || this.skipErrorReport {
+		return e
+	}
+	stack := goStackTrace(message, this.stackFrameLevel+1)
+	if reporting.API {
+		go this.sendErrorReport(reporting, stack)
+		return e
+	}
+	if !config.GcpLogFormat {
+		return e
+	}
+	return e.Str("@type", reportedErrorEventType).
+		Dict("serviceContext", zerolog.Dict().Str("service", reporting.Service).Str("version", reporting.Version)).
+		Str("stack_trace", stack)
+}
+
+// sendErrorReport sends the error to the Error Reporting API
+func (this FunctionContext) sendErrorReport(reporting *ErrorReportingConfig, stack string) {
+	project := projectId()
+	if project == "" {
+		backgroundLogger().Error().Msg("Failed to report error: project id is unknown")
+		return
+	}
+	event := map[string]interface{}{
+		"eventTime":      time.Now().UTC().Format(time.RFC3339Nano),
+		"serviceContext": map[string]string{"service": reporting.Service, "version": reporting.Version},
+		"message":        stack,
+		"context": map[string]interface{}{
+			"httpRequest": map[string]interface{}{
+				"method":    this.Request.Method,
+				"url":       this.Request.URL.String(),
+				"userAgent": this.Request.UserAgent(),
+				"remoteIp":  this.Request.RemoteAddr,
+			},
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	url := reporting.Endpoint + "/v1beta1/projects/" + project + "/events:report"
+	if err := googleApi(ctx, http.MethodPost, url, event, nil); err != nil {
+		backgroundLogger().Error().Err(err).Msg("Failed to report error")
+	}
+}
+
+// goStackTrace formats the message and the call stack starting `skip` frames above its caller like the output of a Go panic, which is the format Error Reporting parses
+func goStackTrace(message string, skip int) string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(skip+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var builder strings.Builder
+	builder.WriteString(message + "\n\ngoroutine 1 [running]:\n")
+	for {
+		frame, more := frames.Next()
+		builder.WriteString(frame.Function + "()\n\t" + frame.File + ":" + strconv.Itoa(frame.Line) + "\n")
+		if !more {
+			break
+		}
+	}
+	return builder.String()
+}
@@ -0,0 +1,89 @@
+package toolkit
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Errors collects the errors of operations which continue after a failure, e.g. validating every item of a bulk import, so all of them can be reported.
+// The zero value is empty and ready to use. ErrResponse sends each error as one of the details of the response
+type Errors struct {
+	entries []fieldError
+}
+
+type fieldError struct {
+	field string
+	err   error
+}
+
+// Append adds the error to the collection. nil errors are ignored, so the result of an operation can be appended directly
+func (this *Errors) Append(err error) {
+	this.AppendField("", err)
+}
+
+// AppendField adds the error of the given field or item (e.g. `items[3].quantity`) to the collection. nil errors are ignored
+func (this *Errors) AppendField(field string, err error) {
+	if err == nil {
+		return
+	}
+	this.entries = append(this.entries, fieldError{field: field, err: err})
+}
+
+// Len returns the number of errors in the collection
+func (this *Errors) Len() int {
+	return len(this.entries)
+}
+
+// ErrOrNil returns the collection as an error if it contains any errors, and nil otherwise
+func (this *Errors) ErrOrNil() error {
+	if len(this.entries) == 0 {
+		return nil
+	}
+	return this
+}
+
+// Error joins the messages of the errors, prefixed with their field
+func (this *Errors) Error() string {
+	messages := make([]string, len(this.entries))
+	for i, entry := range this.entries {
+		messages[i] = entry.err.Error()
+		if entry.field != "" {
+			messages[i] = entry.field + ": " + messages[i]
+		}
+	}
+	return strconv.Itoa(len(this.entries)) + " errors: " + strings.Join(messages, "; ")
+}
+
+// Unwrap returns the errors in the collection, so errors.Is and errors.As check each of them
+func (this *Errors) Unwrap() []error {
+	errs := make([]error, len(this.entries))
+	for i, entry := range this.entries {
+		errs[i] = entry.err
+	}
+	return errs
+}
+
+// ErrorDetails returns a detail for each error, containing its field and client message (see ClientMessage).
+// Errors without a client message, which may contain internal details, get a generic message
+func (this *Errors) ErrorDetails() []ErrorDetail {
+	details := make([]ErrorDetail, len(this.entries))
+	for i, entry := range this.entries {
+		message := ClientMessage(entry.err)
+		if message == "" {
+			message = http.StatusText(http.StatusInternalServerError)
+		}
+		details[i] = ErrorDetail{Field: entry.field, Message: message}
+	}
+	return details
+}
+
+// errorDetails returns the details of the error, if it wraps an error which has details like Errors or ResponseError
+func errorDetails(err error) []ErrorDetail {
+	var detailed interface{ ErrorDetails() []ErrorDetail }
+	if errors.As(err, &detailed) {
+		return detailed.ErrorDetails()
+	}
+	return nil
+}
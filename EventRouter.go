@@ -0,0 +1,99 @@
+package toolkit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+)
+
+// EventRouter dispatches CloudEvents to the handlers registered for their type and source, for functions with several Eventarc triggers.
+// Create it with NewEventRouter and register its Handle method with functions.CloudEvent
+type EventRouter struct {
+	routes    []eventRoute
+	otherwise HandlerFunc
+}
+
+type eventRoute struct {
+	eventType string
+	source    string
+	handler   HandlerFunc
+}
+
+// NewEventRouter creates a router without any routes
+func NewEventRouter() *EventRouter {
+	return &EventRouter{}
+}
+
+// On registers the handler for events of the given type, e.g. `google.cloud.storage.object.v1.finalized`. A type ending in * matches every type starting with the rest of it.
+// Routes are matched in the order they're registered
+func (this *EventRouter) On(eventType string, handler HandlerFunc) *EventRouter {
+	return this.OnSource(eventType, "*", handler)
+}
+
+// OnSource registers the handler for events of the given type from the given source. Like the type, a source ending in * matches every source starting with the rest of it
+func (this *EventRouter) OnSource(eventType string, source string, handler HandlerFunc) *EventRouter {
+	this.routes = append(this.routes, eventRoute{eventType: eventType, source: source, handler: handler})
+	return this
+}
+
+// Otherwise registers the handler for events which match no route. Without one, they're dropped
+func (this *EventRouter) Otherwise(handler HandlerFunc) *EventRouter {
+	this.otherwise = handler
+	return this
+}
+
+// matchesPattern returns true if the value equals the pattern, or starts with it when it ends in *
+func matchesPattern(pattern string, value string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(value, prefix)
+	}
+	return pattern == value
+}
+
+// route returns the handler of the first route matching the event
+func (this *EventRouter) route(e event.Event) HandlerFunc {
+	for _, route := range this.routes {
+		if matchesPattern(route.eventType, e.Type()) && matchesPattern(route.source, e.Source()) {
+			return route.handler
+		}
+	}
+	return this.otherwise
+}
+
+// Handle creates the ctx of the event with EventCtx and runs the handler of its route. Handlers can finish the event with Ack, Nack or Drop,
+// or return an error: errors with a 4xx status (a StatusError or a mapping added with MapError) are dropped, and other errors are returned so the event is retried.
+// A nil return acknowledges the event. Panics are recovered with Recover and returned as errors
+func (this *EventRouter) Handle(c context.Context, e event.Event) (err error) {
+	ctx := EventCtx(c, e)
+	defer ctx.state.cancel()
+	defer func() {
+		if err == nil && ctx.state.writer.statusCode() >= 500 {
+			ctx.state.mutex.Lock()
+			err = ctx.state.err
+			ctx.state.mutex.Unlock()
+		}
+	}()
+	defer ctx.Recover()
+	handler := this.route(e)
+	if handler == nil {
+		return ctx.Drop(fmt.Errorf("no route for %v events from %v", e.Type(), e.Source()))
+	}
+	return ctx.finishEvent(handler(ctx))
+}
+
+// finishEvent finishes the handling of the event with the error returned by its handler, unless the handler already finished it
+func (this FunctionContext) finishEvent(err error) error {
+	if this.state.writer.hasWritten() {
+		return err
+	}
+	if err == nil {
+		return this.Ack()
+	}
+	code, _ := errorStatus(err)
+	if _, retryable := RetryAfter(err); code < 500 && !retryable {
+		return this.Drop(err)
+	}
+	return this.Nack(err)
+}
@@ -0,0 +1,134 @@
+package toolkit
+
+import (
+	"errors"
+	"strings"
+)
+
+// fieldMask is a parsed `fields` query parameter. A nil fieldMask selects the whole value
+type fieldMask map[string]fieldMask
+
+// parseFieldMask parses a Google API style field mask, e.g. `id,name,author/email,items(id,title)`. Both `/` and `.` can be used to select sub-fields
+func parseFieldMask(fields string) (fieldMask, error) {
+	mask, rest, err := parseFieldMaskList(fields)
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, errors.New("unexpected ')' in fields")
+	}
+	return mask, nil
+}
+
+func parseFieldMaskList(fields string) (fieldMask, string, error) {
+	mask := fieldMask{}
+	for {
+		end := strings.IndexAny(fields, ",()")
+		var path string
+		if end == -1 {
+			path, fields = fields, ""
+		} else {
+			path, fields = fields[:end], fields[end:]
+		}
+		path = strings.TrimSpace(path)
+		if path == "" {
+			return nil, fields, errors.New("empty field name in fields")
+		}
+
+		var sub fieldMask
+		if strings.HasPrefix(fields, "(") {
+			var err error
+			sub, fields, err = parseFieldMaskList(fields[1:])
+			if err != nil {
+				return nil, fields, err
+			}
+			if !strings.HasPrefix(fields, ")") {
+				return nil, fields, errors.New("missing ')' in fields")
+			}
+			fields = fields[1:]
+		}
+		mask.add(strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == '.' }), sub)
+
+		if fields == "" || strings.HasPrefix(fields, ")") {
+			return mask, fields, nil
+		}
+		if !strings.HasPrefix(fields, ",") {
+			return nil, fields, errors.New("unexpected '(' in fields")
+		}
+		fields = fields[1:]
+	}
+}
+
+// add selects the given path in the mask, with sub as the selection of the last path segment
+func (this fieldMask) add(path []string, sub fieldMask) {
+	current := this
+	for i, name := range path {
+		existing, found := current[name]
+		if found && existing == nil {
+			//  The whole field is already selected
+			return
+		}
+		if i == len(path)-1 {
+			if sub == nil || !found {
+				current[name] = sub
+			} else {
+				for k, v := range sub {
+					existing[k] = v
+				}
+			}
+			return
+		}
+		if !found {
+			existing = fieldMask{}
+			current[name] = existing
+		}
+		current = existing
+	}
+}
+
+// apply removes every field which isn't selected by the mask from the given decoded json value
+func (this fieldMask) apply(value interface{}) interface{} {
+	if this == nil {
+		return value
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		filtered := make(map[string]interface{}, len(this))
+		for name, sub := range this {
+			if field, ok := v[name]; ok {
+				filtered[name] = sub.apply(field)
+			}
+		}
+		return filtered
+	case []interface{}:
+		for i := range v {
+			v[i] = this.apply(v[i])
+		}
+		return v
+	default:
+		return value
+	}
+}
+
+// filterFields applies the field mask in the `fields` query parameter to the given object.
+// Returns the object unchanged if the request doesn't contain a field mask
+func (this FunctionContext) filterFields(obj interface{}) (interface{}, error) {
+	fields := this.Request.URL.Query().Get("fields")
+	if fields == "" || obj == nil {
+		return obj, nil
+	}
+	mask, err := parseFieldMask(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	bytes, err := codec.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var decoded interface{}
+	if err := codec.Unmarshal(bytes, &decoded); err != nil {
+		return nil, err
+	}
+	return mask.apply(decoded), nil
+}
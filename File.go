@@ -0,0 +1,36 @@
+package toolkit
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// FileResponse sends the contents of the reader as a file attachment with the given filename and Content-Type.
+// If the reader is an io.ReadSeeker (e.g. an *os.File or *bytes.Reader) Content-Length and range requests are handled automatically,
+// otherwise the contents are streamed to the client
+func (this FunctionContext) FileResponse(r io.Reader, filename string, contentType string) {
+	header := this.Response.Header()
+	header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	header.Set("Content-Type", contentType)
+
+	if seeker, ok := r.(io.ReadSeeker); ok {
+		this.withSkip(1).Debugf("Responding with file %v", filename)
+		http.ServeContent(this.Response, this.Request, filename, time.Time{}, seeker)
+		this.finishResponse(nil)
+		return
+	}
+
+	if sized, ok := r.(interface{ Len() int }); ok {
+		header.Set("Content-Length", strconv.Itoa(sized.Len()))
+	}
+	this.withSkip(1).Debugf("Responding with status 200, file %v", filename)
+	this.Response.WriteHeader(http.StatusOK)
+	written, err := io.Copy(this.Response, r)
+	if err != nil {
+		this.withSkip(1).Errorf("Failed to send file %v after %v bytes: %v", filename, written, err)
+	}
+	this.finishResponse(err)
+}
@@ -0,0 +1,61 @@
+package toolkit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"runtime"
+)
+
+// FingerprintFieldName is the log field the fingerprint of ERROR messages is added to
+var FingerprintFieldName = "fingerprint"
+
+var (
+	fingerprintQuoted = regexp.MustCompile(`"[^"]*"|'[^']*'`)
+	fingerprintUuid   = regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`)
+	fingerprintHex    = regexp.MustCompile(`(?i)\b(0x)?[0-9a-f]*[0-9][0-9a-f]*\b`)
+)
+
+// normalizeErrorMessage replaces the parts of a message which vary between occurrences of the same failure (quoted values, ids and numbers) with placeholders
+func normalizeErrorMessage(message string) string {
+	message = fingerprintQuoted.ReplaceAllString(message, "<str>")
+	message = fingerprintUuid.ReplaceAllString(message, "<id>")
+	return fingerprintHex.ReplaceAllString(message, "<n>")
+}
+
+// rootCause returns the innermost error wrapped by the error
+func rootCause(err error) error {
+	for {
+		inner := errors.Unwrap(err)
+		if inner == nil {
+			return err
+		}
+		err = inner
+	}
+}
+
+// callerFunction returns the name of the function `skip` frames above its caller
+func callerFunction(skip int) string {
+	pc, _, _, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return ""
+	}
+	if function := runtime.FuncForPC(pc); function != nil {
+		return function.Name()
+	}
+	return ""
+}
+
+// errorFingerprint hashes the type of the error's root cause, the normalized error message (or the message if there's no error) and the function the error was logged in.
+// The line isn't included, so the fingerprint stays the same when unrelated code around it changes
+func errorFingerprint(err error, message string, function string) string {
+	errorType := ""
+	if err != nil {
+		errorType = fmt.Sprintf("%T", rootCause(err))
+		message = err.Error()
+	}
+	hash := sha256.Sum256([]byte(errorType + "\n" + normalizeErrorMessage(message) + "\n" + function))
+	return hex.EncodeToString(hash[:8])
+}
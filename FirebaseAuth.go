@@ -0,0 +1,143 @@
+package toolkit
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// firebaseCertsUrl is the JSON Web Key Set Firebase Authentication signs its ID tokens with
+const firebaseCertsUrl = "https://www.googleapis.com/service_accounts/v1/jwk/securetoken@system.gserviceaccount.com"
+
+// firebaseStandardClaims are the claims of Firebase ID tokens which aren't custom claims
+var firebaseStandardClaims = []string{"iss", "aud", "sub", "iat", "exp", "nbf", "auth_time", "user_id", "email", "email_verified", "name", "picture", "phone_number", "firebase"}
+
+// FirebaseAuthConfig configures how RequireFirebaseAuth verifies the Firebase Authentication ID tokens of requests
+type FirebaseAuthConfig struct {
+	// ProjectId is the Firebase project the tokens must be issued by. Defaults to the project the function runs in
+	ProjectId string
+	// CheckRevoked looks the user up with the Identity Toolkit API on every request, to reject the tokens of disabled users and those issued before their tokens were revoked.
+	// The function's service account needs the Firebase Authentication Viewer role
+	CheckRevoked bool
+	// KeysUrl is the address of the keys Firebase signs ID tokens with
+	KeysUrl string
+	// Endpoint is the address of the Identity Toolkit API
+	Endpoint string
+}
+
+// FirebaseUser is the user of a request authenticated with a Firebase ID token
+type FirebaseUser struct {
+	Uid            string
+	Email          string
+	EmailVerified  bool
+	Name           string
+	Picture        string
+	PhoneNumber    string
+	SignInProvider string
+	// Tenant is the Identity Platform tenant of the user, if any
+	Tenant   string
+	AuthTime time.Time
+	// Claims are the custom claims set on the user with the Admin SDK
+	Claims map[string]interface{}
+}
+
+// RequireFirebaseAuth is a middleware which rejects requests with a 401 response unless they have a bearer token which is a valid Firebase Authentication ID token of the project.
+// The handler gets a ctx whose principal is the uid of the user, with the user available through ctx.User and the token's claims through ctx.Claims
+func RequireFirebaseAuth(firebase FirebaseAuthConfig) Middleware {
+	if firebase.ProjectId == "" {
+		firebase.ProjectId = projectId()
+	}
+	if firebase.KeysUrl == "" {
+		firebase.KeysUrl = firebaseCertsUrl
+	}
+	if firebase.Endpoint == "" {
+		firebase.Endpoint = "https://identitytoolkit.googleapis.com"
+	}
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx FunctionContext) error {
+			token := ctx.bearerToken()
+			if token == "" {
+				ctx.SetResponseHeader("WWW-Authenticate", "Bearer")
+				return Unauthorized("Missing Firebase ID token")
+			}
+			claims, err := verifyJwt(ctx.Context, token, keySet(firebase.KeysUrl))
+			if err == nil {
+				err = validateClaims(claims, []string{"https://securetoken.google.com/" + firebase.ProjectId}, firebase.ProjectId)
+			}
+			if uid, _ := claims["sub"].(string); err == nil && uid == "" {
+				err = errors.New("token has no subject")
+			}
+			if authTime, _ := claims["auth_time"].(float64); err == nil && time.Unix(int64(authTime), 0).After(time.Now().Add(jwtLeeway)) {
+				err = errors.New("token was authenticated in the future")
+			}
+			if err == nil && firebase.CheckRevoked {
+				err = firebase.checkRevoked(ctx, claims)
+			}
+			if err != nil {
+				var statusErr *httpStatusError
+				if errors.As(err, &statusErr) {
+					return ServiceUnavailable("Failed to verify the Firebase ID token").WithCause(err)
+				}
+				ctx.SetResponseHeader("WWW-Authenticate", `Bearer error="invalid_token"`)
+				return Unauthorized("Invalid Firebase ID token").WithCause(err)
+			}
+			return next(ctx.WithPrincipal(claims["sub"].(string), claims))
+		}
+	}
+}
+
+// checkRevoked looks the user up, and fails if they're disabled or their tokens were revoked after the token was issued
+func (this FirebaseAuthConfig) checkRevoked(ctx FunctionContext, claims map[string]interface{}) error {
+	var response struct {
+		Users []struct {
+			Disabled   bool   `json:"disabled"`
+			ValidSince string `json:"validSince"`
+		} `json:"users"`
+	}
+	request := map[string]interface{}{"localId": []string{claims["sub"].(string)}}
+	if err := googleApi(ctx.Context, http.MethodPost, this.Endpoint+"/v1/projects/"+this.ProjectId+"/accounts:lookup", request, &response); err != nil {
+		return err
+	}
+	if len(response.Users) == 0 {
+		return errors.New("user doesn't exist")
+	}
+	if response.Users[0].Disabled {
+		return errors.New("user is disabled")
+	}
+	issuedAt, _ := claims["iat"].(float64)
+	if validSince, err := strconv.ParseInt(response.Users[0].ValidSince, 10, 64); err == nil && int64(issuedAt) < validSince {
+		return errors.New("token has been revoked")
+	}
+	return nil
+}
+
+// User returns the user of a request authenticated by RequireFirebaseAuth, and false if the request wasn't authenticated with a Firebase ID token
+func (this FunctionContext) User() (FirebaseUser, bool) {
+	principal, ok := this.Principal()
+	firebase, isFirebase := principal.Claims["firebase"].(map[string]interface{})
+	if !ok || !isFirebase {
+		return FirebaseUser{}, false
+	}
+	user := FirebaseUser{
+		Uid:         principal.Claim("sub"),
+		Email:       principal.Claim("email"),
+		Name:        principal.Claim("name"),
+		Picture:     principal.Claim("picture"),
+		PhoneNumber: principal.Claim("phone_number"),
+		Claims:      map[string]interface{}{},
+	}
+	user.EmailVerified, _ = principal.Claims["email_verified"].(bool)
+	user.SignInProvider, _ = firebase["sign_in_provider"].(string)
+	user.Tenant, _ = firebase["tenant"].(string)
+	if authTime, ok := principal.Claims["auth_time"].(float64); ok {
+		user.AuthTime = time.Unix(int64(authTime), 0).UTC()
+	}
+	for name, value := range principal.Claims {
+		if !slices.Contains(firebaseStandardClaims, name) {
+			user.Claims[name] = value
+		}
+	}
+	return user, true
+}
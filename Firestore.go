@@ -0,0 +1,389 @@
+package toolkit
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// FirestoreDocument is a version of a Firestore document in a document change event.
+// The fields are decoded into plain Go values: nil, bool, int64, float64, string, []byte, time.Time, FirestoreGeoPoint,
+// []interface{} for arrays, and map[string]interface{} for maps. References are decoded as the resource name of the referenced document
+type FirestoreDocument struct {
+	// Name is the resource name of the document, e.g. `projects/<project>/databases/(default)/documents/users/u-1`
+	Name       string
+	Fields     map[string]interface{}
+	CreateTime time.Time
+	UpdateTime time.Time
+}
+
+// FirestoreGeoPoint is the value of a geo point field
+type FirestoreGeoPoint struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// Path returns the segments of the document's path within the database, e.g. `["users", "u-1", "orders", "o-7"]`
+func (this FirestoreDocument) Path() []string {
+	_, path, found := strings.Cut(this.Name, "/documents/")
+	if !found || path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// Id returns the id of the document, which is the last segment of its path
+func (this FirestoreDocument) Id() string {
+	path := this.Path()
+	if len(path) == 0 {
+		return ""
+	}
+	return path[len(path)-1]
+}
+
+// FirestoreEvent is a Firestore document change event
+type FirestoreEvent struct {
+	// Value is the document after the change, nil if it was deleted
+	Value *FirestoreDocument
+	// OldValue is the document before the change, nil if it was created
+	OldValue *FirestoreDocument
+	// UpdateMask lists the paths of the fields which changed, for updates
+	UpdateMask []string
+}
+
+// Document returns the document after the change, or before it if it was deleted
+func (this FirestoreEvent) Document() FirestoreDocument {
+	if this.Value != nil {
+		return *this.Value
+	}
+	if this.OldValue != nil {
+		return *this.OldValue
+	}
+	return FirestoreDocument{}
+}
+
+// BindFirestoreEvent decodes the data of a Firestore CloudEvent, which is encoded as protobuf by default, or as json if the trigger was created with that content type
+func (this FunctionContext) BindFirestoreEvent() (FirestoreEvent, error) {
+	e, ok := this.Event()
+	if !ok {
+		return FirestoreEvent{}, errNotAnEvent
+	}
+	if !strings.HasPrefix(e.Type(), "google.cloud.firestore.document.v1.") {
+		return FirestoreEvent{}, fmt.Errorf("%v is not a Firestore document event", e.Type())
+	}
+	var event FirestoreEvent
+	var err error
+	if strings.Contains(e.DataContentType(), "json") {
+		err = decodeFirestoreJson(e.Data(), &event)
+	} else {
+		err = decodeFirestoreProto(e.Data(), &event)
+	}
+	if err != nil {
+		return FirestoreEvent{}, fmt.Errorf("invalid Firestore event: %w", err)
+	}
+	this.withSkip(1).Debugf("Received %v for %v", e.Type(), event.Document().Name)
+	return event, nil
+}
+
+// protoFields calls the callback with every field of an encoded protobuf message. Varint and fixed-size values are passed as the number, length-delimited ones as the bytes
+func protoFields(b []byte, field func(number protowire.Number, number64 uint64, bytes []byte) error) error {
+	for len(b) > 0 {
+		number, kind, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		var value uint64
+		var bytes []byte
+		switch kind {
+		case protowire.VarintType:
+			value, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			value, n = protowire.ConsumeFixed64(b)
+		case protowire.Fixed32Type:
+			var value32 uint32
+			value32, n = protowire.ConsumeFixed32(b)
+			value = uint64(value32)
+		case protowire.BytesType:
+			bytes, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(number, kind, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if err := field(number, value, bytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeFirestoreProto decodes a google.events.cloud.firestore.v1.DocumentEventData message
+func decodeFirestoreProto(b []byte, event *FirestoreEvent) error {
+	return protoFields(b, func(number protowire.Number, _ uint64, bytes []byte) error {
+		switch number {
+		case 1, 2:
+			document, err := decodeFirestoreDocument(bytes)
+			if err != nil {
+				return err
+			}
+			if number == 1 {
+				event.Value = &document
+			} else {
+				event.OldValue = &document
+			}
+		case 3:
+			return protoFields(bytes, func(number protowire.Number, _ uint64, bytes []byte) error {
+				if number == 1 {
+					event.UpdateMask = append(event.UpdateMask, string(bytes))
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+}
+
+func decodeFirestoreDocument(b []byte) (FirestoreDocument, error) {
+	document := FirestoreDocument{Fields: map[string]interface{}{}}
+	err := protoFields(b, func(number protowire.Number, _ uint64, bytes []byte) error {
+		var err error
+		switch number {
+		case 1:
+			document.Name = string(bytes)
+		case 2:
+			err = decodeFirestoreEntry(bytes, document.Fields)
+		case 3:
+			document.CreateTime, err = decodeProtoTimestamp(bytes)
+		case 4:
+			document.UpdateTime, err = decodeProtoTimestamp(bytes)
+		}
+		return err
+	})
+	return document, err
+}
+
+// decodeFirestoreEntry decodes an entry of a map<string, Value> field into the map
+func decodeFirestoreEntry(b []byte, fields map[string]interface{}) error {
+	var key string
+	var value interface{}
+	err := protoFields(b, func(number protowire.Number, _ uint64, bytes []byte) error {
+		var err error
+		switch number {
+		case 1:
+			key = string(bytes)
+		case 2:
+			value, err = decodeFirestoreValue(bytes)
+		}
+		return err
+	})
+	fields[key] = value
+	return err
+}
+
+// decodeFirestoreValue decodes a google.events.cloud.firestore.v1.Value message
+func decodeFirestoreValue(b []byte) (interface{}, error) {
+	var value interface{}
+	err := protoFields(b, func(number protowire.Number, number64 uint64, bytes []byte) error {
+		var err error
+		switch number {
+		case 11:
+			value = nil
+		case 1:
+			value = number64 != 0
+		case 2:
+			value = int64(number64)
+		case 3:
+			value = math.Float64frombits(number64)
+		case 10:
+			value, err = decodeProtoTimestamp(bytes)
+		case 17, 5:
+			value = string(bytes)
+		case 18:
+			value = append([]byte(nil), bytes...)
+		case 8:
+			var point FirestoreGeoPoint
+			err = protoFields(bytes, func(number protowire.Number, number64 uint64, _ []byte) error {
+				if number == 1 {
+					point.Latitude = math.Float64frombits(number64)
+				} else if number == 2 {
+					point.Longitude = math.Float64frombits(number64)
+				}
+				return nil
+			})
+			value = point
+		case 9:
+			values := []interface{}{}
+			err = protoFields(bytes, func(number protowire.Number, _ uint64, bytes []byte) error {
+				if number != 1 {
+					return nil
+				}
+				item, err := decodeFirestoreValue(bytes)
+				values = append(values, item)
+				return err
+			})
+			value = values
+		case 6:
+			fields := map[string]interface{}{}
+			err = protoFields(bytes, func(number protowire.Number, _ uint64, bytes []byte) error {
+				if number != 1 {
+					return nil
+				}
+				return decodeFirestoreEntry(bytes, fields)
+			})
+			value = fields
+		}
+		return err
+	})
+	return value, err
+}
+
+// decodeProtoTimestamp decodes a google.protobuf.Timestamp message
+func decodeProtoTimestamp(b []byte) (time.Time, error) {
+	var seconds, nanos int64
+	err := protoFields(b, func(number protowire.Number, number64 uint64, _ []byte) error {
+		if number == 1 {
+			seconds = int64(number64)
+		} else if number == 2 {
+			nanos = int64(int32(number64))
+		}
+		return nil
+	})
+	return time.Unix(seconds, nanos).UTC(), err
+}
+
+type firestoreJsonDocument struct {
+	Name       string                     `json:"name"`
+	Fields     map[string]json.RawMessage `json:"fields"`
+	CreateTime time.Time                  `json:"createTime"`
+	UpdateTime time.Time                  `json:"updateTime"`
+}
+
+// decodeFirestoreJson decodes the json encoding of a google.events.cloud.firestore.v1.DocumentEventData message
+func decodeFirestoreJson(b []byte, event *FirestoreEvent) error {
+	var data struct {
+		Value      *firestoreJsonDocument `json:"value"`
+		OldValue   *firestoreJsonDocument `json:"oldValue"`
+		UpdateMask struct {
+			FieldPaths []string `json:"fieldPaths"`
+		} `json:"updateMask"`
+	}
+	if err := json.Unmarshal(b, &data); err != nil {
+		return err
+	}
+	event.UpdateMask = data.UpdateMask.FieldPaths
+	for _, document := range []struct {
+		source *firestoreJsonDocument
+		target **FirestoreDocument
+	}{{data.Value, &event.Value}, {data.OldValue, &event.OldValue}} {
+		if document.source == nil {
+			continue
+		}
+		fields, err := decodeFirestoreJsonFields(document.source.Fields)
+		if err != nil {
+			return err
+		}
+		*document.target = &FirestoreDocument{Name: document.source.Name, Fields: fields, CreateTime: document.source.CreateTime, UpdateTime: document.source.UpdateTime}
+	}
+	return nil
+}
+
+func decodeFirestoreJsonFields(raw map[string]json.RawMessage) (map[string]interface{}, error) {
+	fields := make(map[string]interface{}, len(raw))
+	for name, value := range raw {
+		decoded, err := decodeFirestoreJsonValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("field %v: %w", name, err)
+		}
+		fields[name] = decoded
+	}
+	return fields, nil
+}
+
+// decodeFirestoreJsonValue decodes the json encoding of a google.events.cloud.firestore.v1.Value message, e.g. `{"integerValue": "42"}`
+func decodeFirestoreJsonValue(raw json.RawMessage) (interface{}, error) {
+	var value map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, err
+	}
+	for kind, content := range value {
+		switch kind {
+		case "nullValue":
+			return nil, nil
+		case "booleanValue":
+			var boolean bool
+			err := json.Unmarshal(content, &boolean)
+			return boolean, err
+		case "integerValue":
+			var integer json.Number
+			if err := json.Unmarshal(content, &integer); err != nil {
+				return nil, err
+			}
+			return strconv.ParseInt(string(integer), 10, 64)
+		case "doubleValue":
+			var double interface{}
+			if err := json.Unmarshal(content, &double); err != nil {
+				return nil, err
+			}
+			if text, ok := double.(string); ok {
+				return strconv.ParseFloat(text, 64)
+			}
+			return double, nil
+		case "timestampValue":
+			var timestamp time.Time
+			err := json.Unmarshal(content, &timestamp)
+			return timestamp, err
+		case "stringValue", "referenceValue":
+			var text string
+			err := json.Unmarshal(content, &text)
+			return text, err
+		case "bytesValue":
+			var text string
+			if err := json.Unmarshal(content, &text); err != nil {
+				return nil, err
+			}
+			return base64.StdEncoding.DecodeString(text)
+		case "geoPointValue":
+			var point struct {
+				Latitude  float64 `json:"latitude"`
+				Longitude float64 `json:"longitude"`
+			}
+			err := json.Unmarshal(content, &point)
+			return FirestoreGeoPoint(point), err
+		case "arrayValue":
+			var array struct {
+				Values []json.RawMessage `json:"values"`
+			}
+			if err := json.Unmarshal(content, &array); err != nil {
+				return nil, err
+			}
+			values := make([]interface{}, 0, len(array.Values))
+			for _, item := range array.Values {
+				decoded, err := decodeFirestoreJsonValue(item)
+				if err != nil {
+					return nil, err
+				}
+				values = append(values, decoded)
+			}
+			return values, nil
+		case "mapValue":
+			var fields struct {
+				Fields map[string]json.RawMessage `json:"fields"`
+			}
+			if err := json.Unmarshal(content, &fields); err != nil {
+				return nil, err
+			}
+			return decodeFirestoreJsonFields(fields.Fields)
+		}
+	}
+	return nil, errors.New("unknown value type")
+}
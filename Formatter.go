@@ -0,0 +1,24 @@
+package toolkit
+
+// ResponseFormatter builds the objects which are serialized as the body of json responses. Register your own with WithResponseFormatter
+// to change the shape of the responses (e.g. rename or add fields, or drop the envelope entirely) without changing any ctx.OkResponseJson call sites
+type ResponseFormatter interface {
+	// FormatSuccess builds the body of a successful response containing the given data
+	FormatSuccess(ctx FunctionContext, data interface{}) interface{}
+	// FormatError builds the body of an error response
+	FormatError(ctx FunctionContext, code int, message string, details []ErrorDetail) interface{}
+}
+
+// DefaultResponseFormatter builds the standard SuccessResponseStruct and ErrorResponseStruct envelopes.
+// Embed it in your own formatter to only override one of the methods
+type DefaultResponseFormatter struct{}
+
+// FormatSuccess returns a SuccessResponseStruct containing the span id and data, and the metadata if it's enabled
+func (this DefaultResponseFormatter) FormatSuccess(ctx FunctionContext, data interface{}) interface{} {
+	return SuccessResponseStruct{SpanId: ctx.SpanId, Data: data, Meta: ctx.responseMeta()}
+}
+
+// FormatError returns an ErrorResponseStruct containing the span id, message and details, and whether the request can be retried
+func (this DefaultResponseFormatter) FormatError(ctx FunctionContext, code int, message string, details []ErrorDetail) interface{} {
+	return ErrorResponseStruct{SpanId: ctx.SpanId, Message: message, Details: details, Retryable: ctx.ErrorRetryable()}
+}
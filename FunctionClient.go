@@ -0,0 +1,188 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FunctionClient calls another function, or Cloud Run service, which requires authentication, with an OIDC identity token of the function's service account.
+// Requests carry the trace and request id of the ctx, calls failing with a 429 or 5xx status are retried with exponential backoff,
+// and responses are decoded from the SuccessResponseStruct and ErrorResponseStruct envelopes
+type FunctionClient struct {
+	// Url is the address of the function, which the paths of calls are appended to
+	Url string
+	// Audience of the identity tokens. Defaults to the Url
+	Audience string
+	// MaxAttempts is how many times a call is sent before giving up
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled for every later one. A Retry-After header in the response overrides it
+	Backoff time.Duration
+	// Client sends the requests
+	Client *http.Client
+}
+
+// NewFunctionClient creates a client for the function at the given url, e.g. `https://europe-west1-my-project.cloudfunctions.net/orders`,
+// which makes up to 3 attempts per call
+func NewFunctionClient(targetURL string) *FunctionClient {
+	return &FunctionClient{
+		Url:         strings.TrimSuffix(targetURL, "/"),
+		Audience:    targetURL,
+		MaxAttempts: 3,
+		Backoff:     200 * time.Millisecond,
+		Client:      http.DefaultClient,
+	}
+}
+
+// FunctionCallError is returned by a FunctionClient when the function responds with an error status.
+// The message, details and span id are read from the ErrorResponseStruct or problem details document of the response
+type FunctionCallError struct {
+	Url       string
+	Status    int
+	Message   string
+	Details   []ErrorDetail
+	Retryable bool
+	// SpanId is the span id of the failed request in the called function's logs
+	SpanId string
+}
+
+func (this *FunctionCallError) Error() string {
+	message := this.Message
+	if message == "" {
+		message = http.StatusText(this.Status)
+	}
+	return fmt.Sprintf("%v responded with status %v: %v (span %v)", this.Url, this.Status, message, this.SpanId)
+}
+
+// Get calls the path of the function with a GET request, and decodes the data of the response into the response object, which may be nil
+func (this *FunctionClient) Get(ctx FunctionContext, path string, response interface{}) error {
+	return this.Call(ctx.withSkip(1), http.MethodGet, path, nil, response)
+}
+
+// Post sends the request object as json to the path of the function, and decodes the data of the response into the response object, which may be nil
+func (this *FunctionClient) Post(ctx FunctionContext, path string, request interface{}, response interface{}) error {
+	return this.Call(ctx.withSkip(1), http.MethodPost, path, request, response)
+}
+
+// Call sends the request object as json to the path of the function with the given method, and decodes the data of the response into the response object. Either may be nil.
+// Error responses are returned as a *FunctionCallError. Calls are retried until MaxAttempts is reached or the ctx's deadline would pass while waiting,
+// so requests which aren't idempotent should only be retried if the called function deduplicates them, e.g. by their X-Request-ID header
+func (this *FunctionClient) Call(ctx FunctionContext, method string, path string, request interface{}, response interface{}) error {
+	var body []byte
+	if request != nil {
+		var err error
+		if body, err = codec.Marshal(request); err != nil {
+			return err
+		}
+	}
+	url := this.Url + path
+	backoff := this.Backoff
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		retry, retryAfter, err := this.send(ctx, method, url, body, response)
+		if err == nil {
+			ctx.withSkip(1).Debugf("Called %v %v in %v", method, url, time.Since(start))
+			return nil
+		}
+		delay := backoff
+		if retryAfter > 0 {
+			delay = retryAfter
+		}
+		deadline, hasDeadline := ctx.Context.Deadline()
+		if !retry || attempt >= this.MaxAttempts || ctx.Context.Err() != nil || (hasDeadline && time.Now().Add(delay).After(deadline)) {
+			ctx.withSkip(1).Warnf("Call to %v %v failed after %v attempts: %v", method, url, attempt, err)
+			return err
+		}
+		ctx.withSkip(1).Debugf("Retrying %v %v in %v: %v", method, url, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Context.Done():
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// send makes one attempt of a call, returning whether it can be retried, and after how long the function asked for it to be retried
+func (this *FunctionClient) send(ctx FunctionContext, method string, url string, body []byte, response interface{}) (bool, time.Duration, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	rq, err := http.NewRequestWithContext(ctx.Context, method, url, reader)
+	if err != nil {
+		return false, 0, err
+	}
+	for name, values := range ctx.OutgoingHeaders() {
+		rq.Header[name] = values
+	}
+	rq.Header.Set("Accept", "application/json")
+	if body != nil {
+		rq.Header.Set("Content-Type", "application/json")
+	}
+	token, err := identityToken(ctx.Context, this.Audience)
+	if err == nil {
+		rq.Header.Set("Authorization", "Bearer "+token)
+	} else if !isLocalDeployment {
+		// Functions running locally call other local functions without a token, as there's no metadata server to get one from
+		return true, 0, fmt.Errorf("failed to get an identity token for %v: %w", this.Audience, err)
+	}
+	res, err := this.Client.Do(rq)
+	if err != nil {
+		return true, 0, err
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return true, 0, err
+	}
+	if res.StatusCode >= 200 && res.StatusCode <= 299 {
+		return false, 0, decodeSuccessResponse(data, response)
+	}
+	var retryAfter time.Duration
+	if seconds, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil {
+		retryAfter = time.Duration(seconds) * time.Second
+	}
+	return res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500, retryAfter, decodeErrorResponse(url, res.StatusCode, data)
+}
+
+// decodeSuccessResponse decodes the data of a SuccessResponseStruct into the response object. Bodies which aren't an envelope are decoded as they are
+func decodeSuccessResponse(data []byte, response interface{}) error {
+	if response == nil || len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+	var envelope struct {
+		SpanId string          `json:"spanId"`
+		Data   json.RawMessage `json:"data"`
+	}
+	if json.Unmarshal(data, &envelope) != nil || envelope.SpanId == "" {
+		return codec.Unmarshal(data, response)
+	}
+	if envelope.Data == nil {
+		return nil
+	}
+	return codec.Unmarshal(envelope.Data, response)
+}
+
+// decodeErrorResponse reads an ErrorResponseStruct, or a ProblemResponseStruct, into a FunctionCallError
+func decodeErrorResponse(url string, status int, data []byte) *FunctionCallError {
+	var body struct {
+		ErrorResponseStruct
+		Detail   string `json:"detail"`
+		Instance string `json:"instance"`
+	}
+	_ = json.Unmarshal(data, &body)
+	callErr := &FunctionCallError{Url: url, Status: status, Message: body.Message, Details: body.Details, Retryable: body.Retryable, SpanId: body.SpanId}
+	if callErr.Message == "" {
+		callErr.Message = body.Detail
+	}
+	if callErr.SpanId == "" {
+		callErr.SpanId = body.Instance
+	}
+	return callErr
+}
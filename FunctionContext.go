@@ -2,10 +2,19 @@ package toolkit
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"github.com/cloudevents/sdk-go/v2/event"
 	"github.com/rs/zerolog"
 	"github.com/teris-io/shortid"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"io"
 	"net/http"
 	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
 )
 
 const (
@@ -13,97 +22,296 @@ const (
 	LogLevelInfo
 	LogLevelWarn
 	LogLevelError
+	LogLevelFatal
+	LogLevelPanic
 )
 
 var isLocalDeployment = (0 == (len(os.Getenv("FUNCTION_NAME")) + len(os.Getenv("FUNCTION_REGION")) + len(os.Getenv("FUNCTION_IDENTITY")) + len(os.Getenv("K_SERVICE")) + len(os.Getenv("K_CONFIGURATION")) + len(os.Getenv("GOOGLE_FUNCTION_TARGET")) + len(os.Getenv("GOOGLE_CLOUD_PROJECT"))))
 
+// backgroundLogger returns a logger for the messages of the toolkit which aren't part of a request, e.g. failures of background exports
+func backgroundLogger() *zerolog.Logger {
+	logger := zerolog.New(logOutput(context.Background())).With().Timestamp().Logger()
+	return &logger
+}
+
 type FunctionContext struct {
 	Context         context.Context
 	SpanId          string
+	TraceId         string
+	RequestId       string
 	spanIdLogField  string
 	Logger          *zerolog.Logger
 	Response        http.ResponseWriter
 	Request         *http.Request
 	stackFrameLevel int
+	skipErrorReport bool
+	state           *requestState
+}
+
+// requestState holds the data of a request which is shared between every copy of its FunctionContext
+type requestState struct {
+	start     time.Time
+	coldStart bool
+	trace     traceContext
+	span      oteltrace.Span
+	// cancel releases the timer of the request's deadline
+	cancel context.CancelFunc
+	// inFlight is true for requests counted by InFlightRequests until their response is finished
+	inFlight bool
+
+	body           []byte
+	bodyRead       bool
+	bodyErr        error
+	requestCapture *captureBuffer
+
+	principal *Principal
+	// event is the CloudEvent of contexts created by EventCtx
+	event *event.Event
+	// job is the Cloud Run Jobs task of contexts created by JobCtx
+	job         *JobInfo
+	checkpoints []func(ctx FunctionContext) error
+	retryable   bool
+	logBuffer   *logBuffer
+	writer      *trackingWriter
+	mutex       sync.Mutex
+	hooks       []func(status int, bytes int, err error)
+	// returnHooks are run when the handler given to Handle returns
+	returnHooks []func()
+	err         error
+	finished    bool
 }
 
 // ErrorResponseStruct used internally to return data in an invalid json response. Exported to allow for manually building responses
 type ErrorResponseStruct struct {
-	SpanId  string `json:"spanId"`
+	SpanId  string        `json:"spanId"`
+	Message string        `json:"message,omitempty"`
+	Details []ErrorDetail `json:"details,omitempty"`
+	// Retryable is true when the request can be retried, after the delay in the Retry-After header
+	Retryable bool `json:"retryable,omitempty"`
+}
+
+// ErrorDetail describes a single problem with the request, e.g. a field which failed validation
+type ErrorDetail struct {
+	Field   string `json:"field,omitempty"`
+	Code    string `json:"code,omitempty"`
 	Message string `json:"message,omitempty"`
 }
 
 // SuccessResponseStruct used internally to return data in a successful json response. Exported to allow for manually building responses
 type SuccessResponseStruct struct {
-	SpanId string      `json:"spanId"`
-	Data   interface{} `json:"data,omitempty"`
+	SpanId string        `json:"spanId"`
+	Data   interface{}   `json:"data,omitempty"`
+	Meta   *ResponseMeta `json:"meta,omitempty"`
 }
 
 // FuncCtx Creates a context from the given request reader and response writer. Generates a new span id and context.Context from the request.
+// The request's trace is read from its traceparent or X-Cloud-Trace-Context header, or a new trace is started.
+// The request id is read from the X-Request-ID header, or generated, and is sent back in the same header
 func FuncCtx(w http.ResponseWriter, r *http.Request) FunctionContext {
-	spanId := shortid.MustGenerate()
+	return newFuncCtx(w, r, shortid.MustGenerate())
+}
+
+// newFuncCtx creates the context of a request with the given span id
+func newFuncCtx(w http.ResponseWriter, r *http.Request, spanId string) FunctionContext {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 
-	logger := zerolog.New(os.Stdout).With().Timestamp().Str("spanId", "["+spanId+"]").Logger()
-	if isLocalDeployment {
-		logger = logger.Output(zerolog.ConsoleWriter{
-			Out:           os.Stdout,
-			PartsOrder:    []string{zerolog.TimestampFieldName, zerolog.LevelFieldName, "spanId", zerolog.CallerFieldName, zerolog.MessageFieldName},
-			FieldsExclude: []string{"spanId"},
-		})
+	cold, initDuration := claimColdStart()
+	trace := parseTrace(r)
+	trace.requestId = requestId(r)
+	requestContext := context.WithValue(r.Context(), traceContextKey{}, trace)
+	var span oteltrace.Span
+	if config.TracerProvider != nil {
+		requestContext, span = startServerSpan(r.WithContext(requestContext))
+		trace = traceFromSpan(requestContext, trace)
+		annotateColdStart(span, cold)
 	}
 
+	output := logOutput(requestContext)
+	var buffer *logBuffer
+	if config.LogBuffering != nil {
+		buffer = &logBuffer{out: output, maxEntries: config.LogBuffering.MaxEntries}
+		output = buffer
+	}
+	loggerContext := zerolog.New(output).With().Timestamp().Str("spanId", "["+spanId+"]")
+	if cold {
+		loggerContext = loggerContext.Bool("coldStart", true).Float64("initDurationMs", float64(initDuration.Microseconds())/1000)
+	}
+	loggerContext = loggerContext.Str("requestId", trace.requestId)
+	cancel := context.CancelFunc(func() {})
+	if config.Timeout > 0 {
+		requestContext, cancel = context.WithTimeout(requestContext, config.Timeout)
+	}
+	//  With OpenTelemetry enabled, the ids of the active span are added to every log message instead
+	if config.GcpLogFormat && config.TracerProvider == nil {
+		if project := projectId(); project != "" {
+			loggerContext = loggerContext.Str("logging.googleapis.com/trace", "projects/"+project+"/traces/"+trace.traceId)
+		}
+		if trace.spanId != "" {
+			loggerContext = loggerContext.Str("logging.googleapis.com/spanId", trace.spanId)
+		}
+		loggerContext = loggerContext.Bool("logging.googleapis.com/trace_sampled", trace.sampled)
+	}
+	//  The span id prefix isn't needed locally where it's printed by the console writer, or in the GCP format where entries are grouped by trace
 	var spanIdLogField = "[" + spanId + "] "
-	if isLocalDeployment {
+	if isLocalDeployment || config.GcpLogFormat {
 		spanIdLogField = ""
 	}
+	logger := loggerContext.Logger()
+	if config.LogSampling != nil {
+		logger = logger.Hook(samplingHook{sampling: config.LogSampling, prefix: spanIdLogField})
+	}
 
-	return FunctionContext{
+	writer := &trackingWriter{ResponseWriter: w}
+	lifecycle.inFlight.Add(1)
+	ctx := FunctionContext{
 		SpanId:          spanId,
+		TraceId:         trace.traceId,
+		RequestId:       trace.requestId,
 		spanIdLogField:  spanIdLogField,
 		Logger:          &logger,
-		Response:        w,
+		Response:        writer,
 		Request:         r,
-		Context:         r.Context(),
+		Context:         requestContext,
 		stackFrameLevel: 1,
+		state:           &requestState{writer: writer, start: time.Now(), coldStart: cold, trace: trace, span: span, logBuffer: buffer, cancel: cancel, inFlight: true},
 	}
+	writer.Header().Set(RequestIdHeader, trace.requestId)
+	if config.AccessLog != nil {
+		ctx.startAccessLog()
+	}
+	if config.CORS != nil {
+		ctx.applyCORS()
+	}
+	//  Requests which never write a response through the ctx stop being in flight when the server ends them
+	context.AfterFunc(r.Context(), func() {
+		ctx.state.mutex.Lock()
+		defer ctx.state.mutex.Unlock()
+		ctx.state.leave()
+	})
+	if config.Timeout > 0 {
+		//  From here on the handler sets headers on its own map, the timeout response only has the headers set above
+		writer.header = w.Header().Clone()
+	}
+	return ctx
+}
+
+// logOutput builds the writer the logs of a request are written to. Unless a writer has been set with WithLogWriter, the entries are written to stdout,
+// and printed by a console writer instead of as json when running locally. A slog handler set with WithSlogHandler gets the context of the request
+func logOutput(ctx context.Context) io.Writer {
+	if writer, ok := config.LogWriter.(slogWriter); ok {
+		writer.ctx = ctx
+		return redactingWriter{out: writer}
+	}
+	if config.LogWriter != nil {
+		return redactingWriter{out: config.LogWriter}
+	}
+	var out io.Writer = os.Stdout
+	if isLocalDeployment {
+		out = zerolog.ConsoleWriter{
+			Out:           os.Stdout,
+			PartsOrder:    []string{zerolog.TimestampFieldName, zerolog.LevelFieldName, "spanId", zerolog.CallerFieldName, zerolog.MessageFieldName},
+			FieldsExclude: []string{"spanId"},
+		}
+	}
+	return redactingWriter{out: out}
 }
 
 // WithCtx generates a copy of this ctx object with the given `context.Context` as its context.
 func (this FunctionContext) WithCtx(ctx context.Context) FunctionContext {
 	return FunctionContext{
-		SpanId:   this.SpanId,
-		Logger:   this.Logger,
-		Response: this.Response,
-		Request:  this.Request,
-		Context:  ctx,
+		SpanId:    this.SpanId,
+		TraceId:   this.TraceId,
+		RequestId: this.RequestId,
+		Logger:    this.Logger,
+		Response:  this.Response,
+		Request:   this.Request,
+		Context:   ctx,
 
 		spanIdLogField:  this.spanIdLogField,
 		stackFrameLevel: 1,
+		state:           this.state,
+	}
+}
+
+// WithFields generates a copy of this ctx object whose log messages include the given fields
+func (this FunctionContext) WithFields(fields map[string]interface{}) FunctionContext {
+	logger := this.Logger.With().Fields(fields).Logger()
+	this.Logger = &logger
+	return this
+}
+
+// WithField generates a copy of this ctx object whose log messages include the given field
+func (this FunctionContext) WithField(key string, value interface{}) FunctionContext {
+	logger := this.Logger.With().Interface(key, value).Logger()
+	this.Logger = &logger
+	return this
+}
+
+// Component generates a copy of this ctx object whose log messages carry a `component` field with the given name, e.g. `ctx.Component("billing")`.
+// If a level is given, the messages of the component below it are dropped, so the verbosity of noisy subsystems can be tuned independently
+func (this FunctionContext) Component(name string, level ...int) FunctionContext {
+	logger := this.Logger.With().Str("component", name).Logger()
+	if len(level) > 0 {
+		logger = logger.Level(zerologLevel(level[0]))
+	}
+	this.Logger = &logger
+	return this
+}
+
+// WithCallerSkip generates a copy of this ctx object whose log messages are attributed to the code `frames` stack frames further up the call stack.
+// Use it in your own logging helpers so the messages point at the code calling the helper, e.g. `ctx.WithCallerSkip(1).Info(message)`
+func (this FunctionContext) WithCallerSkip(frames int) FunctionContext {
+	return this.withSkip(frames)
+}
+
+// event adds the context and the location of the code which called the logging method to the log event
+func (this FunctionContext) event(e *zerolog.Event) *zerolog.Event {
+	//  zerolog returns a nil event when the level is disabled
+	if e == nil {
+		return nil
+	}
+	e = e.Ctx(this.Context)
+	if config.TracerProvider != nil {
+		e = this.spanEvent(e)
+	}
+	if config.DisableCaller {
+		return e
+	}
+	if !config.GcpLogFormat {
+		return e.Caller(this.stackFrameLevel + 1)
 	}
+	pc, file, line, ok := runtime.Caller(this.stackFrameLevel + 1)
+	if !ok {
+		return e
+	}
+	location := zerolog.Dict().Str("file", file).Str("line", strconv.Itoa(line))
+	if function := runtime.FuncForPC(pc); function != nil {
+		location = location.Str("function", function.Name())
+	}
+	return e.Dict("logging.googleapis.com/sourceLocation", location)
 }
 
 // Info logs a message to the console at the INFO level
 func (this FunctionContext) Info(message string) {
-	this.Logger.Info().Ctx(this.Context).Caller(this.stackFrameLevel).Msg(this.spanIdLogField + message)
+	this.event(this.Logger.Info()).Msg(this.spanIdLogField + message)
 }
 
 // Warn logs a message to the console at the WARN level
 func (this FunctionContext) Warn(message string) {
-	this.Logger.Warn().Ctx(this.Context).Caller(this.stackFrameLevel).Msg(this.spanIdLogField + message)
+	this.event(this.Logger.Warn()).Msg(this.spanIdLogField + message)
 }
 
 // Error logs a message to the console at the ERROR level
 func (this FunctionContext) Error(message string) {
-	this.Logger.Error().Ctx(this.Context).Caller(this.stackFrameLevel).Msg(this.spanIdLogField + message)
+	this.event(this.reportError(this.Logger.Error(), nil, message)).Msg(this.spanIdLogField + message)
 }
 
 // Debug logs a message to the console at the DEBUG level
 func (this FunctionContext) Debug(message string) {
-	this.Logger.Debug().Ctx(this.Context).Caller(this.stackFrameLevel).Msg(this.spanIdLogField + message)
+	this.event(this.Logger.Debug()).Msg(this.spanIdLogField + message)
 }
 
-// Log logs a message to the console at the given log level
+// Log logs a message to the console at the given log level. The FATAL and PANIC levels only log the message, use Fatal or Panic to also abort the handler
 func (this FunctionContext) Log(level int, message string) {
 	var e *zerolog.Event
 	switch level {
@@ -119,10 +327,19 @@ func (this FunctionContext) Log(level int, message string) {
 	case LogLevelError:
 		e = this.Logger.Error()
 		break
+	case LogLevelFatal:
+		e = this.Logger.WithLevel(zerolog.FatalLevel)
+		break
+	case LogLevelPanic:
+		e = this.Logger.WithLevel(zerolog.PanicLevel)
+		break
 	default:
 		e = this.Logger.Debug()
 	}
-	e.Ctx(this.Context).Caller(this.stackFrameLevel).Msg(this.spanIdLogField + message)
+	if level >= LogLevelError {
+		e = this.reportError(e, nil, message)
+	}
+	this.event(e).Msg(this.spanIdLogField + message)
 }
 
 // Logf Formats a message with the given format and logs it to the console at the given log level
@@ -141,28 +358,121 @@ func (this FunctionContext) Logf(level int, format string, args ...interface{})
 	case LogLevelError:
 		e = this.Logger.Error()
 		break
+	case LogLevelFatal:
+		e = this.Logger.WithLevel(zerolog.FatalLevel)
+		break
+	case LogLevelPanic:
+		e = this.Logger.WithLevel(zerolog.PanicLevel)
+		break
 	default:
 		e = this.Logger.Debug()
 	}
-	e.Ctx(this.Context).Caller(this.stackFrameLevel).Msgf(this.spanIdLogField+format, args...)
+	message := fmt.Sprintf(format, args...)
+	if level >= LogLevelError {
+		e = this.reportError(e, nil, message)
+	}
+	this.event(e).Msg(this.spanIdLogField + message)
 }
 
 // Infof Formats a message with the given format and logs it to the console at the INFO level
 func (this FunctionContext) Infof(format string, args ...interface{}) {
-	this.Logger.Info().Ctx(this.Context).Caller(this.stackFrameLevel).Msgf(this.spanIdLogField+format, args...)
+	this.event(this.Logger.Info()).Msgf(this.spanIdLogField+format, args...)
 }
 
 // Warnf Formats a message with the given format and logs it to the console at the WARN level
 func (this FunctionContext) Warnf(format string, args ...interface{}) {
-	this.Logger.Warn().Ctx(this.Context).Caller(this.stackFrameLevel).Msgf(this.spanIdLogField+format, args...)
+	this.event(this.Logger.Warn()).Msgf(this.spanIdLogField+format, args...)
 }
 
 // Errorf Formats a message with the given format and logs it to the console at the ERROR level
 func (this FunctionContext) Errorf(format string, args ...interface{}) {
-	this.Logger.Error().Ctx(this.Context).Caller(this.stackFrameLevel).Msgf(this.spanIdLogField+format, args...)
+	message := fmt.Sprintf(format, args...)
+	this.event(this.reportError(this.Logger.Error(), nil, message)).Msg(this.spanIdLogField + message)
 }
 
 // Debugf Formats a message with the given format and logs it to the console at the DEBUG level
 func (this FunctionContext) Debugf(format string, args ...interface{}) {
-	this.Logger.Debug().Ctx(this.Context).Caller(this.stackFrameLevel).Msgf(this.spanIdLogField+format, args...)
+	this.event(this.Logger.Debug()).Msgf(this.spanIdLogField+format, args...)
+}
+
+// Fatal logs a message to the console at the FATAL level and aborts the handler. Unlike zerolog's Fatal it doesn't exit the process, which would kill the other
+// requests being handled by the instance. Instead the buffered logs are written, a 500 response is sent if no response has been written yet,
+// and the handler is stopped by panicking with http.ErrAbortHandler, which the http server recovers from silently
+func (this FunctionContext) Fatal(message string) {
+	this.event(this.reportError(this.Logger.WithLevel(zerolog.FatalLevel), nil, message)).Msg(this.spanIdLogField + message)
+	this.abort(errors.New(message))
+}
+
+// Fatalf Formats a message with the given format, logs it to the console at the FATAL level and aborts the handler like Fatal
+func (this FunctionContext) Fatalf(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	this.event(this.reportError(this.Logger.WithLevel(zerolog.FatalLevel), nil, message)).Msg(this.spanIdLogField + message)
+	this.abort(errors.New(message))
+}
+
+// Panic logs a message to the console at the PANIC level, then panics with the message
+func (this FunctionContext) Panic(message string) {
+	this.event(this.Logger.WithLevel(zerolog.PanicLevel)).Msg(this.spanIdLogField + message)
+	panic(message)
+}
+
+// Panicf Formats a message with the given format, logs it to the console at the PANIC level, then panics with the formatted message
+func (this FunctionContext) Panicf(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	this.event(this.Logger.WithLevel(zerolog.PanicLevel)).Msg(this.spanIdLogField + message)
+	panic(message)
+}
+
+// abort finishes the request with a 500 response, unless a response has already been written, and stops the handler
+func (this FunctionContext) abort(err error) {
+	this.state.err = err
+	if !this.state.writer.hasWritten() {
+		this.writeError(http.StatusInternalServerError, "Internal server error", nil)
+	} else {
+		this.finishResponse(err)
+	}
+	panic(http.ErrAbortHandler)
+}
+
+// DebugFn logs the message returned by the function at the DEBUG level. The function is only called if the DEBUG level is enabled,
+// so expensive messages (e.g. payload dumps) aren't built for nothing
+func (this FunctionContext) DebugFn(message func() string) {
+	if e := this.event(this.Logger.Debug()); e != nil {
+		e.Msg(this.spanIdLogField + message())
+	}
+}
+
+// InfoFn logs the message returned by the function at the INFO level, only calling it if the INFO level is enabled
+func (this FunctionContext) InfoFn(message func() string) {
+	if e := this.event(this.Logger.Info()); e != nil {
+		e.Msg(this.spanIdLogField + message())
+	}
+}
+
+// WarnFn logs the message returned by the function at the WARN level, only calling it if the WARN level is enabled
+func (this FunctionContext) WarnFn(message func() string) {
+	if e := this.event(this.Logger.Warn()); e != nil {
+		e.Msg(this.spanIdLogField + message())
+	}
+}
+
+// DebugEvent returns a zerolog event at the DEBUG level with the fields of this ctx, to add fields to before sending it with Msg, e.g. `ctx.DebugEvent().Int("count", n).Msg("Loaded")`.
+// The event is nil, and adding fields to it does nothing, if the level is disabled. The message isn't prefixed with the span id, which is only in the `spanId` field
+func (this FunctionContext) DebugEvent() *zerolog.Event {
+	return this.event(this.Logger.Debug())
+}
+
+// InfoEvent returns a zerolog event at the INFO level with the fields of this ctx, like DebugEvent
+func (this FunctionContext) InfoEvent() *zerolog.Event {
+	return this.event(this.Logger.Info())
+}
+
+// WarnEvent returns a zerolog event at the WARN level with the fields of this ctx, like DebugEvent
+func (this FunctionContext) WarnEvent() *zerolog.Event {
+	return this.event(this.Logger.Warn())
+}
+
+// ErrorEvent returns a zerolog event at the ERROR level with the fields of this ctx, like DebugEvent. The event isn't sent to Error Reporting
+func (this FunctionContext) ErrorEvent() *zerolog.Event {
+	return this.event(this.Logger.Error())
 }
@@ -0,0 +1,210 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metadataUrl returns the address of the GCP metadata server, which can be overridden with the GCE_METADATA_HOST environment variable
+func metadataUrl() string {
+	host := os.Getenv("GCE_METADATA_HOST")
+	if host == "" {
+		host = "metadata.google.internal"
+	}
+	return "http://" + host + "/computeMetadata/v1/"
+}
+
+// metadata reads the given path from the GCP metadata server
+func metadata(ctx context.Context, path string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	rq, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataUrl()+path, nil)
+	if err != nil {
+		return "", err
+	}
+	rq.Header.Set("Metadata-Flavor", "Google")
+	res, err := http.DefaultClient.Do(rq)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", &httpStatusError{status: res.StatusCode, body: string(body)}
+	}
+	return string(body), nil
+}
+
+// httpStatusError is returned by the toolkit's API clients when a call returns an unexpected status code
+type httpStatusError struct {
+	status int
+	body   string
+}
+
+func (this *httpStatusError) Error() string {
+	return "unexpected status " + http.StatusText(this.status) + ": " + strings.TrimSpace(this.body)
+}
+
+var metadataProject struct {
+	once sync.Once
+	id   string
+}
+
+// projectId returns the id of the GCP project the function runs in, from the environment or the metadata server. Returns an empty string if it's unknown
+func projectId() string {
+	for _, name := range []string{"GOOGLE_CLOUD_PROJECT", "GCP_PROJECT", "GCLOUD_PROJECT"} {
+		if id := os.Getenv(name); id != "" {
+			return id
+		}
+	}
+	if isLocalDeployment {
+		return ""
+	}
+	metadataProject.once.Do(func() {
+		metadataProject.id, _ = metadata(context.Background(), "project/project-id")
+	})
+	return metadataProject.id
+}
+
+var metadataToken struct {
+	mutex  sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// accessToken returns an OAuth2 access token of the function's service account, from the metadata server.
+// The token is cached until shortly before it expires
+func accessToken(ctx context.Context) (string, error) {
+	metadataToken.mutex.Lock()
+	defer metadataToken.mutex.Unlock()
+	if metadataToken.token != "" && time.Now().Before(metadataToken.expiry) {
+		return metadataToken.token, nil
+	}
+	body, err := metadata(ctx, "instance/service-accounts/default/token")
+	if err != nil {
+		return "", err
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal([]byte(body), &token); err != nil {
+		return "", err
+	}
+	metadataToken.token = token.AccessToken
+	metadataToken.expiry = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return token.AccessToken, nil
+}
+
+var identityTokens struct {
+	mutex  sync.Mutex
+	tokens map[string]cachedToken
+}
+
+type cachedToken struct {
+	token  string
+	expiry time.Time
+}
+
+// identityToken returns a Google-signed OIDC identity token of the function's service account for the audience, from the metadata server.
+// Tokens are cached per audience until shortly before they expire
+func identityToken(ctx context.Context, audience string) (string, error) {
+	identityTokens.mutex.Lock()
+	defer identityTokens.mutex.Unlock()
+	if cached, ok := identityTokens.tokens[audience]; ok && time.Now().Before(cached.expiry) {
+		return cached.token, nil
+	}
+	token, err := metadata(ctx, "instance/service-accounts/default/identity?format=full&audience="+url.QueryEscape(audience))
+	if err != nil {
+		return "", err
+	}
+	expiry := time.Now().Add(time.Hour)
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if parts := strings.Split(token, "."); len(parts) == 3 && decodeJwtPart(parts[1], &claims) == nil && claims.Exp != 0 {
+		expiry = time.Unix(claims.Exp, 0)
+	}
+	if identityTokens.tokens == nil {
+		identityTokens.tokens = map[string]cachedToken{}
+	}
+	identityTokens.tokens[audience] = cachedToken{token: token, expiry: expiry.Add(-5 * time.Minute)}
+	return token, nil
+}
+
+// googleApi calls a Google Cloud REST API with the function's service account, sending the request object as json and decoding the response into the response object.
+// Either may be nil
+func googleApi(ctx context.Context, method string, url string, request interface{}, response interface{}) error {
+	var body io.Reader
+	if request != nil {
+		encoded, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encoded)
+	}
+	rq, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	token, err := accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	rq.Header.Set("Authorization", "Bearer "+token)
+	if request != nil {
+		rq.Header.Set("Content-Type", "application/json")
+	}
+	res, err := http.DefaultClient.Do(rq)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		message, _ := io.ReadAll(res.Body)
+		return &httpStatusError{status: res.StatusCode, body: string(message)}
+	}
+	if response == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(response)
+}
+
+// secretManagerEndpoint is the address of the Secret Manager API
+const secretManagerEndpoint = "https://secretmanager.googleapis.com"
+
+// secretVersion returns the full name of a Secret Manager secret version. A secret without the `projects/` prefix is a secret of the project the function runs in,
+// and a secret without a version is read at its latest version
+func secretVersion(secret string) string {
+	if !strings.HasPrefix(secret, "projects/") {
+		secret = "projects/" + projectId() + "/secrets/" + secret
+	}
+	if !strings.Contains(secret, "/versions/") {
+		secret += "/versions/latest"
+	}
+	return secret
+}
+
+// accessSecret reads the payload of a Secret Manager secret version with the function's service account
+func accessSecret(ctx context.Context, endpoint string, secret string) ([]byte, error) {
+	var response struct {
+		Payload struct {
+			Data []byte `json:"data"`
+		} `json:"payload"`
+	}
+	if err := googleApi(ctx, http.MethodGet, endpoint+"/v1/"+secretVersion(secret)+":access", nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Payload.Data, nil
+}
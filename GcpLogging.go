@@ -0,0 +1,47 @@
+package toolkit
+
+import (
+	"github.com/rs/zerolog"
+)
+
+// gcpSeverity maps zerolog levels to the severities recognized by Cloud Logging
+func gcpSeverity(level zerolog.Level) string {
+	switch level {
+	case zerolog.TraceLevel, zerolog.DebugLevel:
+		return "DEBUG"
+	case zerolog.InfoLevel:
+		return "INFO"
+	case zerolog.WarnLevel:
+		return "WARNING"
+	case zerolog.ErrorLevel:
+		return "ERROR"
+	case zerolog.FatalLevel:
+		return "CRITICAL"
+	case zerolog.PanicLevel:
+		return "ALERT"
+	default:
+		return "DEFAULT"
+	}
+}
+
+// WithGcpLogFormat enables or disables writing logs in the Cloud Logging structured format, with a `severity` field instead of `level`,
+// and the location of the logging call in `logging.googleapis.com/sourceLocation`. Enabled by default when the function is deployed.
+// Note that this changes the level field of every zerolog logger in the process
+func WithGcpLogFormat(enabled bool) Option {
+	return func(config *Config) {
+		config.GcpLogFormat = enabled
+		if enabled {
+			zerolog.LevelFieldName = "severity"
+			zerolog.LevelFieldMarshalFunc = gcpSeverity
+		} else {
+			zerolog.LevelFieldName = "level"
+			zerolog.LevelFieldMarshalFunc = func(level zerolog.Level) string { return level.String() }
+		}
+	}
+}
+
+func init() {
+	if !isLocalDeployment {
+		Configure(WithGcpLogFormat(true))
+	}
+}
@@ -0,0 +1,77 @@
+package toolkit
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// gitHubReplayRetention is how long RequireGitHubSignature remembers the deliveries it handled, to ignore replays of them
+const gitHubReplayRetention = time.Hour
+
+// GitHubEvent is an event delivered by a GitHub webhook. Bind decodes its payload into the typed event, e.g. a push or pull_request event
+type GitHubEvent struct {
+	// Name is the name of the event, from the X-GitHub-Event header, e.g. `pull_request`
+	Name string
+	// DeliveryId is the id of the delivery, from the X-GitHub-Delivery header. Redeliveries keep the id of the original delivery
+	DeliveryId string
+	HookId     string
+	// Action is the activity which triggered the event, e.g. `opened` for pull_request events. Some events, like push, have none
+	Action  string
+	Payload json.RawMessage
+}
+
+// Bind decodes the payload of the event into the given object
+func (this GitHubEvent) Bind(obj interface{}) error {
+	return codec.Unmarshal(this.Payload, obj)
+}
+
+// RequireGitHubSignature is a middleware which rejects requests with a 401 response unless their X-Hub-Signature-256 header is the signature of the body
+// with the webhook's secret. Deliveries the instance handled successfully in the last hour are acknowledged without running the handler again,
+// so captured requests can't be replayed. The handler gets the event with ctx.GitHubEvent. Panics if the secret is empty
+func RequireGitHubSignature(secret string) Middleware {
+	if secret == "" {
+		panic("RequireGitHubSignature requires the webhook's secret")
+	}
+	deliveries := newDeliveryLog(gitHubReplayRetention)
+	config := HMACConfig{Header: "X-Hub-Signature-256", Secret: secret, Algorithm: sha256.New, Prefix: "sha256="}
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx FunctionContext) error {
+			if err := ctx.VerifyHMACWith(config); err != nil {
+				return err
+			}
+			deliveryId := ctx.Request.Header.Get("X-GitHub-Delivery")
+			ctx = ctx.WithFields(map[string]interface{}{"githubEvent": ctx.Request.Header.Get("X-GitHub-Event"), "githubDelivery": deliveryId})
+			return deliveries.handleOnce(ctx, deliveryId, next)
+		}
+	}
+}
+
+// GitHubEvent returns the event delivered by a GitHub webhook request, whose payload is sent as json or, for webhooks with the
+// `application/x-www-form-urlencoded` content type, in the payload form field. Returns a BadRequest error if the request isn't a GitHub event
+func (this FunctionContext) GitHubEvent() (GitHubEvent, error) {
+	event := GitHubEvent{
+		Name:       this.Request.Header.Get("X-GitHub-Event"),
+		DeliveryId: this.Request.Header.Get("X-GitHub-Delivery"),
+		HookId:     this.Request.Header.Get("X-GitHub-Hook-ID"),
+	}
+	if event.Name == "" {
+		return GitHubEvent{}, BadRequest("Missing X-GitHub-Event header")
+	}
+	body, err := this.RawBody()
+	if err != nil {
+		return GitHubEvent{}, BadRequest("Failed to read request body").WithCause(err)
+	}
+	if strings.HasPrefix(this.Request.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		body = []byte(this.Request.PostFormValue("payload"))
+	}
+	var common struct {
+		Action string `json:"action"`
+	}
+	if err := codec.Unmarshal(body, &common); err != nil {
+		return GitHubEvent{}, BadRequest("Invalid GitHub event payload").WithCause(err)
+	}
+	event.Action, event.Payload = common.Action, body
+	return event, nil
+}
@@ -0,0 +1,79 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// GoogleIDTokenConfig configures how RequireGoogleIDToken verifies the ID tokens of requests
+type GoogleIDTokenConfig struct {
+	// Audience the token must be issued for, usually the url of the function. It's required, as the Host of requests is chosen by the client
+	Audience string
+	// ServiceAccounts are the emails of the service accounts allowed to call the function. It's required unless AllowAnyAccount is set
+	ServiceAccounts []string
+	// AllowAnyAccount accepts the tokens of any Google account when ServiceAccounts is empty, e.g. for handlers which check the caller's email themselves
+	AllowAnyAccount bool
+	// KeysUrl is the address of the keys Google signs ID tokens with
+	KeysUrl string
+}
+
+// RequireGoogleIDToken is a middleware which rejects requests with a 401 response unless they have a Google-signed ID token for the audience,
+// like those sent by other functions, Cloud Scheduler, Cloud Tasks and Pub/Sub push subscriptions. Tokens of other service accounts than the allowed ones get a 403 response.
+// The handler gets a ctx whose principal is the email of the caller, with the token's claims available through ctx.Claims.
+// Panics without an Audience, and without ServiceAccounts unless AllowAnyAccount is set, as anyone with a Google account can get a token
+func RequireGoogleIDToken(google GoogleIDTokenConfig) Middleware {
+	if google.Audience == "" {
+		panic("RequireGoogleIDToken requires an Audience")
+	}
+	if len(google.ServiceAccounts) == 0 && !google.AllowAnyAccount {
+		panic("RequireGoogleIDToken requires ServiceAccounts, or AllowAnyAccount to accept the tokens of any Google account")
+	}
+	if google.KeysUrl == "" {
+		google.KeysUrl = googleCertsUrl
+	}
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx FunctionContext) error {
+			claims, err := ctx.verifyGoogleIdToken(google.Audience, google.KeysUrl)
+			if err != nil {
+				ctx.SetResponseHeader("WWW-Authenticate", "Bearer")
+				return Unauthorized("Invalid Google ID token").WithCause(err)
+			}
+			email, _ := claims["email"].(string)
+			if len(google.ServiceAccounts) > 0 && !slices.Contains(google.ServiceAccounts, email) {
+				return Forbidden("The caller isn't allowed to call this function").WithInternal("token is issued for %v", email)
+			}
+			if email == "" {
+				email, _ = claims["sub"].(string)
+			}
+			return next(ctx.WithPrincipal(email, claims))
+		}
+	}
+}
+
+// VerifyGoogleIDToken verifies the Google-signed ID token of the request's Authorization header, and returns its claims.
+// The token must be issued for the audience, which is required. Any Google account can get a token, so check the `email` claim, which holds the email of service accounts
+func (this FunctionContext) VerifyGoogleIDToken(audience string) (map[string]interface{}, error) {
+	return this.verifyGoogleIdToken(audience, googleCertsUrl)
+}
+
+func (this FunctionContext) verifyGoogleIdToken(audience string, keysUrl string) (map[string]interface{}, error) {
+	token := this.bearerToken()
+	if token == "" {
+		return nil, errors.New("missing ID token")
+	}
+	if audience == "" {
+		return nil, errors.New("no audience to verify the ID token against")
+	}
+	claims, err := verifyJwt(this.Context, token, keySet(keysUrl))
+	if err != nil {
+		return nil, err
+	}
+	if err := validateClaims(claims, googleIssuers, audience); err != nil {
+		return nil, err
+	}
+	if verified, ok := claims["email_verified"].(bool); ok && !verified {
+		return nil, fmt.Errorf("email %v isn't verified", claims["email"])
+	}
+	return claims, nil
+}
@@ -0,0 +1,160 @@
+package toolkit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+)
+
+// graphQLRequest is the body of a GraphQL request, or its query parameters for GET requests
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+type resolverKey struct{}
+
+// GraphQL returns a handler executing the GraphQL queries of POST requests with a json body, and of GET requests with the `query`, `operationName` and `variables` query parameters.
+// Resolvers get the request's ctx with ResolverCtx, and how long every field with a resolver took is logged at the DEBUG level.
+// Errors returned by resolvers are sent with the client message and status (in the `status` extension) of the StatusError they wrap or of their mapping added with MapError,
+// like Handle does, and those with a 5xx status are logged at the ERROR level and sent to the error reporters. Queries which can't be executed get a 400 response
+func GraphQL(schema graphql.Schema) HandlerFunc {
+	schema.AddExtensions(resolverTiming{})
+	return func(ctx FunctionContext) error {
+		var request graphQLRequest
+		switch ctx.Request.Method {
+		case http.MethodGet:
+			query := ctx.Request.URL.Query()
+			request.Query, request.OperationName = query.Get("query"), query.Get("operationName")
+			if variables := query.Get("variables"); variables != "" {
+				if err := codec.Unmarshal([]byte(variables), &request.Variables); err != nil {
+					ctx.FailResponse(http.StatusBadRequest, "Invalid GraphQL variables: "+err.Error())
+					return nil
+				}
+			}
+		case http.MethodPost:
+			if !ctx.BindJson(&request) {
+				return nil
+			}
+		default:
+			ctx.SetResponseHeader("Allow", "GET, POST")
+			ctx.FailResponse(http.StatusMethodNotAllowed, "GraphQL requests must use GET or POST")
+			return nil
+		}
+		if request.Query == "" {
+			ctx.FailResponse(http.StatusBadRequest, "Missing GraphQL query")
+			return nil
+		}
+
+		result := graphql.Do(graphql.Params{
+			Schema:         schema,
+			RequestString:  request.Query,
+			VariableValues: request.Variables,
+			OperationName:  request.OperationName,
+			Context:        context.WithValue(ctx.Context, resolverKey{}, ctx),
+		})
+		for i, formatted := range result.Errors {
+			result.Errors[i] = ctx.mapResolverError(formatted)
+		}
+		status := http.StatusOK
+		if result.Data == nil && result.HasErrors() {
+			status = http.StatusBadRequest
+			ctx.Warnf("Responding with status %v: %v", status, result.Errors[0].Message)
+		} else {
+			ctx.Debugf("Responding with status %v (%v errors)", status, len(result.Errors))
+		}
+		ctx.writeJson(status, result)
+		return nil
+	}
+}
+
+// ResolverCtx returns the ctx of the request a GraphQL resolver runs for, from the context of its graphql.ResolveParams
+func ResolverCtx(ctx context.Context) (FunctionContext, bool) {
+	fctx, ok := ctx.Value(resolverKey{}).(FunctionContext)
+	return fctx, ok
+}
+
+// mapResolverError replaces the message of an error returned by a resolver with its client message, and logs it. Syntax and validation errors are kept as they are
+func (this FunctionContext) mapResolverError(formatted gqlerrors.FormattedError) gqlerrors.FormattedError {
+	located, ok := formatted.OriginalError().(*gqlerrors.Error)
+	if !ok || located.OriginalError == nil {
+		return formatted
+	}
+	err := located.OriginalError
+	status, message := errorStatus(err)
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	if status >= 500 {
+		this.ErrorErrf(err, "Resolver of %v failed", graphQLPath(formatted.Path))
+		this.reportToReporters(err, "Resolver failed", status, false)
+	} else {
+		this.Warnf("Resolver of %v failed with status %v: %v", graphQLPath(formatted.Path), status, err)
+	}
+	extensions := map[string]interface{}{}
+	for name, value := range formatted.Extensions {
+		extensions[name] = value
+	}
+	extensions["status"] = status
+	return gqlerrors.FormattedError{Message: message, Locations: formatted.Locations, Path: formatted.Path, Extensions: extensions}
+}
+
+// graphQLPath formats the path of an error, e.g. `orders.0.total`
+func graphQLPath(path []interface{}) string {
+	segments := make([]string, len(path))
+	for i, segment := range path {
+		segments[i] = fmt.Sprint(segment)
+	}
+	return strings.Join(segments, ".")
+}
+
+// resolverTiming is a GraphQL extension logging how long the fields with a resolver took
+type resolverTiming struct{}
+
+func (resolverTiming) Init(ctx context.Context, _ *graphql.Params) context.Context {
+	return ctx
+}
+
+func (resolverTiming) Name() string {
+	return "toolkitResolverTiming"
+}
+
+func (resolverTiming) ParseDidStart(ctx context.Context) (context.Context, graphql.ParseFinishFunc) {
+	return ctx, func(error) {}
+}
+
+func (resolverTiming) ValidationDidStart(ctx context.Context) (context.Context, graphql.ValidationFinishFunc) {
+	return ctx, func([]gqlerrors.FormattedError) {}
+}
+
+func (resolverTiming) ExecutionDidStart(ctx context.Context) (context.Context, graphql.ExecutionFinishFunc) {
+	return ctx, func(*graphql.Result) {}
+}
+
+func (resolverTiming) ResolveFieldDidStart(ctx context.Context, info *graphql.ResolveInfo) (context.Context, graphql.ResolveFieldFinishFunc) {
+	fctx, ok := ResolverCtx(ctx)
+	parent, isObject := info.ParentType.(*graphql.Object)
+	if !ok || !isObject || parent.Fields()[info.FieldName] == nil || parent.Fields()[info.FieldName].Resolve == nil {
+		return ctx, func(interface{}, error) {}
+	}
+	start := time.Now()
+	resolver := parent.Name() + "." + info.FieldName
+	return ctx, func(interface{}, error) {
+		duration := time.Since(start)
+		fctx.event(fctx.Logger.Debug()).Str("resolver", resolver).Dur("duration", duration).Msgf(fctx.spanIdLogField+"Resolved %v in %v", resolver, duration)
+	}
+}
+
+func (resolverTiming) HasResult() bool {
+	return false
+}
+
+func (resolverTiming) GetResult(context.Context) interface{} {
+	return nil
+}
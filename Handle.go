@@ -0,0 +1,112 @@
+package toolkit
+
+import (
+	"errors"
+	"net/http"
+)
+
+// StatusError is implemented by errors which carry the status code and message of the error response they should be sent as
+type StatusError interface {
+	error
+	// StatusCode is the status code of the response
+	StatusCode() int
+	// ClientMessage is the message sent to the client. Unlike Error, it mustn't contain internal details
+	ClientMessage() string
+}
+
+// Handle adapts a handler which returns an error into an http.HandlerFunc. The ctx is created with FuncCtx, and a returned error is sent with ErrResponse,
+// with the status, message and details of the StatusError it wraps (e.g. one created with NotFound) or of its mapping added with MapError, or a 500 status otherwise. A nil return which didn't write a response gets an empty 200 json response.
+// Panics are recovered with Recover, warmup requests are answered by RespondToWarmup, and requests arriving once the instance is shutting down get a 503 response.
+// If the deadline set with WithTimeout passes before the handler writes a response, a 504 response is sent
+func Handle(handler HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := FuncCtx(w, r)
+		defer ctx.state.cancel()
+		defer ctx.watchTimeout()()
+		defer ctx.runReturnHooks()
+		defer ctx.Recover()
+		if ShuttingDown() {
+			ctx.SetResponseHeader("Connection", "close")
+			ctx.FailResponse(http.StatusServiceUnavailable, "The service is shutting down")
+			return
+		}
+		if ctx.RespondToWarmup() {
+			return
+		}
+		ctx.finishHandler(handler(ctx))
+	}
+}
+
+// onReturn registers a function run when the handler given to Handle returns, or panics, e.g. to stop the background writes of a stream it didn't close
+func (this FunctionContext) onReturn(hook func()) {
+	this.state.mutex.Lock()
+	defer this.state.mutex.Unlock()
+	this.state.returnHooks = append(this.state.returnHooks, hook)
+}
+
+// runReturnHooks runs the functions registered with onReturn, after Recover has sent the response of a panic
+func (this FunctionContext) runReturnHooks() {
+	this.state.mutex.Lock()
+	hooks := this.state.returnHooks
+	this.state.mutex.Unlock()
+	for _, hook := range hooks {
+		hook()
+	}
+}
+
+// finishHandler sends the response for the error returned by a handler, unless the handler has already written one
+func (this FunctionContext) finishHandler(err error) {
+	written := this.state.writer.hasWritten()
+	if err == nil && !written {
+		err = this.timedOut()
+	}
+	switch {
+	case err == nil && !written:
+		this.OkResponseJson(nil)
+	case err != nil && written && this.state.writer.hasTimedOut():
+		this.Debugf("Handler returned after the request timed out: %v", err)
+	case err != nil && written:
+		this.ErrorErr(err, "Handler failed after writing the response")
+	case err != nil:
+		code, message := errorStatus(err)
+		this.ErrResponse(code, err, message)
+	}
+}
+
+// ClientMessage returns the message of the error which is safe to send to clients: the client message of the StatusError it wraps, or the message of its mapping
+// added with MapError. Other errors may contain internal details like SQL queries or hostnames, so an empty string is returned for them
+func ClientMessage(err error) string {
+	var statusErr StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.ClientMessage()
+	}
+	if _, message, ok := mappedStatus(err); ok {
+		return message
+	}
+	return ""
+}
+
+// ErrorStatus returns the status code and client message of the response an error is sent as by Handle and ErrResponse.
+// Useful for adapters which send errors over other protocols, like gRPC
+func ErrorStatus(err error) (int, string) {
+	return errorStatus(err)
+}
+
+// errorStatus returns the status code and client message of the response an error is sent as: those of the StatusError it wraps,
+// then of the first mapping added with MapError which matches it, then 504 for expired deadlines, and 500 otherwise
+func errorStatus(err error) (int, string) {
+	var statusErr StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode(), statusErr.ClientMessage()
+	}
+	if code, message, ok := mappedStatus(err); ok {
+		return code, message
+	}
+	if code, message, ok := timeoutStatus(err); ok {
+		return code, message
+	}
+	if _, ok := RetryAfter(err); ok {
+		return http.StatusServiceUnavailable, http.StatusText(http.StatusServiceUnavailable)
+	}
+	return http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)
+}
@@ -0,0 +1,113 @@
+package toolkit
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Header returns the value of the given request header, or an empty string if it isn't set
+func (this FunctionContext) Header(name string) string {
+	return this.Request.Header.Get(name)
+}
+
+// ClientIP returns the address of the client which sent the request. Cloud Functions and Cloud Run append it to the X-Forwarded-For header,
+// so it's the last address of the header which isn't one of the proxies set with WithTrustedProxies, as the ones before it are sent by the client and can't be trusted.
+// Without the header it's the address of the connection
+func (this FunctionContext) ClientIP() string {
+	var addresses []string
+	for _, value := range this.Request.Header.Values("X-Forwarded-For") {
+		for _, address := range strings.Split(value, ",") {
+			if address = strings.TrimSpace(address); address != "" {
+				addresses = append(addresses, address)
+			}
+		}
+	}
+	for i := len(addresses) - 1; i >= 0; i-- {
+		if !isTrustedProxy(addresses[i]) || i == 0 {
+			return addresses[i]
+		}
+	}
+	host, _, err := net.SplitHostPort(this.Request.RemoteAddr)
+	if err != nil {
+		return this.Request.RemoteAddr
+	}
+	return host
+}
+
+// isTrustedProxy returns true if the address is in one of the TrustedProxies
+func isTrustedProxy(address string) bool {
+	ip, err := netip.ParseAddr(address)
+	return err == nil && prefixesContain(config.TrustedProxies, ip)
+}
+
+// RequireHeader returns the value of the given request header.
+// If the header is missing a 400 response is sent, and false is returned. The handler should return without writing anything else in that case
+func (this FunctionContext) RequireHeader(name string) (string, bool) {
+	value := this.Request.Header.Get(name)
+	if value == "" {
+		this.withSkip(1).FailResponse(http.StatusBadRequest, "Missing required header "+name)
+		return "", false
+	}
+	return value, true
+}
+
+// RequireHeaderInt parses the given request header as an integer.
+// If the header is missing or isn't a valid integer a 400 response is sent, and false is returned
+func (this FunctionContext) RequireHeaderInt(name string) (int, bool) {
+	value, ok := this.withSkip(1).RequireHeader(name)
+	if !ok {
+		return 0, false
+	}
+	return this.withSkip(1).parseHeaderInt(name, value)
+}
+
+// RequireHeaderBool parses the given request header as a boolean (accepts the values supported by strconv.ParseBool).
+// If the header is missing or isn't a valid boolean a 400 response is sent, and false is returned
+func (this FunctionContext) RequireHeaderBool(name string) (bool, bool) {
+	value, ok := this.withSkip(1).RequireHeader(name)
+	if !ok {
+		return false, false
+	}
+	return this.withSkip(1).parseHeaderBool(name, value)
+}
+
+// HeaderInt parses the given request header as an integer, returning def if the header isn't set.
+// If the header is set but isn't a valid integer a 400 response is sent, and false is returned
+func (this FunctionContext) HeaderInt(name string, def int) (int, bool) {
+	value := this.Request.Header.Get(name)
+	if value == "" {
+		return def, true
+	}
+	return this.withSkip(1).parseHeaderInt(name, value)
+}
+
+// HeaderBool parses the given request header as a boolean, returning def if the header isn't set.
+// If the header is set but isn't a valid boolean a 400 response is sent, and false is returned
+func (this FunctionContext) HeaderBool(name string, def bool) (bool, bool) {
+	value := this.Request.Header.Get(name)
+	if value == "" {
+		return def, true
+	}
+	return this.withSkip(1).parseHeaderBool(name, value)
+}
+
+func (this FunctionContext) parseHeaderInt(name string, value string) (int, bool) {
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		this.withSkip(1).FailResponse(http.StatusBadRequest, "Header "+name+" must be an integer")
+		return 0, false
+	}
+	return parsed, true
+}
+
+func (this FunctionContext) parseHeaderBool(name string, value string) (bool, bool) {
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		this.withSkip(1).FailResponse(http.StatusBadRequest, "Header "+name+" must be a boolean")
+		return false, false
+	}
+	return parsed, true
+}
@@ -0,0 +1,152 @@
+package toolkit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HealthCheck checks a dependency of the function, e.g. by pinging the database. It should return quickly, and respect the context's deadline
+type HealthCheck func(ctx context.Context) error
+
+// HealthCheckTimeout is how long the checks of a health request may take in total
+var HealthCheckTimeout = 5 * time.Second
+
+// HealthReport is the body of health responses. Exported to allow for decoding the responses
+type HealthReport struct {
+	// Status is "ok" when every check passed, "fail" otherwise, or "shutting_down" for readiness requests once the instance is shutting down
+	Status string                       `json:"status"`
+	Checks map[string]HealthCheckResult `json:"checks,omitempty"`
+}
+
+// HealthCheckResult is the outcome of a single check. The error isn't included, as health endpoints are usually public, it's logged instead
+type HealthCheckResult struct {
+	Status     string  `json:"status"`
+	DurationMs float64 `json:"durationMs"`
+}
+
+type namedHealthCheck struct {
+	name  string
+	check HealthCheck
+}
+
+var healthChecks struct {
+	mutex     sync.Mutex
+	liveness  []namedHealthCheck
+	readiness []namedHealthCheck
+}
+
+// AddLivenessCheck registers a check which fails the liveness and readiness probes, so the instance is restarted when it fails.
+// Only use it for problems a restart fixes, e.g. a deadlocked worker, not for unavailable dependencies
+func AddLivenessCheck(name string, check HealthCheck) {
+	healthChecks.mutex.Lock()
+	defer healthChecks.mutex.Unlock()
+	healthChecks.liveness = append(healthChecks.liveness, namedHealthCheck{name: name, check: check})
+}
+
+// AddReadinessCheck registers a check which fails the readiness probe, so no requests are sent to the instance while it fails, e.g. a database ping
+func AddReadinessCheck(name string, check HealthCheck) {
+	healthChecks.mutex.Lock()
+	defer healthChecks.mutex.Unlock()
+	healthChecks.readiness = append(healthChecks.readiness, namedHealthCheck{name: name, check: check})
+}
+
+// ResetHealthChecks removes every registered check. Used in tests
+func ResetHealthChecks() {
+	healthChecks.mutex.Lock()
+	defer healthChecks.mutex.Unlock()
+	healthChecks.liveness = nil
+	healthChecks.readiness = nil
+}
+
+// HealthHandler returns a handler for health probes and uptime checks. Requests whose path ends with /live or /livez run the liveness checks,
+// every other request runs the liveness and readiness checks. Responds with a HealthReport and a 200 status if every check passed, 503 otherwise.
+// Mount it on a prefix, e.g. `http.Handle("/health/", tk.HealthHandler())` to serve /health/live and /health/ready
+func HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimSuffix(r.URL.Path, "/")
+		liveness := strings.HasSuffix(path, "/live") || strings.HasSuffix(path, "/livez")
+
+		healthChecks.mutex.Lock()
+		checks := append([]namedHealthCheck(nil), healthChecks.liveness...)
+		if !liveness {
+			checks = append(checks, healthChecks.readiness...)
+		}
+		healthChecks.mutex.Unlock()
+
+		report := runHealthChecks(r.Context(), checks)
+		if !liveness && ShuttingDown() {
+			report.Status = "shutting_down"
+		}
+		status := http.StatusOK
+		if report.Status != "ok" {
+			status = http.StatusServiceUnavailable
+		}
+		body, err := codec.Marshal(report)
+		if err != nil {
+			backgroundLogger().Error().Err(err).Msg("Failed to serialize health report")
+			status = http.StatusInternalServerError
+		}
+		w.Header().Set("Content-Type", jsonContentType)
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		_, _ = w.Write(body)
+	})
+}
+
+// runHealthChecks runs the checks concurrently and collects their results. Failed checks, and checks which didn't complete in time, are logged at the WARN level
+func runHealthChecks(ctx context.Context, checks []namedHealthCheck) HealthReport {
+	ctx, cancel := context.WithTimeout(ctx, HealthCheckTimeout)
+	defer cancel()
+	type outcome struct {
+		name     string
+		err      error
+		duration time.Duration
+	}
+	//  Buffered, so checks which ignore the deadline don't block forever once the results are no longer collected
+	outcomes := make(chan outcome, len(checks))
+	start := time.Now()
+	for _, check := range checks {
+		go func(check namedHealthCheck) {
+			err := runHealthCheck(ctx, check.check)
+			outcomes <- outcome{name: check.name, err: err, duration: time.Since(start)}
+		}(check)
+	}
+
+	report := HealthReport{Status: "ok", Checks: make(map[string]HealthCheckResult, len(checks))}
+	record := func(name string, err error, duration time.Duration) {
+		result := HealthCheckResult{Status: "ok", DurationMs: float64(duration.Microseconds()) / 1000}
+		if err != nil {
+			result.Status = "fail"
+			report.Status = "fail"
+			backgroundLogger().Warn().Err(err).Str("check", name).Msg("Health check failed")
+		}
+		report.Checks[name] = result
+	}
+	for range checks {
+		select {
+		case result := <-outcomes:
+			record(result.name, result.err, result.duration)
+		case <-ctx.Done():
+			for _, check := range checks {
+				if _, ok := report.Checks[check.name]; !ok {
+					record(check.name, ctx.Err(), time.Since(start))
+				}
+			}
+			return report
+		}
+	}
+	return report
+}
+
+func runHealthCheck(ctx context.Context, check HealthCheck) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("health check panicked: %v", recovered)
+		}
+	}()
+	return check(ctx)
+}
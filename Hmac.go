@@ -0,0 +1,182 @@
+package toolkit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSignatureTolerance is how old the timestamp of a signed request can be, when HMACConfig doesn't set a Tolerance
+const DefaultSignatureTolerance = 5 * time.Minute
+
+// HMACConfig describes how a webhook signs its requests with an HMAC over the raw body
+type HMACConfig struct {
+	// Header carrying the signature, e.g. X-Signature
+	Header string
+	Secret string
+	// Algorithm is the hash function of the HMAC, e.g. sha1.New. Defaults to sha256.New
+	Algorithm func() hash.Hash
+	// Prefix is removed from the header before decoding the signature, e.g. `sha256=`. The signature can be encoded as hex or base64
+	Prefix string
+	// TimestampHeader carries the time the request was signed at, in unix seconds or RFC 3339. Requests signed more than the Tolerance
+	// before or after now are rejected, so captured requests can't be replayed later. The timestamp isn't checked if it's empty
+	TimestampHeader string
+	// Tolerance defaults to DefaultSignatureTolerance
+	Tolerance time.Duration
+	// SignedPayload builds the content the signature is computed over from the timestamp and body. Defaults to the body alone
+	SignedPayload func(timestamp string, body []byte) []byte
+}
+
+// VerifyHMAC checks that the header carries the hex or base64 HMAC of the raw request body with the secret, using the hash function, e.g. `ctx.VerifyHMAC("X-Signature", secret, sha256.New)`.
+// A prefix naming the algorithm, like `sha256=`, is ignored. Returns an Unauthorized error if the signature doesn't match, which handlers can return as is,
+// and an Internal error if the secret is empty, e.g. because its variable isn't set.
+// There's no timestamp check, as the signature only covers the body and a timestamp header could be replaced along with it. Use VerifyHMACWith with a
+// TimestampHeader and a SignedPayload including the timestamp to reject replayed requests
+func (this FunctionContext) VerifyHMAC(header string, secret string, algorithm func() hash.Hash) error {
+	signature := this.Request.Header.Get(header)
+	if name, value, found := strings.Cut(signature, "="); found && value != "" && isAlgorithmName(name) {
+		signature = value
+	}
+	return this.verifyHMAC(HMACConfig{Header: header, Secret: secret, Algorithm: algorithm}, signature)
+}
+
+// isAlgorithmName returns whether the text is the name of a hash algorithm, like `sha256`, rather than the start of a signature
+func isAlgorithmName(text string) bool {
+	return strings.HasPrefix(strings.ToLower(text), "sha") || strings.HasPrefix(strings.ToLower(text), "md5")
+}
+
+// VerifyHMACWith checks the signature of the request as described by the config, and the freshness of its timestamp if the config has a TimestampHeader.
+// Returns an Unauthorized error if the request isn't correctly signed
+func (this FunctionContext) VerifyHMACWith(config HMACConfig) error {
+	signature, ok := strings.CutPrefix(this.Request.Header.Get(config.Header), config.Prefix)
+	if !ok {
+		signature = ""
+	}
+	return this.verifyHMAC(config, signature)
+}
+
+// verifyHMAC checks the signature, which has been read from the config's header
+func (this FunctionContext) verifyHMAC(config HMACConfig, signature string) error {
+	if config.Secret == "" {
+		return Internal("Failed to verify the signature", errors.New("the HMAC secret is empty"))
+	}
+	if signature == "" {
+		return Unauthorized("Missing signature").WithInternal("no %v header", config.Header)
+	}
+	var timestamp string
+	if config.TimestampHeader != "" {
+		timestamp = this.Request.Header.Get(config.TimestampHeader)
+		if err := checkTimestamp(timestamp, config.Tolerance); err != nil {
+			return Unauthorized("Invalid signature").WithCause(err)
+		}
+	}
+	body, err := this.RawBody()
+	if err != nil {
+		return BadRequest("Failed to read request body").WithCause(err)
+	}
+	payload := body
+	if config.SignedPayload != nil {
+		payload = config.SignedPayload(timestamp, body)
+	}
+	if !signatureMatches(config.Algorithm, config.Secret, payload, signature) {
+		return Unauthorized("Invalid signature").WithInternal("%v doesn't match the body", config.Header)
+	}
+	return nil
+}
+
+// RequireHMAC is a middleware which rejects requests with a 401 response unless they are signed as described by the config.
+// Panics if the config has no Secret, as anyone could sign requests with an empty key
+func RequireHMAC(config HMACConfig) Middleware {
+	if config.Secret == "" {
+		panic("RequireHMAC requires a Secret")
+	}
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx FunctionContext) error {
+			if err := ctx.VerifyHMACWith(config); err != nil {
+				return err
+			}
+			return next(ctx)
+		}
+	}
+}
+
+// signatureMatches compares the hex or base64 encoded signature with the HMAC of the payload in constant time
+func signatureMatches(algorithm func() hash.Hash, secret string, payload []byte, signature string) bool {
+	if algorithm == nil {
+		algorithm = sha256.New
+	}
+	mac := hmac.New(algorithm, []byte(secret))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+	for _, decode := range []func(string) ([]byte, error){hex.DecodeString, base64.StdEncoding.DecodeString, base64.RawURLEncoding.DecodeString} {
+		if decoded, err := decode(strings.TrimSpace(signature)); err == nil && hmac.Equal(decoded, expected) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTimestamp fails if the timestamp, in unix seconds or RFC 3339, is further from now than the tolerance
+func checkTimestamp(timestamp string, tolerance time.Duration) error {
+	if tolerance == 0 {
+		tolerance = DefaultSignatureTolerance
+	}
+	var signedAt time.Time
+	if seconds, err := strconv.ParseInt(timestamp, 10, 64); err == nil {
+		signedAt = time.Unix(seconds, 0)
+	} else if parsed, err := time.Parse(time.RFC3339, timestamp); err == nil {
+		signedAt = parsed
+	} else {
+		return errors.New("missing or invalid signature timestamp")
+	}
+	if age := time.Since(signedAt); age > tolerance || age < -tolerance {
+		return errors.New("signature timestamp is outside the tolerance")
+	}
+	return nil
+}
+
+// deliveryLog remembers the ids of the webhook deliveries handled successfully in the last retention period, so replays of them aren't handled again.
+// It's kept in memory, so it only protects the instance which handled the delivery
+type deliveryLog struct {
+	mutex     sync.Mutex
+	retention time.Duration
+	handled   map[string]time.Time
+}
+
+func newDeliveryLog(retention time.Duration) *deliveryLog {
+	return &deliveryLog{retention: retention, handled: map[string]time.Time{}}
+}
+
+// handleOnce runs the handler unless the delivery with the given id was already handled, in which case it's acknowledged without running it
+func (this *deliveryLog) handleOnce(ctx FunctionContext, id string, next HandlerFunc) error {
+	if id == "" {
+		return next(ctx)
+	}
+	now := time.Now()
+	this.mutex.Lock()
+	for handledId, handledAt := range this.handled {
+		if now.Sub(handledAt) > this.retention {
+			delete(this.handled, handledId)
+		}
+	}
+	_, replayed := this.handled[id]
+	this.mutex.Unlock()
+	if replayed {
+		ctx.Warnf("Ignoring replayed delivery %v", id)
+		return nil
+	}
+	err := next(ctx)
+	if err == nil && ctx.state.writer.statusCode() < 400 {
+		this.mutex.Lock()
+		this.handled[id] = now
+		this.mutex.Unlock()
+	}
+	return err
+}
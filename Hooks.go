@@ -0,0 +1,226 @@
+package toolkit
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// trackingWriter wraps the http.ResponseWriter of a request to keep track of the status code and number of bytes written to it
+type trackingWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+	// capture keeps the start of the body for the access log, nil when it isn't captured
+	capture *captureBuffer
+	// header is the handler's own header map when the request has a timeout, copied to the response when it's written,
+	// so the timeout response can be written from another goroutine. nil when the handler uses the response's header map
+	header   http.Header
+	mutex    sync.Mutex
+	timedOut bool
+	// beforeWrite are called once, right before the headers of the response are written, e.g. to set a cookie
+	beforeWrite []func()
+}
+
+func (this *trackingWriter) Header() http.Header {
+	if this.header != nil {
+		return this.header
+	}
+	return this.ResponseWriter.Header()
+}
+
+func (this *trackingWriter) WriteHeader(code int) {
+	this.runBeforeWrite()
+	if this.header != nil {
+		this.mutex.Lock()
+		defer this.mutex.Unlock()
+		if this.timedOut {
+			return
+		}
+		this.copyHeader()
+	}
+	if this.status == 0 {
+		this.status = code
+	}
+	this.ResponseWriter.WriteHeader(code)
+}
+
+func (this *trackingWriter) Write(buf []byte) (int, error) {
+	this.runBeforeWrite()
+	if this.header != nil {
+		this.mutex.Lock()
+		defer this.mutex.Unlock()
+		if this.timedOut {
+			return 0, http.ErrHandlerTimeout
+		}
+		this.copyHeader()
+	}
+	if this.status == 0 {
+		this.status = http.StatusOK
+	}
+	n, err := this.ResponseWriter.Write(buf)
+	this.bytes += n
+	if this.capture != nil {
+		_, _ = this.capture.Write(buf[:n])
+	}
+	return n, err
+}
+
+// runBeforeWrite calls the beforeWrite functions the first time the response is written. They're only added and called by the handler's goroutine
+func (this *trackingWriter) runBeforeWrite() {
+	if len(this.beforeWrite) == 0 {
+		return
+	}
+	hooks := this.beforeWrite
+	this.beforeWrite = nil
+	for _, hook := range hooks {
+		hook()
+	}
+}
+
+// copyHeader copies the handler's header map to the response before its headers are written
+func (this *trackingWriter) copyHeader() {
+	if this.status != 0 {
+		return
+	}
+	response := this.ResponseWriter.Header()
+	for name, values := range this.header {
+		response[name] = values
+	}
+}
+
+// writeTimeout writes the response sent when the request's deadline passes, unless a response has already been written.
+// Anything the handler writes afterwards is discarded
+func (this *trackingWriter) writeTimeout(contentType string, body []byte) bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.status != 0 || this.timedOut {
+		return false
+	}
+	this.timedOut = true
+	this.status = http.StatusGatewayTimeout
+	this.ResponseWriter.Header().Set("Content-Type", contentType)
+	this.ResponseWriter.Header().Del("Content-Length")
+	this.ResponseWriter.WriteHeader(http.StatusGatewayTimeout)
+	n, _ := this.ResponseWriter.Write(body)
+	this.bytes += n
+	if this.capture != nil {
+		_, _ = this.capture.Write(body[:n])
+	}
+	return true
+}
+
+// hasWritten returns true if the response's headers have been written
+func (this *trackingWriter) hasWritten() bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.status != 0
+}
+
+// statusCode returns the status code of the response, or 0 if it hasn't been written
+func (this *trackingWriter) statusCode() int {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.status
+}
+
+// hasTimedOut returns true if the timeout response has been written
+func (this *trackingWriter) hasTimedOut() bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.timedOut
+}
+
+// Flush flushes the underlying writer, if it supports flushing
+func (this *trackingWriter) Flush() {
+	if this.header != nil {
+		this.mutex.Lock()
+		defer this.mutex.Unlock()
+		if this.timedOut {
+			return
+		}
+		this.copyHeader()
+		if this.status == 0 {
+			this.status = http.StatusOK
+		}
+	}
+	if flusher, ok := this.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack hijacks the connection of the underlying writer, if it supports hijacking
+func (this *trackingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := this.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	if this.header != nil {
+		this.mutex.Lock()
+		defer this.mutex.Unlock()
+		if this.timedOut {
+			return nil, nil, http.ErrHandlerTimeout
+		}
+	}
+	if this.status == 0 {
+		this.status = http.StatusSwitchingProtocols
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap returns the underlying writer, for use with http.ResponseController
+func (this *trackingWriter) Unwrap() http.ResponseWriter {
+	return this.ResponseWriter
+}
+
+// OnResponse registers a function which is called once the response has been written by one of the response methods, with the status code,
+// the number of body bytes written, and the error passed to ErrResponse or the error which occurred while writing (nil otherwise).
+// Hooks are called in the order they were registered
+func (this FunctionContext) OnResponse(hook func(status int, bytes int, err error)) {
+	this.state.mutex.Lock()
+	defer this.state.mutex.Unlock()
+	this.state.hooks = append(this.state.hooks, hook)
+}
+
+// finishResponse records the request metrics, writes the buffered logs and the access log, runs the OnResponse hooks and ends the request's span, unless they have already been run
+func (this FunctionContext) finishResponse(err error) {
+	this.state.mutex.Lock()
+	if this.state.finished {
+		this.state.mutex.Unlock()
+		return
+	}
+	this.state.finished = true
+	this.state.leave()
+	hooks := this.state.hooks
+	if err == nil {
+		err = this.state.err
+	}
+	this.state.mutex.Unlock()
+
+	status, bytes := this.state.writer.status, this.state.writer.bytes
+	this.recordRequestMetrics(status)
+	if this.state.coldStart {
+		coldStart.finished.Store(true)
+	}
+	if this.state.logBuffer != nil {
+		this.finishLogBuffer(status, err)
+	}
+	if config.AccessLog != nil {
+		this.writeAccessLog(status, bytes)
+	}
+	for _, hook := range hooks {
+		this.runHook(hook, status, bytes, err)
+	}
+	this.endServerSpan(status, err)
+}
+
+func (this FunctionContext) runHook(hook func(status int, bytes int, err error), status int, bytes int, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			this.Errorf("Response hook panicked: %v", recovered)
+		}
+	}()
+	hook(status, bytes, err)
+}
@@ -0,0 +1,78 @@
+package toolkit
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// WithTrustedProxies sets the addresses or CIDR ranges of the proxies in front of the function, e.g. the address of an external Application Load Balancer,
+// which ClientIP skips in the X-Forwarded-For header. Panics if one of them isn't valid
+func WithTrustedProxies(cidrs ...string) Option {
+	proxies := parsePrefixes(cidrs)
+	return func(config *Config) {
+		config.TrustedProxies = proxies
+	}
+}
+
+// IPFilterConfig configures IPFilter with addresses or CIDR ranges, e.g. `10.0.0.0/8` or `2001:db8::1`
+type IPFilterConfig struct {
+	// Allow are the only addresses which can call the function, unless it's empty
+	Allow []string
+	// Deny are the addresses which can't call the function, even if they're allowed
+	Deny []string
+}
+
+// IPFilter is a middleware which rejects requests with a 403 response unless their ClientIP is allowed and not denied by the config.
+// Rejected requests are logged at the WARN level with the client's address. Panics if one of the addresses isn't valid
+func IPFilter(filter IPFilterConfig) Middleware {
+	allow, deny := parsePrefixes(filter.Allow), parsePrefixes(filter.Deny)
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx FunctionContext) error {
+			address := ctx.ClientIP()
+			ip, err := netip.ParseAddr(address)
+			switch {
+			case err != nil:
+				ctx.WithField("clientIp", address).Warnf("Rejected request from invalid address %v", address)
+			case prefixesContain(deny, ip):
+				ctx.WithField("clientIp", address).Warnf("Rejected request from denied address %v", address)
+			case len(allow) > 0 && !prefixesContain(allow, ip):
+				ctx.WithField("clientIp", address).Warnf("Rejected request from address %v which isn't allowed", address)
+			default:
+				return next(ctx)
+			}
+			return Forbidden("Forbidden")
+		}
+	}
+}
+
+// parsePrefixes parses addresses and CIDR ranges, panicking if one of them isn't valid
+func parsePrefixes(cidrs []string) []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip, err := netip.ParseAddr(cidr)
+			if err != nil {
+				panic("invalid IP address " + cidr + ": " + err.Error())
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(ip, ip.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			panic("invalid CIDR range " + cidr + ": " + err.Error())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes
+}
+
+// prefixesContain returns true if the address is in one of the prefixes. IPv4 addresses mapped to IPv6 match IPv4 prefixes
+func prefixesContain(prefixes []netip.Prefix, ip netip.Addr) bool {
+	ip = ip.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
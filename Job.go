@@ -0,0 +1,185 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// jobFlushTimeout is how long RunJob waits for the metrics, spans and error reports to be sent before the task exits
+const jobFlushTimeout = 10 * time.Second
+
+// JobInfo describes the Cloud Run Jobs task a ctx created by JobCtx runs, read from the environment variables set by Cloud Run
+type JobInfo struct {
+	Job       string
+	Execution string
+	// TaskIndex is the index of this task among the TaskCount tasks of the execution, starting at 0
+	TaskIndex int
+	TaskCount int
+	// TaskAttempt is the number of times this task has been retried, starting at 0
+	TaskAttempt int
+}
+
+// jobInfo reads the task from the CLOUD_RUN_* environment variables. Outside Cloud Run the task is the only one of its execution
+func jobInfo() JobInfo {
+	info := JobInfo{Job: os.Getenv("CLOUD_RUN_JOB"), Execution: os.Getenv("CLOUD_RUN_EXECUTION"), TaskCount: 1}
+	if info.Job == "" {
+		info.Job = "local"
+	}
+	if info.Execution == "" {
+		info.Execution = info.Job + "-" + randomHex(4)
+	}
+	for _, variable := range []struct {
+		name   string
+		target *int
+	}{{"CLOUD_RUN_TASK_INDEX", &info.TaskIndex}, {"CLOUD_RUN_TASK_COUNT", &info.TaskCount}, {"CLOUD_RUN_TASK_ATTEMPT", &info.TaskAttempt}} {
+		if value, err := strconv.Atoi(os.Getenv(variable.name)); err == nil {
+			*variable.target = value
+		}
+	}
+	return info
+}
+
+// JobCtx creates a context for a task of a Cloud Run Job, which has no http request. Every task of an execution shares the execution's name as its request id,
+// and the span id identifies the task and attempt. The logs include the job, execution, task index and attempt.
+// The ctx's context is cancelled when the task receives SIGTERM. Finish the task with FinishJob, or run it with RunJob
+func JobCtx() FunctionContext {
+	info := jobInfo()
+	signalContext, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	r, _ := http.NewRequestWithContext(signalContext, http.MethodPost, "/", http.NoBody)
+	r.Header.Set(RequestIdHeader, info.Execution)
+
+	ctx := newFuncCtx(&eventWriter{header: http.Header{}}, r, eventSpanId(fmt.Sprintf("%v-%v-%v", info.Execution, info.TaskIndex, info.TaskAttempt)))
+	cancel := ctx.state.cancel
+	ctx.state.cancel = func() {
+		cancel()
+		stop()
+	}
+	ctx.state.job = &info
+	return ctx.WithFields(map[string]interface{}{"job": info.Job, "execution": info.Execution, "taskIndex": info.TaskIndex, "taskAttempt": info.TaskAttempt})
+}
+
+// JobInfo returns the task of a ctx created by JobCtx, and false for other contexts
+func (this FunctionContext) JobInfo() (JobInfo, bool) {
+	if this.state.job == nil {
+		return JobInfo{}, false
+	}
+	return *this.state.job, true
+}
+
+// OnCheckpoint registers a hook which saves the progress of the task, so that the next attempt can resume from it.
+// The hooks are run by Checkpoint, and when the task fails
+func (this FunctionContext) OnCheckpoint(hook func(ctx FunctionContext) error) {
+	this.state.mutex.Lock()
+	defer this.state.mutex.Unlock()
+	this.state.checkpoints = append(this.state.checkpoints, hook)
+}
+
+// Checkpoint runs the hooks registered with OnCheckpoint, in the order they were registered. Failures are logged at the ERROR level and returned
+func (this FunctionContext) Checkpoint() error {
+	this.state.mutex.Lock()
+	hooks := append([]func(ctx FunctionContext) error(nil), this.state.checkpoints...)
+	this.state.mutex.Unlock()
+	var errs []error
+	for _, hook := range hooks {
+		if err := hook(this); err != nil {
+			this.withSkip(1).ErrorErr(err, "Checkpoint failed")
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// exitCodeError is an error which sets the exit code of the task
+type exitCodeError struct {
+	error
+	code int
+}
+
+func (this exitCodeError) Unwrap() error {
+	return this.error
+}
+
+func (this exitCodeError) ExitCode() int {
+	return this.code
+}
+
+// WithExitCode wraps the error so the task fails with the given exit code
+func WithExitCode(err error, code int) error {
+	return exitCodeError{error: err, code: code}
+}
+
+// ExitCode returns the exit code of a task which failed with the error: 0 for nil, the code of errors with an ExitCode method (e.g. those wrapped with WithExitCode
+// or an exec.ExitError), 143 if the task was cancelled by SIGTERM, and 1 otherwise
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var coder interface{ ExitCode() int }
+	if errors.As(err, &coder) && coder.ExitCode() > 0 {
+		return coder.ExitCode()
+	}
+	if errors.Is(err, context.Canceled) {
+		return 128 + int(syscall.SIGTERM)
+	}
+	return 1
+}
+
+// FinishJob finishes the task with the error returned by it, and returns the exit code the process should exit with.
+// Failures run the OnCheckpoint hooks, are logged at the ERROR level and sent to the error reporters
+func (this FunctionContext) FinishJob(err error) int {
+	defer this.state.cancel()
+	if this.state.writer.hasWritten() {
+		return ExitCode(err)
+	}
+	if err == nil {
+		this.withSkip(1).Info("Job task finished")
+		this.writeResponse(http.StatusOK, "", nil)
+		return 0
+	}
+	_ = this.withSkip(1).Checkpoint()
+	code := ExitCode(err)
+	this.withSkip(1).ErrorErr(err, fmt.Sprintf("Job task failed with exit code %v", code))
+	this.withSkip(1).reportToReporters(err, "Job task failed", http.StatusInternalServerError, false)
+	this.state.mutex.Lock()
+	this.state.err = err
+	this.state.mutex.Unlock()
+	this.writeResponse(http.StatusInternalServerError, "", nil)
+	return code
+}
+
+// RunJob runs the task with a ctx created by JobCtx, recovering from panics, and returns its exit code once the metrics, spans and error reporters
+// have been flushed: `os.Exit(tk.RunJob(yourJob))`
+func RunJob(job HandlerFunc) int {
+	ctx := JobCtx()
+	code := ctx.runJob(job)
+	flushContext, cancel := context.WithTimeout(context.Background(), jobFlushTimeout)
+	defer cancel()
+	if err := ShutdownTelemetry(flushContext); err != nil {
+		backgroundLogger().Error().Err(err).Msg("Failed to flush telemetry")
+	}
+	flushReporters(flushContext)
+	return code
+}
+
+// runJob runs the job, turning panics recovered by Recover into a failure of the task
+func (this FunctionContext) runJob(job HandlerFunc) (code int) {
+	defer func() {
+		if this.state.writer.statusCode() >= 500 && code == 0 {
+			this.state.mutex.Lock()
+			err := this.state.err
+			this.state.mutex.Unlock()
+			_ = this.Checkpoint()
+			code = ExitCode(err)
+		}
+		this.state.cancel()
+	}()
+	defer this.Recover()
+	return this.FinishJob(job(this))
+}
@@ -0,0 +1,596 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JWEContentType is the Content-Type of compact JWE payloads
+const JWEContentType = "application/jose"
+
+// jweKeyRefreshInterval is how long the keys read from Secret Manager are cached
+const jweKeyRefreshInterval = 5 * time.Minute
+
+// ErrUnsupportedJWEAlgorithm is returned when a JWE payload uses an algorithm which isn't allowed or implemented
+var ErrUnsupportedJWEAlgorithm = errors.New("unsupported JWE algorithm")
+
+// errJWEKeysUnavailable is returned when the keys can't be read from Secret Manager
+var errJWEKeysUnavailable = errors.New("failed to read the JWE keys")
+
+// JWEConfig describes the keys and algorithms of the JWE (RFC 7516) payloads exchanged with a partner. Keys are read from Secret Manager secrets
+// holding either a PEM encoded RSA key or a JSON Web Key, and cached for 5 minutes so rotated keys are picked up without a deployment.
+// Supported key algorithms are RSA-OAEP, RSA-OAEP-256, A128KW, A192KW, A256KW and dir, and content algorithms are A128GCM, A192GCM, A256GCM,
+// A128CBC-HS256, A192CBC-HS384 and A256CBC-HS512. Compressed payloads aren't accepted
+type JWEConfig struct {
+	// DecryptionKey is the secret holding the private or symmetric key requests are encrypted for, e.g. `partner-x-jwe-private-key`
+	DecryptionKey string
+	// EncryptionKey is the secret holding the partner's public or symmetric key responses are encrypted with
+	EncryptionKey string
+	// KeyAlgorithms are the `alg` values requests may use. Defaults to RSA-OAEP-256, A256KW and dir
+	KeyAlgorithms []string
+	// ContentAlgorithms are the `enc` values requests may use. Defaults to A256GCM and A256CBC-HS512
+	ContentAlgorithms []string
+	// ResponseKeyAlgorithm is the `alg` of responses. Defaults to RSA-OAEP-256 for RSA keys and A256KW for symmetric keys
+	ResponseKeyAlgorithm string
+	// ResponseContentAlgorithm is the `enc` of responses. Defaults to A256GCM
+	ResponseContentAlgorithm string
+	// Endpoint is the address of the Secret Manager API
+	Endpoint string
+
+	mutex      sync.Mutex
+	decryption *jweKey
+	encryption *jweKey
+	fetchedAt  time.Time
+}
+
+// jweKey is an RSA or symmetric key
+type jweKey struct {
+	id      string
+	private *rsa.PrivateKey
+	public  *rsa.PublicKey
+	secret  []byte
+}
+
+// jweHeader is the protected header of a JWE payload
+type jweHeader struct {
+	Alg string `json:"alg"`
+	Enc string `json:"enc"`
+	Zip string `json:"zip,omitempty"`
+	Kid string `json:"kid,omitempty"`
+	Cty string `json:"cty,omitempty"`
+}
+
+// NewJWEConfig creates a config reading the keys from the latest versions of the given secrets. Either may be empty, if only requests or responses are encrypted
+func NewJWEConfig(decryptionKey string, encryptionKey string) *JWEConfig {
+	return &JWEConfig{DecryptionKey: decryptionKey, EncryptionKey: encryptionKey, Endpoint: secretManagerEndpoint}
+}
+
+// RequireJWE is a middleware decrypting the compact JWE body of requests, so handlers read the plaintext with RawBody or BindJson.
+// The Content-Type of the request becomes the `cty` of the payload's header, or json when it has none.
+// Requests get a 400 response if the body can't be decrypted, with a detail whose code is `jwe.unsupported_algorithm` or `jwe.invalid`, and a 503 response if the keys can't be read
+func RequireJWE(jwe *JWEConfig) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx FunctionContext) error {
+			body, err := ctx.RawBody()
+			if err != nil {
+				return BadRequest("Failed to read request body").WithCause(err)
+			}
+			plaintext, header, err := jwe.decrypt(ctx.Context, string(bytes.TrimSpace(body)))
+			switch {
+			case errors.Is(err, errJWEKeysUnavailable):
+				return ServiceUnavailable("Failed to decrypt the request").WithCause(err)
+			case errors.Is(err, ErrUnsupportedJWEAlgorithm):
+				return BadRequest("The encryption algorithm isn't supported", ErrorDetail{Code: "jwe.unsupported_algorithm", Message: err.Error()}).WithCause(err)
+			case err != nil:
+				return BadRequest("The request can't be decrypted", ErrorDetail{Code: "jwe.invalid", Message: "The body must be a compact JWE encrypted for this function"}).WithCause(err)
+			}
+			ctx.state.body, ctx.state.bodyErr = plaintext, nil
+			ctx.Request.Body = io.NopCloser(bytes.NewReader(plaintext))
+			ctx.Request.ContentLength = int64(len(plaintext))
+			ctx.Request.Header.Set("Content-Type", header.contentType())
+			return next(ctx)
+		}
+	}
+}
+
+// OkResponseJWE serializes the given object inside a SuccessResponseStruct, encrypts it with the config's EncryptionKey, and sends it as a 200 `application/jose` response.
+// A 500 response is sent if it can't be encrypted
+func (this FunctionContext) OkResponseJWE(jwe *JWEConfig, obj interface{}) {
+	plaintext, err := codec.Marshal(config.Formatter.FormatSuccess(this, obj))
+	var encrypted string
+	if err == nil {
+		encrypted, err = jwe.Encrypt(this.Context, plaintext)
+	}
+	if err != nil {
+		this.withSkip(1).ErrResponse(http.StatusInternalServerError, err, "Failed to encrypt the response")
+		return
+	}
+	this.withSkip(1).Debug("Responding with status 200 (encrypted)")
+	this.writeResponse(http.StatusOK, JWEContentType, []byte(encrypted))
+}
+
+// Decrypt decrypts a compact JWE payload with the DecryptionKey, rejecting the algorithms which aren't allowed
+func (this *JWEConfig) Decrypt(ctx context.Context, token string) ([]byte, error) {
+	plaintext, _, err := this.decrypt(ctx, token)
+	return plaintext, err
+}
+
+// contentType returns the media type of the plaintext named by the `cty` parameter, which omits the `application/` prefix when it has no other slash
+func (this jweHeader) contentType() string {
+	switch {
+	case this.Cty == "":
+		return jsonContentType
+	case strings.Contains(this.Cty, "/"):
+		return this.Cty
+	default:
+		return "application/" + this.Cty
+	}
+}
+
+// decrypt decrypts a compact JWE payload, returning its plaintext and protected header
+func (this *JWEConfig) decrypt(ctx context.Context, token string) ([]byte, jweHeader, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		return nil, jweHeader{}, errors.New("payload is not a compact JWE")
+	}
+	var header jweHeader
+	if err := decodeJwtPart(parts[0], &header); err != nil {
+		return nil, jweHeader{}, fmt.Errorf("invalid JWE header: %w", err)
+	}
+	keyAlgorithms, contentAlgorithms := this.KeyAlgorithms, this.ContentAlgorithms
+	if len(keyAlgorithms) == 0 {
+		keyAlgorithms = []string{"RSA-OAEP-256", "A256KW", "dir"}
+	}
+	if len(contentAlgorithms) == 0 {
+		contentAlgorithms = []string{"A256GCM", "A256CBC-HS512"}
+	}
+	if !slices.Contains(keyAlgorithms, header.Alg) {
+		return nil, header, fmt.Errorf("%w: alg %q isn't allowed", ErrUnsupportedJWEAlgorithm, header.Alg)
+	}
+	if !slices.Contains(contentAlgorithms, header.Enc) {
+		return nil, header, fmt.Errorf("%w: enc %q isn't allowed", ErrUnsupportedJWEAlgorithm, header.Enc)
+	}
+	if header.Zip != "" {
+		return nil, header, fmt.Errorf("%w: compressed payloads aren't accepted", ErrUnsupportedJWEAlgorithm)
+	}
+	var decoded [4][]byte
+	for i, part := range parts[1:] {
+		var err error
+		if decoded[i], err = base64.RawURLEncoding.DecodeString(part); err != nil {
+			return nil, header, fmt.Errorf("invalid JWE part %v: %w", i+2, err)
+		}
+	}
+	encryptedKey, iv, ciphertext, tag := decoded[0], decoded[1], decoded[2], decoded[3]
+	key, _, err := this.keys(ctx)
+	if err != nil {
+		return nil, header, err
+	}
+	if key == nil {
+		return nil, header, errors.New("no decryption key is configured")
+	}
+	size, err := jweContentKeySize(header.Enc)
+	if err != nil {
+		return nil, header, err
+	}
+	cek, err := key.unwrap(header.Alg, encryptedKey, size)
+	if err != nil {
+		return nil, header, err
+	}
+	plaintext, err := jweDecryptContent(header.Enc, cek, iv, ciphertext, tag, []byte(parts[0]))
+	return plaintext, header, err
+}
+
+// Encrypt encrypts the plaintext with the EncryptionKey, returning a compact JWE payload
+func (this *JWEConfig) Encrypt(ctx context.Context, plaintext []byte) (string, error) {
+	_, key, err := this.keys(ctx)
+	if err != nil {
+		return "", err
+	}
+	if key == nil {
+		return "", errors.New("no encryption key is configured")
+	}
+	header := jweHeader{Alg: this.ResponseKeyAlgorithm, Enc: this.ResponseContentAlgorithm, Kid: key.id}
+	if header.Alg == "" {
+		header.Alg = "A256KW"
+		if key.public != nil {
+			header.Alg = "RSA-OAEP-256"
+		}
+	}
+	if header.Enc == "" {
+		header.Enc = "A256GCM"
+	}
+	size, err := jweContentKeySize(header.Enc)
+	if err != nil {
+		return "", err
+	}
+	cek := make([]byte, size)
+	if header.Alg == "dir" {
+		cek = key.secret
+	} else if _, err := rand.Read(cek); err != nil {
+		return "", err
+	}
+	encryptedKey, err := key.wrap(header.Alg, cek)
+	if err != nil {
+		return "", err
+	}
+	encodedHeader, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	protected := base64.RawURLEncoding.EncodeToString(encodedHeader)
+	iv, ciphertext, tag, err := jweEncryptContent(header.Enc, cek, plaintext, []byte(protected))
+	if err != nil {
+		return "", err
+	}
+	return strings.Join([]string{
+		protected,
+		base64.RawURLEncoding.EncodeToString(encryptedKey),
+		base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(ciphertext),
+		base64.RawURLEncoding.EncodeToString(tag),
+	}, "."), nil
+}
+
+// keys returns the decryption and encryption keys, reading them from Secret Manager if they aren't cached.
+// If the secrets can't be read, the keys read before are used for another refresh interval, so requests don't wait for a failing API one after the other
+func (this *JWEConfig) keys(ctx context.Context) (*jweKey, *jweKey, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if time.Since(this.fetchedAt) < jweKeyRefreshInterval {
+		return this.decryption, this.encryption, nil
+	}
+	endpoint := this.Endpoint
+	if endpoint == "" {
+		endpoint = secretManagerEndpoint
+	}
+	var keys [2]*jweKey
+	for i, secret := range []string{this.DecryptionKey, this.EncryptionKey} {
+		if secret == "" {
+			continue
+		}
+		payload, err := accessSecret(ctx, endpoint, secret)
+		if err == nil {
+			keys[i], err = parseJWEKey(payload)
+		}
+		if err != nil {
+			if this.fetchedAt.IsZero() {
+				return nil, nil, fmt.Errorf("%w from %v: %v", errJWEKeysUnavailable, secret, err)
+			}
+			this.fetchedAt = time.Now()
+			return this.decryption, this.encryption, nil
+		}
+	}
+	this.decryption, this.encryption, this.fetchedAt = keys[0], keys[1], time.Now()
+	return this.decryption, this.encryption, nil
+}
+
+// parseJWEKey parses a PEM encoded RSA key, or a JSON Web Key of the RSA or oct type
+func parseJWEKey(data []byte) (*jweKey, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			private, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			return &jweKey{private: private, public: &private.PublicKey}, nil
+		case "PRIVATE KEY":
+			parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			private, ok := parsed.(*rsa.PrivateKey)
+			if err != nil || !ok {
+				return nil, fmt.Errorf("not an RSA private key: %v", err)
+			}
+			return &jweKey{private: private, public: &private.PublicKey}, nil
+		case "PUBLIC KEY":
+			parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+			public, ok := parsed.(*rsa.PublicKey)
+			if err != nil || !ok {
+				return nil, fmt.Errorf("not an RSA public key: %v", err)
+			}
+			return &jweKey{public: public}, nil
+		}
+		return nil, fmt.Errorf("unsupported PEM block %v", block.Type)
+	}
+	var jwk struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		K   string `json:"k"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		D   string `json:"d"`
+		P   string `json:"p"`
+		Q   string `json:"q"`
+	}
+	if err := json.Unmarshal(data, &jwk); err != nil {
+		return nil, errors.New("key is neither PEM nor a JSON Web Key")
+	}
+	number := func(encoded string) *big.Int {
+		decoded, _ := base64.RawURLEncoding.DecodeString(encoded)
+		return new(big.Int).SetBytes(decoded)
+	}
+	switch jwk.Kty {
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(jwk.K)
+		if err != nil || len(secret) == 0 {
+			return nil, errors.New("invalid symmetric key")
+		}
+		return &jweKey{id: jwk.Kid, secret: secret}, nil
+	case "RSA":
+		public := &rsa.PublicKey{N: number(jwk.N), E: int(number(jwk.E).Int64())}
+		if jwk.D == "" {
+			return &jweKey{id: jwk.Kid, public: public}, nil
+		}
+		private := &rsa.PrivateKey{PublicKey: *public, D: number(jwk.D), Primes: []*big.Int{number(jwk.P), number(jwk.Q)}}
+		if err := private.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid RSA key: %w", err)
+		}
+		private.Precompute()
+		return &jweKey{id: jwk.Kid, private: private, public: public}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
+
+// unwrap decrypts the content encryption key. Failed RSA decryptions return a random key, so that they fail like a wrong tag and don't reveal which step failed
+func (this *jweKey) unwrap(algorithm string, encryptedKey []byte, size int) ([]byte, error) {
+	switch algorithm {
+	case "dir":
+		if this.secret == nil || len(encryptedKey) != 0 || len(this.secret) != size {
+			return nil, errors.New("invalid direct key")
+		}
+		return this.secret, nil
+	case "A128KW", "A192KW", "A256KW":
+		if this.secret == nil || len(this.secret)*8 != jweKeyWrapBits(algorithm) {
+			return nil, fmt.Errorf("the key doesn't match %v", algorithm)
+		}
+		cek, err := aesKeyUnwrap(this.secret, encryptedKey)
+		if err == nil && len(cek) != size {
+			err = errors.New("wrapped key doesn't match the content algorithm")
+		}
+		return cek, err
+	case "RSA-OAEP", "RSA-OAEP-256":
+		if this.private == nil {
+			return nil, fmt.Errorf("the key doesn't match %v", algorithm)
+		}
+		var hash hash.Hash = sha256.New()
+		if algorithm == "RSA-OAEP" {
+			hash = sha1.New()
+		}
+		cek, err := rsa.DecryptOAEP(hash, nil, this.private, encryptedKey, nil)
+		if err != nil || len(cek) != size {
+			cek = make([]byte, size)
+			_, _ = rand.Read(cek)
+		}
+		return cek, nil
+	}
+	return nil, fmt.Errorf("%w: alg %q", ErrUnsupportedJWEAlgorithm, algorithm)
+}
+
+// wrap encrypts the content encryption key for the recipient of the key
+func (this *jweKey) wrap(algorithm string, cek []byte) ([]byte, error) {
+	switch algorithm {
+	case "dir":
+		if this.secret == nil || len(this.secret) != len(cek) {
+			return nil, errors.New("the key can't be used directly with the content algorithm")
+		}
+		return nil, nil
+	case "A128KW", "A192KW", "A256KW":
+		if this.secret == nil || len(this.secret)*8 != jweKeyWrapBits(algorithm) {
+			return nil, fmt.Errorf("the key doesn't match %v", algorithm)
+		}
+		return aesKeyWrap(this.secret, cek)
+	case "RSA-OAEP", "RSA-OAEP-256":
+		if this.public == nil {
+			return nil, fmt.Errorf("the key doesn't match %v", algorithm)
+		}
+		var hash hash.Hash = sha256.New()
+		if algorithm == "RSA-OAEP" {
+			hash = sha1.New()
+		}
+		return rsa.EncryptOAEP(hash, rand.Reader, this.public, cek, nil)
+	}
+	return nil, fmt.Errorf("%w: alg %q", ErrUnsupportedJWEAlgorithm, algorithm)
+}
+
+// jweKeyWrapBits returns the size of the key of an AES key wrap algorithm, e.g. 256 for A256KW
+func jweKeyWrapBits(algorithm string) int {
+	switch algorithm {
+	case "A128KW":
+		return 128
+	case "A192KW":
+		return 192
+	}
+	return 256
+}
+
+// jweContentKeySize returns the size in bytes of the content encryption key of the algorithm
+func jweContentKeySize(algorithm string) (int, error) {
+	switch algorithm {
+	case "A128GCM":
+		return 16, nil
+	case "A192GCM":
+		return 24, nil
+	case "A256GCM", "A128CBC-HS256":
+		return 32, nil
+	case "A192CBC-HS384":
+		return 48, nil
+	case "A256CBC-HS512":
+		return 64, nil
+	}
+	return 0, fmt.Errorf("%w: enc %q", ErrUnsupportedJWEAlgorithm, algorithm)
+}
+
+// jweDecryptContent decrypts and authenticates the ciphertext with the content encryption key
+func jweDecryptContent(algorithm string, cek []byte, iv []byte, ciphertext []byte, tag []byte, aad []byte) ([]byte, error) {
+	if strings.HasSuffix(algorithm, "GCM") {
+		block, err := aes.NewCipher(cek)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		if len(iv) != aead.NonceSize() {
+			return nil, errors.New("invalid initialization vector")
+		}
+		plaintext, err := aead.Open(nil, iv, append(ciphertext, tag...), aad)
+		if err != nil {
+			return nil, errors.New("payload can't be authenticated")
+		}
+		return plaintext, nil
+	}
+	macKey, encKey := cek[:len(cek)/2], cek[len(cek)/2:]
+	if !hmac.Equal(tag, jweCbcTag(macKey, aad, iv, ciphertext)) {
+		return nil, errors.New("payload can't be authenticated")
+	}
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() || len(ciphertext) == 0 || len(ciphertext)%block.BlockSize() != 0 {
+		return nil, errors.New("invalid ciphertext")
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > block.BlockSize() || subtle.ConstantTimeCompare(plaintext[len(plaintext)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) != 1 {
+		return nil, errors.New("invalid padding")
+	}
+	return plaintext[:len(plaintext)-padding], nil
+}
+
+// jweEncryptContent encrypts the plaintext with the content encryption key, returning the initialization vector, ciphertext and authentication tag
+func jweEncryptContent(algorithm string, cek []byte, plaintext []byte, aad []byte) ([]byte, []byte, []byte, error) {
+	if strings.HasSuffix(algorithm, "GCM") {
+		block, err := aes.NewCipher(cek)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		iv := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(iv); err != nil {
+			return nil, nil, nil, err
+		}
+		sealed := aead.Seal(nil, iv, plaintext, aad)
+		cut := len(sealed) - aead.Overhead()
+		return iv, sealed[:cut], sealed[cut:], nil
+	}
+	macKey, encKey := cek[:len(cek)/2], cek[len(cek)/2:]
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	iv := make([]byte, block.BlockSize())
+	if _, err := rand.Read(iv); err != nil {
+		return nil, nil, nil, err
+	}
+	padding := block.BlockSize() - len(plaintext)%block.BlockSize()
+	padded := append(slices.Clone(plaintext), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	ciphertext := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, padded)
+	return iv, ciphertext, jweCbcTag(macKey, aad, iv, ciphertext), nil
+}
+
+// jweCbcTag computes the authentication tag of the AES-CBC-HMAC-SHA2 algorithms, which is the first half of the HMAC
+func jweCbcTag(macKey []byte, aad []byte, iv []byte, ciphertext []byte) []byte {
+	var algorithm func() hash.Hash
+	switch len(macKey) {
+	case 16:
+		algorithm = sha256.New
+	case 24:
+		algorithm = sha512.New384
+	default:
+		algorithm = sha512.New
+	}
+	mac := hmac.New(algorithm, macKey)
+	mac.Write(aad)
+	mac.Write(iv)
+	mac.Write(ciphertext)
+	_ = binary.Write(mac, binary.BigEndian, uint64(len(aad))*8)
+	return mac.Sum(nil)[:len(macKey)]
+}
+
+// aesKeyWrapIV is the initial value of the AES key wrap algorithm (RFC 3394)
+var aesKeyWrapIV = []byte{0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6}
+
+// aesKeyWrap wraps the key with the key encryption key (RFC 3394)
+func aesKeyWrap(kek []byte, key []byte) ([]byte, error) {
+	if len(key)%8 != 0 || len(key) < 16 {
+		return nil, errors.New("invalid key size for key wrap")
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	n := len(key) / 8
+	a := slices.Clone(aesKeyWrapIV)
+	r := slices.Clone(key)
+	buffer := make([]byte, 16)
+	for j := 0; j < 6; j++ {
+		for i := 0; i < n; i++ {
+			copy(buffer, a)
+			copy(buffer[8:], r[i*8:i*8+8])
+			block.Encrypt(buffer, buffer)
+			t := uint64(n*j + i + 1)
+			binary.BigEndian.PutUint64(a, binary.BigEndian.Uint64(buffer[:8])^t)
+			copy(r[i*8:], buffer[8:])
+		}
+	}
+	return append(a, r...), nil
+}
+
+// aesKeyUnwrap unwraps a key wrapped with the key encryption key, failing if its integrity check doesn't match (RFC 3394)
+func aesKeyUnwrap(kek []byte, wrapped []byte) ([]byte, error) {
+	if len(wrapped)%8 != 0 || len(wrapped) < 24 {
+		return nil, errors.New("invalid wrapped key size")
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	n := len(wrapped)/8 - 1
+	a := slices.Clone(wrapped[:8])
+	r := slices.Clone(wrapped[8:])
+	buffer := make([]byte, 16)
+	for j := 5; j >= 0; j-- {
+		for i := n - 1; i >= 0; i-- {
+			t := uint64(n*j + i + 1)
+			binary.BigEndian.PutUint64(buffer, binary.BigEndian.Uint64(a)^t)
+			copy(buffer[8:], r[i*8:i*8+8])
+			block.Decrypt(buffer, buffer)
+			copy(a, buffer[:8])
+			copy(r[i*8:], buffer[8:])
+		}
+	}
+	if !hmac.Equal(a, aesKeyWrapIV) {
+		return nil, errors.New("wrapped key can't be authenticated")
+	}
+	return r, nil
+}
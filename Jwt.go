@@ -0,0 +1,296 @@
+package toolkit
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jwtLeeway is the clock skew allowed when checking the expiry and not-before times of tokens
+const jwtLeeway = time.Minute
+
+// jwksRefreshInterval is the minimum time between fetches of a key set, so tokens with unknown key ids can't make the function hammer the issuer
+const jwksRefreshInterval = time.Minute
+
+// jwks caches the public keys of a JSON Web Key Set. The keys are fetched again when they expire, or when a token is signed with an unknown key
+type jwks struct {
+	url       string
+	mutex     sync.Mutex
+	keys      map[string]crypto.PublicKey
+	expiry    time.Time
+	fetchedAt time.Time
+}
+
+var jwksCache = struct {
+	mutex sync.Mutex
+	sets  map[string]*jwks
+}{sets: map[string]*jwks{}}
+
+// keySet returns the cached key set with the given url
+func keySet(url string) *jwks {
+	jwksCache.mutex.Lock()
+	defer jwksCache.mutex.Unlock()
+	set, ok := jwksCache.sets[url]
+	if !ok {
+		set = &jwks{url: url}
+		jwksCache.sets[url] = set
+	}
+	return set
+}
+
+// key returns the key with the given id, fetching the key set if needed. The key set isn't fetched again for jwksRefreshInterval after a failed fetch,
+// in which case the keys fetched before are used
+func (this *jwks) key(ctx context.Context, id string) (crypto.PublicKey, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	key, ok := this.keys[id]
+	if ok && time.Now().Before(this.expiry) {
+		return key, nil
+	}
+	if time.Since(this.fetchedAt) >= jwksRefreshInterval {
+		if err := this.fetch(ctx); err != nil {
+			//  The failed attempt counts as a fetch, so requests don't wait for a failing issuer one after the other
+			this.fetchedAt = time.Now()
+			return nil, err
+		}
+		key, ok = this.keys[id]
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", id)
+	}
+	return key, nil
+}
+
+// fetch downloads the key set, keeping it for the max-age of its Cache-Control header, or an hour
+func (this *jwks) fetch(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	rq, err := http.NewRequestWithContext(ctx, http.MethodGet, this.url, nil)
+	if err != nil {
+		return err
+	}
+	res, err := http.DefaultClient.Do(rq)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		return &httpStatusError{status: res.StatusCode, body: string(body)}
+	}
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&set); err != nil {
+		return err
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		switch {
+		case jwk.Kty == "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+			e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+			if errN != nil || errE != nil {
+				continue
+			}
+			keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case jwk.Kty == "EC" && jwk.Crv == "P-256":
+			x, errX := base64.RawURLEncoding.DecodeString(jwk.X)
+			y, errY := base64.RawURLEncoding.DecodeString(jwk.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			keys[jwk.Kid] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+	this.keys = keys
+	this.fetchedAt = time.Now()
+	this.expiry = this.fetchedAt.Add(cacheMaxAge(res.Header.Get("Cache-Control"), time.Hour))
+	return nil
+}
+
+// cacheMaxAge returns the max-age directive of a Cache-Control header, or the fallback if it's missing
+func cacheMaxAge(cacheControl string, fallback time.Duration) time.Duration {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if strings.EqualFold(name, "max-age") {
+			if seconds, err := strconv.Atoi(value); err == nil {
+				return time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return fallback
+}
+
+// verifyJwt checks the RS256 or ES256 signature of the token against the keys of the key set, and returns its claims.
+// The claims aren't validated, see validateClaims
+func verifyJwt(ctx context.Context, token string, keys *jwks) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("token is not a JWT")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJwtPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid token header: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid token signature: %w", err)
+	}
+	key, err := keys.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if header.Alg != "RS256" {
+			return nil, fmt.Errorf("algorithm %q doesn't match the RSA key", header.Alg)
+		}
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return nil, errors.New("invalid token signature")
+		}
+	case *ecdsa.PublicKey:
+		if header.Alg != "ES256" {
+			return nil, fmt.Errorf("algorithm %q doesn't match the EC key", header.Alg)
+		}
+		if len(signature) != 64 || !ecdsa.Verify(key, digest[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])) {
+			return nil, errors.New("invalid token signature")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	var claims map[string]interface{}
+	if err := decodeJwtPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid token claims: %w", err)
+	}
+	return claims, nil
+}
+
+// decodeJwtPart decodes a base64url encoded json part of a JWT
+func decodeJwtPart(part string, obj interface{}) error {
+	bytes, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bytes, obj)
+}
+
+// validateClaims checks that the token hasn't expired, is already valid, was issued by one of the issuers, and is meant for the audience.
+// Empty issuers and audience aren't checked
+func validateClaims(claims map[string]interface{}, issuers []string, audience string) error {
+	now := time.Now()
+	expiry, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("token has no expiry")
+	}
+	if now.After(time.Unix(int64(expiry), 0).Add(jwtLeeway)) {
+		return errors.New("token has expired")
+	}
+	if notBefore, ok := claims["nbf"].(float64); ok && now.Add(jwtLeeway).Before(time.Unix(int64(notBefore), 0)) {
+		return errors.New("token is not valid yet")
+	}
+	if len(issuers) > 0 {
+		if issuer, _ := claims["iss"].(string); !slices.Contains(issuers, issuer) {
+			return fmt.Errorf("unexpected issuer %q", issuer)
+		}
+	}
+	if audience != "" && !slices.Contains(Principal{Claims: claims}.ClaimStrings("aud"), audience) {
+		return fmt.Errorf("token isn't meant for audience %q", audience)
+	}
+	return nil
+}
+
+// bearerToken returns the token of the request's Authorization header, or an empty string if it doesn't have a bearer token
+func (this FunctionContext) bearerToken() string {
+	scheme, token, ok := strings.Cut(this.Request.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// JWTConfig configures how RequireJWT verifies bearer tokens
+type JWTConfig struct {
+	// KeysUrl is the address of the JSON Web Key Set the tokens are signed with, e.g. `https://<tenant>.auth0.com/.well-known/jwks.json`.
+	// The keys are cached for the max-age of the response, and fetched again when a token is signed with a new key
+	KeysUrl string
+	// Issuers are the accepted values of the `iss` claim
+	Issuers []string
+	// Audience is the value the `aud` claim must contain
+	Audience string
+	// PrincipalClaim is the claim identifying the principal of the request. Defaults to `sub`
+	PrincipalClaim string
+}
+
+// RequireJWT is a middleware which rejects requests with a 401 response unless they have a bearer token signed with RS256 or ES256 by one of the keys at the KeysUrl,
+// which hasn't expired and was issued by one of the Issuers for the Audience. The handler gets a ctx with the token's principal set by WithPrincipal,
+// and its claims available through ctx.Claims. Panics if no KeysUrl, Issuers or Audience is configured
+func RequireJWT(jwt JWTConfig) Middleware {
+	if jwt.KeysUrl == "" {
+		panic("RequireJWT needs a KeysUrl")
+	}
+	if len(jwt.Issuers) == 0 {
+		panic("RequireJWT needs the Issuers of the tokens")
+	}
+	if jwt.Audience == "" {
+		panic("RequireJWT needs the Audience of the tokens")
+	}
+	if jwt.PrincipalClaim == "" {
+		jwt.PrincipalClaim = "sub"
+	}
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx FunctionContext) error {
+			token := ctx.bearerToken()
+			if token == "" {
+				ctx.SetResponseHeader("WWW-Authenticate", "Bearer")
+				return Unauthorized("Missing bearer token")
+			}
+			claims, err := verifyJwt(ctx.Context, token, keySet(jwt.KeysUrl))
+			if err == nil {
+				err = validateClaims(claims, jwt.Issuers, jwt.Audience)
+			}
+			if err != nil {
+				ctx.SetResponseHeader("WWW-Authenticate", `Bearer error="invalid_token"`)
+				return Unauthorized("Invalid bearer token").WithCause(err)
+			}
+			principal := Principal{Claims: claims}.Claim(jwt.PrincipalClaim)
+			return next(ctx.WithPrincipal(principal, claims))
+		}
+	}
+}
+
+// Claims returns the claims of the token the request was authenticated with, e.g. by RequireJWT, and false if the request hasn't been authenticated
+func (this FunctionContext) Claims() (map[string]interface{}, bool) {
+	principal, ok := this.Principal()
+	if !ok {
+		return nil, false
+	}
+	return principal.Claims, true
+}
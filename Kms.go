@@ -0,0 +1,248 @@
+package toolkit
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDataKeyLifetime is how long an Encrypter keeps using a data key, and caches the data keys it decrypted, when KeyLifetime isn't set
+const DefaultDataKeyLifetime = 10 * time.Minute
+
+// Encrypter encrypts payloads with envelope encryption: every payload is encrypted locally with AES-256-GCM by a data key, which is itself encrypted by a Cloud KMS key
+// and stored in the ciphertext. Data keys are reused and cached for the KeyLifetime, so most payloads are encrypted and decrypted without calling KMS.
+// The function's service account needs the Cloud KMS CryptoKey Encrypter/Decrypter role on the key
+type Encrypter struct {
+	// Key is the full name of the KMS key, e.g. `projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>`
+	Key string
+	// KeyLifetime is how long a data key encrypts payloads before a new one is generated, and how long decrypted data keys are cached
+	KeyLifetime time.Duration
+	// Endpoint is the address of the Cloud KMS API
+	Endpoint string
+
+	mutex     sync.Mutex
+	current   *dataKey
+	decrypted map[string]*dataKey
+	fetches   map[string]*keyFetch
+}
+
+// currentKeyFetch identifies the generation of a new current data key among the fetches of an Encrypter, which are otherwise identified by the wrapped data key
+const currentKeyFetch = ""
+
+// keyFetch is a KMS call shared by the concurrent Encrypt or Decrypt calls needing the same data key
+type keyFetch struct {
+	done chan struct{}
+	key  *dataKey
+	err  error
+}
+
+// dataKey is an AES key and its ciphertext encrypted with the KMS key
+type dataKey struct {
+	aead    cipher.AEAD
+	wrapped []byte
+	expiry  time.Time
+}
+
+// encryptedPayload is the format of the ciphertexts of an Encrypter
+type encryptedPayload struct {
+	Key        string `json:"key"`
+	DataKey    []byte `json:"dataKey"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// NewEncrypter creates an encrypter with the given KMS key. A key without the `projects/` prefix is a key of the project the function runs in,
+// e.g. `locations/europe-west1/keyRings/payments/cryptoKeys/cards`
+func NewEncrypter(key string) *Encrypter {
+	if !strings.HasPrefix(key, "projects/") {
+		key = "projects/" + projectId() + "/" + key
+	}
+	return &Encrypter{Key: key, KeyLifetime: DefaultDataKeyLifetime, Endpoint: "https://cloudkms.googleapis.com", decrypted: map[string]*dataKey{}}
+}
+
+// encrypters are the shared Encrypters of Encrypt and Decrypt, by the key given by the function
+var encrypters sync.Map
+
+// Encrypt encrypts the plaintext with the given KMS key, using a shared Encrypter for every key
+func Encrypt(ctx FunctionContext, key string, plaintext []byte) ([]byte, error) {
+	return sharedEncrypter(key).Encrypt(ctx, plaintext)
+}
+
+// Decrypt decrypts a ciphertext created by Encrypt or an Encrypter with the given KMS key, using the shared Encrypter of the key.
+// Ciphertexts naming another key are rejected without calling KMS
+func Decrypt(ctx FunctionContext, key string, ciphertext []byte) ([]byte, error) {
+	return sharedEncrypter(key).Decrypt(ctx, ciphertext)
+}
+
+// sharedEncrypter returns the shared Encrypter of the key, creating it on first use
+func sharedEncrypter(key string) *Encrypter {
+	if encrypter, ok := encrypters.Load(key); ok {
+		return encrypter.(*Encrypter)
+	}
+	encrypter, _ := encrypters.LoadOrStore(key, NewEncrypter(key))
+	return encrypter.(*Encrypter)
+}
+
+// Encrypt encrypts the plaintext with the current data key, generating a new one with KMS if it has expired
+func (this *Encrypter) Encrypt(ctx FunctionContext, plaintext []byte) ([]byte, error) {
+	key, err := this.currentKey(ctx)
+	if err != nil {
+		ctx.withSkip(1).Warnf("Failed to generate a data key with %v: %v", this.Key, err)
+		return nil, err
+	}
+	nonce := make([]byte, key.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return json.Marshal(encryptedPayload{
+		Key:        this.Key,
+		DataKey:    key.wrapped,
+		Nonce:      nonce,
+		Ciphertext: key.aead.Seal(nil, nonce, plaintext, []byte(this.Key)),
+	})
+}
+
+// Decrypt decrypts a ciphertext created with the encrypter's key, decrypting its data key with KMS unless it's cached
+func (this *Encrypter) Decrypt(ctx FunctionContext, ciphertext []byte) ([]byte, error) {
+	var payload encryptedPayload
+	if err := json.Unmarshal(ciphertext, &payload); err != nil || len(payload.DataKey) == 0 {
+		return nil, errors.New("invalid ciphertext")
+	}
+	if payload.Key != this.Key {
+		return nil, fmt.Errorf("ciphertext was encrypted with %v, not %v", payload.Key, this.Key)
+	}
+	key, err := this.decryptedKey(ctx, payload.DataKey)
+	if err != nil {
+		ctx.withSkip(1).Warnf("Failed to decrypt the data key with %v: %v", this.Key, err)
+		return nil, err
+	}
+	if len(payload.Nonce) != key.aead.NonceSize() {
+		return nil, errors.New("invalid ciphertext")
+	}
+	plaintext, err := key.aead.Open(nil, payload.Nonce, payload.Ciphertext, []byte(this.Key))
+	if err != nil {
+		return nil, errors.New("ciphertext can't be authenticated")
+	}
+	return plaintext, nil
+}
+
+// currentKey returns the data key payloads are encrypted with, generating a new one if it has expired
+func (this *Encrypter) currentKey(ctx FunctionContext) (*dataKey, error) {
+	cached := func() *dataKey {
+		if this.current != nil && time.Now().Before(this.current.expiry) {
+			return this.current
+		}
+		return nil
+	}
+	return this.sharedKey(ctx, currentKeyFetch, cached, func() (*dataKey, error) {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		var response struct {
+			Ciphertext []byte `json:"ciphertext"`
+		}
+		if err := googleApi(ctx.Context, http.MethodPost, this.Endpoint+"/v1/"+this.Key+":encrypt", map[string]interface{}{"plaintext": secret}, &response); err != nil {
+			return nil, err
+		}
+		ctx.withSkip(4).Debugf("Generated a data key with %v", this.Key)
+		return this.newDataKey(secret, response.Ciphertext)
+	})
+}
+
+// decryptedKey returns the data key of a ciphertext, from the cache or by decrypting it with KMS
+func (this *Encrypter) decryptedKey(ctx FunctionContext, wrapped []byte) (*dataKey, error) {
+	cached := func() *dataKey {
+		if key, ok := this.decrypted[string(wrapped)]; ok && time.Now().Before(key.expiry) {
+			return key
+		}
+		return nil
+	}
+	return this.sharedKey(ctx, string(wrapped), cached, func() (*dataKey, error) {
+		var response struct {
+			Plaintext []byte `json:"plaintext"`
+		}
+		if err := googleApi(ctx.Context, http.MethodPost, this.Endpoint+"/v1/"+this.Key+":decrypt", map[string]interface{}{"ciphertext": wrapped}, &response); err != nil {
+			return nil, err
+		}
+		return this.newDataKey(response.Plaintext, wrapped)
+	})
+}
+
+// sharedKey returns the cached data key, or fetches it from KMS. The mutex is only held to check and update the cache, so a slow KMS call doesn't block
+// the payloads of other data keys, and concurrent calls missing the same data key wait for a single fetch
+func (this *Encrypter) sharedKey(ctx FunctionContext, id string, cached func() *dataKey, fetch func() (*dataKey, error)) (*dataKey, error) {
+	this.mutex.Lock()
+	if key := cached(); key != nil {
+		this.mutex.Unlock()
+		return key, nil
+	}
+	call, fetching := this.fetches[id]
+	if !fetching {
+		call = &keyFetch{done: make(chan struct{})}
+		if this.fetches == nil {
+			this.fetches = map[string]*keyFetch{}
+		}
+		this.fetches[id] = call
+	}
+	this.mutex.Unlock()
+	if fetching {
+		select {
+		case <-call.done:
+			return call.key, call.err
+		case <-ctx.Context.Done():
+			return nil, ctx.Context.Err()
+		}
+	}
+
+	call.key, call.err = fetch()
+	this.mutex.Lock()
+	delete(this.fetches, id)
+	if call.err == nil {
+		this.cache(call.key)
+		if id == currentKeyFetch {
+			this.current = call.key
+		}
+	}
+	this.mutex.Unlock()
+	close(call.done)
+	return call.key, call.err
+}
+
+// newDataKey creates a data key from its secret and its ciphertext encrypted with the KMS key
+func (this *Encrypter) newDataKey(secret []byte, wrapped []byte) (*dataKey, error) {
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	lifetime := this.KeyLifetime
+	if lifetime == 0 {
+		lifetime = DefaultDataKeyLifetime
+	}
+	return &dataKey{aead: aead, wrapped: wrapped, expiry: time.Now().Add(lifetime)}, nil
+}
+
+// cache caches the data key for decryption, removing the expired ones from the cache. Must be called with the mutex locked
+func (this *Encrypter) cache(key *dataKey) {
+	now := time.Now()
+	for cached, other := range this.decrypted {
+		if now.After(other.expiry) {
+			delete(this.decrypted, cached)
+		}
+	}
+	if this.decrypted == nil {
+		this.decrypted = map[string]*dataKey{}
+	}
+	this.decrypted[string(key.wrapped)] = key
+}
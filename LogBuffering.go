@@ -0,0 +1,117 @@
+package toolkit
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// LogBuffering configures the buffering of DEBUG and INFO messages until the outcome of the request is known. Enable it with WithLogBuffering
+type LogBuffering struct {
+	// LatencyThreshold writes the buffered messages of requests which took longer than it, even if they succeeded. 0 disables it
+	LatencyThreshold time.Duration
+	// MaxEntries is the number of messages buffered per request, the oldest ones are dropped beyond it. Defaults to 1000
+	MaxEntries int
+}
+
+// WithLogBuffering buffers the DEBUG and INFO messages of every request, and only writes them if the request fails (a 5xx status or an error passed to ErrResponse),
+// logs an ERROR message, or is slower than the latency threshold. Otherwise a single summary line is written instead.
+// WARN and ERROR messages are always written immediately. Messages of requests which never write a response through the ctx are lost
+func WithLogBuffering(buffering LogBuffering) Option {
+	return func(config *Config) {
+		if buffering.MaxEntries <= 0 {
+			buffering.MaxEntries = 1000
+		}
+		config.LogBuffering = &buffering
+	}
+}
+
+// WithoutLogBuffering writes every message immediately
+func WithoutLogBuffering() Option {
+	return func(config *Config) {
+		config.LogBuffering = nil
+	}
+}
+
+// logBuffer is the log writer of a request which holds on to its DEBUG and INFO entries
+type logBuffer struct {
+	out         io.Writer
+	maxEntries  int
+	mutex       sync.Mutex
+	entries     []bufferedEntry
+	dropped     int
+	passThrough bool
+}
+
+type bufferedEntry struct {
+	level zerolog.Level
+	data  []byte
+}
+
+func (this *logBuffer) Write(p []byte) (int, error) {
+	return this.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (this *logBuffer) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.passThrough || (level >= zerolog.WarnLevel && level != zerolog.NoLevel) {
+		//  An ERROR means the request is failing, so the entries leading up to it are written too
+		if level >= zerolog.ErrorLevel && level != zerolog.NoLevel {
+			this.flushLocked()
+		}
+		return this.writeEntry(level, p)
+	}
+	if len(this.entries) >= this.maxEntries {
+		this.entries = this.entries[1:]
+		this.dropped++
+	}
+	//  zerolog reuses the buffer of the entry once it's been written
+	this.entries = append(this.entries, bufferedEntry{level: level, data: append([]byte{}, p...)})
+	return len(p), nil
+}
+
+func (this *logBuffer) writeEntry(level zerolog.Level, p []byte) (int, error) {
+	if levelWriter, ok := this.out.(zerolog.LevelWriter); ok {
+		return levelWriter.WriteLevel(level, p)
+	}
+	return this.out.Write(p)
+}
+
+// flushLocked writes the buffered entries, and every entry after them immediately
+func (this *logBuffer) flushLocked() {
+	for _, entry := range this.entries {
+		_, _ = this.writeEntry(entry.level, entry.data)
+	}
+	this.entries = nil
+	this.passThrough = true
+}
+
+// discard drops the buffered entries, and writes every entry after them immediately. Returns the number of entries dropped
+func (this *logBuffer) discard() int {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	dropped := len(this.entries) + this.dropped
+	this.entries = nil
+	this.passThrough = true
+	return dropped
+}
+
+// finishLogBuffer writes the buffered entries of a failed or slow request, or a summary line in place of those of a successful one
+func (this FunctionContext) finishLogBuffer(status int, err error) {
+	buffer := this.state.logBuffer
+	latency := time.Since(this.state.start)
+	threshold := config.LogBuffering.LatencyThreshold
+	if status >= 500 || err != nil || (threshold > 0 && latency > threshold) {
+		buffer.mutex.Lock()
+		buffer.flushLocked()
+		buffer.mutex.Unlock()
+		return
+	}
+	if dropped := buffer.discard(); dropped > 0 {
+		this.Logger.Info().Ctx(this.Context).Int("droppedLogEntries", dropped).
+			Msgf(this.spanIdLogField+"Responded with status %v in %v, %v buffered log entries were not written", status, latency.Round(time.Microsecond), dropped)
+	}
+}
@@ -0,0 +1,65 @@
+package toolkit
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// SetLogLevel changes the minimum level of the messages written by every logger of the instance, e.g. `tk.SetLogLevel(tk.LogLevelWarn)`.
+// It takes effect immediately, including for requests being handled
+func SetLogLevel(level int) {
+	zerolog.SetGlobalLevel(zerologLevel(level))
+}
+
+// zerologLevel maps the toolkit log levels to zerolog's
+func zerologLevel(level int) zerolog.Level {
+	switch level {
+	case LogLevelInfo:
+		return zerolog.InfoLevel
+	case LogLevelWarn:
+		return zerolog.WarnLevel
+	case LogLevelError:
+		return zerolog.ErrorLevel
+	case LogLevelFatal:
+		return zerolog.FatalLevel
+	case LogLevelPanic:
+		return zerolog.PanicLevel
+	default:
+		return zerolog.DebugLevel
+	}
+}
+
+// LogLevelHandler returns an admin handler which reports the current log level on GET, and changes it on POST or PUT with the `level` query parameter
+// (debug, info, warn or error). Requests must have an `Authorization: Bearer <token>` header with the given token, every request is refused if it's empty
+func LogLevelHandler(token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := FuncCtx(w, r)
+		if token == "" || subtle.ConstantTimeCompare([]byte(ctx.bearerToken()), []byte(token)) != 1 {
+			ctx.FailResponse(http.StatusUnauthorized, "Invalid admin token")
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost, http.MethodPut:
+			name := strings.ToLower(r.URL.Query().Get("level"))
+			if name == "warning" {
+				name = "warn"
+			}
+			level, err := zerolog.ParseLevel(name)
+			if err != nil || name == "" || level < zerolog.DebugLevel || level > zerolog.ErrorLevel {
+				ctx.FailResponse(http.StatusBadRequest, "Level must be one of debug, info, warn or error")
+				return
+			}
+			zerolog.SetGlobalLevel(level)
+			ctx.Warnf("Log level changed to %v", level)
+		default:
+			ctx.SetResponseHeader("Allow", "GET, POST, PUT")
+			ctx.FailResponse(http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		ctx.OkResponseJson(Json{"level": zerolog.GlobalLevel().String()})
+	})
+}
@@ -0,0 +1,98 @@
+package toolkit
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// LogSampling configures which log messages are dropped to limit the volume of logs written by busy functions. Enable it with WithLogSampling
+type LogSampling struct {
+	// DebugEvery keeps one in every DebugEvery DEBUG messages. 0 or 1 keeps all of them
+	DebugEvery uint32
+	// InfoEvery keeps one in every InfoEvery INFO messages. 0 or 1 keeps all of them
+	InfoEvery uint32
+	// WarnBurst is how many identical WARN messages are written per WarnPeriod, further repeats are dropped. 0 keeps all of them
+	WarnBurst int
+	// WarnPeriod is the period WarnBurst applies to. Defaults to a minute
+	WarnPeriod time.Duration
+}
+
+// logSampler holds the state of the sampling, which is shared by every request of the instance
+var logSampler struct {
+	debugCount  atomic.Uint32
+	infoCount   atomic.Uint32
+	mutex       sync.Mutex
+	windowStart time.Time
+	warnCounts  map[string]int
+}
+
+// WithLogSampling drops DEBUG and INFO messages and repeated WARN messages according to the given sampling. ERROR messages are never dropped
+func WithLogSampling(sampling LogSampling) Option {
+	return func(config *Config) {
+		if sampling.WarnPeriod <= 0 {
+			sampling.WarnPeriod = time.Minute
+		}
+		config.LogSampling = &sampling
+		logSampler.debugCount.Store(0)
+		logSampler.infoCount.Store(0)
+		logSampler.mutex.Lock()
+		logSampler.warnCounts = map[string]int{}
+		logSampler.windowStart = time.Now()
+		logSampler.mutex.Unlock()
+	}
+}
+
+// WithoutLogSampling writes every log message
+func WithoutLogSampling() Option {
+	return func(config *Config) {
+		config.LogSampling = nil
+	}
+}
+
+// samplingHook is the zerolog hook which drops the messages of a request according to the sampling config
+type samplingHook struct {
+	sampling *LogSampling
+	// prefix is the span id prefix of the request, ignored when comparing WARN messages
+	prefix string
+}
+
+func (this samplingHook) Run(e *zerolog.Event, level zerolog.Level, message string) {
+	switch level {
+	case zerolog.DebugLevel:
+		if !keepEvery(&logSampler.debugCount, this.sampling.DebugEvery) {
+			e.Discard()
+		}
+	case zerolog.InfoLevel:
+		if !keepEvery(&logSampler.infoCount, this.sampling.InfoEvery) {
+			e.Discard()
+		}
+	case zerolog.WarnLevel:
+		if this.sampling.WarnBurst > 0 && !this.keepWarn(strings.TrimPrefix(message, this.prefix)) {
+			e.Discard()
+		}
+	}
+}
+
+// keepEvery returns true for one in every n calls
+func keepEvery(counter *atomic.Uint32, n uint32) bool {
+	if n <= 1 {
+		return true
+	}
+	return (counter.Add(1)-1)%n == 0
+}
+
+// keepWarn counts the occurrences of the message in the current period, returning false once it's been written WarnBurst times
+func (this samplingHook) keepWarn(message string) bool {
+	logSampler.mutex.Lock()
+	defer logSampler.mutex.Unlock()
+	if time.Since(logSampler.windowStart) > this.sampling.WarnPeriod || logSampler.warnCounts == nil {
+		logSampler.warnCounts = map[string]int{}
+		logSampler.windowStart = time.Now()
+	}
+	logSampler.warnCounts[message]++
+	return logSampler.warnCounts[message] <= this.sampling.WarnBurst
+}
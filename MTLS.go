@@ -0,0 +1,148 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// MTLSConfig describes the client certificate presented to APIs requiring mutual TLS, e.g. partner banks. The certificate and key are read from Secret Manager secrets
+// and cached, and read again every RefreshInterval so that rotated certificates are used without a deployment.
+// Declare it as a package variable so that its connections are reused by every request of a warm instance
+type MTLSConfig struct {
+	// CertificateSecret is the secret holding the PEM encoded client certificate, followed by its intermediate certificates. It may also hold the private key
+	CertificateSecret string
+	// KeySecret is the secret holding the PEM encoded private key of the certificate. The key is read from the CertificateSecret when it's empty
+	KeySecret string
+	// CASecret is the secret holding the PEM encoded certificates of the authorities the server's certificate must be issued by. Defaults to the system's authorities
+	CASecret string
+	// ServerName overrides the name the server's certificate is verified against, which defaults to the host of the requests
+	ServerName string
+	// RefreshInterval is how long the secrets are cached for. Defaults to 5 minutes
+	RefreshInterval time.Duration
+	// Endpoint is the address of the Secret Manager API
+	Endpoint string
+
+	mutex     sync.Mutex
+	transport *http.Transport
+	material  []byte
+	fetchedAt time.Time
+}
+
+// NewMTLSConfig creates the config of a client certificate and key held by the given secrets
+func NewMTLSConfig(certificateSecret string, keySecret string) *MTLSConfig {
+	return &MTLSConfig{CertificateSecret: certificateSecret, KeySecret: keySecret, Endpoint: secretManagerEndpoint}
+}
+
+// HTTPClient returns an http.Client which presents the client certificate and adds the ctx's trace headers to every request it sends
+func (this *MTLSConfig) HTTPClient(ctx FunctionContext) *http.Client {
+	trace := ctx.currentTrace()
+	return &http.Client{Transport: &tracingTransport{base: this.Transport(), trace: &trace}}
+}
+
+// Transport returns a transport presenting the client certificate. Requests fail if the secrets can't be read or don't hold a valid certificate
+func (this *MTLSConfig) Transport() http.RoundTripper {
+	return &mtlsTransport{config: this}
+}
+
+// current returns the transport of the current certificate, reading the secrets if they aren't cached. A new transport is created when the secrets changed,
+// and the connections of the previous one are closed once idle. If the secrets can't be read, the certificate read before is used for another RefreshInterval,
+// so requests don't wait for a failing API one after the other
+func (this *MTLSConfig) current(ctx context.Context) (*http.Transport, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	refreshInterval := this.RefreshInterval
+	if refreshInterval <= 0 {
+		refreshInterval = 5 * time.Minute
+	}
+	if this.transport != nil && time.Since(this.fetchedAt) < refreshInterval {
+		return this.transport, nil
+	}
+	transport, material, err := this.load(ctx)
+	if err != nil {
+		if this.transport != nil {
+			this.fetchedAt = time.Now()
+			return this.transport, nil
+		}
+		return nil, err
+	}
+	this.fetchedAt = time.Now()
+	if this.transport != nil && bytes.Equal(material, this.material) {
+		return this.transport, nil
+	}
+	if this.transport != nil {
+		this.transport.CloseIdleConnections()
+	}
+	this.transport, this.material = transport, material
+	return transport, nil
+}
+
+// load reads the secrets and creates a transport presenting their certificate. It also returns the contents of the secrets, to tell when they're rotated
+func (this *MTLSConfig) load(ctx context.Context) (*http.Transport, []byte, error) {
+	if this.CertificateSecret == "" {
+		return nil, nil, errors.New("mTLS certificate secret is missing")
+	}
+	endpoint := this.Endpoint
+	if endpoint == "" {
+		endpoint = secretManagerEndpoint
+	}
+	var payloads [3][]byte
+	for i, secret := range []string{this.CertificateSecret, this.KeySecret, this.CASecret} {
+		if secret == "" {
+			continue
+		}
+		payload, err := accessSecret(ctx, endpoint, secret)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read the mTLS secret %v: %w", secret, err)
+		}
+		payloads[i] = payload
+	}
+	if payloads[1] == nil {
+		payloads[1] = payloads[0]
+	}
+	certificate, err := tls.X509KeyPair(payloads[0], payloads[1])
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid mTLS certificate in %v: %w", this.CertificateSecret, err)
+	}
+	if certificate.Leaf == nil {
+		if certificate.Leaf, err = x509.ParseCertificate(certificate.Certificate[0]); err != nil {
+			return nil, nil, fmt.Errorf("invalid mTLS certificate in %v: %w", this.CertificateSecret, err)
+		}
+	}
+	if now := time.Now(); now.After(certificate.Leaf.NotAfter) || now.Before(certificate.Leaf.NotBefore) {
+		return nil, nil, fmt.Errorf("mTLS certificate %v in %v is only valid from %v to %v", certificate.Leaf.Subject, this.CertificateSecret,
+			certificate.Leaf.NotBefore.Format(time.RFC3339), certificate.Leaf.NotAfter.Format(time.RFC3339))
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{certificate}, ServerName: this.ServerName, MinVersion: tls.VersionTLS12}
+	if payloads[2] != nil {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(payloads[2]) {
+			return nil, nil, fmt.Errorf("no PEM encoded certificate in the mTLS secret %v", this.CASecret)
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return transport, bytes.Join(payloads[:], []byte{0}), nil
+}
+
+// mtlsTransport sends requests with the transport of the current certificate of a config
+type mtlsTransport struct {
+	config *MTLSConfig
+}
+
+func (this *mtlsTransport) RoundTrip(rq *http.Request) (*http.Response, error) {
+	transport, err := this.config.current(rq.Context())
+	if err != nil {
+		if rq.Body != nil {
+			_ = rq.Body.Close()
+		}
+		return nil, err
+	}
+	return transport.RoundTrip(rq)
+}
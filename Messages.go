@@ -0,0 +1,106 @@
+package toolkit
+
+import (
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// catalog contains the translated messages loaded by LoadMessages, by language and message key
+var catalog struct {
+	messages        map[string]map[string]string
+	defaultLanguage string
+}
+
+// LoadMessages loads a message catalog from the json files in the root of the given file system (usually an embed.FS).
+// Each file is named after its language (e.g. `en.json`, `pt-BR.json`) and contains an object mapping message keys to translated messages.
+// Once loaded, the messages passed to the error response methods are looked up as keys in the catalog, and translated to the language the client
+// prefers according to its Accept-Language header, falling back to the default language
+func LoadMessages(fsys fs.FS, defaultLanguage string) error {
+	files, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return err
+	}
+	messages := map[string]map[string]string{}
+	for _, file := range files {
+		bytes, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		var translations map[string]string
+		if err := codec.Unmarshal(bytes, &translations); err != nil {
+			return err
+		}
+		messages[strings.ToLower(strings.TrimSuffix(path.Base(file), ".json"))] = translations
+	}
+	catalog.messages = messages
+	catalog.defaultLanguage = strings.ToLower(defaultLanguage)
+	return nil
+}
+
+// Language returns the language from the message catalog which best matches the request's Accept-Language header, or the default language if none match
+func (this FunctionContext) Language() string {
+	type preference struct {
+		tag string
+		q   float64
+	}
+	var preferences []preference
+	for _, part := range strings.Split(this.Request.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" && q > 0 {
+			preferences = append(preferences, preference{tag, q})
+		}
+	}
+	sort.SliceStable(preferences, func(i, j int) bool { return preferences[i].q > preferences[j].q })
+
+	for _, preference := range preferences {
+		if _, ok := catalog.messages[preference.tag]; ok {
+			return preference.tag
+		}
+		if base, _, ok := strings.Cut(preference.tag, "-"); ok {
+			if _, ok := catalog.messages[base]; ok {
+				return base
+			}
+		}
+	}
+	return catalog.defaultLanguage
+}
+
+// T translates the message with the given key to the request's language. Returns the key itself if the catalog doesn't contain it
+func (this FunctionContext) T(key string) string {
+	if len(catalog.messages) == 0 {
+		return key
+	}
+	if message, ok := catalog.messages[this.Language()][key]; ok {
+		return message
+	}
+	if message, ok := catalog.messages[catalog.defaultLanguage][key]; ok {
+		return message
+	}
+	return key
+}
+
+// translateError translates the message and details of an error response, setting the Content-Language header when a catalog is loaded
+func (this FunctionContext) translateError(message string, details []ErrorDetail) (string, []ErrorDetail) {
+	if len(catalog.messages) == 0 {
+		return message, details
+	}
+	this.Response.Header().Set("Content-Language", this.Language())
+	translated := make([]ErrorDetail, len(details))
+	for i, detail := range details {
+		detail.Message = this.T(detail.Message)
+		translated[i] = detail
+	}
+	if details == nil {
+		translated = nil
+	}
+	return this.T(message), translated
+}
@@ -0,0 +1,45 @@
+package toolkit
+
+import (
+	"os"
+	"runtime/debug"
+	"time"
+)
+
+// ResponseMeta contains debugging information added to success responses when Config.ResponseMeta is enabled
+type ResponseMeta struct {
+	DurationMs     float64 `json:"durationMs"`
+	ToolkitVersion string  `json:"toolkitVersion,omitempty"`
+	AppVersion     string  `json:"appVersion,omitempty"`
+	Region         string  `json:"region,omitempty"`
+}
+
+// toolkitVersion is the version of this module the function was built with
+var toolkitVersion = func() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == "github.com/Platform48/function_toolkit" {
+			return dep.Version
+		}
+	}
+	return "(devel)"
+}()
+
+// region is the region the function is deployed in, if the platform exposes it
+var region = os.Getenv("FUNCTION_REGION")
+
+// responseMeta builds the metadata of this ctx's response, or returns nil if it's disabled in the toolkit config
+func (this FunctionContext) responseMeta() *ResponseMeta {
+	if !config.ResponseMeta {
+		return nil
+	}
+	return &ResponseMeta{
+		DurationMs:     float64(time.Since(this.state.start).Microseconds()) / 1000,
+		ToolkitVersion: toolkitVersion,
+		AppVersion:     config.AppVersion,
+		Region:         region,
+	}
+}
@@ -0,0 +1,296 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetricKind is the type of a metric
+type MetricKind string
+
+const (
+	MetricKindCounter   MetricKind = "counter"
+	MetricKindHistogram MetricKind = "histogram"
+)
+
+// Labels are the dimensions of a metric, e.g. `tk.Labels{"status": "200"}`
+type Labels map[string]string
+
+// DefaultHistogramBuckets are the upper bounds of the buckets used by histograms created without explicit buckets. Suited to latencies in milliseconds
+var DefaultHistogramBuckets = []float64{1, 2.5, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// MetricsExportInterval is how often the metrics are sent to the exporters added with WithMetricExporter
+var MetricsExportInterval = time.Minute
+
+// MetricPoint is the current value of a metric for one set of labels. Counters and histograms are cumulative since StartTime
+type MetricPoint struct {
+	Name      string
+	Kind      MetricKind
+	Labels    Labels
+	StartTime time.Time
+	// Value is the total of a counter
+	Value float64
+	// Count, Sum, Buckets and BucketCounts describe the distribution of a histogram. BucketCounts has one more entry than Buckets, for the values above the last bound
+	Count        uint64
+	Sum          float64
+	Buckets      []float64
+	BucketCounts []uint64
+}
+
+// MetricExporter sends the collected metrics to a monitoring backend
+type MetricExporter interface {
+	ExportMetrics(ctx context.Context, points []MetricPoint) error
+}
+
+type metricSeries struct {
+	labels       Labels
+	start        time.Time
+	value        float64
+	count        uint64
+	sum          float64
+	bucketCounts []uint64
+}
+
+type metric struct {
+	name    string
+	kind    MetricKind
+	buckets []float64
+	mutex   sync.Mutex
+	series  map[string]*metricSeries
+}
+
+var registry = struct {
+	mutex   sync.Mutex
+	metrics map[string]*metric
+}{metrics: map[string]*metric{}}
+
+// getMetric returns the registered metric with the given name, registering it if needed
+func getMetric(name string, kind MetricKind, buckets []float64) *metric {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	if existing, ok := registry.metrics[name]; ok {
+		if existing.kind != kind {
+			panic("metric " + name + " is already registered as a " + string(existing.kind))
+		}
+		return existing
+	}
+	m := &metric{name: name, kind: kind, buckets: buckets, series: map[string]*metricSeries{}}
+	registry.metrics[name] = m
+	return m
+}
+
+// seriesKey builds a key which uniquely identifies a set of labels
+func seriesKey(labels Labels) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var builder strings.Builder
+	for _, key := range keys {
+		builder.WriteString(key)
+		builder.WriteByte(0)
+		builder.WriteString(labels[key])
+		builder.WriteByte(0)
+	}
+	return builder.String()
+}
+
+// record updates the series of the given labels while holding the metric's lock
+func (this *metric) record(labels Labels, update func(series *metricSeries)) {
+	key := seriesKey(labels)
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	series, ok := this.series[key]
+	if !ok {
+		series = &metricSeries{labels: labels, start: time.Now()}
+		if this.kind == MetricKindHistogram {
+			series.bucketCounts = make([]uint64, len(this.buckets)+1)
+		}
+		this.series[key] = series
+	}
+	update(series)
+}
+
+// withLabels merges the given labels into a copy of the current ones
+func withLabels(current Labels, labels Labels) Labels {
+	merged := make(Labels, len(current)+len(labels))
+	for key, value := range current {
+		merged[key] = value
+	}
+	for key, value := range labels {
+		merged[key] = value
+	}
+	return merged
+}
+
+// CounterMetric is a value which only goes up, e.g. the number of orders created
+type CounterMetric struct {
+	metric *metric
+	labels Labels
+}
+
+// Counter returns the counter with the given name, creating it on first use
+func Counter(name string) CounterMetric {
+	return CounterMetric{metric: getMetric(name, MetricKindCounter, nil)}
+}
+
+// With returns a copy of this counter which records its values with the given labels added
+func (this CounterMetric) With(labels Labels) CounterMetric {
+	this.labels = withLabels(this.labels, labels)
+	return this
+}
+
+// Inc adds one to the counter
+func (this CounterMetric) Inc() {
+	this.Add(1)
+}
+
+// Add adds the given value to the counter. Negative values are ignored
+func (this CounterMetric) Add(value float64) {
+	if value < 0 {
+		return
+	}
+	this.metric.record(this.labels, func(series *metricSeries) {
+		series.value += value
+	})
+}
+
+// HistogramMetric records the distribution of a value, e.g. the latency of database calls
+type HistogramMetric struct {
+	metric *metric
+	labels Labels
+}
+
+// Histogram returns the histogram with the given name, creating it on first use with the given bucket upper bounds (DefaultHistogramBuckets if none are given).
+// The buckets of an existing histogram aren't changed
+func Histogram(name string, buckets ...float64) HistogramMetric {
+	if len(buckets) == 0 {
+		buckets = DefaultHistogramBuckets
+	}
+	sorted := append([]float64{}, buckets...)
+	sort.Float64s(sorted)
+	return HistogramMetric{metric: getMetric(name, MetricKindHistogram, sorted)}
+}
+
+// With returns a copy of this histogram which records its values with the given labels added
+func (this HistogramMetric) With(labels Labels) HistogramMetric {
+	this.labels = withLabels(this.labels, labels)
+	return this
+}
+
+// Observe records a value in the histogram
+func (this HistogramMetric) Observe(value float64) {
+	bucket := sort.SearchFloat64s(this.metric.buckets, value)
+	this.metric.record(this.labels, func(series *metricSeries) {
+		series.count++
+		series.sum += value
+		series.bucketCounts[bucket]++
+	})
+}
+
+// CollectMetrics returns the current value of every metric, sorted by name
+func CollectMetrics() []MetricPoint {
+	registry.mutex.Lock()
+	metrics := make([]*metric, 0, len(registry.metrics))
+	for _, m := range registry.metrics {
+		metrics = append(metrics, m)
+	}
+	registry.mutex.Unlock()
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].name < metrics[j].name })
+
+	var points []MetricPoint
+	for _, m := range metrics {
+		m.mutex.Lock()
+		keys := make([]string, 0, len(m.series))
+		for key := range m.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			series := m.series[key]
+			points = append(points, MetricPoint{
+				Name:         m.name,
+				Kind:         m.kind,
+				Labels:       series.labels,
+				StartTime:    series.start,
+				Value:        series.value,
+				Count:        series.count,
+				Sum:          series.sum,
+				Buckets:      m.buckets,
+				BucketCounts: append([]uint64{}, series.bucketCounts...),
+			})
+		}
+		m.mutex.Unlock()
+	}
+	return points
+}
+
+// ResetMetrics removes every metric and its values. Mainly useful in tests
+func ResetMetrics() {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	registry.metrics = map[string]*metric{}
+}
+
+var metricExporters = struct {
+	mutex     sync.Mutex
+	exporters []MetricExporter
+	loop      sync.Once
+}{}
+
+// WithMetricExporter adds an exporter which is sent the metrics every MetricsExportInterval from a background goroutine.
+// Call FlushMetrics before the instance stops to export the latest values
+func WithMetricExporter(exporter MetricExporter) Option {
+	return func(config *Config) {
+		metricExporters.mutex.Lock()
+		metricExporters.exporters = append(metricExporters.exporters, exporter)
+		metricExporters.mutex.Unlock()
+		metricExporters.loop.Do(func() {
+			go func() {
+				for range time.Tick(MetricsExportInterval) {
+					if err := FlushMetrics(context.Background()); err != nil {
+						backgroundLogger().Error().Err(err).Msg("Failed to export metrics")
+					}
+				}
+			}()
+		})
+	}
+}
+
+// FlushMetrics sends the current metrics to every exporter added with WithMetricExporter
+func FlushMetrics(ctx context.Context) error {
+	metricExporters.mutex.Lock()
+	exporters := metricExporters.exporters
+	metricExporters.mutex.Unlock()
+	if len(exporters) == 0 {
+		return nil
+	}
+	points := CollectMetrics()
+	var errs []error
+	for _, exporter := range exporters {
+		if err := exporter.ExportMetrics(ctx, points); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// recordRequestMetrics updates the built-in request count and latency metrics once the response has been written
+func (this FunctionContext) recordRequestMetrics(status int) {
+	labels := Labels{"method": this.Request.Method, "status": statusClass(status)}
+	Counter("requests_total").With(labels).Inc()
+	Histogram("request_duration_ms").With(labels).Observe(float64(time.Since(this.state.start).Microseconds()) / 1000)
+}
+
+// statusClass groups status codes by their first digit (e.g. 2xx) to keep the number of series small
+func statusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+	return string(rune('0'+status/100)) + "xx"
+}
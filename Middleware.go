@@ -0,0 +1,40 @@
+package toolkit
+
+import "net/http"
+
+// HandlerFunc is a handler which receives the ctx of the request, and returns the error to respond with, if any
+type HandlerFunc func(ctx FunctionContext) error
+
+// Middleware wraps a handler with a cross-cutting concern, e.g. authentication. It can change the ctx passed to the next handler,
+// respond without calling it, or act on the error it returns
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// MiddlewareChain is a list of middleware applied to handlers in order, created with Chain
+type MiddlewareChain struct {
+	middleware []Middleware
+}
+
+// Chain creates a chain of the given middleware. The first one is the outermost, so it's the first to see the request and the last to see the error
+func Chain(middleware ...Middleware) MiddlewareChain {
+	return MiddlewareChain{middleware: append([]Middleware(nil), middleware...)}
+}
+
+// Append returns a new chain with the given middleware added after the middleware of this chain
+func (this MiddlewareChain) Append(middleware ...Middleware) MiddlewareChain {
+	combined := make([]Middleware, 0, len(this.middleware)+len(middleware))
+	combined = append(combined, this.middleware...)
+	return MiddlewareChain{middleware: append(combined, middleware...)}
+}
+
+// Wrap returns the handler wrapped in the middleware of the chain
+func (this MiddlewareChain) Wrap(handler HandlerFunc) HandlerFunc {
+	for i := len(this.middleware) - 1; i >= 0; i-- {
+		handler = this.middleware[i](handler)
+	}
+	return handler
+}
+
+// Then wraps the handler in the middleware of the chain, and adapts it into an http.HandlerFunc with Handle
+func (this MiddlewareChain) Then(handler HandlerFunc) http.HandlerFunc {
+	return Handle(this.Wrap(handler))
+}
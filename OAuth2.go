@@ -0,0 +1,273 @@
+package toolkit
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OAuth2TokenSource gets access tokens for a third-party API from an OAuth2 token endpoint, with the client credentials or JWT bearer grant, and caches them until they expire.
+// Declare it as a package variable so that its token is shared by every request of a warm instance. Tokens are refreshed in the background once they're
+// within RefreshBefore of their expiry, so requests only wait for the token endpoint when there's no valid token
+type OAuth2TokenSource struct {
+	// TokenUrl is the address of the token endpoint, e.g. `https://login.example.com/oauth2/token`
+	TokenUrl string
+	ClientId string
+	// ClientSecret authenticates the client credentials grant
+	ClientSecret string
+	// ClientSecretInBody sends the client id and secret as form fields instead of a basic Authorization header, for endpoints which only support client_secret_post
+	ClientSecretInBody bool
+	// Assertion creates the signed JWT of the JWT bearer grant. The client credentials grant is used when it's nil, see JwtBearerAssertion
+	Assertion func() (string, error)
+	Scopes    []string
+	// Params are added to the token requests, e.g. the `audience` some providers require
+	Params url.Values
+	// RefreshBefore is how long before a token expires it's refreshed in the background. Defaults to 1 minute
+	RefreshBefore time.Duration
+	// Client sends the token requests. Defaults to a client adding the trace headers of the request
+	Client *http.Client
+
+	mutex      sync.Mutex
+	fetching   sync.Mutex
+	token      string
+	expiry     time.Time
+	refreshing bool
+}
+
+// NewClientCredentialsTokenSource creates a token source using the client credentials grant of the given client
+func NewClientCredentialsTokenSource(tokenURL string, clientId string, clientSecret string, scopes ...string) *OAuth2TokenSource {
+	return &OAuth2TokenSource{TokenUrl: tokenURL, ClientId: clientId, ClientSecret: clientSecret, Scopes: scopes}
+}
+
+// NewJwtBearerTokenSource creates a token source using the JWT bearer grant (RFC 7523), whose assertions are signed by the key, see JwtBearerAssertion
+func NewJwtBearerTokenSource(tokenURL string, issuer string, key crypto.Signer, scopes ...string) *OAuth2TokenSource {
+	return &OAuth2TokenSource{TokenUrl: tokenURL, Assertion: JwtBearerAssertion(issuer, tokenURL, key), Scopes: scopes}
+}
+
+// JwtBearerAssertion returns a function creating the assertions of the JWT bearer grant, issued by and about the issuer for the audience (usually the token endpoint),
+// and valid for 5 minutes. The key must be an RSA key, signing with RS256, or a P-256 key, signing with ES256
+func JwtBearerAssertion(issuer string, audience string, key crypto.Signer) func() (string, error) {
+	return func() (string, error) {
+		algorithm := "RS256"
+		if _, ok := key.Public().(*ecdsa.PublicKey); ok {
+			algorithm = "ES256"
+		}
+		now := time.Now()
+		header, _ := json.Marshal(map[string]string{"alg": algorithm, "typ": "JWT"})
+		claims, err := json.Marshal(map[string]interface{}{"iss": issuer, "sub": issuer, "aud": audience, "iat": now.Unix(), "exp": now.Add(5 * time.Minute).Unix()})
+		if err != nil {
+			return "", err
+		}
+		unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+		digest := sha256.Sum256([]byte(unsigned))
+		signature, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+		if err != nil {
+			return "", err
+		}
+		if algorithm == "ES256" {
+			if signature, err = rawEcdsaSignature(signature); err != nil {
+				return "", err
+			}
+		}
+		return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+	}
+}
+
+// rawEcdsaSignature converts the ASN.1 signature created by ecdsa keys to the r and s values of 32 bytes each which JWTs carry
+func rawEcdsaSignature(encoded []byte) ([]byte, error) {
+	var values struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(encoded, &values); err != nil {
+		return nil, err
+	}
+	signature := make([]byte, 64)
+	values.R.FillBytes(signature[:32])
+	values.S.FillBytes(signature[32:])
+	return signature, nil
+}
+
+// Token returns the cached access token, or gets a new one if there's no valid token. A token which is about to expire is still returned while it's refreshed in the background
+func (this *OAuth2TokenSource) Token(ctx context.Context) (string, error) {
+	this.mutex.Lock()
+	token, expiry := this.token, this.expiry
+	now := time.Now()
+	if token != "" && now.Before(expiry) {
+		if now.After(expiry.Add(-this.refreshBefore())) && !this.refreshing {
+			this.refreshing = true
+			go func() {
+				_, _ = this.fetch(context.WithoutCancel(ctx), token)
+				this.mutex.Lock()
+				this.refreshing = false
+				this.mutex.Unlock()
+			}()
+		}
+		this.mutex.Unlock()
+		return token, nil
+	}
+	this.mutex.Unlock()
+	return this.fetch(ctx, token)
+}
+
+// Invalidate drops the cached token, e.g. when the API rejected it, so that the next call to Token gets a new one
+func (this *OAuth2TokenSource) Invalidate() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.token, this.expiry = "", time.Time{}
+}
+
+// HTTPClient returns an http.Client which adds the token source's access token and the ctx's trace headers to every request it sends
+func (this *OAuth2TokenSource) HTTPClient(ctx FunctionContext) *http.Client {
+	trace := ctx.currentTrace()
+	return &http.Client{Transport: &tracingTransport{base: this.Transport(nil), trace: &trace}}
+}
+
+// Transport wraps the given transport (http.DefaultTransport when nil) so that requests carry the access token in their Authorization header.
+// Requests rejected with a 401 status are sent once more with a new token, unless their body can't be replayed
+func (this *OAuth2TokenSource) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &oauth2Transport{source: this, base: base}
+}
+
+// fetch gets a new token from the token endpoint, unless another call replaced the stale token while it waited
+func (this *OAuth2TokenSource) fetch(ctx context.Context, stale string) (string, error) {
+	this.fetching.Lock()
+	defer this.fetching.Unlock()
+	this.mutex.Lock()
+	if this.token != stale && time.Now().Before(this.expiry) {
+		token := this.token
+		this.mutex.Unlock()
+		return token, nil
+	}
+	this.mutex.Unlock()
+	token, lifetime, err := this.request(ctx)
+	if err != nil {
+		return "", err
+	}
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.token, this.expiry = token, time.Now().Add(lifetime)
+	return token, nil
+}
+
+// request sends a token request, returning the access token and how long it's valid for. Tokens without an expiry are kept for 5 minutes
+func (this *OAuth2TokenSource) request(ctx context.Context) (string, time.Duration, error) {
+	form := url.Values{}
+	for name, values := range this.Params {
+		form[name] = values
+	}
+	if this.Assertion != nil {
+		assertion, err := this.Assertion()
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to sign the assertion: %w", err)
+		}
+		form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+		form.Set("assertion", assertion)
+	} else {
+		form.Set("grant_type", "client_credentials")
+	}
+	if len(this.Scopes) > 0 {
+		form.Set("scope", strings.Join(this.Scopes, " "))
+	}
+	if this.ClientSecretInBody && this.ClientId != "" {
+		form.Set("client_id", this.ClientId)
+		form.Set("client_secret", this.ClientSecret)
+	}
+	rq, err := http.NewRequestWithContext(ctx, http.MethodPost, this.TokenUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	rq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rq.Header.Set("Accept", "application/json")
+	if !this.ClientSecretInBody && this.ClientId != "" {
+		rq.SetBasicAuth(url.QueryEscape(this.ClientId), url.QueryEscape(this.ClientSecret))
+	}
+	client := this.Client
+	if client == nil {
+		client = &http.Client{Transport: NewTracingTransport(nil), Timeout: 30 * time.Second}
+	}
+	res, err := client.Do(rq)
+	if err != nil {
+		return "", 0, fmt.Errorf("token request to %v failed: %w", this.TokenUrl, err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", 0, err
+	}
+	var response struct {
+		AccessToken      string      `json:"access_token"`
+		ExpiresIn        json.Number `json:"expires_in"`
+		Error            string      `json:"error"`
+		ErrorDescription string      `json:"error_description"`
+	}
+	_ = json.Unmarshal(body, &response)
+	if res.StatusCode < 200 || res.StatusCode > 299 || response.AccessToken == "" {
+		if response.Error != "" {
+			return "", 0, fmt.Errorf("token request to %v failed with status %v: %v %v", this.TokenUrl, res.StatusCode, response.Error, response.ErrorDescription)
+		}
+		return "", 0, &httpStatusError{status: res.StatusCode, body: string(body)}
+	}
+	lifetime := 5 * time.Minute
+	if seconds, err := strconv.ParseInt(response.ExpiresIn.String(), 10, 64); err == nil && seconds > 0 {
+		lifetime = time.Duration(seconds) * time.Second
+	}
+	return response.AccessToken, lifetime, nil
+}
+
+// refreshBefore returns how long before their expiry tokens are refreshed
+func (this *OAuth2TokenSource) refreshBefore() time.Duration {
+	if this.RefreshBefore > 0 {
+		return this.RefreshBefore
+	}
+	return time.Minute
+}
+
+// oauth2Transport adds the access token of a token source to requests
+type oauth2Transport struct {
+	source *OAuth2TokenSource
+	base   http.RoundTripper
+}
+
+func (this *oauth2Transport) RoundTrip(rq *http.Request) (*http.Response, error) {
+	token, err := this.source.Token(rq.Context())
+	if err != nil {
+		return nil, err
+	}
+	authorized := rq.Clone(rq.Context())
+	authorized.Header.Set("Authorization", "Bearer "+token)
+	res, err := this.base.RoundTrip(authorized)
+	if err != nil || res.StatusCode != http.StatusUnauthorized || (rq.Body != nil && rq.GetBody == nil) {
+		return res, err
+	}
+	// The token may have been revoked before its expiry, so it's replaced and the request sent once more
+	this.source.Invalidate()
+	if token, err = this.source.Token(rq.Context()); err != nil {
+		return res, nil
+	}
+	retry := rq.Clone(rq.Context())
+	if rq.GetBody != nil {
+		if retry.Body, err = rq.GetBody(); err != nil {
+			return res, nil
+		}
+	}
+	_ = res.Body.Close()
+	retry.Header.Set("Authorization", "Bearer "+token)
+	return this.base.RoundTrip(retry)
+}
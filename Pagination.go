@@ -0,0 +1,94 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// DefaultPageSize is the limit returned by PageParams when the request doesn't specify one
+var DefaultPageSize = 20
+
+// MaxPageSize is the largest limit PageParams will return. Larger requested limits are clamped to this value
+var MaxPageSize = 100
+
+// PageParams contains the pagination parameters of a request. Either Offset or Cursor is set, depending on which the client sent
+type PageParams struct {
+	Limit  int
+	Offset int
+	Cursor string
+}
+
+// PageResponseStruct used internally to return data in a paginated json response. Exported to allow for manually building responses
+type PageResponseStruct struct {
+	SpanId        string        `json:"spanId"`
+	Data          interface{}   `json:"data,omitempty"`
+	NextPageToken string        `json:"nextPageToken,omitempty"`
+	Total         int           `json:"total"`
+	Meta          *ResponseMeta `json:"meta,omitempty"`
+}
+
+// PageParams parses the `limit`, `offset` and `pageToken` query parameters of the request.
+// The limit defaults to DefaultPageSize and is clamped between 1 and MaxPageSize. If a parameter is malformed a 400 response is sent, and false is returned
+func (this FunctionContext) PageParams() (PageParams, bool) {
+	query := this.Request.URL.Query()
+	params := PageParams{Limit: DefaultPageSize, Cursor: query.Get("pageToken")}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			this.withSkip(1).FailResponse(http.StatusBadRequest, "Query parameter limit must be a positive integer")
+			return PageParams{}, false
+		}
+		params.Limit = limit
+	}
+	if params.Limit > MaxPageSize {
+		params.Limit = MaxPageSize
+	}
+
+	if value := query.Get("offset"); value != "" {
+		if params.Cursor != "" {
+			this.withSkip(1).FailResponse(http.StatusBadRequest, "Query parameters offset and pageToken cannot be used together")
+			return PageParams{}, false
+		}
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			this.withSkip(1).FailResponse(http.StatusBadRequest, "Query parameter offset must be a non-negative integer")
+			return PageParams{}, false
+		}
+		params.Offset = offset
+	}
+	return params, true
+}
+
+// OkResponsePage sends a 200 json response containing one page of data, the token of the next page, and the total number of items.
+// The body is built by the configured ResponseFormatter, and the pagination fields are added to its envelope.
+// Pass an empty nextCursor when this is the last page. If the request has a `fields` query parameter, only the fields selected by it are included in the data
+func (this FunctionContext) OkResponsePage(data interface{}, nextCursor string, total int) {
+	data, err := this.filterFields(data)
+	if err != nil {
+		this.withSkip(1).FailResponse(http.StatusBadRequest, "Invalid fields parameter: "+err.Error())
+		return
+	}
+	this.withSkip(1).Debug("Responding with status 200")
+	this.writeJson(200, this.formatPage(data, nextCursor, total))
+}
+
+// formatPage builds the body of a page response with the configured formatter. The `nextPageToken` and `total` fields are added to the envelope
+// of custom formatters when it's a json object, otherwise their body is sent as is
+func (this FunctionContext) formatPage(data interface{}, nextCursor string, total int) interface{} {
+	body := config.Formatter.FormatSuccess(this, data)
+	if success, ok := body.(SuccessResponseStruct); ok {
+		return PageResponseStruct{SpanId: success.SpanId, Data: success.Data, NextPageToken: nextCursor, Total: total, Meta: success.Meta}
+	}
+	bytes, err := codec.Marshal(body)
+	var fields map[string]json.RawMessage
+	if err != nil || codec.Unmarshal(bytes, &fields) != nil || fields == nil {
+		return body
+	}
+	if nextCursor != "" {
+		fields["nextPageToken"], _ = codec.Marshal(nextCursor)
+	}
+	fields["total"], _ = codec.Marshal(total)
+	return fields
+}
@@ -0,0 +1,78 @@
+package toolkit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Principal is the authenticated user or service account a request is made by
+type Principal struct {
+	Id     string
+	Claims map[string]interface{}
+}
+
+// Claim returns the claim with the given name as a string, or an empty string if it's missing
+func (this Principal) Claim(name string) string {
+	value, ok := this.Claims[name]
+	if !ok || value == nil {
+		return ""
+	}
+	if text, ok := value.(string); ok {
+		return text
+	}
+	return fmt.Sprint(value)
+}
+
+// ClaimStrings returns the claim with the given name as a list of strings (e.g. roles or scopes). A single string claim is split on spaces, like the OAuth2 scope claim
+func (this Principal) ClaimStrings(name string) []string {
+	switch value := this.Claims[name].(type) {
+	case []string:
+		return value
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			values = append(values, fmt.Sprint(item))
+		}
+		return values
+	case string:
+		return strings.Fields(value)
+	default:
+		return nil
+	}
+}
+
+type principalKey struct{}
+
+// WithPrincipal generates a copy of this ctx object for the request made by the given principal, once it's been authenticated.
+// Its log messages carry a `principal` field with the id, and the principal is available through ctx.Principal and PrincipalFromContext.
+// The claims aren't logged
+func (this FunctionContext) WithPrincipal(id string, claims map[string]interface{}) FunctionContext {
+	principal := Principal{Id: id, Claims: claims}
+	this.state.mutex.Lock()
+	this.state.principal = &principal
+	this.state.mutex.Unlock()
+	logger := this.Logger.With().Str("principal", id).Logger()
+	this.Logger = &logger
+	this.Context = context.WithValue(this.Context, principalKey{}, principal)
+	return this
+}
+
+// Principal returns the principal set with WithPrincipal, and false if the request hasn't been authenticated
+func (this FunctionContext) Principal() (Principal, bool) {
+	if principal, ok := PrincipalFromContext(this.Context); ok {
+		return principal, true
+	}
+	this.state.mutex.Lock()
+	defer this.state.mutex.Unlock()
+	if this.state.principal != nil {
+		return *this.state.principal, true
+	}
+	return Principal{}, false
+}
+
+// PrincipalFromContext returns the principal of the ctx the context was created from, for code which only has access to the context.Context
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
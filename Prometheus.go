@@ -0,0 +1,81 @@
+package toolkit
+
+import (
+	"bytes"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MetricsHandler returns a handler which serves the built-in and user metrics in the Prometheus text format
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = w.Write(prometheusText(CollectMetrics()))
+	})
+}
+
+// ServeMetrics serves MetricsHandler at /metrics on the given address (e.g. ":9464") from a background goroutine,
+// so it can be scraped by the Cloud Run managed Prometheus sidecar without exposing it on the function's own port
+func ServeMetrics(address string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", MetricsHandler())
+	go func() {
+		if err := http.ListenAndServe(address, mux); err != nil {
+			backgroundLogger().Error().Err(err).Msg("Metrics server stopped")
+		}
+	}()
+}
+
+// prometheusText formats the metric points in the Prometheus text exposition format
+func prometheusText(points []MetricPoint) []byte {
+	var buffer bytes.Buffer
+	previous := ""
+	for _, point := range points {
+		if point.Name != previous {
+			buffer.WriteString("# TYPE " + point.Name + " " + string(point.Kind) + "\n")
+			previous = point.Name
+		}
+		if point.Kind == MetricKindCounter {
+			writePrometheusSample(&buffer, point.Name, point.Labels, "", point.Value)
+			continue
+		}
+		var cumulative uint64
+		for i, bound := range point.Buckets {
+			cumulative += point.BucketCounts[i]
+			writePrometheusSample(&buffer, point.Name+"_bucket", point.Labels, strconv.FormatFloat(bound, 'g', -1, 64), float64(cumulative))
+		}
+		writePrometheusSample(&buffer, point.Name+"_bucket", point.Labels, "+Inf", float64(point.Count))
+		writePrometheusSample(&buffer, point.Name+"_sum", point.Labels, "", point.Sum)
+		writePrometheusSample(&buffer, point.Name+"_count", point.Labels, "", float64(point.Count))
+	}
+	return buffer.Bytes()
+}
+
+// writePrometheusSample writes a single line of the exposition format, adding the `le` label of histogram buckets if given
+func writePrometheusSample(buffer *bytes.Buffer, name string, labels Labels, le string, value float64) {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys)+1)
+	for _, key := range keys {
+		pairs = append(pairs, key+`="`+escapeLabelValue(labels[key])+`"`)
+	}
+	if le != "" {
+		pairs = append(pairs, `le="`+le+`"`)
+	}
+	buffer.WriteString(name)
+	if len(pairs) > 0 {
+		buffer.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	buffer.WriteString(" " + strconv.FormatFloat(value, 'g', -1, 64) + "\n")
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
@@ -0,0 +1,96 @@
+package toolkit
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// PubSubMessage is a message delivered by a Pub/Sub push subscription
+type PubSubMessage struct {
+	// Data is the decoded payload of the message
+	Data        []byte
+	Attributes  map[string]string
+	MessageId   string
+	PublishTime time.Time
+	OrderingKey string
+	// Subscription is the full name of the subscription which pushed the message
+	Subscription string
+	// DeliveryAttempt is the number of times the message has been delivered, only set when the subscription has a dead letter topic
+	DeliveryAttempt int
+}
+
+type pubSubPushEnvelope struct {
+	Message *struct {
+		Data        string            `json:"data"`
+		Attributes  map[string]string `json:"attributes"`
+		MessageId   string            `json:"messageId"`
+		PublishTime time.Time         `json:"publishTime"`
+		OrderingKey string            `json:"orderingKey"`
+	} `json:"message"`
+	Subscription    string `json:"subscription"`
+	DeliveryAttempt int    `json:"deliveryAttempt"`
+}
+
+// BindPubSubPush reads the envelope of a Pub/Sub push request, and decodes the json payload of the message into the given object, unless it's nil.
+// If the request isn't a push request a 400 response is sent. If the payload isn't valid json the message can never be processed,
+// so it's logged at the WARN level and acknowledged with a 204 response to stop Pub/Sub from delivering it again. false is returned in both cases
+func (this FunctionContext) BindPubSubPush(obj interface{}) (PubSubMessage, bool) {
+	var envelope pubSubPushEnvelope
+	body, err := this.RawBody()
+	if err == nil {
+		err = codec.Unmarshal(body, &envelope)
+	}
+	if err == nil && envelope.Message == nil {
+		err = errors.New("message is missing")
+	}
+	if err != nil {
+		this.withSkip(1).FailResponse(http.StatusBadRequest, "Invalid Pub/Sub push request: "+err.Error())
+		return PubSubMessage{}, false
+	}
+	data, err := base64.StdEncoding.DecodeString(envelope.Message.Data)
+	if err != nil {
+		this.withSkip(1).FailResponse(http.StatusBadRequest, "Invalid Pub/Sub push request: data is not base64 encoded")
+		return PubSubMessage{}, false
+	}
+	message := PubSubMessage{
+		Data:            data,
+		Attributes:      envelope.Message.Attributes,
+		MessageId:       envelope.Message.MessageId,
+		PublishTime:     envelope.Message.PublishTime,
+		OrderingKey:     envelope.Message.OrderingKey,
+		Subscription:    envelope.Subscription,
+		DeliveryAttempt: envelope.DeliveryAttempt,
+	}
+	this.withSkip(1).Debugf("Received Pub/Sub message %v from %v", message.MessageId, message.Subscription)
+	if obj != nil {
+		if err := codec.Unmarshal(data, obj); err != nil {
+			this.withSkip(1).Warnf("Dropping Pub/Sub message %v, its data is not valid json: %v", message.MessageId, err)
+			this.writeResponse(http.StatusNoContent, "", nil)
+			return message, false
+		}
+	}
+	return message, true
+}
+
+// PubSubResponse responds to a Pub/Sub push request with the outcome of processing the message. A nil error acknowledges it with a 204 response.
+// Errors with a 4xx status (a StatusError or a mapping added with MapError) mean the message can never be processed, so they're logged at the WARN level
+// and acknowledged too. Other errors are sent with ErrResponse, and the non-2xx status makes Pub/Sub deliver the message again
+func (this FunctionContext) PubSubResponse(err error) {
+	if err == nil {
+		this.withSkip(1).Debug("Acknowledging Pub/Sub message")
+		this.writeResponse(http.StatusNoContent, "", nil)
+		return
+	}
+	code, message := errorStatus(err)
+	if _, retryable := RetryAfter(err); code < 500 && !retryable {
+		this.withSkip(1).Warnf("Dropping Pub/Sub message which can't be processed: %v: %v", message, err)
+		this.state.mutex.Lock()
+		this.state.err = err
+		this.state.mutex.Unlock()
+		this.writeResponse(http.StatusNoContent, "", nil)
+		return
+	}
+	this.withSkip(1).ErrResponse(code, err, message)
+}
@@ -0,0 +1,81 @@
+package toolkit
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Publisher publishes messages to a Pub/Sub topic using the function's service account.
+// The span id and trace of the ctx are added to the attributes of every message, so the functions receiving them can be correlated with the publisher
+type Publisher struct {
+	// Topic is the full name of the topic, e.g. `projects/<project>/topics/<topic>`
+	Topic string
+	// SchemaVersion is added to every message as the schemaVersion attribute, unless it's empty
+	SchemaVersion string
+	// Endpoint is the address of the Pub/Sub API. Messages with an ordering key must be published to a regional endpoint, e.g. `https://europe-west1-pubsub.googleapis.com`
+	Endpoint string
+}
+
+// NewPublisher creates a publisher for the given topic. A topic without the `projects/` prefix is a topic of the project the function runs in
+func NewPublisher(topic string) *Publisher {
+	if !strings.HasPrefix(topic, "projects/") {
+		topic = "projects/" + projectId() + "/topics/" + topic
+	}
+	return &Publisher{Topic: topic, Endpoint: "https://pubsub.googleapis.com"}
+}
+
+type pubSubPublishMessage struct {
+	Data        string            `json:"data"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+	OrderingKey string            `json:"orderingKey,omitempty"`
+}
+
+// Publish publishes the data, attributes and ordering key of the message, and returns the id Pub/Sub assigned to it.
+// The result is logged at the DEBUG level, or at the WARN level if publishing failed
+func (this *Publisher) Publish(ctx FunctionContext, message PubSubMessage) (string, error) {
+	attributes := make(map[string]string, len(message.Attributes)+4)
+	for name, value := range message.Attributes {
+		attributes[name] = value
+	}
+	attributes["spanId"] = ctx.SpanId
+	for _, name := range []string{"traceparent", "tracestate"} {
+		if value := ctx.OutgoingHeaders().Get(name); value != "" {
+			attributes[name] = value
+		}
+	}
+	if this.SchemaVersion != "" {
+		attributes["schemaVersion"] = this.SchemaVersion
+	}
+	request := struct {
+		Messages []pubSubPublishMessage `json:"messages"`
+	}{[]pubSubPublishMessage{{
+		Data:        base64.StdEncoding.EncodeToString(message.Data),
+		Attributes:  attributes,
+		OrderingKey: message.OrderingKey,
+	}}}
+	var response struct {
+		MessageIds []string `json:"messageIds"`
+	}
+	err := googleApi(ctx.Context, http.MethodPost, this.Endpoint+"/v1/"+this.Topic+":publish", request, &response)
+	if err == nil && len(response.MessageIds) == 0 {
+		err = errors.New("no message id was returned")
+	}
+	if err != nil {
+		ctx.withSkip(1).Warnf("Failed to publish message to %v: %v", this.Topic, err)
+		return "", err
+	}
+	ctx.withSkip(1).Debugf("Published message %v to %v", response.MessageIds[0], this.Topic)
+	return response.MessageIds[0], nil
+}
+
+// PublishJson serializes the object and publishes it with the given attributes, which may be nil
+func (this *Publisher) PublishJson(ctx FunctionContext, obj interface{}, attributes map[string]string) (string, error) {
+	data, err := codec.Marshal(obj)
+	if err != nil {
+		ctx.withSkip(1).Warnf("Failed to serialize message for %v: %v", this.Topic, err)
+		return "", err
+	}
+	return this.Publish(ctx.withSkip(1), PubSubMessage{Data: data, Attributes: attributes})
+}
@@ -0,0 +1,306 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Rate is how many requests a key can make per period, e.g. `tk.Rate{Requests: 100, Period: time.Minute}`
+type Rate struct {
+	Requests int
+	Period   time.Duration
+}
+
+// validate fails unless the rate has a positive number of requests, and a period of at least a millisecond
+func (this Rate) validate() error {
+	if this.Requests <= 0 || this.Period < time.Millisecond {
+		return fmt.Errorf("invalid rate of %v requests per %v", this.Requests, this.Period)
+	}
+	return nil
+}
+
+// RateLimitResult is the outcome of counting a request against the rate of its key
+type RateLimitResult struct {
+	Allowed bool
+	// Remaining is how many more requests the key can make right now
+	Remaining int
+	// Reset is how long until the key can make the full number of requests again
+	Reset time.Duration
+	// RetryAfter is how long until the key can make another request, when the request isn't allowed
+	RetryAfter time.Duration
+}
+
+// RateLimitStore counts the requests of keys. Implement it to keep the counts in another store
+type RateLimitStore interface {
+	// Take counts a request of the key, and returns whether it's within the rate
+	Take(ctx context.Context, key string, rate Rate) (RateLimitResult, error)
+}
+
+// MemoryRateLimitStore is a RateLimitStore keeping a token bucket per key in memory. The limit applies to each instance of the function separately,
+// so it's only accurate for functions limited to a single instance
+type MemoryRateLimitStore struct {
+	mutex   sync.Mutex
+	buckets map[string]*tokenBucket
+	pruned  time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	// period is the period of the rate the bucket was last taken from, which it refills completely in
+	period time.Duration
+}
+
+// NewMemoryRateLimitStore creates an empty in-memory store
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: map[string]*tokenBucket{}, pruned: time.Now()}
+}
+
+// Take refills the bucket of the key with the tokens earned since its last request, and takes a token from it. Buckets hold up to rate.Requests tokens
+func (this *MemoryRateLimitStore) Take(_ context.Context, key string, rate Rate) (RateLimitResult, error) {
+	if err := rate.validate(); err != nil {
+		return RateLimitResult{}, err
+	}
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	now := time.Now()
+	capacity := float64(rate.Requests)
+	perSecond := capacity / rate.Period.Seconds()
+	if now.Sub(this.pruned) > rate.Period {
+		// Buckets which have refilled completely are the same as new ones. Each is checked against its own period, as limiters with other rates may share the store
+		for bucketKey, bucket := range this.buckets {
+			if now.Sub(bucket.updated) > bucket.period {
+				delete(this.buckets, bucketKey)
+			}
+		}
+		this.pruned = now
+	}
+	bucket, ok := this.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: capacity, updated: now}
+		this.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(capacity, bucket.tokens+now.Sub(bucket.updated).Seconds()*perSecond)
+	bucket.updated = now
+	bucket.period = rate.Period
+	allowed := bucket.tokens >= 1
+	if allowed {
+		bucket.tokens--
+	}
+	return tokenBucketResult(allowed, bucket.tokens, capacity, perSecond), nil
+}
+
+// tokenBucketResult describes the state of a token bucket after a request
+func tokenBucketResult(allowed bool, tokens float64, capacity float64, perSecond float64) RateLimitResult {
+	result := RateLimitResult{
+		Allowed:   allowed,
+		Remaining: int(tokens),
+		Reset:     time.Duration((capacity - tokens) / perSecond * float64(time.Second)),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) / perSecond * float64(time.Second))
+	}
+	return result
+}
+
+// RedisEvalFunc runs a Lua script on Redis and returns its result, e.g. with go-redis:
+//
+//	func(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+//		return client.Eval(ctx, script, keys, args...).Result()
+//	}
+type RedisEvalFunc func(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+
+// redisTokenBucket takes a token from the bucket of KEYS[1], whose capacity is ARGV[1] and which earns ARGV[2] tokens per millisecond, using the clock of Redis
+const redisTokenBucket = `
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(bucket[1]) or capacity
+local updated = tonumber(bucket[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - updated) * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(capacity / rate))
+return {allowed, tostring(tokens)}
+`
+
+// RedisRateLimitStore is a RateLimitStore keeping a token bucket per key in Redis (e.g. Memorystore), shared by every instance of the function.
+// The toolkit doesn't depend on a Redis client, so the store runs its script with the Eval function of yours
+type RedisRateLimitStore struct {
+	Eval RedisEvalFunc
+	// Prefix is added to the keys of the buckets in Redis
+	Prefix string
+}
+
+// NewRedisRateLimitStore creates a store running its script with the given function, whose buckets are stored under the `ratelimit:` prefix
+func NewRedisRateLimitStore(eval RedisEvalFunc) *RedisRateLimitStore {
+	return &RedisRateLimitStore{Eval: eval, Prefix: "ratelimit:"}
+}
+
+// Take takes a token from the bucket of the key atomically
+func (this *RedisRateLimitStore) Take(ctx context.Context, key string, rate Rate) (RateLimitResult, error) {
+	if err := rate.validate(); err != nil {
+		return RateLimitResult{}, err
+	}
+	perMillisecond := float64(rate.Requests) / float64(rate.Period.Milliseconds())
+	reply, err := this.Eval(ctx, redisTokenBucket, []string{this.Prefix + key}, rate.Requests, strconv.FormatFloat(perMillisecond, 'g', -1, 64))
+	if err != nil {
+		return RateLimitResult{}, fmt.Errorf("failed to take a token from Redis: %w", err)
+	}
+	values, _ := reply.([]interface{})
+	if len(values) != 2 {
+		return RateLimitResult{}, fmt.Errorf("unexpected reply from Redis: %v", reply)
+	}
+	allowed, _ := values[0].(int64)
+	tokens, err := strconv.ParseFloat(fmt.Sprint(values[1]), 64)
+	if err != nil {
+		return RateLimitResult{}, fmt.Errorf("unexpected reply from Redis: %v", reply)
+	}
+	return tokenBucketResult(allowed == 1, tokens, float64(rate.Requests), perMillisecond*1000), nil
+}
+
+// FirestoreRateLimitStore is a RateLimitStore counting the requests of each key per fixed window of the period in Firestore, shared by every instance of the function.
+// Every window is a document of the collection, whose `expireAt` field can be used as a TTL policy to delete them
+type FirestoreRateLimitStore struct {
+	Collection string
+	// Database is the id of the Firestore database. Defaults to `(default)`
+	Database string
+	// Endpoint is the address of the Firestore API, which can be set to an emulator
+	Endpoint string
+}
+
+// NewFirestoreRateLimitStore creates a store counting requests in the collection of the default database of the function's project
+func NewFirestoreRateLimitStore(collection string) *FirestoreRateLimitStore {
+	endpoint := "https://firestore.googleapis.com"
+	if host := os.Getenv("FIRESTORE_EMULATOR_HOST"); host != "" {
+		endpoint = "http://" + host
+	}
+	return &FirestoreRateLimitStore{Collection: collection, Database: "(default)", Endpoint: endpoint}
+}
+
+// Take increments the count of the key's current window atomically
+func (this *FirestoreRateLimitStore) Take(ctx context.Context, key string, rate Rate) (RateLimitResult, error) {
+	if err := rate.validate(); err != nil {
+		return RateLimitResult{}, err
+	}
+	now := time.Now()
+	windowStart := now.Truncate(rate.Period)
+	windowEnd := windowStart.Add(rate.Period)
+	hash := sha256.Sum256([]byte(key))
+	database := "projects/" + projectId() + "/databases/" + this.Database
+	document := database + "/documents/" + this.Collection + "/" + hex.EncodeToString(hash[:16]) + "-" + strconv.FormatInt(windowStart.Unix(), 10)
+	request := map[string]interface{}{"writes": []interface{}{map[string]interface{}{"transform": map[string]interface{}{
+		"document": document,
+		"fieldTransforms": []interface{}{
+			map[string]interface{}{"fieldPath": "count", "increment": map[string]interface{}{"integerValue": "1"}},
+			map[string]interface{}{"fieldPath": "expireAt", "maximum": map[string]interface{}{"timestampValue": windowEnd.UTC().Format(time.RFC3339)}},
+		},
+	}}}}
+	var response struct {
+		WriteResults []struct {
+			TransformResults []struct {
+				IntegerValue string `json:"integerValue"`
+			} `json:"transformResults"`
+		} `json:"writeResults"`
+	}
+	if err := googleApi(ctx, http.MethodPost, this.Endpoint+"/v1/projects/"+projectId()+"/databases/"+url.PathEscape(this.Database)+"/documents:commit", request, &response); err != nil {
+		return RateLimitResult{}, fmt.Errorf("failed to count the request in Firestore: %w", err)
+	}
+	if len(response.WriteResults) == 0 || len(response.WriteResults[0].TransformResults) == 0 {
+		return RateLimitResult{}, errors.New("firestore returned no count")
+	}
+	count, err := strconv.Atoi(response.WriteResults[0].TransformResults[0].IntegerValue)
+	if err != nil {
+		return RateLimitResult{}, fmt.Errorf("invalid count: %w", err)
+	}
+	result := RateLimitResult{Allowed: count <= rate.Requests, Remaining: max(rate.Requests-count, 0), Reset: windowEnd.Sub(now)}
+	if !result.Allowed {
+		result.RetryAfter = result.Reset
+	}
+	return result, nil
+}
+
+// RateLimitConfig configures RateLimit
+type RateLimitConfig struct {
+	Rate Rate
+	// Store counts the requests. Defaults to a MemoryRateLimitStore
+	Store RateLimitStore
+	// Key returns the key requests are counted by. Defaults to RateLimitByIP
+	Key func(ctx FunctionContext) string
+	// FailOpen lets requests through when the store fails, instead of responding with a 503 status
+	FailOpen bool
+}
+
+// RateLimitByIP counts requests by the address of the client
+func RateLimitByIP(ctx FunctionContext) string {
+	return "ip:" + ctx.ClientIP()
+}
+
+// RateLimitByApiKey counts requests by the id of the API key authenticated by RequireApiKey, or by the address of the client without one
+func RateLimitByApiKey(ctx FunctionContext) string {
+	if apiKey, ok := ctx.ApiKey(); ok {
+		return "key:" + apiKey.Id
+	}
+	return RateLimitByIP(ctx)
+}
+
+// RateLimitByPrincipal counts requests by the principal set by an authentication middleware, or by the address of the client without one
+func RateLimitByPrincipal(ctx FunctionContext) string {
+	if principal, ok := ctx.Principal(); ok {
+		return "principal:" + principal.Id
+	}
+	return RateLimitByIP(ctx)
+}
+
+// RateLimit is a middleware which rejects the requests of keys exceeding the rate with a 429 response and a Retry-After header.
+// Every response has the X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset (in seconds) headers.
+// Panics unless the Rate has a positive number of Requests and a Period of at least a millisecond
+func RateLimit(limit RateLimitConfig) Middleware {
+	if err := limit.Rate.validate(); err != nil {
+		panic("RateLimit requires a valid Rate: " + err.Error())
+	}
+	if limit.Store == nil {
+		limit.Store = NewMemoryRateLimitStore()
+	}
+	if limit.Key == nil {
+		limit.Key = RateLimitByIP
+	}
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx FunctionContext) error {
+			key := limit.Key(ctx)
+			result, err := limit.Store.Take(ctx.Context, key, limit.Rate)
+			if err != nil {
+				if limit.FailOpen {
+					ctx.Warnf("Rate limit not applied: %v", err)
+					return next(ctx)
+				}
+				return ServiceUnavailable("Rate limit unavailable").WithCause(err)
+			}
+			header := ctx.Response.Header()
+			header.Set("X-RateLimit-Limit", strconv.Itoa(limit.Rate.Requests))
+			header.Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			header.Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.Reset.Seconds()))))
+			if !result.Allowed {
+				ctx.WithField("rateLimitKey", key).Warnf("Rate limit of %v requests per %v exceeded", limit.Rate.Requests, limit.Rate.Period)
+				return Retryable(NewResponseError(http.StatusTooManyRequests, "Too many requests"), result.RetryAfter)
+			}
+			return next(ctx)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// RecaptchaConfig configures how RequireRecaptcha assesses the reCAPTCHA Enterprise tokens of requests
+type RecaptchaConfig struct {
+	// SiteKey is the reCAPTCHA key the tokens were created with
+	SiteKey string
+	// ProjectId is the project of the key. Defaults to the project the function runs in
+	ProjectId string
+	// Action is the action the tokens must have been created for, e.g. `login`. Any action is accepted if it's empty
+	Action string
+	// MinScore is the lowest score, from 0.0 (likely a bot) to 1.0 (likely a human), of the requests which are let through. Defaults to 0.5
+	MinScore float64
+	// Header is the header carrying the token. Defaults to X-Recaptcha-Token. Form posts can send it in the `g-recaptcha-response` field instead
+	Header string
+	// Hostnames are the only hostnames the tokens can be created on, e.g. `www.example.com`. Any hostname is accepted if it's empty
+	Hostnames []string
+	// Endpoint is the address of the reCAPTCHA Enterprise API
+	Endpoint string
+}
+
+// RecaptchaAssessment is the outcome of assessing a reCAPTCHA token
+type RecaptchaAssessment struct {
+	// Name is the name of the assessment, which can be used to annotate it once the outcome of the request is known
+	Name string
+	// Score is from 0.0 (likely a bot) to 1.0 (likely a human)
+	Score float64
+	// Reasons explain the score, e.g. `AUTOMATION` or `UNEXPECTED_USAGE_PATTERNS`
+	Reasons  []string
+	Action   string
+	Hostname string
+}
+
+type recaptchaKey struct{}
+
+// RequireRecaptcha is a middleware which assesses the reCAPTCHA Enterprise token of every request, and rejects it with a 403 response unless the token is valid, was created
+// for the Action and scores at least the MinScore. The response has a detail whose code is the reason of the denial, e.g. `recaptcha.low_score`.
+// Requests get a 503 response if the API fails. The function's service account needs the reCAPTCHA Enterprise Agent role. Panics if no SiteKey is configured
+func RequireRecaptcha(recaptcha RecaptchaConfig) Middleware {
+	if recaptcha.SiteKey == "" {
+		panic("RequireRecaptcha needs a SiteKey")
+	}
+	if recaptcha.ProjectId == "" {
+		recaptcha.ProjectId = projectId()
+	}
+	if recaptcha.MinScore == 0 {
+		recaptcha.MinScore = 0.5
+	}
+	if recaptcha.Header == "" {
+		recaptcha.Header = "X-Recaptcha-Token"
+	}
+	if recaptcha.Endpoint == "" {
+		recaptcha.Endpoint = "https://recaptchaenterprise.googleapis.com"
+	}
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx FunctionContext) error {
+			token := ctx.Request.Header.Get(recaptcha.Header)
+			if token == "" && strings.HasPrefix(ctx.Request.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+				if _, err := ctx.RawBody(); err == nil {
+					token = ctx.Request.PostFormValue("g-recaptcha-response")
+				}
+			}
+			if token == "" {
+				return recaptcha.deny("missing", "The request has no reCAPTCHA token")
+			}
+			assessment, reason, err := recaptcha.assess(ctx, token)
+			if err != nil {
+				return ServiceUnavailable("Failed to verify the reCAPTCHA token").WithCause(err)
+			}
+			if reason != "" {
+				return recaptcha.deny("invalid", "The reCAPTCHA token is invalid").WithInternal("invalid reCAPTCHA token: %v", reason)
+			}
+			if recaptcha.Action != "" && assessment.Action != recaptcha.Action {
+				return recaptcha.deny("action_mismatch", "The reCAPTCHA token was created for another action").
+					WithInternal("reCAPTCHA token was created for action %q instead of %q", assessment.Action, recaptcha.Action)
+			}
+			if len(recaptcha.Hostnames) > 0 && !slices.Contains(recaptcha.Hostnames, assessment.Hostname) {
+				return recaptcha.deny("hostname_mismatch", "The reCAPTCHA token was created on another site").
+					WithInternal("reCAPTCHA token was created on %v", assessment.Hostname)
+			}
+			if assessment.Score < recaptcha.MinScore {
+				return recaptcha.deny("low_score", "The request looks automated").
+					WithInternal("reCAPTCHA score %v is below %v: %v", assessment.Score, recaptcha.MinScore, strings.Join(assessment.Reasons, ", "))
+			}
+			ctx.Context = context.WithValue(ctx.Context, recaptchaKey{}, assessment)
+			return next(ctx)
+		}
+	}
+}
+
+// RecaptchaAssessment returns the assessment of a request let through by RequireRecaptcha, and false for other requests
+func (this FunctionContext) RecaptchaAssessment() (RecaptchaAssessment, bool) {
+	assessment, ok := this.Context.Value(recaptchaKey{}).(RecaptchaAssessment)
+	return assessment, ok
+}
+
+// assess creates an assessment of the token, returning the reason it's invalid, if it is
+func (this RecaptchaConfig) assess(ctx FunctionContext, token string) (RecaptchaAssessment, string, error) {
+	request := map[string]interface{}{"event": map[string]interface{}{
+		"token":          token,
+		"siteKey":        this.SiteKey,
+		"expectedAction": this.Action,
+		"userIpAddress":  ctx.ClientIP(),
+		"userAgent":      ctx.Request.UserAgent(),
+	}}
+	var response struct {
+		Name         string `json:"name"`
+		RiskAnalysis struct {
+			Score   float64  `json:"score"`
+			Reasons []string `json:"reasons"`
+		} `json:"riskAnalysis"`
+		TokenProperties struct {
+			Valid         bool   `json:"valid"`
+			InvalidReason string `json:"invalidReason"`
+			Hostname      string `json:"hostname"`
+			Action        string `json:"action"`
+		} `json:"tokenProperties"`
+	}
+	err := googleApi(ctx.Context, http.MethodPost, this.Endpoint+"/v1/projects/"+this.ProjectId+"/assessments", request, &response)
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) && statusErr.status == http.StatusBadRequest {
+		// The API rejects malformed tokens instead of assessing them
+		return RecaptchaAssessment{}, "MALFORMED", nil
+	}
+	if err != nil {
+		return RecaptchaAssessment{}, "", err
+	}
+	if !response.TokenProperties.Valid {
+		return RecaptchaAssessment{}, response.TokenProperties.InvalidReason, nil
+	}
+	return RecaptchaAssessment{
+		Name:     response.Name,
+		Score:    response.RiskAnalysis.Score,
+		Reasons:  response.RiskAnalysis.Reasons,
+		Action:   response.TokenProperties.Action,
+		Hostname: response.TokenProperties.Hostname,
+	}, "", nil
+}
+
+// deny creates the 403 error of a request denied for the given reason
+func (this RecaptchaConfig) deny(reason string, message string) *ResponseError {
+	return NewResponseError(http.StatusForbidden, message, ErrorDetail{Field: this.Header, Code: "recaptcha." + reason, Message: message})
+}
@@ -0,0 +1,54 @@
+package toolkit
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+)
+
+// Recover recovers from a panic in the handler. Defer it right after creating the ctx: `defer ctx.Recover()`. Handle does it automatically.
+// The panic is logged at the ERROR level with its stack trace, sent to the error reporters, and a 500 response is sent if no response has been written yet.
+// Panics with http.ErrAbortHandler, used by Fatal, are passed on to the http server
+func (this FunctionContext) Recover() {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+	if recovered == http.ErrAbortHandler {
+		panic(recovered)
+	}
+	err, ok := recovered.(error)
+	if !ok {
+		err = fmt.Errorf("%v", recovered)
+	}
+	//  Attribute the logs and the fingerprint to the function which panicked, rather than to the runtime's panic functions
+	frames := panicFrames()
+	this.withSkip(frames+1).ErrorErr(err, "Recovered from panic")
+	this.withSkip(frames).reportToReporters(err, "Recovered from panic", http.StatusInternalServerError, true)
+
+	this.state.mutex.Lock()
+	this.state.err = err
+	this.state.mutex.Unlock()
+	if !this.state.writer.hasWritten() {
+		this.writeError(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError), nil)
+		return
+	}
+	this.finishResponse(err)
+}
+
+// panicFrames returns the number of runtime frames between Recover and the function which panicked
+func panicFrames() int {
+	pcs := make([]uintptr, 16)
+	//  Skip runtime.Callers, panicFrames and Recover
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	count := 0
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "runtime.") || !more {
+			return count
+		}
+		count++
+	}
+}
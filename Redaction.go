@@ -0,0 +1,159 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// RedactedValue replaces the redacted values in the logs
+const RedactedValue = "[REDACTED]"
+
+// Patterns of common sensitive values, for use with RedactPatterns
+var (
+	RedactEmails       = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	RedactCardNumbers  = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+	RedactBearerTokens = regexp.MustCompile(`(?i)bearer\s+[A-Za-z0-9._~+/=-]+`)
+)
+
+var redaction struct {
+	mutex    sync.RWMutex
+	fields   map[string]bool
+	patterns []*regexp.Regexp
+}
+
+// RedactFields masks the values of the log fields with the given names (case-insensitive, at any depth) in all log output
+func RedactFields(names ...string) {
+	redaction.mutex.Lock()
+	defer redaction.mutex.Unlock()
+	if redaction.fields == nil {
+		redaction.fields = map[string]bool{}
+	}
+	for _, name := range names {
+		redaction.fields[strings.ToLower(name)] = true
+	}
+}
+
+// RedactPatterns masks the parts of log messages and string fields matching any of the given patterns in all log output, e.g. `tk.RedactPatterns(tk.RedactEmails)`
+func RedactPatterns(patterns ...*regexp.Regexp) {
+	redaction.mutex.Lock()
+	defer redaction.mutex.Unlock()
+	redaction.patterns = append(redaction.patterns, patterns...)
+}
+
+// ResetRedaction removes every registered field and pattern. Mainly useful in tests
+func ResetRedaction() {
+	redaction.mutex.Lock()
+	defer redaction.mutex.Unlock()
+	redaction.fields = nil
+	redaction.patterns = nil
+}
+
+// RedactingWriter returns a writer which masks the registered fields and patterns in the json log entries written to it before passing them to out.
+// The loggers created by FuncCtx already use it, it's only needed when replacing the output of ctx.Logger
+func RedactingWriter(out io.Writer) io.Writer {
+	return redactingWriter{out: out}
+}
+
+type redactingWriter struct {
+	out io.Writer
+}
+
+func (this redactingWriter) Write(p []byte) (int, error) {
+	return this.WriteLevel(zerolog.NoLevel, p)
+}
+
+// WriteLevel redacts the entry and passes it on with its level, so the writer can be placed in front of level aware writers
+func (this redactingWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	redacted := redact(p)
+	var err error
+	if levelWriter, ok := this.out.(zerolog.LevelWriter); ok && level != zerolog.NoLevel {
+		_, err = levelWriter.WriteLevel(level, redacted)
+	} else {
+		_, err = this.out.Write(redacted)
+	}
+	//  Report the length of the original entry, as the caller doesn't know about the redacted one
+	return len(p), err
+}
+
+// redact masks the registered fields and patterns in a json log entry, which is decoded and encoded again with the json codec.
+// Entries which aren't valid json are only matched against the patterns
+func redact(entry []byte) []byte {
+	redaction.mutex.RLock()
+	defer redaction.mutex.RUnlock()
+	if len(redaction.fields) == 0 && len(redaction.patterns) == 0 {
+		return entry
+	}
+	var fields map[string]json.RawMessage
+	if err := codec.Unmarshal(entry, &fields); err != nil {
+		return []byte(redactString(string(entry)))
+	}
+	encoded, err := codec.Marshal(redactFields(fields))
+	if err != nil {
+		return entry
+	}
+	return append(encoded, '\n')
+}
+
+// redactFields masks the registered fields of a json object, and the patterns in the values of the others
+func redactFields(fields map[string]json.RawMessage) map[string]json.RawMessage {
+	for key, field := range fields {
+		if redaction.fields[strings.ToLower(key)] {
+			fields[key], _ = codec.Marshal(RedactedValue)
+		} else {
+			fields[key] = redactRaw(field)
+		}
+	}
+	return fields
+}
+
+// redactRaw masks the registered fields and patterns in a json value. Numbers, booleans and unchanged strings are kept as they are, so numbers don't lose precision
+func redactRaw(value json.RawMessage) json.RawMessage {
+	trimmed := bytes.TrimSpace(value)
+	if len(trimmed) == 0 {
+		return value
+	}
+	var redacted interface{}
+	switch trimmed[0] {
+	case '{':
+		var fields map[string]json.RawMessage
+		if codec.Unmarshal(trimmed, &fields) != nil {
+			return value
+		}
+		redacted = redactFields(fields)
+	case '[':
+		var items []json.RawMessage
+		if codec.Unmarshal(trimmed, &items) != nil {
+			return value
+		}
+		for i, item := range items {
+			items[i] = redactRaw(item)
+		}
+		redacted = items
+	case '"':
+		var text string
+		if codec.Unmarshal(trimmed, &text) != nil || redactString(text) == text {
+			return value
+		}
+		redacted = redactString(text)
+	default:
+		return value
+	}
+	encoded, err := codec.Marshal(redacted)
+	if err != nil {
+		return value
+	}
+	return encoded
+}
+
+func redactString(value string) string {
+	for _, pattern := range redaction.patterns {
+		value = pattern.ReplaceAllString(value, RedactedValue)
+	}
+	return value
+}
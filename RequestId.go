@@ -0,0 +1,23 @@
+package toolkit
+
+import (
+	"net/http"
+)
+
+// RequestIdHeader is the header the request id is read from, and sent in on responses and outbound calls
+var RequestIdHeader = "X-Request-ID"
+
+// requestId returns the request id set by the caller (e.g. a gateway), or generates a new one if it's missing or invalid.
+// Ids longer than 200 characters or containing non-printable characters are replaced to keep them safe to log
+func requestId(r *http.Request) string {
+	id := r.Header.Get(RequestIdHeader)
+	if id == "" || len(id) > 200 {
+		return randomHex(16)
+	}
+	for _, c := range id {
+		if c < 0x20 || c > 0x7e {
+			return randomHex(16)
+		}
+	}
+	return id
+}
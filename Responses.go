@@ -0,0 +1,206 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Json is a shorthand for defining json objects inline, e.g. `tk.Json{"data": "Hello, World!"}`
+type Json map[string]interface{}
+
+// AsMap returns the object as a plain map[string]interface{}. Useful when comparing responses in tests
+func (this Json) AsMap() map[string]interface{} {
+	return this
+}
+
+// withSkip returns a copy of this ctx whose log messages are attributed `frames` stack frames further up the call stack.
+// Used by the helpers in this library so that log messages point at the caller's code instead of the toolkit
+func (this FunctionContext) withSkip(frames int) FunctionContext {
+	this.stackFrameLevel += frames
+	return this
+}
+
+// SetResponseHeader sets a header on the response. Must be called before any of the response methods
+func (this FunctionContext) SetResponseHeader(name string, value string) {
+	this.Response.Header().Set(name, value)
+}
+
+// writeResponse writes the status code, Content-Type and body to the response writer, compressing the body if enabled, and logging any write errors.
+// The body is skipped for HEAD requests
+func (this FunctionContext) writeResponse(code int, contentType string, body []byte) {
+	if contentType != "" {
+		this.Response.Header().Set("Content-Type", contentType)
+		body = this.compressBody(contentType, body)
+	}
+	if this.Request.Method == http.MethodHead {
+		//  HEAD responses only contain the headers the GET response would have
+		if len(body) > 0 {
+			this.Response.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		}
+		this.Response.WriteHeader(code)
+		this.finishResponse(nil)
+		return
+	}
+	this.Response.WriteHeader(code)
+	var err error
+	if len(body) > 0 {
+		_, err = this.Response.Write(body)
+	}
+	if errors.Is(err, http.ErrHandlerTimeout) {
+		this.withSkip(1).Warn("Response discarded, the request has already timed out")
+	} else if err != nil {
+		this.withSkip(1).Errorf("Failed to write response: %v", err)
+	}
+	this.finishResponse(err)
+}
+
+const jsonContentType = "application/json; charset=utf-8"
+
+// writeJson serializes the given object and writes it as a json response with the given status code
+func (this FunctionContext) writeJson(code int, obj interface{}) {
+	bytes, err := codec.Marshal(obj)
+	if err != nil {
+		this.withSkip(1).Errorf("Failed to serialize response: %v", err)
+		this.writeResponse(500, jsonContentType, []byte(`{"spanId":"`+this.SpanId+`"}`))
+		return
+	}
+	this.writeResponse(code, jsonContentType, bytes)
+}
+
+// ProblemResponseStruct used internally to return an RFC 7807 problem details document when Config.ProblemJson is enabled. Exported to allow for manually building responses
+type ProblemResponseStruct struct {
+	Type      string        `json:"type"`
+	Title     string        `json:"title"`
+	Status    int           `json:"status"`
+	Detail    string        `json:"detail,omitempty"`
+	Instance  string        `json:"instance,omitempty"`
+	Details   []ErrorDetail `json:"details,omitempty"`
+	Retryable bool          `json:"retryable,omitempty"`
+}
+
+// writeError sends the message as an error response with the given status code, in the format selected in the toolkit config.
+// The message and details are translated if a message catalog is loaded
+func (this FunctionContext) writeError(code int, message string, details []ErrorDetail) {
+	contentType, bytes, err := this.errorBody(code, message, details)
+	if err != nil {
+		this.withSkip(1).Errorf("Failed to serialize response: %v", err)
+		if contentType == jsonContentType {
+			this.writeResponse(500, contentType, []byte(`{"spanId":"`+this.SpanId+`"}`))
+			return
+		}
+	}
+	this.writeResponse(code, contentType, bytes)
+}
+
+// errorBody builds the body of an error response with the given status code, returning its content type
+func (this FunctionContext) errorBody(code int, message string, details []ErrorDetail) (string, []byte, error) {
+	message, details = this.translateError(message, details)
+	if !config.ProblemJson {
+		bytes, err := codec.Marshal(config.Formatter.FormatError(this, code, message, details))
+		return jsonContentType, bytes, err
+	}
+	bytes, err := codec.Marshal(ProblemResponseStruct{Type: "about:blank", Title: http.StatusText(code), Status: code, Detail: message, Instance: this.SpanId, Details: details, Retryable: this.ErrorRetryable()})
+	return "application/problem+json", bytes, err
+}
+
+// OkResponse sends a 200 response with the given Content-Type and body
+func (this FunctionContext) OkResponse(contentType string, bytes []byte) {
+	this.withSkip(1).Debugf("Responding with status 200 (%v bytes)", len(bytes))
+	this.writeResponse(200, contentType, bytes)
+}
+
+// OkResponseJson serializes the given object inside a SuccessResponseStruct and sends it as a 200 json response.
+// If the request has a `fields` query parameter, only the fields selected by it are included in the response
+func (this FunctionContext) OkResponseJson(obj interface{}) {
+	obj, err := this.filterFields(obj)
+	if err != nil {
+		this.withSkip(1).FailResponse(http.StatusBadRequest, "Invalid fields parameter: "+err.Error())
+		return
+	}
+	this.withSkip(1).Debug("Responding with status 200")
+	this.writeJson(200, config.Formatter.FormatSuccess(this, obj))
+}
+
+// FailResponse logs the message at the WARN level and sends it inside an ErrorResponseStruct with the given status code.
+// Useful for when the request contains a problem, but an error wasn't thrown
+func (this FunctionContext) FailResponse(code int, message string) {
+	this.withSkip(1).Warnf("Responding with status %v: %v", code, message)
+	this.writeError(code, message, nil)
+}
+
+// ErrResponse logs the error and message at the ERROR level and sends the message inside an ErrorResponseStruct with the given status code.
+// The error itself is only logged, and is never sent to the user. Errors of 5xx responses are also sent to the reporters added with WithErrorReporter.
+// With a 0 status code, the status (and the message, if it's empty) are those of the StatusError the error wraps, or of its mapping added with MapError.
+// Errors marked with Retryable are sent with a 503 status (unless it's 429) and a Retry-After header. The details of errors like Errors and ResponseError are sent too
+func (this FunctionContext) ErrResponse(code int, err error, message string) {
+	if code == 0 {
+		var mappedMessage string
+		code, mappedMessage = errorStatus(err)
+		if message == "" {
+			message = mappedMessage
+		}
+	}
+	code = this.applyRetry(code, err)
+	this.withSkip(1).withoutErrorReport(code < 500).errorf(err, "Responding with status %v: %v: %v", code, message, err)
+	this.state.err = err
+	if code >= 500 {
+		this.reportToReporters(err, message, code, false)
+	}
+	this.writeError(code, message, errorDetails(err))
+}
+
+// CreatedResponse sets the Location header to the url of the created resource, and sends the object inside a SuccessResponseStruct with a 201 status code
+func (this FunctionContext) CreatedResponse(location string, obj interface{}) {
+	this.withSkip(1).Debugf("Responding with status 201, created %v", location)
+	this.Response.Header().Set("Location", location)
+	this.writeJson(http.StatusCreated, config.Formatter.FormatSuccess(this, obj))
+}
+
+// AcceptedResponse sends a 202 response for requests which will be processed asynchronously.
+// The Location header and the `statusUrl` field of the response data are set to the url where the client can check the status of the operation
+func (this FunctionContext) AcceptedResponse(statusURL string) {
+	this.withSkip(1).Debugf("Responding with status 202, status at %v", statusURL)
+	this.Response.Header().Set("Location", statusURL)
+	this.writeJson(http.StatusAccepted, config.Formatter.FormatSuccess(this, Json{"statusUrl": statusURL}))
+}
+
+// NoContentResponse sends a 204 response without a body
+func (this FunctionContext) NoContentResponse() {
+	this.withSkip(1).Debug("Responding with status 204")
+	this.writeResponse(http.StatusNoContent, "", nil)
+}
+
+// ErrResponseDetails works like ErrResponse, but also sends a list of details about what was wrong with the request (e.g. every field that failed validation).
+// The error may be nil, in which case the message is logged at the WARN level instead of ERROR
+func (this FunctionContext) ErrResponseDetails(code int, err error, message string, details []ErrorDetail) {
+	code = this.applyRetry(code, err)
+	if err == nil {
+		this.withSkip(1).Warnf("Responding with status %v: %v (%v details)", code, message, len(details))
+	} else {
+		this.withSkip(1).withoutErrorReport(code < 500).errorf(err, "Responding with status %v: %v: %v (%v details)", code, message, err, len(details))
+		if code >= 500 {
+			this.reportToReporters(err, message, code, false)
+		}
+	}
+	this.state.err = err
+	this.writeError(code, message, details)
+}
+
+// Redirect sends a redirect response with the given 3xx status code to the given url.
+// Urls containing CR or LF characters are rejected with a 500 response to prevent header injection
+func (this FunctionContext) Redirect(code int, url string) {
+	if strings.ContainsAny(url, "\r\n") {
+		this.withSkip(1).ErrResponse(http.StatusInternalServerError, errors.New("redirect url contains CR or LF characters"), "Invalid redirect")
+		return
+	}
+	if code < 300 || code > 399 {
+		this.withSkip(1).ErrResponse(http.StatusInternalServerError, fmt.Errorf("redirect status must be 3xx, got %v", code), "Invalid redirect")
+		return
+	}
+	this.withSkip(1).Debugf("Redirecting with status %v to %v", code, url)
+	this.Response.Header().Set("Location", url)
+	this.writeResponse(code, "", nil)
+}
@@ -0,0 +1,66 @@
+package toolkit
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryableError marks an error as temporary, so the request can be retried after the given delay. Create it with Retryable
+type RetryableError struct {
+	Err error
+	// After is how long the client should wait before retrying, 0 when it's up to the client
+	After time.Duration
+}
+
+// Retryable marks the error as temporary. ErrResponse then responds with a 503 status (or 429, if that's the status it was called with),
+// a Retry-After header with the delay, and `retryable: true` in the body, which clients and Cloud Tasks retry policies can act on
+func Retryable(err error, after time.Duration) error {
+	return &RetryableError{Err: err, After: after}
+}
+
+func (this *RetryableError) Error() string {
+	return this.Err.Error()
+}
+
+// Unwrap returns the temporary error
+func (this *RetryableError) Unwrap() error {
+	return this.Err
+}
+
+// RetryAfter returns the delay of the RetryableError the error wraps, and false if it doesn't wrap one
+func RetryAfter(err error) (time.Duration, bool) {
+	var retryable *RetryableError
+	if errors.As(err, &retryable) {
+		return retryable.After, true
+	}
+	return 0, false
+}
+
+// ErrorRetryable returns true if the error response of the request tells the client to retry it. Used by custom ResponseFormatters
+func (this FunctionContext) ErrorRetryable() bool {
+	this.state.mutex.Lock()
+	defer this.state.mutex.Unlock()
+	return this.state.retryable
+}
+
+// applyRetry sets the Retry-After header and marks the response as retryable if the error is retryable, and returns the status code of the response:
+// 429 responses stay 429, other error statuses become 503
+func (this FunctionContext) applyRetry(code int, err error) int {
+	after, ok := RetryAfter(err)
+	if !ok || code < 400 {
+		return code
+	}
+	if code != http.StatusTooManyRequests {
+		code = http.StatusServiceUnavailable
+	}
+	if after > 0 {
+		this.Response.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(after.Seconds()))))
+	}
+	this.state.mutex.Lock()
+	this.state.retryable = true
+	this.state.mutex.Unlock()
+	return code
+}
@@ -0,0 +1,122 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SSEHeartbeatInterval is how often an EventStream sends a comment line to keep idle connections open
+var SSEHeartbeatInterval = 15 * time.Second
+
+// EventStream writes Server-Sent Events to the response. Create it with ctx.SSE, and Close it when the handler is done.
+// Streams of handlers created with Handle are closed when the handler returns, as the response can't be written anymore
+type EventStream struct {
+	ctx     FunctionContext
+	flusher http.Flusher
+	mutex   sync.Mutex
+	done    chan struct{}
+	closed  bool
+}
+
+// SSE starts a Server-Sent Events response and returns a stream for sending events to the client.
+// The stream sends heartbeats in the background until it's closed or the request's context is cancelled
+func (this FunctionContext) SSE() (*EventStream, error) {
+	flusher, ok := this.Response.(http.Flusher)
+	if !ok {
+		return nil, errors.New("response writer does not support flushing")
+	}
+	header := this.Response.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	this.withSkip(1).Debug("Starting event stream")
+	this.Response.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	stream := &EventStream{ctx: this, flusher: flusher, done: make(chan struct{})}
+	this.onReturn(stream.Close)
+	go stream.heartbeat(SSEHeartbeatInterval)
+	return stream, nil
+}
+
+func (this *EventStream) heartbeat(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := this.write(": heartbeat\n\n"); err != nil {
+				return
+			}
+		case <-this.ctx.Context.Done():
+			return
+		case <-this.done:
+			return
+		}
+	}
+}
+
+func (this *EventStream) write(message string) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.closed {
+		return errors.New("event stream is closed")
+	}
+	if err := this.ctx.Context.Err(); err != nil {
+		return err
+	}
+	if _, err := this.ctx.Response.Write([]byte(message)); err != nil {
+		return err
+	}
+	this.flusher.Flush()
+	return nil
+}
+
+// Send sends an event with the given name to the client. Strings and byte slices are sent as they are, other values are serialized to json.
+// The event name can be empty to send an unnamed message. Returns an error if the client disconnected or the stream was closed
+func (this *EventStream) Send(event string, data interface{}) error {
+	var text string
+	switch d := data.(type) {
+	case string:
+		text = d
+	case []byte:
+		text = string(d)
+	default:
+		bytes, err := codec.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("failed to serialize event: %w", err)
+		}
+		text = string(bytes)
+	}
+
+	var message strings.Builder
+	if event != "" {
+		message.WriteString("event: " + event + "\n")
+	}
+	for _, line := range strings.Split(text, "\n") {
+		message.WriteString("data: " + strings.TrimSuffix(line, "\r") + "\n")
+	}
+	message.WriteString("\n")
+
+	if err := this.write(message.String()); err != nil {
+		this.ctx.withSkip(1).Debugf("Failed to send event %v: %v", event, err)
+		return err
+	}
+	return nil
+}
+
+// Close stops the heartbeats. Events can't be sent after the stream is closed
+func (this *EventStream) Close() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if !this.closed {
+		this.closed = true
+		close(this.done)
+		this.ctx.finishResponse(nil)
+	}
+}
@@ -0,0 +1,75 @@
+package toolkit
+
+import (
+	"crypto/subtle"
+	"time"
+)
+
+// googleCertsUrl is the JSON Web Key Set Google signs its ID tokens with
+const googleCertsUrl = "https://www.googleapis.com/oauth2/v3/certs"
+
+// googleIssuers are the issuers of Google-signed ID tokens
+var googleIssuers = []string{"https://accounts.google.com", "accounts.google.com"}
+
+// SchedulerConfig selects how RequireScheduler verifies that requests were sent by Cloud Scheduler.
+// Either the OIDC token of the job, or a secret header configured on the job is required
+type SchedulerConfig struct {
+	// Audience of the OIDC token sent by the job, usually the url of the function. Requests must have a Google-signed ID token with this audience
+	Audience string
+	// ServiceAccount is the email of the service account the job's OIDC token must be issued for. It's required with an Audience,
+	// as anyone with a Google account can get a token for the function's url
+	ServiceAccount string
+	// Header is the name of the header carrying the shared secret. Defaults to X-Scheduler-Secret
+	Header string
+	// Secret which requests must send in the Header, if no Audience is set
+	Secret string
+	// KeysUrl is the address of the keys Google signs ID tokens with
+	KeysUrl string
+}
+
+// RequireScheduler is a middleware which rejects requests with a 401 response unless they were sent by Cloud Scheduler, verified by the OIDC token or the shared secret of the job.
+// Panics if neither an Audience nor a Secret is configured, or if an Audience is configured without a ServiceAccount
+func RequireScheduler(scheduler SchedulerConfig) Middleware {
+	if scheduler.Audience == "" && scheduler.Secret == "" {
+		panic("RequireScheduler needs an Audience or a Secret")
+	}
+	if scheduler.Audience != "" && scheduler.ServiceAccount == "" {
+		panic("RequireScheduler needs the ServiceAccount of the job's OIDC token")
+	}
+	if scheduler.Header == "" {
+		scheduler.Header = "X-Scheduler-Secret"
+	}
+	if scheduler.KeysUrl == "" {
+		scheduler.KeysUrl = googleCertsUrl
+	}
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx FunctionContext) error {
+			if scheduler.Audience == "" {
+				secret := ctx.Request.Header.Get(scheduler.Header)
+				if subtle.ConstantTimeCompare([]byte(secret), []byte(scheduler.Secret)) != 1 {
+					return Unauthorized("Not a Cloud Scheduler request").WithInternal("missing or invalid %v header", scheduler.Header)
+				}
+				return next(ctx)
+			}
+			claims, err := ctx.verifyGoogleIdToken(scheduler.Audience, scheduler.KeysUrl)
+			if err != nil {
+				return Unauthorized("Not a Cloud Scheduler request").WithCause(err)
+			}
+			email, _ := claims["email"].(string)
+			if email != scheduler.ServiceAccount {
+				return Unauthorized("Not a Cloud Scheduler request").WithInternal("token is issued for unexpected service account %v", email)
+			}
+			return next(ctx)
+		}
+	}
+}
+
+// ScheduleTime returns the time the Cloud Scheduler job which sent the request was scheduled for, from its X-CloudScheduler-ScheduleTime header.
+// false is returned if the request wasn't sent by Cloud Scheduler
+func (this FunctionContext) ScheduleTime() (time.Time, bool) {
+	scheduled, err := time.Parse(time.RFC3339, this.Request.Header.Get("X-CloudScheduler-ScheduleTime"))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return scheduled, true
+}
@@ -0,0 +1,66 @@
+package toolkit
+
+import (
+	"strings"
+)
+
+// SecurityHeadersConfig configures the security headers SecurityHeaders adds to responses. Headers whose field is empty aren't added
+type SecurityHeadersConfig struct {
+	// StrictTransportSecurity is the Strict-Transport-Security header, e.g. `max-age=63072000; includeSubDomains`
+	StrictTransportSecurity string
+	// ContentTypeOptions is the X-Content-Type-Options header, which should be `nosniff`
+	ContentTypeOptions string
+	// ContentSecurityPolicy is the Content-Security-Policy header, e.g. `default-src 'self'`
+	ContentSecurityPolicy string
+	// ReferrerPolicy is the Referrer-Policy header, e.g. `strict-origin-when-cross-origin`
+	ReferrerPolicy string
+	// FrameOptions is the X-Frame-Options header, `DENY` or `SAMEORIGIN`
+	FrameOptions string
+	// Routes replace the headers of the requests whose path starts with their key, e.g. `/docs/` for pages which load scripts.
+	// The longest matching route is used
+	Routes map[string]SecurityHeadersConfig
+}
+
+// DefaultSecurityHeaders returns the headers suited to json APIs, which forbid browsers from rendering, framing or sniffing the responses
+func DefaultSecurityHeaders() SecurityHeadersConfig {
+	return SecurityHeadersConfig{
+		StrictTransportSecurity: "max-age=63072000; includeSubDomains",
+		ContentTypeOptions:      "nosniff",
+		ContentSecurityPolicy:   "default-src 'none'; frame-ancestors 'none'",
+		ReferrerPolicy:          "no-referrer",
+		FrameOptions:            "DENY",
+	}
+}
+
+// SecurityHeaders is a middleware adding the security headers of the config, or of the route matching the request's path, to every response.
+// Handlers can still change them with ctx.SetResponseHeader
+func SecurityHeaders(security SecurityHeadersConfig) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx FunctionContext) error {
+			headers := security.route(ctx.Request.URL.Path)
+			for name, value := range map[string]string{
+				"Strict-Transport-Security": headers.StrictTransportSecurity,
+				"X-Content-Type-Options":    headers.ContentTypeOptions,
+				"Content-Security-Policy":   headers.ContentSecurityPolicy,
+				"Referrer-Policy":           headers.ReferrerPolicy,
+				"X-Frame-Options":           headers.FrameOptions,
+			} {
+				if value != "" {
+					ctx.SetResponseHeader(name, value)
+				}
+			}
+			return next(ctx)
+		}
+	}
+}
+
+// route returns the headers of the longest route the path starts with, or the config's own headers
+func (this SecurityHeadersConfig) route(path string) SecurityHeadersConfig {
+	matched, headers := "", this
+	for prefix, route := range this.Routes {
+		if strings.HasPrefix(path, prefix) && len(prefix) > len(matched) {
+			matched, headers = prefix, route
+		}
+	}
+	return headers
+}
@@ -0,0 +1,62 @@
+package toolkit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// SentryReporter is an ErrorReporter which sends the errors to Sentry, tagged with the span and trace ids of the request, and the request's metadata
+type SentryReporter struct {
+	client *sentry.Client
+}
+
+// NewSentryReporter creates a reporter from the given Sentry client options, e.g. `sentry.ClientOptions{Dsn: os.Getenv("SENTRY_DSN")}`.
+// The release defaults to the app version set with WithResponseMeta
+func NewSentryReporter(options sentry.ClientOptions) (*SentryReporter, error) {
+	if options.Release == "" {
+		options.Release = config.AppVersion
+	}
+	client, err := sentry.NewClient(options)
+	if err != nil {
+		return nil, err
+	}
+	return &SentryReporter{client: client}, nil
+}
+
+// ReportError sends the error to Sentry. Sentry sends it from a background goroutine
+func (this *SentryReporter) ReportError(ctx context.Context, report ErrorReport) {
+	scope := sentry.NewScope()
+	scope.SetTag("spanId", report.SpanId)
+	scope.SetTag("traceId", report.TraceId)
+	scope.SetTag("requestId", report.RequestId)
+	scope.SetTag("status", strconv.Itoa(report.Status))
+	scope.SetExtra("message", report.Message)
+	if report.Request != nil {
+		scope.SetRequest(report.Request)
+	}
+	if report.Principal != nil {
+		scope.SetUser(sentry.User{ID: report.Principal.Id, Email: report.Principal.Claim("email")})
+	}
+	if report.Fingerprint != "" {
+		scope.SetFingerprint([]string{report.Fingerprint})
+	}
+	level := sentry.LevelError
+	if report.Panic {
+		level = sentry.LevelFatal
+	}
+	scope.SetLevel(level)
+	hub := sentry.NewHub(this.client, scope)
+	if report.Err != nil {
+		hub.CaptureException(report.Err)
+	} else {
+		hub.CaptureMessage(report.Message)
+	}
+}
+
+// Flush waits until the errors have been sent to Sentry, or the timeout expires. Call it before the instance stops
+func (this *SentryReporter) Flush(timeout time.Duration) bool {
+	return this.client.Flush(timeout)
+}
@@ -0,0 +1,349 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// SessionStore keeps the values of sessions by their id. Implement it to keep sessions in another store
+type SessionStore interface {
+	// Load returns the values of a session, and nil if it doesn't exist or has expired
+	Load(ctx context.Context, id string) (map[string]interface{}, error)
+	// Save stores the values of a session until the maxAge has passed
+	Save(ctx context.Context, id string, values map[string]interface{}, maxAge time.Duration) error
+	// Delete removes a session
+	Delete(ctx context.Context, id string) error
+}
+
+// SessionConfig configures Sessions
+type SessionConfig struct {
+	// Store keeps the values of sessions, whose id is kept in a signed cookie. When it's nil, the values are kept in an encrypted cookie,
+	// which needs no store but is limited to about 4KB and can't be revoked before it expires
+	Store SessionStore
+	// CookieName is the name of the session cookie. Defaults to `session`
+	CookieName string
+	// MaxAge is how long a session lasts after it was last changed. Defaults to 24 hours
+	MaxAge time.Duration
+	// Cookie is the template of the session cookie, whose Path, Domain, Secure, HttpOnly and SameSite attributes are used.
+	// Defaults to a cookie for every path which is Secure, HttpOnly and SameSite=Lax
+	Cookie *http.Cookie
+}
+
+// Session holds the values of a browser's session. Values are encoded as json, so they're read back as the types json.Unmarshal decodes into an interface{}
+type Session struct {
+	mutex     sync.Mutex
+	id        string
+	values    map[string]interface{}
+	changed   bool
+	destroyed bool
+	// previousId is the id of the session before Renew, which is deleted from the store
+	previousId string
+}
+
+type sessionKey struct{}
+
+// Sessions is a middleware loading the session of the request's cookie, available through ctx.Session, and saving it before the response is written if it was changed.
+// Requests get a 503 response if the store fails. Needs WithCookieSecrets to sign or encrypt the cookie
+func Sessions(sessions SessionConfig) Middleware {
+	if sessions.CookieName == "" {
+		sessions.CookieName = "session"
+	}
+	if sessions.MaxAge == 0 {
+		sessions.MaxAge = 24 * time.Hour
+	}
+	if sessions.Cookie == nil {
+		sessions.Cookie = &http.Cookie{Path: "/", Secure: true, HttpOnly: true, SameSite: http.SameSiteLaxMode}
+	}
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx FunctionContext) error {
+			session, err := sessions.load(ctx)
+			if err != nil {
+				return ServiceUnavailable("Failed to load the session").WithCause(err)
+			}
+			ctx.Context = context.WithValue(ctx.Context, sessionKey{}, session)
+			ctx.beforeWrite(func() {
+				if err := sessions.save(ctx, session); err != nil {
+					ctx.Errorf("Failed to save the session: %v", err)
+				}
+			})
+			return next(ctx)
+		}
+	}
+}
+
+// Session returns the session loaded by the Sessions middleware, and nil for requests it didn't handle
+func (this FunctionContext) Session() *Session {
+	session, _ := this.Context.Value(sessionKey{}).(*Session)
+	return session
+}
+
+// beforeWrite calls the hook right before the headers of the response are written
+func (this FunctionContext) beforeWrite(hook func()) {
+	if this.state != nil {
+		this.state.writer.beforeWrite = append(this.state.writer.beforeWrite, hook)
+	}
+}
+
+// load reads the session of the request's cookie, or creates an empty one
+func (this SessionConfig) load(ctx FunctionContext) (*Session, error) {
+	session := &Session{values: map[string]interface{}{}}
+	if this.Store == nil {
+		if value, ok := ctx.GetEncryptedCookie(this.CookieName); ok && json.Unmarshal([]byte(value), &session.values) != nil {
+			session.values = map[string]interface{}{}
+		}
+		return session, nil
+	}
+	id, ok := ctx.GetSignedCookie(this.CookieName)
+	if !ok {
+		return session, nil
+	}
+	values, err := this.Store.Load(ctx.Context, id)
+	if err != nil || values == nil {
+		return session, err
+	}
+	session.id, session.values = id, values
+	return session, nil
+}
+
+// save stores a changed session and sets its cookie, or deletes a destroyed one and expires its cookie
+func (this SessionConfig) save(ctx FunctionContext, session *Session) error {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	cookie := *this.Cookie
+	cookie.Name = this.CookieName
+	if this.Store != nil && session.previousId != "" {
+		if err := this.Store.Delete(ctx.Context, session.previousId); err != nil {
+			return err
+		}
+	}
+	if session.destroyed {
+		if this.Store != nil && session.id != "" {
+			if err := this.Store.Delete(ctx.Context, session.id); err != nil {
+				return err
+			}
+		}
+		cookie.MaxAge = -1
+		http.SetCookie(ctx.Response, &cookie)
+		return nil
+	}
+	if !session.changed {
+		return nil
+	}
+	cookie.MaxAge = int(this.MaxAge.Seconds())
+	if this.Store == nil {
+		encoded, err := json.Marshal(session.values)
+		if err != nil {
+			return err
+		}
+		cookie.Value = string(encoded)
+		return ctx.SetEncryptedCookie(cookie)
+	}
+	if session.id == "" {
+		session.id = newSessionId()
+	}
+	if err := this.Store.Save(ctx.Context, session.id, session.values, this.MaxAge); err != nil {
+		return err
+	}
+	cookie.Value = session.id
+	return ctx.SetSignedCookie(cookie)
+}
+
+// newSessionId returns a random id of 256 bits
+func newSessionId() string {
+	id := make([]byte, 32)
+	_, _ = rand.Read(id)
+	return base64.RawURLEncoding.EncodeToString(id)
+}
+
+// Id returns the id of the session in its store, which is empty for new sessions and sessions kept in a cookie
+func (this *Session) Id() string {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	return this.id
+}
+
+// Get returns a value of the session, and false if it isn't set
+func (this *Session) Get(key string) (interface{}, bool) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	value, ok := this.values[key]
+	return value, ok
+}
+
+// GetString returns a string value of the session, and an empty string if it isn't set or isn't a string
+func (this *Session) GetString(key string) string {
+	value, _ := this.Get(key)
+	text, _ := value.(string)
+	return text
+}
+
+// Set sets a value of the session, which must be encodable as json
+func (this *Session) Set(key string, value interface{}) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.values[key] = value
+	this.changed = true
+}
+
+// Delete removes a value of the session
+func (this *Session) Delete(key string) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	delete(this.values, key)
+	this.changed = true
+}
+
+// Renew gives the session a new id while keeping its values, which should be done when a user logs in so that a session id set by an attacker can't be used
+func (this *Session) Renew() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.id != "" && this.previousId == "" {
+		this.previousId = this.id
+	}
+	this.id = ""
+	this.changed = true
+}
+
+// Destroy removes the session from its store and expires its cookie, e.g. when the user logs out
+func (this *Session) Destroy() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.values = map[string]interface{}{}
+	this.destroyed = true
+}
+
+// RedisSessionStore is a SessionStore keeping sessions in Redis (e.g. Memorystore), with their values encoded as json.
+// The toolkit doesn't depend on a Redis client, so the store runs its commands with the Eval function of yours
+type RedisSessionStore struct {
+	Eval RedisEvalFunc
+	// Prefix is added to the session ids in Redis
+	Prefix string
+}
+
+// NewRedisSessionStore creates a store running its commands with the given function, whose sessions are stored under the `session:` prefix
+func NewRedisSessionStore(eval RedisEvalFunc) *RedisSessionStore {
+	return &RedisSessionStore{Eval: eval, Prefix: "session:"}
+}
+
+// Load gets the values of the session
+func (this *RedisSessionStore) Load(ctx context.Context, id string) (map[string]interface{}, error) {
+	reply, err := this.Eval(ctx, `return redis.call('GET', KEYS[1])`, []string{this.Prefix + id})
+	if err != nil || reply == nil {
+		// go-redis returns an error for nil replies, which means the session doesn't exist
+		if err != nil && err.Error() != "redis: nil" {
+			return nil, fmt.Errorf("failed to load the session from Redis: %w", err)
+		}
+		return nil, nil
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(fmt.Sprint(reply)), &values); err != nil {
+		return nil, fmt.Errorf("invalid session in Redis: %w", err)
+	}
+	return values, nil
+}
+
+// Save sets the values of the session, which Redis expires after the maxAge
+func (this *RedisSessionStore) Save(ctx context.Context, id string, values map[string]interface{}, maxAge time.Duration) error {
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	_, err = this.Eval(ctx, `return redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])`, []string{this.Prefix + id}, string(encoded), maxAge.Milliseconds())
+	if err != nil {
+		return fmt.Errorf("failed to save the session in Redis: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the session from Redis
+func (this *RedisSessionStore) Delete(ctx context.Context, id string) error {
+	if _, err := this.Eval(ctx, `return redis.call('DEL', KEYS[1])`, []string{this.Prefix + id}); err != nil {
+		return fmt.Errorf("failed to delete the session from Redis: %w", err)
+	}
+	return nil
+}
+
+// FirestoreSessionStore is a SessionStore keeping every session in a document of the collection, with its values encoded as json in the `values` field.
+// Expired sessions aren't loaded, and their `expireAt` field can be used as a TTL policy to delete them
+type FirestoreSessionStore struct {
+	Collection string
+	// Database is the id of the Firestore database. Defaults to `(default)`
+	Database string
+	// Endpoint is the address of the Firestore API, which can be set to an emulator
+	Endpoint string
+}
+
+// NewFirestoreSessionStore creates a store keeping sessions in the collection of the default database of the function's project
+func NewFirestoreSessionStore(collection string) *FirestoreSessionStore {
+	endpoint := "https://firestore.googleapis.com"
+	if host := os.Getenv("FIRESTORE_EMULATOR_HOST"); host != "" {
+		endpoint = "http://" + host
+	}
+	return &FirestoreSessionStore{Collection: collection, Database: "(default)", Endpoint: endpoint}
+}
+
+// Load gets the document of the session
+func (this *FirestoreSessionStore) Load(ctx context.Context, id string) (map[string]interface{}, error) {
+	var document firestoreJsonDocument
+	err := googleApi(ctx, http.MethodGet, this.document(id), nil, &document)
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) && statusErr.status == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the session from Firestore: %w", err)
+	}
+	fields, err := decodeFirestoreJsonFields(document.Fields)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session document: %w", err)
+	}
+	if expireAt, ok := fields["expireAt"].(time.Time); ok && time.Now().After(expireAt) {
+		return nil, nil
+	}
+	encoded, _ := fields["values"].(string)
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(encoded), &values); err != nil {
+		return nil, fmt.Errorf("invalid session document: %w", err)
+	}
+	return values, nil
+}
+
+// Save writes the document of the session
+func (this *FirestoreSessionStore) Save(ctx context.Context, id string, values map[string]interface{}, maxAge time.Duration) error {
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	document := map[string]interface{}{"fields": map[string]interface{}{
+		"values":   map[string]interface{}{"stringValue": string(encoded)},
+		"expireAt": map[string]interface{}{"timestampValue": time.Now().Add(maxAge).UTC().Format(time.RFC3339)},
+	}}
+	if err := googleApi(ctx, http.MethodPatch, this.document(id), document, nil); err != nil {
+		return fmt.Errorf("failed to save the session in Firestore: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the document of the session
+func (this *FirestoreSessionStore) Delete(ctx context.Context, id string) error {
+	err := googleApi(ctx, http.MethodDelete, this.document(id), nil, nil)
+	var statusErr *httpStatusError
+	if err != nil && !(errors.As(err, &statusErr) && statusErr.status == http.StatusNotFound) {
+		return fmt.Errorf("failed to delete the session from Firestore: %w", err)
+	}
+	return nil
+}
+
+// document returns the address of the document of a session
+func (this *FirestoreSessionStore) document(id string) string {
+	return this.Endpoint + "/v1/projects/" + projectId() + "/databases/" + url.PathEscape(this.Database) + "/documents/" + this.Collection + "/" + url.PathEscape(id)
+}
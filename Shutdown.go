@@ -0,0 +1,158 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ShutdownFlushTimeout is the least time Shutdown gives the OnShutdown hooks and the flushes of the metrics, spans and error reporters,
+// even when the requests in flight used up the grace period
+var ShutdownFlushTimeout = 2 * time.Second
+
+// lifecycle keeps track of the requests being handled by the instance, and the hooks run when it shuts down
+var lifecycle struct {
+	inFlight     atomic.Int64
+	shuttingDown atomic.Bool
+	mutex        sync.Mutex
+	hooks        []func(ctx context.Context) error
+}
+
+// OnShutdown registers a function which is called when the instance shuts down, after the requests in flight have completed, e.g. to close database connections.
+// Hooks are called in the reverse order they were registered, like deferred functions
+func OnShutdown(hook func(ctx context.Context) error) {
+	lifecycle.mutex.Lock()
+	defer lifecycle.mutex.Unlock()
+	lifecycle.hooks = append(lifecycle.hooks, hook)
+}
+
+// ShuttingDown returns true once the instance has started shutting down. Handlers created with Handle respond with a 503 status from then on
+func ShuttingDown() bool {
+	return lifecycle.shuttingDown.Load()
+}
+
+// InFlightRequests returns the number of requests whose ctx has been created but whose response hasn't been written yet
+func InFlightRequests() int {
+	return int(lifecycle.inFlight.Load())
+}
+
+// HandleShutdown listens for the SIGTERM signal Cloud Run sends before stopping an instance (and SIGINT, for local runs), then shuts the instance down
+// with Shutdown, giving it the grace period to complete, and exits. The given servers are shut down first, so they stop accepting connections.
+// Keep the grace period and ShutdownFlushTimeout within the time the platform waits after sending the signal
+func HandleShutdown(gracePeriod time.Duration, servers ...*http.Server) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		received := <-signals
+		backgroundLogger().Info().Msgf("Received %v, shutting down", received)
+		ctx, cancel := context.WithTimeout(context.Background(), gracePeriod)
+		err := Shutdown(ctx, servers...)
+		cancel()
+		if err != nil {
+			backgroundLogger().Error().Err(err).Msg("Failed to shut down gracefully")
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}()
+}
+
+// Shutdown stops the instance gracefully: new requests are refused, the given servers are shut down, the requests in flight are given until the context
+// is done to complete, then the OnShutdown hooks are run, and the metrics, spans and error reporters are flushed. The hooks and flushes get at least
+// ShutdownFlushTimeout, since they matter most when the requests were slow to complete
+func Shutdown(ctx context.Context, servers ...*http.Server) error {
+	lifecycle.shuttingDown.Store(true)
+	var errs []error
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to shut down server %v: %w", server.Addr, err))
+		}
+	}
+	if err := waitForRequests(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	ctx, cancel := flushContext(ctx)
+	defer cancel()
+	lifecycle.mutex.Lock()
+	hooks := lifecycle.hooks
+	lifecycle.mutex.Unlock()
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := runShutdownHook(ctx, hooks[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := ShutdownTelemetry(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	flushReporters(ctx)
+	return errors.Join(errs...)
+}
+
+// flushContext returns the context of the hooks and flushes: the given one, or one lasting ShutdownFlushTimeout if it has less time left
+func flushContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if deadline, ok := ctx.Deadline(); ctx.Err() == nil && (!ok || time.Until(deadline) >= ShutdownFlushTimeout) {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(context.WithoutCancel(ctx), ShutdownFlushTimeout)
+}
+
+// leave stops counting the request as in flight. Called with the state's mutex held when the response is finished, or when the server ends the request
+func (this *requestState) leave() {
+	if this.inFlight {
+		this.inFlight = false
+		lifecycle.inFlight.Add(-1)
+	}
+}
+
+// waitForRequests waits until every request in flight has completed, or the context is done
+func waitForRequests(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for InFlightRequests() > 0 {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%v requests still in flight: %w", InFlightRequests(), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+func runShutdownHook(ctx context.Context, hook func(ctx context.Context) error) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("shutdown hook panicked: %v", recovered)
+		}
+	}()
+	return hook(ctx)
+}
+
+// flushReporters waits for the error reporters which send errors in the background, like SentryReporter, until the context is done
+func flushReporters(ctx context.Context) {
+	timeout := 2 * time.Second
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	for _, reporter := range config.ErrorReporters {
+		if flusher, ok := reporter.(interface{ Flush(time.Duration) bool }); ok && timeout > 0 {
+			flusher.Flush(timeout)
+		}
+	}
+}
+
+// ResetShutdown clears the shutdown state, the hooks and the count of requests in flight, so the instance handles requests again. Used in tests
+func ResetShutdown() {
+	lifecycle.mutex.Lock()
+	defer lifecycle.mutex.Unlock()
+	lifecycle.shuttingDown.Store(false)
+	lifecycle.inFlight.Store(0)
+	lifecycle.hooks = nil
+}
@@ -0,0 +1,82 @@
+package toolkit
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RequestSigner signs outbound requests, e.g. an AWSSigner or an HMACConfig
+type RequestSigner interface {
+	// Sign adds the signature headers to the request, whose body has been read into the body slice
+	Sign(rq *http.Request, body []byte) error
+}
+
+// signingTransport signs requests before sending them
+type signingTransport struct {
+	signer RequestSigner
+	base   http.RoundTripper
+}
+
+// NewSigningTransport wraps the given transport (http.DefaultTransport when nil) so that every request is signed by the signer before it's sent
+func NewSigningTransport(signer RequestSigner, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &signingTransport{signer: signer, base: base}
+}
+
+func (this *signingTransport) RoundTrip(rq *http.Request) (*http.Response, error) {
+	signed := rq.Clone(rq.Context())
+	var body []byte
+	if rq.Body != nil && rq.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(rq.Body)
+		_ = rq.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		signed.Body = io.NopCloser(bytes.NewReader(body))
+		signed.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+		signed.ContentLength = int64(len(body))
+	}
+	if err := this.signer.Sign(signed, body); err != nil {
+		return nil, err
+	}
+	return this.base.RoundTrip(signed)
+}
+
+// SignedHTTPClient returns an http.Client which adds this ctx's trace headers to every request it sends, and signs it with the signer
+func (this FunctionContext) SignedHTTPClient(signer RequestSigner) *http.Client {
+	trace := this.currentTrace()
+	return &http.Client{Transport: &tracingTransport{base: NewSigningTransport(signer, nil), trace: &trace}}
+}
+
+// Sign signs an outbound request the way the config verifies inbound ones, so a function can call another which checks its signature with RequireHMAC.
+// The signature is hex encoded and the timestamp is in unix seconds
+func (this HMACConfig) Sign(rq *http.Request, body []byte) error {
+	var timestamp string
+	if this.TimestampHeader != "" {
+		timestamp = strconv.FormatInt(time.Now().Unix(), 10)
+		rq.Header.Set(this.TimestampHeader, timestamp)
+	}
+	payload := body
+	if this.SignedPayload != nil {
+		payload = this.SignedPayload(timestamp, body)
+	}
+	algorithm := this.Algorithm
+	if algorithm == nil {
+		algorithm = sha256.New
+	}
+	mac := hmac.New(algorithm, []byte(this.Secret))
+	mac.Write(payload)
+	rq.Header.Set(this.Header, this.Prefix+hex.EncodeToString(mac.Sum(nil)))
+	return nil
+}
@@ -0,0 +1,80 @@
+package toolkit
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+)
+
+// SlackEvent is the envelope of a request sent by the Slack Events API. Bind decodes the event it carries, e.g. an app_mention event
+type SlackEvent struct {
+	// Type is `event_callback` for events, or `url_verification` when the request URL is configured
+	Type      string          `json:"type"`
+	TeamId    string          `json:"team_id"`
+	ApiAppId  string          `json:"api_app_id"`
+	EventId   string          `json:"event_id"`
+	EventTime int64           `json:"event_time"`
+	Challenge string          `json:"challenge"`
+	Event     json.RawMessage `json:"event"`
+}
+
+// EventType returns the type of the event the envelope carries, e.g. `app_mention`
+func (this SlackEvent) EventType() string {
+	var event struct {
+		Type string `json:"type"`
+	}
+	_ = codec.Unmarshal(this.Event, &event)
+	return event.Type
+}
+
+// Bind decodes the event the envelope carries into the given object
+func (this SlackEvent) Bind(obj interface{}) error {
+	return codec.Unmarshal(this.Event, obj)
+}
+
+// RequireSlackSignature is a middleware which rejects requests with a 401 response unless they're signed by Slack with the app's signing secret less than 5 minutes ago.
+// Requests the instance handled successfully are acknowledged without running the handler again if they're replayed within the tolerance.
+// It answers the url_verification challenge Slack sends when the request URL of the Events API is configured.
+// Handlers of the Events API get the event with ctx.SlackEvent, and those of slash commands read its form fields with ctx.Request.PostFormValue.
+// Panics if the signing secret is empty
+func RequireSlackSignature(signingSecret string) Middleware {
+	if signingSecret == "" {
+		panic("RequireSlackSignature requires the app's signing secret")
+	}
+	deliveries := newDeliveryLog(2 * DefaultSignatureTolerance)
+	config := HMACConfig{
+		Header:          "X-Slack-Signature",
+		Secret:          signingSecret,
+		Algorithm:       sha256.New,
+		Prefix:          "v0=",
+		TimestampHeader: "X-Slack-Request-Timestamp",
+		SignedPayload: func(timestamp string, body []byte) []byte {
+			return append([]byte("v0:"+timestamp+":"), body...)
+		},
+	}
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx FunctionContext) error {
+			if err := ctx.VerifyHMACWith(config); err != nil {
+				return err
+			}
+			if event, err := ctx.SlackEvent(); err == nil && event.Type == "url_verification" {
+				ctx.Debug("Answering Slack URL verification")
+				ctx.OkResponse("text/plain", []byte(event.Challenge))
+				return nil
+			}
+			return deliveries.handleOnce(ctx, ctx.Request.Header.Get("X-Slack-Signature"), next)
+		}
+	}
+}
+
+// SlackEvent decodes the request body as an envelope of the Slack Events API. Returns a BadRequest error if it isn't one
+func (this FunctionContext) SlackEvent() (SlackEvent, error) {
+	body, err := this.RawBody()
+	if err != nil {
+		return SlackEvent{}, BadRequest("Failed to read request body").WithCause(err)
+	}
+	var event SlackEvent
+	if err := codec.Unmarshal(body, &event); err != nil || event.Type == "" {
+		return SlackEvent{}, BadRequest("Invalid Slack event").WithCause(err)
+	}
+	return event, nil
+}
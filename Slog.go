@@ -0,0 +1,125 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// WithSlogHandler sends the logs to the given log/slog handler instead of writing them as json, e.g. `tk.WithSlogHandler(slog.Default().Handler())`.
+// The ctx logging methods, sampling, redaction and buffering work the same, and the fields of each entry become attributes of the slog record.
+// The handler gets the context of the request, with its OpenTelemetry span when tracing is enabled, so context aware handlers can correlate the records.
+// The entries are still encoded as json by zerolog first, and decoded with the json codec into records, which costs more than writing them directly
+func WithSlogHandler(handler slog.Handler) Option {
+	return func(config *Config) {
+		config.LogWriter = slogWriter{handler: handler}
+	}
+}
+
+// slogWriter converts the json entries written by zerolog into slog records. The writer of each request is given the request's context
+type slogWriter struct {
+	handler slog.Handler
+	ctx     context.Context
+}
+
+func (this slogWriter) Write(p []byte) (int, error) {
+	return this.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (this slogWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	var raw map[string]json.RawMessage
+	if err := codec.Unmarshal(p, &raw); err != nil {
+		return 0, err
+	}
+	fields := make(map[string]interface{}, len(raw))
+	for key, value := range raw {
+		fields[key] = decodeSlogField(value)
+	}
+	if level == zerolog.NoLevel {
+		if name, ok := fields[zerolog.LevelFieldName].(string); ok {
+			level, _ = zerolog.ParseLevel(name)
+		}
+	}
+	ctx := this.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	slogLevel := slogLevel(level)
+	if !this.handler.Enabled(ctx, slogLevel) {
+		return len(p), nil
+	}
+
+	message, _ := fields[zerolog.MessageFieldName].(string)
+	timestamp := time.Now()
+	if unix, ok := fields[zerolog.TimestampFieldName].(json.Number); ok && zerolog.TimeFieldFormat == zerolog.TimeFormatUnix {
+		if seconds, err := unix.Int64(); err == nil {
+			timestamp = time.Unix(seconds, 0)
+		}
+	}
+	delete(fields, zerolog.MessageFieldName)
+	delete(fields, zerolog.TimestampFieldName)
+	delete(fields, zerolog.LevelFieldName)
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	record := slog.NewRecord(timestamp, slogLevel, message, 0)
+	for _, key := range keys {
+		record.AddAttrs(slog.Any(key, slogValue(fields[key])))
+	}
+	if err := this.handler.Handle(ctx, record); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// decodeSlogField decodes a field of the entry with the json codec. Numbers are kept as json.Number, so that slogValue converts them without losing precision
+func decodeSlogField(value json.RawMessage) interface{} {
+	trimmed := bytes.TrimSpace(value)
+	if len(trimmed) > 0 && (trimmed[0] == '-' || (trimmed[0] >= '0' && trimmed[0] <= '9')) {
+		return json.Number(trimmed)
+	}
+	var decoded interface{}
+	_ = codec.Unmarshal(trimmed, &decoded)
+	return decoded
+}
+
+// slogValue converts the numbers decoded from the entry back into ints and floats
+func slogValue(value interface{}) interface{} {
+	number, ok := value.(json.Number)
+	if !ok {
+		return value
+	}
+	if integer, err := number.Int64(); err == nil {
+		return integer
+	}
+	float, _ := number.Float64()
+	return float
+}
+
+// slogLevel maps zerolog levels to slog's. FATAL and PANIC are above ERROR, as slog has no levels for them
+func slogLevel(level zerolog.Level) slog.Level {
+	switch level {
+	case zerolog.TraceLevel:
+		return slog.LevelDebug - 4
+	case zerolog.DebugLevel:
+		return slog.LevelDebug
+	case zerolog.WarnLevel:
+		return slog.LevelWarn
+	case zerolog.ErrorLevel:
+		return slog.LevelError
+	case zerolog.FatalLevel:
+		return slog.LevelError + 4
+	case zerolog.PanicLevel:
+		return slog.LevelError + 8
+	default:
+		return slog.LevelInfo
+	}
+}
@@ -0,0 +1,118 @@
+package toolkit
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ResponseError is an error which carries the status code, client message and details of the error response it should be sent as, and the internal message and error
+// which caused it. Create it with one of the constructors, e.g. NotFound, and return it from a handler created with Handle
+type ResponseError struct {
+	Status int
+	// Message is sent to the client, so it mustn't contain internal details
+	Message string
+	Details []ErrorDetail
+	// Internal is the message logged instead of the client message, which may contain internal details like ids and hostnames
+	Internal string
+	// Cause is the internal error, which is logged but never sent to the client
+	Cause error
+}
+
+// NewResponseError creates an error sent with the given status code and client message
+func NewResponseError(status int, message string, details ...ErrorDetail) *ResponseError {
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	return &ResponseError{Status: status, Message: message, Details: details}
+}
+
+// BadRequest creates an error sent with a 400 status, and the details of what was wrong with the request
+func BadRequest(message string, details ...ErrorDetail) *ResponseError {
+	return NewResponseError(http.StatusBadRequest, message, details...)
+}
+
+// Unauthorized creates an error sent with a 401 status, for requests without valid credentials
+func Unauthorized(message string) *ResponseError {
+	return NewResponseError(http.StatusUnauthorized, message)
+}
+
+// Forbidden creates an error sent with a 403 status, for requests whose credentials don't allow the operation
+func Forbidden(message string) *ResponseError {
+	return NewResponseError(http.StatusForbidden, message)
+}
+
+// NotFound creates an error sent with a 404 status
+func NotFound(message string) *ResponseError {
+	return NewResponseError(http.StatusNotFound, message)
+}
+
+// Conflict creates an error sent with a 409 status, e.g. when the resource already exists or was changed concurrently
+func Conflict(message string) *ResponseError {
+	return NewResponseError(http.StatusConflict, message)
+}
+
+// Unprocessable creates an error sent with a 422 status, and the details of every field which failed validation
+func Unprocessable(message string, details ...ErrorDetail) *ResponseError {
+	return NewResponseError(http.StatusUnprocessableEntity, message, details...)
+}
+
+// TooManyRequests creates an error sent with a 429 status
+func TooManyRequests(message string) *ResponseError {
+	return NewResponseError(http.StatusTooManyRequests, message)
+}
+
+// Internal creates an error sent with a 500 status, caused by the given internal error
+func Internal(message string, cause error) *ResponseError {
+	return NewResponseError(http.StatusInternalServerError, message).WithCause(cause)
+}
+
+// ServiceUnavailable creates an error sent with a 503 status, e.g. when a dependency is down
+func ServiceUnavailable(message string) *ResponseError {
+	return NewResponseError(http.StatusServiceUnavailable, message)
+}
+
+// WithCause returns a copy of the error caused by the given internal error, e.g. `tk.NotFound("Order not found").WithCause(err)`
+func (this *ResponseError) WithCause(cause error) *ResponseError {
+	copied := *this
+	copied.Cause = cause
+	return &copied
+}
+
+// WithInternal returns a copy of the error with the given internal message, formatted with the args, e.g. `tk.NotFound("Order not found").WithInternal("order %v is not in shard %v", id, shard)`
+func (this *ResponseError) WithInternal(format string, args ...interface{}) *ResponseError {
+	copied := *this
+	copied.Internal = fmt.Sprintf(format, args...)
+	return &copied
+}
+
+// Error returns the internal message (or the client message if there's none), followed by the internal error if there is one. It's meant for logs, not for clients
+func (this *ResponseError) Error() string {
+	message := this.Message
+	if this.Internal != "" {
+		message = this.Internal
+	}
+	if this.Cause == nil {
+		return message
+	}
+	return message + ": " + this.Cause.Error()
+}
+
+// Unwrap returns the internal error
+func (this *ResponseError) Unwrap() error {
+	return this.Cause
+}
+
+// StatusCode returns the status code of the response
+func (this *ResponseError) StatusCode() int {
+	return this.Status
+}
+
+// ClientMessage returns the message sent to the client
+func (this *ResponseError) ClientMessage() string {
+	return this.Message
+}
+
+// ErrorDetails returns the details sent to the client
+func (this *ResponseError) ErrorDetails() []ErrorDetail {
+	return this.Details
+}
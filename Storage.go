@@ -0,0 +1,157 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The kinds of Cloud Storage object events, returned by StorageEventKind
+const (
+	StorageFinalized       = "finalized"
+	StorageDeleted         = "deleted"
+	StorageArchived        = "archived"
+	StorageMetadataUpdated = "metadataUpdated"
+)
+
+// StorageObject is the Cloud Storage object an event was sent for. It decodes the data of both the CloudEvents and the legacy background function events,
+// so it can also be the event parameter of a background function: `func(ctx context.Context, object tk.StorageObject) error`
+type StorageObject struct {
+	Bucket         string
+	Name           string
+	Generation     int64
+	Metageneration int64
+	ContentType    string
+	Size           int64
+	Md5Hash        string
+	Crc32c         string
+	Metadata       map[string]string
+	TimeCreated    time.Time
+	Updated        time.Time
+}
+
+// UnmarshalJSON decodes the object resource of an event, whose 64-bit numbers are encoded as strings
+func (this *StorageObject) UnmarshalJSON(data []byte) error {
+	var resource struct {
+		Bucket         string            `json:"bucket"`
+		Name           string            `json:"name"`
+		Generation     json.Number       `json:"generation"`
+		Metageneration json.Number       `json:"metageneration"`
+		ContentType    string            `json:"contentType"`
+		Size           json.Number       `json:"size"`
+		Md5Hash        string            `json:"md5Hash"`
+		Crc32c         string            `json:"crc32c"`
+		Metadata       map[string]string `json:"metadata"`
+		TimeCreated    time.Time         `json:"timeCreated"`
+		Updated        time.Time         `json:"updated"`
+	}
+	if err := json.Unmarshal(data, &resource); err != nil {
+		return err
+	}
+	*this = StorageObject{
+		Bucket:      resource.Bucket,
+		Name:        resource.Name,
+		ContentType: resource.ContentType,
+		Md5Hash:     resource.Md5Hash,
+		Crc32c:      resource.Crc32c,
+		Metadata:    resource.Metadata,
+		TimeCreated: resource.TimeCreated,
+		Updated:     resource.Updated,
+	}
+	for _, number := range []struct {
+		value  json.Number
+		target *int64
+	}{{resource.Generation, &this.Generation}, {resource.Metageneration, &this.Metageneration}, {resource.Size, &this.Size}} {
+		if number.value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseInt(string(number.value), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid storage object: %w", err)
+		}
+		*number.target = parsed
+	}
+	return nil
+}
+
+// StorageEventKind returns the kind of a Cloud Storage event type (e.g. StorageFinalized), in either the CloudEvents format (`google.cloud.storage.object.v1.finalized`)
+// or the legacy format (`google.storage.object.finalize`). An empty string is returned for other event types
+func StorageEventKind(eventType string) string {
+	switch eventType {
+	case "google.cloud.storage.object.v1.finalized", "google.storage.object.finalize":
+		return StorageFinalized
+	case "google.cloud.storage.object.v1.deleted", "google.storage.object.delete":
+		return StorageDeleted
+	case "google.cloud.storage.object.v1.archived", "google.storage.object.archive":
+		return StorageArchived
+	case "google.cloud.storage.object.v1.metadataUpdated", "google.storage.object.metadataUpdate":
+		return StorageMetadataUpdated
+	default:
+		return ""
+	}
+}
+
+// BindStorageObject decodes the object of a Cloud Storage CloudEvent, and returns it together with the kind of the event (e.g. StorageFinalized)
+func (this FunctionContext) BindStorageObject() (StorageObject, string, error) {
+	e, ok := this.Event()
+	if !ok {
+		return StorageObject{}, "", errNotAnEvent
+	}
+	kind := StorageEventKind(e.Type())
+	if kind == "" {
+		return StorageObject{}, "", fmt.Errorf("%v is not a Cloud Storage object event", e.Type())
+	}
+	var object StorageObject
+	if err := e.DataAs(&object); err != nil {
+		return StorageObject{}, "", err
+	}
+	this.withSkip(1).Debugf("Received %v event for gs://%v/%v#%v", kind, object.Bucket, object.Name, object.Generation)
+	return object, kind, nil
+}
+
+// storageUrl returns the address of the Cloud Storage API, which can be overridden with the STORAGE_EMULATOR_HOST environment variable
+func storageUrl() string {
+	host := os.Getenv("STORAGE_EMULATOR_HOST")
+	if host == "" {
+		return "https://storage.googleapis.com"
+	}
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	return strings.TrimSuffix(host, "/")
+}
+
+// OpenObject opens the contents of the object for reading with the function's service account. The generation of the object is read,
+// so it fails with a 404 status if the object has since been overwritten and the bucket doesn't keep old versions. The reader must be closed
+func (this FunctionContext) OpenObject(object StorageObject) (io.ReadCloser, error) {
+	query := url.Values{"alt": {"media"}}
+	if object.Generation != 0 {
+		query.Set("generation", strconv.FormatInt(object.Generation, 10))
+	}
+	address := storageUrl() + "/storage/v1/b/" + url.PathEscape(object.Bucket) + "/o/" + url.PathEscape(object.Name) + "?" + query.Encode()
+	rq, err := http.NewRequestWithContext(this.Context, http.MethodGet, address, nil)
+	if err != nil {
+		return nil, err
+	}
+	token, err := accessToken(this.Context)
+	if err != nil {
+		return nil, err
+	}
+	rq.Header.Set("Authorization", "Bearer "+token)
+	res, err := http.DefaultClient.Do(rq)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		return nil, &httpStatusError{status: res.StatusCode, body: string(body)}
+	}
+	return res.Body, nil
+}
@@ -0,0 +1,102 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+)
+
+// StreamFlushInterval is the number of elements a JsonStream writes between flushes
+var StreamFlushInterval = 100
+
+// JsonStream writes a json array to the response one element at a time. Create it with ctx.StreamResponseJson, and Close it when all elements have been written
+type JsonStream struct {
+	ctx    FunctionContext
+	out    *responseStream
+	suffix []byte
+	count  int
+	closed bool
+}
+
+// streamDataPlaceholder is formatted as the data of a streamed response, to find where the formatter puts the array in its envelope
+const streamDataPlaceholder = "\x00streamed data\x00"
+
+// StreamResponseJson starts a 200 json response whose data is an array, and returns a stream for writing the array's elements.
+// The envelope is built by the configured ResponseFormatter, which must include the data once. Elements are written as soon as they are encoded,
+// so the whole result never has to be kept in memory. Once the stream has started the status code can't be changed anymore, so check for errors which should fail the request before calling it
+func (this FunctionContext) StreamResponseJson() (*JsonStream, error) {
+	prefix, suffix, err := this.streamEnvelope()
+	if err != nil {
+		return nil, err
+	}
+	this.withSkip(1).Debug("Responding with status 200 (streamed)")
+	out := this.startStream(http.StatusOK, "application/json; charset=utf-8")
+	if _, err := out.Write(append(prefix, '[')); err != nil {
+		return nil, err
+	}
+	return &JsonStream{ctx: this, out: out, suffix: append([]byte{']'}, suffix...)}, nil
+}
+
+// streamEnvelope returns the json written before and after the array of a streamed response, by formatting a placeholder as its data
+func (this FunctionContext) streamEnvelope() ([]byte, []byte, error) {
+	placeholder, err := codec.Marshal(streamDataPlaceholder)
+	if err != nil {
+		return nil, nil, err
+	}
+	envelope, err := codec.Marshal(config.Formatter.FormatSuccess(this, streamDataPlaceholder))
+	if err != nil {
+		return nil, nil, err
+	}
+	prefix, suffix, found := bytes.Cut(envelope, placeholder)
+	if !found || bytes.Contains(suffix, placeholder) {
+		return nil, nil, errors.New("the response formatter must include the data of streamed responses once")
+	}
+	return prefix, suffix, nil
+}
+
+// Encode serializes the object and writes it as the next element of the array
+func (this *JsonStream) Encode(obj interface{}) error {
+	if this.closed {
+		return errors.New("json stream is closed")
+	}
+	if err := this.ctx.Context.Err(); err != nil {
+		return err
+	}
+	bytes, err := codec.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	if this.count > 0 {
+		bytes = append([]byte{','}, bytes...)
+	}
+	if _, err := this.out.Write(bytes); err != nil {
+		this.ctx.withSkip(1).Errorf("Failed to write response: %v", err)
+		return err
+	}
+	this.count++
+	if this.count%StreamFlushInterval == 0 {
+		return this.out.Flush()
+	}
+	return nil
+}
+
+// Close ends the array and the response. It must be called for the response to be valid json
+func (this *JsonStream) Close() error {
+	if this.closed {
+		return nil
+	}
+	this.closed = true
+	if _, err := this.out.Write(this.suffix); err != nil {
+		this.ctx.withSkip(1).Errorf("Failed to write response: %v", err)
+		this.ctx.finishResponse(err)
+		return err
+	}
+	if err := this.out.Close(); err != nil {
+		this.ctx.withSkip(1).Errorf("Failed to write response: %v", err)
+		this.ctx.finishResponse(err)
+		return err
+	}
+	this.ctx.finishResponse(nil)
+	this.ctx.withSkip(1).Debugf("Streamed %v elements", this.count)
+	return nil
+}
@@ -0,0 +1,170 @@
+package toolkit
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+// StripeSignatureHeader is the header Stripe signs its webhook requests in
+const StripeSignatureHeader = "Stripe-Signature"
+
+// StripeEvent is the envelope of a Stripe webhook event. Bind decodes the object the event is about, e.g. a PaymentIntent
+type StripeEvent struct {
+	Id         string `json:"id"`
+	Type       string `json:"type"`
+	ApiVersion string `json:"api_version"`
+	Created    int64  `json:"created"`
+	Livemode   bool   `json:"livemode"`
+	// Account is the connected account the event happened in, for Connect webhooks
+	Account string `json:"account"`
+	Data    struct {
+		Object json.RawMessage `json:"object"`
+		// PreviousAttributes are the values of the fields an `*.updated` event changed, before the change
+		PreviousAttributes json.RawMessage `json:"previous_attributes"`
+	} `json:"data"`
+	Request struct {
+		Id             string `json:"id"`
+		IdempotencyKey string `json:"idempotency_key"`
+	} `json:"request"`
+}
+
+// Bind decodes the object of the event into the given object
+func (this StripeEvent) Bind(obj interface{}) error {
+	return codec.Unmarshal(this.Data.Object, obj)
+}
+
+// StripeHandlerFunc handles a Stripe event
+type StripeHandlerFunc func(ctx FunctionContext, event StripeEvent) error
+
+// StripeWebhook verifies the signature of Stripe webhook requests and dispatches their events to the handlers registered for their type.
+// Create it with NewStripeWebhook and use its Handle method as the function's handler
+type StripeWebhook struct {
+	secrets   []string
+	tolerance time.Duration
+	routes    []stripeRoute
+	otherwise StripeHandlerFunc
+}
+
+type stripeRoute struct {
+	eventType string
+	handler   StripeHandlerFunc
+}
+
+// NewStripeWebhook creates a webhook verifying signatures with the signing secret of the endpoint (`whsec_...`). While rolling a secret,
+// pass both the old and new ones, as Stripe signs requests with each of them. Panics without a secret or with an empty one
+func NewStripeWebhook(secrets ...string) *StripeWebhook {
+	if len(secrets) == 0 {
+		panic("NewStripeWebhook requires the endpoint's signing secret")
+	}
+	for _, secret := range secrets {
+		if secret == "" {
+			panic("NewStripeWebhook requires non-empty signing secrets")
+		}
+	}
+	return &StripeWebhook{secrets: secrets, tolerance: DefaultSignatureTolerance}
+}
+
+// WithTolerance sets how far from now the timestamp of a signature can be, which defaults to DefaultSignatureTolerance
+func (this *StripeWebhook) WithTolerance(tolerance time.Duration) *StripeWebhook {
+	this.tolerance = tolerance
+	return this
+}
+
+// On registers the handler for events of the given type, e.g. `payment_intent.succeeded`. A type ending in * matches every type starting with the rest of it.
+// Routes are matched in the order they're registered
+func (this *StripeWebhook) On(eventType string, handler StripeHandlerFunc) *StripeWebhook {
+	this.routes = append(this.routes, stripeRoute{eventType: eventType, handler: handler})
+	return this
+}
+
+// Otherwise registers the handler for events which match no route. Without one, they're acknowledged without being handled
+func (this *StripeWebhook) Otherwise(handler StripeHandlerFunc) *StripeWebhook {
+	this.otherwise = handler
+	return this
+}
+
+// Handle verifies the request and runs the handler of its event's type, with a ctx logging the event's id and type.
+// Requests which aren't correctly signed get a 401 response. Errors returned by the handler are sent like Handle does, so Stripe retries the event
+func (this *StripeWebhook) Handle(ctx FunctionContext) error {
+	event, err := ctx.VerifyStripeSignature(this.tolerance, this.secrets...)
+	if err != nil {
+		return err
+	}
+	ctx = ctx.WithFields(map[string]interface{}{"stripeEventId": event.Id, "stripeEventType": event.Type})
+	handler := this.otherwise
+	for _, route := range this.routes {
+		if matchesPattern(route.eventType, event.Type) {
+			handler = route.handler
+			break
+		}
+	}
+	if handler == nil {
+		ctx.Debugf("Ignoring Stripe %v event without a handler", event.Type)
+		return nil
+	}
+	return handler(ctx, event)
+}
+
+// VerifyStripeSignature checks the Stripe-Signature header of the request against the signing secrets, and that it was signed less than the tolerance
+// (or DefaultSignatureTolerance if 0) from now, then decodes the event. Returns an Unauthorized error if the request isn't correctly signed,
+// and an Internal error without a secret or with an empty one
+func (this FunctionContext) VerifyStripeSignature(tolerance time.Duration, secrets ...string) (StripeEvent, error) {
+	if len(secrets) == 0 || slices.Contains(secrets, "") {
+		return StripeEvent{}, Internal("Failed to verify the signature", errors.New("the Stripe signing secret is not configured"))
+	}
+	timestamp, signatures := parseStripeSignature(this.Request.Header.Get(StripeSignatureHeader))
+	if len(signatures) == 0 {
+		return StripeEvent{}, Unauthorized("Missing signature").WithInternal("no v1 signature in the %v header", StripeSignatureHeader)
+	}
+	if err := checkTimestamp(timestamp, tolerance); err != nil {
+		return StripeEvent{}, Unauthorized("Invalid signature").WithCause(err)
+	}
+	body, err := this.RawBody()
+	if err != nil {
+		return StripeEvent{}, BadRequest("Failed to read request body").WithCause(err)
+	}
+	payload := append([]byte(timestamp+"."), body...)
+	if !stripeSignatureMatches(secrets, payload, signatures) {
+		return StripeEvent{}, Unauthorized("Invalid signature").WithInternal("%v doesn't match the body", StripeSignatureHeader)
+	}
+	var event StripeEvent
+	if err := codec.Unmarshal(body, &event); err != nil {
+		return StripeEvent{}, BadRequest("Invalid Stripe event").WithCause(err)
+	}
+	if event.Type == "" {
+		return StripeEvent{}, BadRequest("Invalid Stripe event").WithCause(errors.New("event has no type"))
+	}
+	return event, nil
+}
+
+// parseStripeSignature reads the timestamp and v1 signatures of a Stripe-Signature header, e.g. `t=1492774577,v1=5257a8...,v0=6ffbb5...`
+func parseStripeSignature(header string) (string, []string) {
+	var timestamp string
+	var signatures []string
+	for _, item := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(item), "=")
+		switch name {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	return timestamp, signatures
+}
+
+// stripeSignatureMatches returns true if one of the signatures is the HMAC-SHA256 of the payload with one of the secrets
+func stripeSignatureMatches(secrets []string, payload []byte, signatures []string) bool {
+	for _, secret := range secrets {
+		for _, signature := range signatures {
+			if signatureMatches(sha256.New, secret, payload, signature) {
+				return true
+			}
+		}
+	}
+	return false
+}
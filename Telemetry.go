@@ -0,0 +1,128 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/Platform48/function_toolkit"
+
+// propagator reads and writes the W3C trace context headers
+var propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// WithTracerProvider enables OpenTelemetry tracing with the given provider. FuncCtx starts a server span for every request, which ends once the response is written
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(config *Config) {
+		config.TracerProvider = provider
+	}
+}
+
+// WithOpenTelemetry enables OpenTelemetry tracing, exporting the spans over OTLP/HTTP. The exporter is configured through the standard
+// OTEL_EXPORTER_OTLP_* environment variables. Call ShutdownTelemetry before the instance stops to flush the remaining spans
+func WithOpenTelemetry(serviceName string) Option {
+	return func(config *Config) {
+		exporter, err := otlptracehttp.New(context.Background())
+		if err != nil {
+			panic("failed to create the OTLP exporter: " + err.Error())
+		}
+		res, _ := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(serviceName)))
+		provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+		config.TracerProvider = provider
+	}
+}
+
+// ShutdownTelemetry exports the latest metrics, flushes the spans which haven't been exported yet and stops the tracer provider, if it was created by WithOpenTelemetry
+func ShutdownTelemetry(ctx context.Context) error {
+	err := FlushMetrics(ctx)
+	if provider, ok := config.TracerProvider.(*sdktrace.TracerProvider); ok {
+		return errors.Join(err, provider.Shutdown(ctx))
+	}
+	return err
+}
+
+// startServerSpan starts the root span of the request, continuing the trace from its headers. Returns the context containing the span
+func startServerSpan(r *http.Request) (context.Context, trace.Span) {
+	ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	return config.TracerProvider.Tracer(tracerName).Start(ctx, r.Method+" "+r.URL.Path,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(r.Method),
+			semconv.URLPath(r.URL.Path),
+			semconv.UserAgentOriginal(r.UserAgent()),
+		))
+}
+
+// endServerSpan records the status of the response on the root span of the request and ends it
+func (this FunctionContext) endServerSpan(status int, err error) {
+	span := this.state.span
+	if span == nil {
+		return
+	}
+	span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+	if err != nil {
+		span.RecordError(err)
+	}
+	if status >= 500 {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+	span.End()
+}
+
+// StartSpan starts a child span of the span in this ctx's Context, and returns a copy of this ctx whose Context contains the new span,
+// so log messages and further spans are attributed to it. End the span when the operation is done.
+// The span doesn't record anything if tracing isn't enabled
+func (this FunctionContext) StartSpan(name string, attributes ...attribute.KeyValue) (FunctionContext, trace.Span) {
+	provider := config.TracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	ctx, span := provider.Tracer(tracerName).Start(this.Context, name, trace.WithAttributes(attributes...))
+	this.Context = ctx
+	return this, span
+}
+
+// spanEvent adds the ids of the active span to the log event
+func (this FunctionContext) spanEvent(e *zerolog.Event) *zerolog.Event {
+	spanContext := trace.SpanContextFromContext(this.Context)
+	if !spanContext.IsValid() {
+		return e
+	}
+	if !config.GcpLogFormat {
+		return e.Str("traceId", spanContext.TraceID().String()).Str("otelSpanId", spanContext.SpanID().String())
+	}
+	e = e.Str("logging.googleapis.com/spanId", spanContext.SpanID().String()).Bool("logging.googleapis.com/trace_sampled", spanContext.IsSampled())
+	if project := projectId(); project != "" {
+		e = e.Str("logging.googleapis.com/trace", "projects/"+project+"/traces/"+spanContext.TraceID().String())
+	}
+	return e
+}
+
+// traceFromSpan builds the trace propagated to outbound calls from the active span of the context
+func traceFromSpan(ctx context.Context, fallback traceContext) traceContext {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return fallback
+	}
+	return traceContext{
+		traceId:    spanContext.TraceID().String(),
+		spanId:     fallback.spanId,
+		sampled:    spanContext.IsSampled(),
+		traceState: spanContext.TraceState().String(),
+		hopSpanId:  spanContext.SpanID().String(),
+		requestId:  fallback.requestId,
+	}
+}
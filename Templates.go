@@ -0,0 +1,69 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"sync"
+)
+
+var templates struct {
+	sync.RWMutex
+	fs     fs.FS
+	shared []string
+	parsed map[string]*template.Template
+}
+
+// Templates registers the file system (usually an embed.FS) containing the templates rendered by ctx.HTMLResponse.
+// Files matching the shared glob patterns (e.g. "layouts/*.tmpl") are parsed together with every page, so pages can use the templates defined in them.
+// Parsed templates are cached for the lifetime of the instance
+func Templates(fsys fs.FS, shared ...string) {
+	templates.Lock()
+	defer templates.Unlock()
+	templates.fs = fsys
+	templates.shared = shared
+	templates.parsed = map[string]*template.Template{}
+}
+
+func lookupTemplate(name string) (*template.Template, error) {
+	templates.RLock()
+	tmpl, ok := templates.parsed[name]
+	templates.RUnlock()
+	if ok {
+		return tmpl, nil
+	}
+
+	templates.Lock()
+	defer templates.Unlock()
+	if templates.fs == nil {
+		return nil, errors.New("no templates registered, call toolkit.Templates first")
+	}
+	if tmpl, ok := templates.parsed[name]; ok {
+		return tmpl, nil
+	}
+	tmpl, err := template.ParseFS(templates.fs, append([]string{name}, templates.shared...)...)
+	if err != nil {
+		return nil, err
+	}
+	templates.parsed[name] = tmpl
+	return tmpl, nil
+}
+
+// HTMLResponse renders the template with the given name and data, and sends it as an HTML response with the given status code.
+// If the template fails to render, a 500 response is sent instead
+func (this FunctionContext) HTMLResponse(code int, name string, data interface{}) {
+	tmpl, err := lookupTemplate(name)
+	if err != nil {
+		this.withSkip(1).ErrResponse(http.StatusInternalServerError, err, "Failed to render page")
+		return
+	}
+	var buffer bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buffer, tmpl.Name(), data); err != nil {
+		this.withSkip(1).ErrResponse(http.StatusInternalServerError, err, "Failed to render page")
+		return
+	}
+	this.withSkip(1).Debugf("Responding with status %v, page %v", code, name)
+	this.writeResponse(code, "text/html; charset=utf-8", buffer.Bytes())
+}
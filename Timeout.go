@@ -0,0 +1,91 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"time"
+)
+
+// WithTimeout gives the context of every request a deadline after the given duration. Downstream calls made with ctx.Context are cancelled when it passes,
+// and handlers created with Handle which haven't written a response by then get a 504 response
+func WithTimeout(timeout time.Duration) Option {
+	return func(config *Config) {
+		config.Timeout = timeout
+	}
+}
+
+// WithoutTimeout removes the deadline set with WithTimeout. Requests still have the deadline of the server, if it sets one
+func WithoutTimeout() Option {
+	return func(config *Config) {
+		config.Timeout = 0
+	}
+}
+
+// RemainingTime returns the time left until the deadline of the request's context, 0 once it has passed.
+// Requests without a deadline have an unlimited amount of time left, math.MaxInt64
+func (this FunctionContext) RemainingTime() time.Duration {
+	deadline, ok := this.Context.Deadline()
+	if !ok {
+		return math.MaxInt64
+	}
+	if remaining := time.Until(deadline); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// timedOut returns the error of the request's context if its deadline has passed, nil otherwise
+func (this FunctionContext) timedOut() error {
+	if err := this.Context.Err(); errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return nil
+}
+
+// watchTimeout sends a 504 response once the deadline of the request's context passes, unless the handler has already written a response.
+// The returned function stops watching, and waits for the response to be written if the deadline has already passed
+func (this FunctionContext) watchTimeout() func() {
+	if config.Timeout <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	stop := context.AfterFunc(this.Context, func() {
+		defer close(done)
+		if err := this.timedOut(); err != nil {
+			this.respondTimeout(err)
+		}
+	})
+	return func() {
+		if !stop() {
+			<-done
+		}
+	}
+}
+
+// respondTimeout writes the 504 response of a request whose deadline has passed. It runs on its own goroutine, so it writes to the response directly
+func (this FunctionContext) respondTimeout(err error) {
+	code, message, _ := timeoutStatus(err)
+	contentType, body, marshalErr := this.errorBody(code, message, nil)
+	if marshalErr != nil {
+		this.Errorf("Failed to serialize response: %v", marshalErr)
+	}
+	if !this.state.writer.writeTimeout(contentType, body) {
+		return
+	}
+	this.Errorf("Responding with status %v: request timed out after %v", code, config.Timeout)
+	this.reportToReporters(err, message, code, false)
+	this.state.mutex.Lock()
+	this.state.err = err
+	this.state.mutex.Unlock()
+	this.finishResponse(err)
+}
+
+// timeoutStatus maps the errors of expired deadlines to a 504 response
+func timeoutStatus(err error) (int, string, bool) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout, "Request timed out", true
+	}
+	return 0, "", false
+}
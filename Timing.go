@@ -0,0 +1,35 @@
+package toolkit
+
+import (
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+// Time runs the operation and logs how long it took with the `operation` and `duration` fields. Failed operations are logged at the ERROR level.
+// With OpenTelemetry enabled the operation is also recorded as a child span, and the ctx passed to it is attributed to that span.
+// Returns the error returned by the operation
+func (this FunctionContext) Time(name string, operation func(cctx FunctionContext) error) error {
+	cctx := this
+	var span trace.Span
+	if config.TracerProvider != nil {
+		cctx, span = this.StartSpan(name)
+	}
+	start := time.Now()
+	err := operation(cctx)
+	duration := time.Since(start)
+
+	if span != nil {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+	if err != nil {
+		this.event(this.Logger.Error()).Str("operation", name).Dur("duration", duration).Msgf(this.spanIdLogField+"%v failed after %v: %v", name, duration, err)
+		return err
+	}
+	this.event(this.Logger.Info()).Str("operation", name).Dur("duration", duration).Msgf(this.spanIdLogField+"%v took %v", name, duration)
+	return nil
+}
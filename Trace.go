@@ -0,0 +1,173 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// traceContext is the trace the request belongs to, parsed from its traceparent or X-Cloud-Trace-Context header
+type traceContext struct {
+	traceId    string
+	spanId     string
+	sampled    bool
+	traceState string
+	// hopSpanId identifies this function's part of the trace, and is sent as the parent span id on outbound calls
+	hopSpanId string
+	// requestId identifies the request across every function it passes through
+	requestId string
+}
+
+func randomHex(bytes int) string {
+	buffer := make([]byte, bytes)
+	_, _ = rand.Read(buffer)
+	return hex.EncodeToString(buffer)
+}
+
+func isHex(value string, length int) bool {
+	if len(value) != length {
+		return false
+	}
+	for _, c := range value {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return strings.Trim(value, "0") != ""
+}
+
+// parseTraceparent parses a W3C traceparent header, e.g. `00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01`
+func parseTraceparent(header string) (traceContext, bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || !isHex(parts[1], 32) || !isHex(parts[2], 16) || len(parts[3]) != 2 {
+		return traceContext{}, false
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return traceContext{}, false
+	}
+	return traceContext{traceId: parts[1], spanId: parts[2], sampled: flags&1 == 1}, true
+}
+
+// parseCloudTraceContext parses an X-Cloud-Trace-Context header, e.g. `105445aa7843bc8bf206b12000100000/1;o=1`. The decimal span id is converted to hex
+func parseCloudTraceContext(header string) (traceContext, bool) {
+	trace, rest, _ := strings.Cut(strings.TrimSpace(header), "/")
+	trace = strings.ToLower(trace)
+	if !isHex(trace, 32) {
+		return traceContext{}, false
+	}
+	span, options, _ := strings.Cut(rest, ";")
+	result := traceContext{traceId: trace, sampled: options == "o=1"}
+	if id, err := strconv.ParseUint(span, 10, 64); err == nil && id != 0 {
+		result.spanId = fmt.Sprintf("%016x", id)
+	}
+	return result, true
+}
+
+// parseTrace extracts the trace of the request from its headers, preferring traceparent over X-Cloud-Trace-Context.
+// A new trace is started if the request doesn't belong to one
+func parseTrace(r *http.Request) traceContext {
+	trace, ok := parseTraceparent(r.Header.Get("traceparent"))
+	if ok {
+		trace.traceState = r.Header.Get("tracestate")
+	} else if trace, ok = parseCloudTraceContext(r.Header.Get("X-Cloud-Trace-Context")); !ok {
+		trace = traceContext{traceId: randomHex(16)}
+	}
+	trace.hopSpanId = randomHex(8)
+	return trace
+}
+
+type traceContextKey struct{}
+
+// traceFromContext returns the trace stored in the context by FuncCtx
+func traceFromContext(ctx context.Context) (traceContext, bool) {
+	trace, ok := ctx.Value(traceContextKey{}).(traceContext)
+	return trace, ok
+}
+
+// headers returns the headers which propagate the trace to the next hop
+func (this traceContext) headers() http.Header {
+	flags := "00"
+	cloudOptions := "0"
+	if this.sampled {
+		flags, cloudOptions = "01", "1"
+	}
+	header := http.Header{}
+	header.Set("traceparent", "00-"+this.traceId+"-"+this.hopSpanId+"-"+flags)
+	if this.traceState != "" {
+		header.Set("tracestate", this.traceState)
+	}
+	if hop, err := strconv.ParseUint(this.hopSpanId, 16, 64); err == nil {
+		header.Set("X-Cloud-Trace-Context", this.traceId+"/"+strconv.FormatUint(hop, 10)+";o="+cloudOptions)
+	}
+	if this.requestId != "" {
+		header.Set(RequestIdHeader, this.requestId)
+	}
+	return header
+}
+
+// Traceparent returns the W3C traceparent header which identifies this function's part of the request's trace
+func (this FunctionContext) Traceparent() string {
+	return this.currentTrace().headers().Get("traceparent")
+}
+
+// currentTrace returns the trace propagated to outbound calls. With OpenTelemetry enabled, the active span of the ctx is the parent of outbound calls
+func (this FunctionContext) currentTrace() traceContext {
+	if config.TracerProvider != nil {
+		return traceFromSpan(this.Context, this.state.trace)
+	}
+	return this.state.trace
+}
+
+// OutgoingHeaders returns the headers which should be added to outbound requests so that the called services join the request's trace
+// (traceparent, tracestate and X-Cloud-Trace-Context)
+func (this FunctionContext) OutgoingHeaders() http.Header {
+	return this.currentTrace().headers()
+}
+
+// tracingTransport adds the trace headers to outbound requests
+type tracingTransport struct {
+	base  http.RoundTripper
+	trace *traceContext
+}
+
+func (this *tracingTransport) RoundTrip(rq *http.Request) (*http.Response, error) {
+	trace, ok := traceContext{}, false
+	if this.trace != nil {
+		trace, ok = *this.trace, true
+	} else {
+		trace, ok = traceFromContext(rq.Context())
+		if ok && config.TracerProvider != nil {
+			trace = traceFromSpan(rq.Context(), trace)
+		}
+	}
+	if ok {
+		rq = rq.Clone(rq.Context())
+		for name, values := range trace.headers() {
+			if rq.Header.Get(name) == "" {
+				rq.Header[name] = values
+			}
+		}
+	}
+	base := this.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(rq)
+}
+
+// NewTracingTransport wraps the given transport (http.DefaultTransport when nil) so that outbound requests created with a ctx.Context
+// carry the trace headers of the request that ctx belongs to
+func NewTracingTransport(base http.RoundTripper) http.RoundTripper {
+	return &tracingTransport{base: base}
+}
+
+// HTTPClient returns an http.Client which adds this ctx's trace headers to every request it sends
+func (this FunctionContext) HTTPClient() *http.Client {
+	trace := this.currentTrace()
+	return &http.Client{Transport: &tracingTransport{trace: &trace}}
+}
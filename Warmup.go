@@ -0,0 +1,111 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// WarmupConfig configures how warmup requests are recognised. Enable it with WithWarmup
+type WarmupConfig struct {
+	// Path is the path of warmup requests. Defaults to /_ah/warmup
+	Path string
+	// Header is a header set on warmup requests, e.g. by a Cloud Scheduler job keeping instances warm. Defaults to X-Warmup
+	Header string
+}
+
+// WithWarmup enables the handling of warmup requests, which run the hooks registered with OnWarmup instead of the handler
+func WithWarmup(warmup WarmupConfig) Option {
+	return func(config *Config) {
+		if warmup.Path == "" {
+			warmup.Path = "/_ah/warmup"
+		}
+		if warmup.Header == "" {
+			warmup.Header = "X-Warmup"
+		}
+		config.Warmup = &warmup
+	}
+}
+
+// WithoutWarmup disables the handling of warmup requests, they're passed to the handler like any other request
+func WithoutWarmup() Option {
+	return func(config *Config) {
+		config.Warmup = nil
+	}
+}
+
+var warmup struct {
+	mutex sync.Mutex
+	hooks []func(ctx context.Context) error
+	done  bool
+}
+
+// OnWarmup registers a function which is called by the first warmup request, e.g. to open database connections or load caches before real requests arrive.
+// Hooks are called in the order they were registered. If one fails, the next warmup request calls them again
+func OnWarmup(hook func(ctx context.Context) error) {
+	warmup.mutex.Lock()
+	defer warmup.mutex.Unlock()
+	warmup.hooks = append(warmup.hooks, hook)
+}
+
+// ResetWarmup removes the hooks registered with OnWarmup, and allows them to run again. Used in tests
+func ResetWarmup() {
+	warmup.mutex.Lock()
+	defer warmup.mutex.Unlock()
+	warmup.hooks = nil
+	warmup.done = false
+}
+
+// IsWarmup returns true if the request is a warmup request, as configured with WithWarmup
+func (this FunctionContext) IsWarmup() bool {
+	warmupConfig := config.Warmup
+	if warmupConfig == nil {
+		return false
+	}
+	return this.Request.URL.Path == warmupConfig.Path || this.Request.Header.Get(warmupConfig.Header) != ""
+}
+
+// RespondToWarmup runs the warmup hooks and sends a 200 response if the request is a warmup request, and returns true if it was.
+// Handle calls it before the handler, other handlers should return when it returns true
+func (this FunctionContext) RespondToWarmup() bool {
+	if !this.IsWarmup() {
+		return false
+	}
+	if err := runWarmup(this.Context); err != nil {
+		this.withSkip(1).ErrResponse(http.StatusInternalServerError, err, "Warmup failed")
+		return true
+	}
+	this.withSkip(1).OkResponseJson(Json{"warm": true})
+	return true
+}
+
+// runWarmup runs the warmup hooks, unless they have already succeeded. Concurrent warmup requests wait for the hooks to finish
+func runWarmup(ctx context.Context) error {
+	warmup.mutex.Lock()
+	defer warmup.mutex.Unlock()
+	if warmup.done {
+		return nil
+	}
+	var errs []error
+	for _, hook := range warmup.hooks {
+		if err := runWarmupHook(ctx, hook); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	warmup.done = true
+	return nil
+}
+
+func runWarmupHook(ctx context.Context, hook func(ctx context.Context) error) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("warmup hook panicked: %v", recovered)
+		}
+	}()
+	return hook(ctx)
+}
@@ -0,0 +1,175 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// webSocketCloseTimeout is how long Close waits for the close frame to be written
+const webSocketCloseTimeout = 5 * time.Second
+
+// WebSocket is a WebSocket connection upgraded by ctx.UpgradeWebSocket. Messages can be written concurrently with reads,
+// and the connection is closed when the ctx's context is done, e.g. when the request's deadline passes
+type WebSocket struct {
+	ctx        FunctionContext
+	conn       *websocket.Conn
+	writeMutex sync.Mutex
+	closeOnce  sync.Once
+	stop       func() bool
+	received   atomic.Int64
+	sent       atomic.Int64
+}
+
+// UpgradeWebSocket upgrades the request to a WebSocket connection. Origins allowed by WithCORS can connect, as well as pages of the function's own host.
+// If the request isn't a valid WebSocket handshake an error response is sent and the error is returned
+func (this FunctionContext) UpgradeWebSocket() (*WebSocket, error) {
+	failureStatus := 0
+	upgrader := websocket.Upgrader{
+		CheckOrigin: this.webSocketOriginAllowed,
+		Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+			failureStatus = status
+		},
+	}
+	conn, err := upgrader.Upgrade(this.Response, this.Request, nil)
+	if err != nil {
+		if failureStatus != 0 {
+			this.withSkip(1).FailResponse(failureStatus, "WebSocket upgrade failed: "+err.Error())
+		} else {
+			this.withSkip(1).Warnf("WebSocket upgrade failed: %v", err)
+		}
+		return nil, err
+	}
+	this.withSkip(1).Debug("Upgraded to WebSocket")
+	socket := &WebSocket{ctx: this, conn: conn}
+	socket.stop = context.AfterFunc(this.Context, func() {
+		socket.close(websocket.CloseGoingAway, "")
+	})
+	return socket, nil
+}
+
+// webSocketOriginAllowed accepts handshakes without an Origin header, from the function's own host, or from the origins allowed by WithCORS
+func (this FunctionContext) webSocketOriginAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	parsed, err := url.Parse(origin)
+	if err == nil && strings.EqualFold(parsed.Host, r.Host) {
+		return true
+	}
+	return config.CORS != nil && config.CORS.originAllowed(origin)
+}
+
+// Read waits for the next message, returning its type (websocket.TextMessage or websocket.BinaryMessage) and data.
+// Returns an error once the connection is closed
+func (this *WebSocket) Read() (int, []byte, error) {
+	return this.read(2)
+}
+
+// ReadJson waits for the next message and decodes it as json into the given object
+func (this *WebSocket) ReadJson(obj interface{}) error {
+	_, data, err := this.read(2)
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(data, obj)
+}
+
+// read reads the next message, attributing its log message `skip` frames up the call stack
+func (this *WebSocket) read(skip int) (int, []byte, error) {
+	kind, data, err := this.conn.ReadMessage()
+	if err != nil {
+		return 0, nil, err
+	}
+	this.received.Add(1)
+	this.ctx.withSkip(skip).Debugf("Received WebSocket message (%v bytes)", len(data))
+	return kind, data, nil
+}
+
+// ReadLoop calls the handler with every message until the connection is closed by the client, the ctx's context is done, or the handler returns an error.
+// The connection is closed when it returns. A normal closure by the client returns nil
+func (this *WebSocket) ReadLoop(handler func(kind int, data []byte) error) error {
+	for {
+		kind, data, err := this.read(2)
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				err = nil
+			} else if this.ctx.Context.Err() != nil {
+				err = this.ctx.Context.Err()
+			}
+			this.finish(err)
+			return err
+		}
+		if err := handler(kind, data); err != nil {
+			this.close(websocket.CloseInternalServerErr, http.StatusText(http.StatusInternalServerError))
+			this.finish(err)
+			return err
+		}
+	}
+}
+
+// Write sends a message of the given type (websocket.TextMessage or websocket.BinaryMessage). Safe to call from several goroutines
+func (this *WebSocket) Write(kind int, data []byte) error {
+	return this.write(kind, data)
+}
+
+// WriteJson serializes the object and sends it as a text message. Safe to call from several goroutines
+func (this *WebSocket) WriteJson(obj interface{}) error {
+	data, err := codec.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return this.write(websocket.TextMessage, data)
+}
+
+func (this *WebSocket) write(kind int, data []byte) error {
+	this.writeMutex.Lock()
+	defer this.writeMutex.Unlock()
+	if deadline, ok := this.ctx.Context.Deadline(); ok {
+		_ = this.conn.SetWriteDeadline(deadline)
+	}
+	if err := this.conn.WriteMessage(kind, data); err != nil {
+		return err
+	}
+	this.sent.Add(1)
+	this.ctx.withSkip(2).Debugf("Sent WebSocket message (%v bytes)", len(data))
+	return nil
+}
+
+// Close sends a close message with the given code (e.g. websocket.CloseNormalClosure) and reason, and closes the connection
+func (this *WebSocket) Close(code int, reason string) error {
+	this.close(code, reason)
+	this.finish(nil)
+	return nil
+}
+
+// close sends the close message and closes the connection, once
+func (this *WebSocket) close(code int, reason string) {
+	this.closeOnce.Do(func() {
+		this.writeMutex.Lock()
+		_ = this.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(webSocketCloseTimeout))
+		this.writeMutex.Unlock()
+		_ = this.conn.Close()
+	})
+}
+
+// finish closes the connection and finishes the request, logging how many messages were exchanged
+func (this *WebSocket) finish(err error) {
+	this.stop()
+	this.close(websocket.CloseNormalClosure, "")
+	if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+		this.ctx.state.mutex.Lock()
+		this.ctx.state.err = err
+		this.ctx.state.mutex.Unlock()
+	}
+	this.ctx.withSkip(2).Debugf("WebSocket closed after %v messages received and %v sent", this.received.Load(), this.sent.Load())
+	this.ctx.finishResponse(err)
+}
@@ -0,0 +1,167 @@
+// Package azureadapter runs the http handlers of the toolkit as Azure Functions custom handlers with HTTP triggers.
+// Handlers keep using FuncCtx or Handle, so they send the same response envelopes and log the same fields as on Google Cloud:
+//
+//	http.ListenAndServe(":"+azureadapter.Port(), azureadapter.Handler(tk.Handle(yourHandler)))
+//
+// Functions whose host.json sets enableForwardingHttpRequest receive the original http request instead, and don't need the adapter
+package azureadapter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	toolkit "github.com/Platform48/function_toolkit"
+)
+
+// InvocationHeader is the header carrying the id of the function invocation, used as the request id of the toolkit's logs
+const InvocationHeader = "X-Azure-Functions-InvocationId"
+
+// HttpRequest is the http request of an HTTP trigger, as sent by the Functions host in the input binding
+type HttpRequest struct {
+	Url        string              `json:"Url"`
+	Method     string              `json:"Method"`
+	Query      map[string]string   `json:"Query"`
+	Headers    map[string][]string `json:"Headers"`
+	Params     map[string]string   `json:"Params"`
+	Identities []interface{}       `json:"Identities"`
+	Body       string              `json:"Body"`
+}
+
+// HttpResponse is the http response returned to the Functions host in the output binding
+type HttpResponse struct {
+	StatusCode int               `json:"statusCode"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       string            `json:"body"`
+}
+
+// InvocationRequest is the request the Functions host sends to the custom handler to invoke a function
+type InvocationRequest struct {
+	Data     map[string]json.RawMessage `json:"Data"`
+	Metadata map[string]json.RawMessage `json:"Metadata"`
+}
+
+// InvocationResponse is the response of the custom handler to the Functions host
+type InvocationResponse struct {
+	Outputs     map[string]interface{} `json:"Outputs"`
+	Logs        []string               `json:"Logs"`
+	ReturnValue interface{}            `json:"ReturnValue"`
+}
+
+// Port returns the port the custom handler must listen on, from the FUNCTIONS_CUSTOMHANDLER_PORT environment variable, or 8080 when run locally
+func Port() string {
+	if port := os.Getenv("FUNCTIONS_CUSTOMHANDLER_PORT"); port != "" {
+		return port
+	}
+	return "8080"
+}
+
+// Handler adapts the http handler into a custom handler, whose http trigger binding is named `req` and output binding `res`
+func Handler(handler http.Handler) http.Handler {
+	return HandlerWithBindings(handler, "req", "res")
+}
+
+// HandlerWithBindings adapts the http handler into a custom handler, with the names of the http trigger and output bindings of the function.json files
+func HandlerWithBindings(handler http.Handler, input string, output string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var invocation InvocationRequest
+		if err := json.NewDecoder(r.Body).Decode(&invocation); err != nil {
+			http.Error(w, "invalid invocation request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		var request HttpRequest
+		if err := json.Unmarshal(invocation.Data[input], &request); err != nil || request.Method == "" {
+			http.Error(w, "the invocation has no http request in the "+input+" binding", http.StatusBadRequest)
+			return
+		}
+		rq, err := NewRequest(r.Context(), request)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if rq.Header.Get(toolkit.RequestIdHeader) == "" && r.Header.Get(InvocationHeader) != "" {
+			rq.Header.Set(toolkit.RequestIdHeader, r.Header.Get(InvocationHeader))
+		}
+		recorder := newResponseRecorder()
+		handler.ServeHTTP(recorder, rq)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(InvocationResponse{Outputs: map[string]interface{}{output: recorder.response()}, Logs: []string{}})
+	})
+}
+
+// NewRequest converts the http request of an HTTP trigger into an http.Request
+func NewRequest(ctx context.Context, request HttpRequest) (*http.Request, error) {
+	address, err := url.Parse(request.Url)
+	if err != nil {
+		return nil, err
+	}
+	if len(request.Query) > 0 && address.RawQuery == "" {
+		query := url.Values{}
+		for name, value := range request.Query {
+			query.Set(name, value)
+		}
+		address.RawQuery = query.Encode()
+	}
+	if request.Method == "" {
+		return nil, errors.New("the http request has no method")
+	}
+	r, err := http.NewRequestWithContext(ctx, strings.ToUpper(request.Method), address.String(), strings.NewReader(request.Body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range request.Headers {
+		for _, value := range values {
+			r.Header.Add(name, value)
+		}
+	}
+	if host := r.Header.Get("Host"); host != "" {
+		r.Host = host
+	}
+	r.RemoteAddr = strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-For"), ",")[0])
+	r.RequestURI = address.RequestURI()
+	return r, nil
+}
+
+// responseRecorder buffers the response written by the handler, so it can be returned in the output binding
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{header: http.Header{}}
+}
+
+func (this *responseRecorder) Header() http.Header {
+	return this.header
+}
+
+func (this *responseRecorder) Write(buf []byte) (int, error) {
+	if this.status == 0 {
+		this.status = http.StatusOK
+	}
+	return this.body.Write(buf)
+}
+
+func (this *responseRecorder) WriteHeader(code int) {
+	if this.status == 0 {
+		this.status = code
+	}
+}
+
+func (this *responseRecorder) response() HttpResponse {
+	response := HttpResponse{StatusCode: this.status, Headers: make(map[string]string, len(this.header)), Body: this.body.String()}
+	if response.StatusCode == 0 {
+		response.StatusCode = http.StatusOK
+	}
+	for name, values := range this.header {
+		response.Headers[name] = strings.Join(values, ",")
+	}
+	return response
+}
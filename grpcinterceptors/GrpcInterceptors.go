@@ -0,0 +1,185 @@
+// Package grpcinterceptors gives every RPC of a gRPC server the same logging and tracing scope as the toolkit's http functions:
+// a FunctionContext with a span id, the request id and trace read from the metadata, an access log entry, metrics, and errors mapped to status codes.
+//
+//	server := grpc.NewServer(grpc.UnaryInterceptor(grpcinterceptors.Unary()), grpc.StreamInterceptor(grpcinterceptors.Stream()))
+package grpcinterceptors
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	toolkit "github.com/Platform48/function_toolkit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type ctxKey struct{}
+
+// FromContext returns the FunctionContext of the RPC, created by the interceptors
+func FromContext(ctx context.Context) (toolkit.FunctionContext, bool) {
+	fctx, ok := ctx.Value(ctxKey{}).(toolkit.FunctionContext)
+	return fctx, ok
+}
+
+// Unary returns an interceptor creating the FunctionContext of unary RPCs. Panics of the handler are recovered like ctx.Recover does, and the RPC fails with the Internal code
+func Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (response interface{}, err error) {
+		fctx := newCtx(ctx, info.FullMethod)
+		panicked := true
+		defer recoverPanic(&panicked, &err)
+		defer fctx.Recover()
+		response, err = handler(context.WithValue(fctx.Context, ctxKey{}, fctx), request)
+		panicked = false
+		return response, finish(fctx, err)
+	}
+}
+
+// Stream returns an interceptor creating the FunctionContext of streaming RPCs. Panics of the handler are recovered like ctx.Recover does, and the RPC fails with the Internal code
+func Stream() grpc.StreamServerInterceptor {
+	return func(server interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		fctx := newCtx(stream.Context(), info.FullMethod)
+		panicked := true
+		defer recoverPanic(&panicked, &err)
+		defer fctx.Recover()
+		err = handler(server, &scopedStream{ServerStream: stream, ctx: context.WithValue(fctx.Context, ctxKey{}, fctx)})
+		panicked = false
+		return finish(fctx, err)
+	}
+}
+
+// recoverPanic returns the Internal code if the handler panicked. The panic has been logged, reported and recorded by ctx.Recover,
+// which passes on the panics of ctx.Fatal, so they're recovered here: grpc-go doesn't recover panics, which would crash the server
+func recoverPanic(panicked *bool, err *error) {
+	_ = recover()
+	if *panicked {
+		*err = status.Error(codes.Internal, http.StatusText(http.StatusInternalServerError))
+	}
+}
+
+// scopedStream replaces the context of a stream with the one containing its FunctionContext
+type scopedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (this *scopedStream) Context() context.Context {
+	return this.ctx
+}
+
+// newCtx creates the FunctionContext of an RPC from the request's metadata, which carries the same trace and request id headers as http requests
+func newCtx(ctx context.Context, method string) toolkit.FunctionContext {
+	r, _ := http.NewRequestWithContext(ctx, http.MethodPost, method, http.NoBody)
+	md, _ := metadata.FromIncomingContext(ctx)
+	for name, values := range md {
+		for _, value := range values {
+			r.Header.Add(name, value)
+		}
+	}
+	r.Host = r.Header.Get(":authority")
+	fctx := toolkit.FuncCtx(&discardWriter{header: http.Header{}}, r)
+	_ = grpc.SetHeader(ctx, metadata.Pairs(toolkit.RequestIdHeader, fctx.RequestId))
+	return fctx
+}
+
+// finish records the outcome of the RPC through the FunctionContext, and returns the error as a gRPC status error.
+// Errors of the toolkit's error model (e.g. NotFound or mappings added with MapError) get the status code matching their http status
+func finish(ctx toolkit.FunctionContext, err error) error {
+	if err == nil {
+		ctx.OkResponse("", nil)
+		return nil
+	}
+	if grpcStatus, ok := status.FromError(err); ok && grpcStatus.Code() != codes.Unknown {
+		ctx.ErrResponse(HttpStatus(grpcStatus.Code()), err, grpcStatus.Message())
+		return err
+	}
+	httpStatus, message := toolkit.ErrorStatus(err)
+	if errors.Is(err, context.Canceled) {
+		httpStatus, message = 499, "Client closed request"
+	}
+	ctx.ErrResponse(httpStatus, err, message)
+	return status.Error(Code(httpStatus), message)
+}
+
+// Code returns the gRPC status code matching an http status code
+func Code(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusOK:
+		return codes.OK
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case 499:
+		return codes.Canceled
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	if httpStatus >= 400 && httpStatus < 500 {
+		return codes.FailedPrecondition
+	}
+	return codes.Internal
+}
+
+// HttpStatus returns the http status code matching a gRPC status code, used for the logs, access log and metrics of the RPC
+func HttpStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.FailedPrecondition:
+		return http.StatusPreconditionFailed
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// discardWriter is the response writer of RPC contexts. The response is sent by gRPC, so only the status is kept for the access log and metrics
+type discardWriter struct {
+	header http.Header
+}
+
+func (this *discardWriter) Header() http.Header {
+	return this.header
+}
+
+func (this *discardWriter) Write(buf []byte) (int, error) {
+	return len(buf), nil
+}
+
+func (this *discardWriter) WriteHeader(code int) {}
@@ -0,0 +1,257 @@
+// Package kafkaadapter runs handlers for the records of Kafka topics delivered over http, either by a Knative KafkaSource (e.g. Eventarc's Kafka triggers),
+// which sends one record per request as a binary CloudEvent, or by the Confluent HTTP Sink connector, which sends a json array of records.
+// Every record is handled with its own FunctionContext, whose logs carry the topic, partition and offset of the record:
+//
+//	var Orders = kafkaadapter.HandlerWithDeadLetter(handleOrder, kafkaadapter.PublishDeadLetter(tk.NewPublisher("orders-dead-letter")))
+//
+// Records whose handler fails with a retryable error (a 5xx status, or marked with tk.Retryable) fail the delivery with that status, so it's retried by the source.
+// Records which fail with a 4xx status can't succeed on a retry, so they're passed to the dead letter function, or dropped, and the delivery succeeds
+package kafkaadapter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	toolkit "github.com/Platform48/function_toolkit"
+)
+
+// Record is a record of a Kafka topic
+type Record struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Headers   map[string]string
+	Timestamp time.Time
+}
+
+// Bind decodes the json value of the record into the object
+func (this Record) Bind(obj interface{}) error {
+	return json.Unmarshal(this.Value, obj)
+}
+
+// HandlerFunc handles a record
+type HandlerFunc func(ctx toolkit.FunctionContext, record Record) error
+
+// DeadLetterFunc receives the records which failed with an error that can't be retried, e.g. to publish them to a dead letter topic
+type DeadLetterFunc func(ctx toolkit.FunctionContext, record Record, err error) error
+
+// Handler returns an http handler running the handler for every record of a delivery. Records which fail with an error that can't be retried are dropped
+func Handler(handler HandlerFunc) http.HandlerFunc {
+	return HandlerWithDeadLetter(handler, nil)
+}
+
+// HandlerWithDeadLetter returns an http handler running the handler for every record of a delivery, passing the records which fail with an error that can't be retried
+// to the dead letter function. If it fails, the delivery fails so the record is retried
+func HandlerWithDeadLetter(handler HandlerFunc, deadLetter DeadLetterFunc) http.HandlerFunc {
+	return toolkit.Handle(func(ctx toolkit.FunctionContext) error {
+		records, err := readRecords(ctx)
+		if err != nil {
+			ctx.FailResponse(http.StatusBadRequest, "Invalid Kafka delivery: "+err.Error())
+			return nil
+		}
+		ctx.Debugf("Received %v Kafka records", len(records))
+		for _, record := range records {
+			// Later records of the partition aren't processed before a failed one, to keep them in order when the delivery is retried
+			if err := process(ctx, record, handler, deadLetter); err != nil {
+				return fmt.Errorf("record %v of %v/%v failed: %w", record.Offset, record.Topic, record.Partition, err)
+			}
+		}
+		return nil
+	})
+}
+
+// PublishDeadLetter returns a dead letter function publishing the value of the records to Pub/Sub, with their topic, partition, offset, key and error as attributes
+func PublishDeadLetter(publisher *toolkit.Publisher) DeadLetterFunc {
+	return func(ctx toolkit.FunctionContext, record Record, err error) error {
+		_, publishErr := publisher.Publish(ctx, toolkit.PubSubMessage{Data: record.Value, Attributes: map[string]string{
+			"kafkaTopic":     record.Topic,
+			"kafkaPartition": strconv.Itoa(int(record.Partition)),
+			"kafkaOffset":    strconv.FormatInt(record.Offset, 10),
+			"kafkaKey":       string(record.Key),
+			"error":          err.Error(),
+		}})
+		return publishErr
+	}
+}
+
+// process runs the handler for the record with a FunctionContext of its own, and returns the error if the record should be retried
+func process(parent toolkit.FunctionContext, record Record, handler HandlerFunc, deadLetter DeadLetterFunc) error {
+	recorder := &statusRecorder{header: http.Header{}}
+	ctx := newCtx(parent, recorder, record)
+	err := run(ctx, record, handler)
+	if recorder.status >= 500 {
+		// The handler panicked and was recovered, or sent an error response itself
+		return fmt.Errorf("handler responded with status %v", recorder.status)
+	}
+	if recorder.status != 0 {
+		return nil
+	}
+	if err == nil {
+		ctx.OkResponse("", nil)
+		return nil
+	}
+	status, message := toolkit.ErrorStatus(err)
+	if _, retryable := toolkit.RetryAfter(err); status >= 500 || retryable {
+		ctx.ErrResponse(status, err, message)
+		return err
+	}
+	if deadLetter == nil {
+		ctx.FailResponse(status, "Dropping Kafka record which can't be processed: "+err.Error())
+		return nil
+	}
+	if dlqErr := deadLetter(ctx, record, err); dlqErr != nil {
+		ctx.ErrResponse(http.StatusInternalServerError, dlqErr, "Failed to dead-letter the record")
+		return dlqErr
+	}
+	ctx.FailResponse(status, "Dead-lettered Kafka record which can't be processed: "+err.Error())
+	return nil
+}
+
+func run(ctx toolkit.FunctionContext, record Record, handler HandlerFunc) error {
+	defer ctx.Recover()
+	return handler(ctx, record)
+}
+
+// newCtx creates the FunctionContext of a record, which shares the trace and request id of the delivery
+func newCtx(parent toolkit.FunctionContext, w http.ResponseWriter, record Record) toolkit.FunctionContext {
+	r, _ := http.NewRequestWithContext(parent.Context, http.MethodPost, parent.Request.URL.Path, http.NoBody)
+	for _, name := range []string{"traceparent", "tracestate", "X-Cloud-Trace-Context"} {
+		if value := parent.Request.Header.Get(name); value != "" {
+			r.Header.Set(name, value)
+		}
+	}
+	r.Header.Set(toolkit.RequestIdHeader, parent.RequestId)
+	ctx := toolkit.FuncCtx(w, r)
+	return ctx.WithFields(map[string]interface{}{"topic": record.Topic, "partition": record.Partition, "offset": record.Offset})
+}
+
+// statusRecorder is the response writer of a record, which only keeps the status
+type statusRecorder struct {
+	header http.Header
+	status int
+}
+
+func (this *statusRecorder) Header() http.Header {
+	return this.header
+}
+
+func (this *statusRecorder) Write(buf []byte) (int, error) {
+	if this.status == 0 {
+		this.status = http.StatusOK
+	}
+	return len(buf), nil
+}
+
+func (this *statusRecorder) WriteHeader(status int) {
+	if this.status == 0 {
+		this.status = status
+	}
+}
+
+// readRecords reads the records of a delivery, which is a binary CloudEvent sent by a KafkaSource, or a json array of records sent by the HTTP Sink connector
+func readRecords(ctx toolkit.FunctionContext) ([]Record, error) {
+	body, err := ctx.RawBody()
+	if err != nil {
+		return nil, err
+	}
+	if ctx.Request.Header.Get("Ce-Type") != "" {
+		return []Record{cloudEventRecord(ctx.Request.Header, body)}, nil
+	}
+	body = bytes.TrimSpace(body)
+	if !bytes.HasPrefix(body, []byte("[")) {
+		body = append(append([]byte("["), body...), ']')
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(body, &items); err != nil {
+		return nil, err
+	}
+	records := make([]Record, 0, len(items))
+	for _, item := range items {
+		record, err := sinkRecord(item)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// cloudEventRecord reads a record sent by a KafkaSource. The topic is the fragment of the event's source, e.g. `/apis/v1/namespaces/default/kafkasources/orders#orders`,
+// and the Kafka headers are sent as `Ce-Kafkaheader<name>` headers
+func cloudEventRecord(header http.Header, body []byte) Record {
+	record := Record{Value: body, Headers: map[string]string{}}
+	if _, topic, found := strings.Cut(header.Get("Ce-Source"), "#"); found {
+		record.Topic = topic
+	}
+	if partition, err := strconv.ParseInt(header.Get("Ce-Partition"), 10, 32); err == nil {
+		record.Partition = int32(partition)
+	}
+	record.Offset, _ = strconv.ParseInt(header.Get("Ce-Offset"), 10, 64)
+	if key := header.Get("Ce-Key"); key != "" {
+		record.Key = []byte(key)
+	}
+	record.Timestamp, _ = time.Parse(time.RFC3339Nano, header.Get("Ce-Time"))
+	for name, values := range header {
+		if strings.HasPrefix(strings.ToLower(name), "ce-kafkaheader") && len(values) > 0 {
+			record.Headers[strings.ToLower(name[len("Ce-Kafkaheader"):])] = values[0]
+		}
+	}
+	return record
+}
+
+// sinkRecord reads a record sent by the HTTP Sink connector: either an envelope with the `topic`, `partition`, `offset`, `key`, `value`, `headers` and `timestamp`
+// of the record, or the value itself, whose `topic`, `partition` and `offset` fields are read when added by the InsertField transform
+func sinkRecord(item json.RawMessage) (Record, error) {
+	var envelope struct {
+		Topic     string                     `json:"topic"`
+		Partition int32                      `json:"partition"`
+		Offset    int64                      `json:"offset"`
+		Key       json.RawMessage            `json:"key"`
+		Value     json.RawMessage            `json:"value"`
+		Headers   map[string]json.RawMessage `json:"headers"`
+		Timestamp json.RawMessage            `json:"timestamp"`
+	}
+	if err := json.Unmarshal(item, &envelope); err != nil || envelope.Value == nil {
+		// Values which aren't objects, or objects without a value field, are the value itself
+		_ = json.Unmarshal(item, &envelope)
+		return Record{Topic: envelope.Topic, Partition: envelope.Partition, Offset: envelope.Offset, Value: item}, nil
+	}
+	record := Record{Topic: envelope.Topic, Partition: envelope.Partition, Offset: envelope.Offset, Key: rawBytes(envelope.Key), Value: rawBytes(envelope.Value)}
+	if len(envelope.Headers) > 0 {
+		record.Headers = make(map[string]string, len(envelope.Headers))
+		for name, value := range envelope.Headers {
+			record.Headers[name] = string(rawBytes(value))
+		}
+	}
+	var millis int64
+	var text string
+	if json.Unmarshal(envelope.Timestamp, &millis) == nil {
+		record.Timestamp = time.UnixMilli(millis).UTC()
+	} else if json.Unmarshal(envelope.Timestamp, &text) == nil {
+		timestamp, err := time.Parse(time.RFC3339Nano, text)
+		if err != nil {
+			return Record{}, fmt.Errorf("invalid timestamp: %w", err)
+		}
+		record.Timestamp = timestamp
+	}
+	return record, nil
+}
+
+// rawBytes returns the contents of json strings, and other json values as they are. Null is returned as nil
+func rawBytes(raw json.RawMessage) []byte {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err != nil {
+		return raw
+	}
+	return []byte(text)
+}
@@ -0,0 +1,197 @@
+// Package lambdaadapter runs the http handlers of the toolkit on AWS Lambda, behind API Gateway or a Function URL.
+// Handlers keep using FuncCtx or Handle, so they send the same response envelopes and log the same fields as on Google Cloud:
+//
+//	lambda.Start(lambdaadapter.Handler(tk.Handle(yourHandler)))
+package lambdaadapter
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	toolkit "github.com/Platform48/function_toolkit"
+)
+
+// Request is the event sent by API Gateway and Function URLs. It covers both the REST API format (version 1.0) and the HTTP API and Function URL format (version 2.0)
+type Request struct {
+	Version string `json:"version"`
+	// Fields of the 1.0 format
+	HttpMethod                      string              `json:"httpMethod"`
+	Path                            string              `json:"path"`
+	MultiValueHeaders               map[string][]string `json:"multiValueHeaders"`
+	MultiValueQueryStringParameters map[string][]string `json:"multiValueQueryStringParameters"`
+	// Fields of the 2.0 format
+	RawPath        string   `json:"rawPath"`
+	RawQueryString string   `json:"rawQueryString"`
+	Cookies        []string `json:"cookies"`
+	// Fields of both formats
+	Headers         map[string]string `json:"headers"`
+	Body            string            `json:"body"`
+	IsBase64Encoded bool              `json:"isBase64Encoded"`
+	RequestContext  struct {
+		RequestId string `json:"requestId"`
+		Http      struct {
+			Method   string `json:"method"`
+			SourceIp string `json:"sourceIp"`
+		} `json:"http"`
+		Identity struct {
+			SourceIp string `json:"sourceIp"`
+		} `json:"identity"`
+	} `json:"requestContext"`
+}
+
+// Response is the response returned to API Gateway or the Function URL, in the format of the request
+type Response struct {
+	StatusCode        int                 `json:"statusCode"`
+	Headers           map[string]string   `json:"headers,omitempty"`
+	MultiValueHeaders map[string][]string `json:"multiValueHeaders,omitempty"`
+	Cookies           []string            `json:"cookies,omitempty"`
+	Body              string              `json:"body"`
+	IsBase64Encoded   bool                `json:"isBase64Encoded"`
+}
+
+// isV2 returns true if the request is in the format of HTTP APIs and Function URLs
+func (this Request) isV2() bool {
+	return this.Version == "2.0"
+}
+
+// Handler adapts the http handler into a Lambda handler, to be started with lambda.Start
+func Handler(handler http.Handler) func(ctx context.Context, request Request) (Response, error) {
+	return func(ctx context.Context, request Request) (Response, error) {
+		r, err := NewRequest(ctx, request)
+		if err != nil {
+			return Response{}, err
+		}
+		w := NewResponseWriter()
+		handler.ServeHTTP(w, r)
+		return w.Response(request.isV2()), nil
+	}
+}
+
+// NewRequest converts an API Gateway or Function URL event into an http request. The request id of the event is used as the X-Request-ID,
+// unless the request already has one, so it's the requestId of the toolkit's logs
+func NewRequest(ctx context.Context, request Request) (*http.Request, error) {
+	method, path, query, sourceIp := request.HttpMethod, request.Path, url.Values(request.MultiValueQueryStringParameters).Encode(), request.RequestContext.Identity.SourceIp
+	if request.isV2() {
+		method, path, query, sourceIp = request.RequestContext.Http.Method, request.RawPath, request.RawQueryString, request.RequestContext.Http.SourceIp
+	}
+	if method == "" {
+		return nil, errors.New("the event is not an API Gateway or Function URL request")
+	}
+	body := []byte(request.Body)
+	if request.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(request.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = decoded
+	}
+	address := path
+	if query != "" {
+		address += "?" + query
+	}
+	r, err := http.NewRequestWithContext(ctx, method, address, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range request.MultiValueHeaders {
+		for _, value := range values {
+			r.Header.Add(name, value)
+		}
+	}
+	for name, value := range request.Headers {
+		if len(r.Header.Values(name)) == 0 {
+			r.Header.Set(name, value)
+		}
+	}
+	if len(request.Cookies) > 0 {
+		r.Header.Set("Cookie", strings.Join(request.Cookies, "; "))
+	}
+	if r.Header.Get(toolkit.RequestIdHeader) == "" && request.RequestContext.RequestId != "" {
+		r.Header.Set(toolkit.RequestIdHeader, request.RequestContext.RequestId)
+	}
+	r.Host = r.Header.Get("Host")
+	r.RemoteAddr = sourceIp
+	r.ContentLength = int64(len(body))
+	r.RequestURI = address
+	return r, nil
+}
+
+// ResponseWriter buffers the response written by the handler, so it can be returned to Lambda
+type ResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+// NewResponseWriter creates an empty ResponseWriter
+func NewResponseWriter() *ResponseWriter {
+	return &ResponseWriter{header: http.Header{}}
+}
+
+func (this *ResponseWriter) Header() http.Header {
+	return this.header
+}
+
+func (this *ResponseWriter) Write(buf []byte) (int, error) {
+	if this.status == 0 {
+		this.status = http.StatusOK
+	}
+	return this.body.Write(buf)
+}
+
+func (this *ResponseWriter) WriteHeader(code int) {
+	if this.status == 0 {
+		this.status = code
+	}
+}
+
+// Response returns the buffered response, in the 2.0 format for HTTP APIs and Function URLs or in the 1.0 format for REST APIs.
+// Bodies which aren't text are base64 encoded
+func (this *ResponseWriter) Response(v2 bool) Response {
+	response := Response{StatusCode: this.status}
+	if response.StatusCode == 0 {
+		response.StatusCode = http.StatusOK
+	}
+	if isText(this.header) {
+		response.Body = this.body.String()
+	} else {
+		response.Body = base64.StdEncoding.EncodeToString(this.body.Bytes())
+		response.IsBase64Encoded = true
+	}
+	if !v2 {
+		response.MultiValueHeaders = this.header.Clone()
+		return response
+	}
+	response.Headers = make(map[string]string, len(this.header))
+	for name, values := range this.header {
+		if name == "Set-Cookie" {
+			response.Cookies = values
+			continue
+		}
+		response.Headers[name] = strings.Join(values, ",")
+	}
+	return response
+}
+
+// isText returns true if the body described by the headers is uncompressed text, which Lambda can return as is
+func isText(header http.Header) bool {
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "json") || strings.HasSuffix(mediaType, "xml") ||
+		mediaType == "application/javascript" || mediaType == "application/x-www-form-urlencoded"
+}
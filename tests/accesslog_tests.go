@@ -0,0 +1,75 @@
+package toolkits
+
+import (
+	"bytes"
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+var _ = Describe("Access log", func() {
+	var outBuffer bytes.Buffer
+	var rq *http.Request
+
+	lastEntry := func() map[string]interface{} {
+		lines := strings.Split(strings.TrimSpace(outBuffer.String()), "\n")
+		var entry map[string]interface{}
+		Expect(json.Unmarshal([]byte(lines[len(lines)-1]), &entry)).To(Succeed())
+		return entry
+	}
+	newCtx := func() toolkit.FunctionContext {
+		ctx := toolkit.FuncCtx(httptest.NewRecorder(), rq)
+		outBuffer.Reset()
+		logger := ctx.Logger.Output(&outBuffer)
+		ctx.Logger = &logger
+		return ctx
+	}
+
+	BeforeEach(func() {
+		rq = httptest.NewRequest(http.MethodPost, "/orders?debug=1", strings.NewReader(`{"item":"book"}`))
+		rq.Header.Set("User-Agent", "test-agent")
+		rq.Header.Set("X-Client", "web")
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithoutAccessLog())
+	})
+	When("access logging is enabled", func() {
+		It("should write a single entry describing the request", func() {
+			toolkit.Configure(toolkit.WithAccessLog(toolkit.AccessLogConfig{}))
+			ctx := newCtx()
+			ctx.FailResponse(http.StatusNotFound, "Not found")
+			entry := lastEntry()
+			Expect(entry["level"]).To(Equal("warn"))
+			Expect(entry["method"]).To(Equal("POST"))
+			Expect(entry["path"]).To(Equal("/orders"))
+			Expect(entry["status"]).To(Equal(404.0))
+			Expect(entry["requestSize"]).To(Equal(15.0))
+			Expect(entry["responseSize"]).To(BeNumerically(">", 0))
+			Expect(entry["userAgent"]).To(Equal("test-agent"))
+			Expect(entry).To(HaveKey("latencyMs"))
+			Expect(entry).NotTo(HaveKey("requestBody"))
+		})
+		It("should capture the configured headers and bodies", func() {
+			toolkit.Configure(toolkit.WithAccessLog(toolkit.AccessLogConfig{Headers: []string{"X-Client"}, RequestBody: true, ResponseBody: true}))
+			ctx := newCtx()
+			var body map[string]string
+			Expect(ctx.BindJson(&body)).To(BeTrue())
+			ctx.OkResponse("text/plain", []byte("created"))
+			entry := lastEntry()
+			Expect(entry["requestHeaders"]).To(Equal(map[string]interface{}{"X-Client": "web"}))
+			Expect(entry["requestBody"]).To(Equal(`{"item":"book"}`))
+			Expect(entry["responseBody"]).To(Equal("created"))
+		})
+	})
+	When("access logging is disabled", func() {
+		It("should not write an entry", func() {
+			ctx := newCtx()
+			ctx.NoContentResponse()
+			Expect(outBuffer.String()).NotTo(ContainSubstring(`"path"`))
+		})
+	})
+})
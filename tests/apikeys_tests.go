@@ -0,0 +1,157 @@
+package toolkits
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+)
+
+type failingKeyStore struct{}
+
+func (failingKeyStore) Lookup(context.Context, string) (toolkit.ApiKey, bool, error) {
+	return toolkit.ApiKey{}, false, errors.New("store unavailable")
+}
+
+var _ = Describe("RequireApiKey", func() {
+	var config toolkit.ApiKeyConfig
+	var principal toolkit.Principal
+	var apiKey toolkit.ApiKey
+
+	BeforeEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+		config = toolkit.ApiKeyConfig{Store: toolkit.StaticKeys(
+			toolkit.ApiKey{Key: "k-7f3a9", Owner: "billing", Scopes: []string{"orders:read", "orders:write"}},
+			toolkit.ApiKey{Key: "k-81bc2", Owner: "reports", Scopes: []string{"orders:read"}},
+		)}
+		principal, apiKey = toolkit.Principal{}, toolkit.ApiKey{}
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+
+	request := func(target string, key string) *httptest.ResponseRecorder {
+		handler := toolkit.Chain(toolkit.RequireApiKey(config)).Then(func(ctx toolkit.FunctionContext) error {
+			principal, _ = ctx.Principal()
+			apiKey, _ = ctx.ApiKey()
+			return nil
+		})
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		if key != "" {
+			r.Header.Set("X-API-Key", key)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, r)
+		return rr
+	}
+
+	When("the key is valid", func() {
+		It("should run the handler with the key's owner as the principal", func() {
+			Expect(request("/", "k-81bc2").Code).To(Equal(http.StatusOK))
+			Expect(principal.Id).To(Equal("reports"))
+			Expect(principal.ClaimStrings("scope")).To(Equal([]string{"orders:read"}))
+			Expect(apiKey.Owner).To(Equal("reports"))
+			Expect(apiKey.Id).To(HaveLen(12))
+		})
+		It("should read the key from the query parameter if configured", func() {
+			config.QueryParameter = "key"
+			Expect(request("/?key=k-7f3a9", "").Code).To(Equal(http.StatusOK))
+			Expect(principal.Id).To(Equal("billing"))
+		})
+	})
+	When("the key is missing or unknown", func() {
+		It("should respond with a 401 status and the span id", func() {
+			rr := request("/", "")
+			Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+			Expect(rr.Body.String()).To(ContainSubstring(`"spanId"`))
+			Expect(request("/", "k-unknown").Code).To(Equal(http.StatusUnauthorized))
+			Expect(request("/?key=k-7f3a9", "").Code).To(Equal(http.StatusUnauthorized))
+		})
+	})
+	When("the key lacks a scope", func() {
+		It("should respond with a 403 status", func() {
+			config.Scopes = []string{"orders:write"}
+			Expect(request("/", "k-81bc2").Code).To(Equal(http.StatusForbidden))
+			Expect(request("/", "k-7f3a9").Code).To(Equal(http.StatusOK))
+		})
+	})
+	When("the store fails", func() {
+		It("should respond with a 503 status", func() {
+			config.Store = failingKeyStore{}
+			Expect(request("/", "k-7f3a9").Code).To(Equal(http.StatusServiceUnavailable))
+		})
+	})
+	When("the keys are read from the environment", func() {
+		It("should parse the owners and scopes", func() {
+			os.Setenv("TEST_API_KEYS", "billing:k-7f3a9:orders:read orders:write, k-anonymous")
+			defer os.Unsetenv("TEST_API_KEYS")
+			store := toolkit.EnvKeys("TEST_API_KEYS")
+			key, found, err := store.Lookup(context.Background(), "k-7f3a9")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(key.Owner).To(Equal("billing"))
+			Expect(key.Scopes).To(Equal([]string{"orders:read", "orders:write"}))
+			_, found, _ = store.Lookup(context.Background(), "k-anonymous")
+			Expect(found).To(BeTrue())
+			_, found, _ = store.Lookup(context.Background(), "k-7f3a")
+			Expect(found).To(BeFalse())
+		})
+	})
+	When("the keys are stored in Google Cloud", func() {
+		var server *httptest.Server
+		var requests int
+
+		BeforeEach(func() {
+			requests = 0
+			hash := sha256.Sum256([]byte("k-7f3a9"))
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case strings.HasSuffix(r.URL.Path, "/token"):
+					_, _ = w.Write([]byte(`{"access_token":"test-token","expires_in":3600}`))
+				case r.URL.Path == "/v1/projects/test-project/secrets/api-keys/versions/latest:access":
+					requests++
+					payload := base64.StdEncoding.EncodeToString([]byte(`[{"key":"k-7f3a9","owner":"billing","scopes":["orders:read"]}]`))
+					_, _ = w.Write([]byte(`{"payload":{"data":"` + payload + `"}}`))
+				case r.URL.Path == "/v1/projects/test-project/databases/(default)/documents/apiKeys/"+hex.EncodeToString(hash[:]):
+					_, _ = w.Write([]byte(`{"name":"x","fields":{"owner":{"stringValue":"billing"},"scopes":{"arrayValue":{"values":[{"stringValue":"orders:read"}]}},"labels":{"mapValue":{"fields":{"team":{"stringValue":"payments"}}}}}}`))
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			os.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(server.URL, "http://"))
+			os.Setenv("GOOGLE_CLOUD_PROJECT", "test-project")
+		})
+		AfterEach(func() {
+			os.Unsetenv("GCE_METADATA_HOST")
+			server.Close()
+		})
+		It("should read and cache the keys of a Secret Manager secret", func() {
+			store := toolkit.NewSecretManagerKeyStore("api-keys")
+			store.Endpoint = server.URL
+			config.Store = store
+			Expect(request("/", "k-7f3a9").Code).To(Equal(http.StatusOK))
+			Expect(principal.Id).To(Equal("billing"))
+			Expect(request("/", "k-81bc2").Code).To(Equal(http.StatusUnauthorized))
+			Expect(requests).To(Equal(1))
+		})
+		It("should look up the hash of the key in Firestore", func() {
+			store := toolkit.NewFirestoreKeyStore("apiKeys")
+			store.Endpoint = server.URL
+			config.Store = store
+			Expect(request("/", "k-7f3a9").Code).To(Equal(http.StatusOK))
+			Expect(apiKey.Owner).To(Equal("billing"))
+			Expect(apiKey.Scopes).To(Equal([]string{"orders:read"}))
+			Expect(apiKey.Labels).To(Equal(map[string]string{"team": "payments"}))
+			Expect(request("/", "k-81bc2").Code).To(Equal(http.StatusUnauthorized))
+		})
+	})
+})
@@ -0,0 +1,115 @@
+package toolkits
+
+import (
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"time"
+)
+
+var _ = Describe("RequireAppCheck", func() {
+	var keys *httptest.Server
+	var appCheckApi *httptest.Server
+	var consumed map[string]bool
+	var config toolkit.AppCheckConfig
+	var claims map[string]interface{}
+	var verified toolkit.AppCheckToken
+
+	BeforeEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+		keys = keysServer()
+		consumed = map[string]bool{}
+		appCheckApi = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, "/token") {
+				_, _ = w.Write([]byte(`{"access_token":"test-token","expires_in":3600}`))
+				return
+			}
+			Expect(r.URL.Path).To(Equal("/v1beta/projects/test-project:verifyAppCheckToken"))
+			var request struct {
+				AppCheckToken string `json:"appCheckToken"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&request)
+			_ = json.NewEncoder(w).Encode(map[string]bool{"alreadyConsumed": consumed[request.AppCheckToken]})
+			consumed[request.AppCheckToken] = true
+		}))
+		os.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(appCheckApi.URL, "http://"))
+		os.Setenv("GOOGLE_CLOUD_PROJECT", "test-project")
+		config = toolkit.AppCheckConfig{KeysUrl: keys.URL, Endpoint: appCheckApi.URL}
+		now := time.Now()
+		claims = map[string]interface{}{
+			"iss": "https://firebaseappcheck.googleapis.com/1234567890",
+			"aud": []string{"projects/1234567890", "projects/test-project"},
+			"sub": "1:1234567890:web:0a1b2c3d",
+			"iat": now.Unix(),
+			"exp": now.Add(time.Hour).Unix(),
+		}
+		verified = toolkit.AppCheckToken{}
+	})
+	AfterEach(func() {
+		os.Unsetenv("GCE_METADATA_HOST")
+		keys.Close()
+		appCheckApi.Close()
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+
+	request := func(token string) (int, toolkit.ErrorResponseStruct) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if token != "" {
+			r.Header.Set("X-Firebase-AppCheck", token)
+		}
+		rr := httptest.NewRecorder()
+		toolkit.Chain(toolkit.RequireAppCheck(config)).Then(func(ctx toolkit.FunctionContext) error {
+			verified, _ = ctx.AppCheck()
+			return nil
+		})(rr, r)
+		var body toolkit.ErrorResponseStruct
+		_ = json.Unmarshal(rr.Body.Bytes(), &body)
+		return rr.Code, body
+	}
+
+	It("should let requests with a valid token through", func() {
+		status, _ := request(signToken(claims))
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(verified.AppId).To(Equal("1:1234567890:web:0a1b2c3d"))
+		Expect(verified.Expiry).To(BeTemporally("~", time.Now().Add(time.Hour), 2*time.Second))
+	})
+	It("should reject requests without a token", func() {
+		status, body := request("")
+		Expect(status).To(Equal(http.StatusUnauthorized))
+		Expect(body.Details[0].Code).To(Equal("appcheck.missing"))
+	})
+	DescribeTable("should reject invalid tokens",
+		func(claim string, value interface{}) {
+			claims[claim] = value
+			status, body := request(signToken(claims))
+			Expect(status).To(Equal(http.StatusUnauthorized))
+			Expect(body.Details[0].Code).To(Equal("appcheck.invalid"))
+			Expect(verified.AppId).To(BeEmpty())
+		},
+		Entry("which have expired", "exp", time.Now().Add(-time.Hour).Unix()),
+		Entry("of another project", "aud", []string{"projects/999", "projects/other-project"}),
+		Entry("of another issuer", "iss", "https://securetoken.google.com/test-project"),
+		Entry("without a subject", "sub", ""),
+	)
+	It("should reject the tokens of apps which aren't allowed", func() {
+		config.AppIds = []string{"1:1234567890:ios:ffff"}
+		status, body := request(signToken(claims))
+		Expect(status).To(Equal(http.StatusForbidden))
+		Expect(body.Details[0].Code).To(Equal("appcheck.app_not_allowed"))
+	})
+	It("should reject tokens which were already consumed", func() {
+		config.Consume = true
+		token := signToken(claims)
+		status, _ := request(token)
+		Expect(status).To(Equal(http.StatusOK))
+		status, body := request(token)
+		Expect(status).To(Equal(http.StatusUnauthorized))
+		Expect(body.Details[0].Code).To(Equal("appcheck.invalid"))
+	})
+})
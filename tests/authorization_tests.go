@@ -0,0 +1,81 @@
+package toolkits
+
+import (
+	"bytes"
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("Authorization", func() {
+	var logs bytes.Buffer
+	var claims map[string]interface{}
+	var authenticated bool
+
+	BeforeEach(func() {
+		logs.Reset()
+		toolkit.Configure(toolkit.WithLogWriter(&logs))
+		claims = map[string]interface{}{"scope": "orders:read orders:write", "roles": []interface{}{"support"}}
+		authenticated = true
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+
+	request := func(middleware toolkit.Middleware) *httptest.ResponseRecorder {
+		authenticate := func(next toolkit.HandlerFunc) toolkit.HandlerFunc {
+			return func(ctx toolkit.FunctionContext) error {
+				if authenticated {
+					ctx = ctx.WithPrincipal("user-7", claims)
+				}
+				return next(ctx)
+			}
+		}
+		rr := httptest.NewRecorder()
+		toolkit.Chain(authenticate, middleware).Then(func(ctx toolkit.FunctionContext) error {
+			return nil
+		})(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr
+	}
+
+	When("scopes are required", func() {
+		It("should accept principals with every scope", func() {
+			Expect(request(toolkit.RequireScopes("orders:read", "orders:write")).Code).To(Equal(http.StatusOK))
+		})
+		It("should read the scopes of other claims", func() {
+			claims = map[string]interface{}{"permissions": []interface{}{"orders:write"}}
+			Expect(request(toolkit.RequireScopes("orders:write")).Code).To(Equal(http.StatusOK))
+		})
+		It("should list the missing scopes in a 403 response and log the denial", func() {
+			rr := request(toolkit.RequireScopes("orders:read", "orders:delete"))
+			Expect(rr.Code).To(Equal(http.StatusForbidden))
+			var body map[string]interface{}
+			Expect(json.Unmarshal(rr.Body.Bytes(), &body)).To(Succeed())
+			Expect(body["details"]).To(Equal([]interface{}{map[string]interface{}{"field": "scope", "code": "missing_scope", "message": "orders:delete"}}))
+			Expect(logs.String()).To(ContainSubstring(`"actor":"user-7"`))
+			Expect(logs.String()).To(ContainSubstring(`"requiredScopes":["orders:read","orders:delete"]`))
+		})
+		It("should respond with a 401 status without a principal", func() {
+			authenticated = false
+			Expect(request(toolkit.RequireScopes("orders:read")).Code).To(Equal(http.StatusUnauthorized))
+		})
+	})
+	When("a role is required", func() {
+		It("should accept principals with one of the roles", func() {
+			Expect(request(toolkit.RequireRole("admin", "support")).Code).To(Equal(http.StatusOK))
+		})
+		It("should respond with a 403 status to other principals", func() {
+			rr := request(toolkit.RequireRole("admin"))
+			Expect(rr.Code).To(Equal(http.StatusForbidden))
+			Expect(rr.Body.String()).To(ContainSubstring("missing_role"))
+			Expect(logs.String()).To(ContainSubstring(`"requiredRoles":["admin"]`))
+		})
+		It("should respond with a 401 status without a principal", func() {
+			authenticated = false
+			Expect(request(toolkit.RequireRole("admin")).Code).To(Equal(http.StatusUnauthorized))
+		})
+	})
+})
@@ -0,0 +1,71 @@
+package toolkits
+
+import (
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	"github.com/Platform48/function_toolkit/azureadapter"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+var _ = Describe("Azure adapter", func() {
+	var handler http.Handler
+	var received *http.Request
+	var body []byte
+
+	BeforeEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+		handler = azureadapter.Handler(toolkit.Handle(func(ctx toolkit.FunctionContext) error {
+			received = ctx.Request
+			body, _ = io.ReadAll(ctx.Request.Body)
+			ctx.CreatedResponse("/orders/o-1", toolkit.Json{"requestId": ctx.RequestId})
+			return nil
+		}))
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+	When("an http trigger is invoked", func() {
+		It("should convert the request and return the response in the output binding", func() {
+			r := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{
+				"Data": {"req": {
+					"Url": "https://orders.azurewebsites.net/api/orders?dryRun=true",
+					"Method": "POST",
+					"Query": {"dryRun": "true"},
+					"Headers": {"Content-Type": ["application/json"], "X-Forwarded-For": ["203.0.113.7:51234"]},
+					"Body": "{\"total\":1250}"
+				}},
+				"Metadata": {}
+			}`))
+			r.Header.Set(azureadapter.InvocationHeader, "a1b2c3d4-invocation")
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, r)
+
+			Expect(received.Method).To(Equal(http.MethodPost))
+			Expect(received.URL.Path).To(Equal("/api/orders"))
+			Expect(received.URL.Query().Get("dryRun")).To(Equal("true"))
+			Expect(body).To(MatchJSON(`{"total":1250}`))
+
+			var response struct {
+				Outputs struct {
+					Res azureadapter.HttpResponse `json:"res"`
+				}
+			}
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(Succeed())
+			Expect(response.Outputs.Res.StatusCode).To(Equal(http.StatusCreated))
+			Expect(response.Outputs.Res.Headers).To(HaveKeyWithValue("Location", "/orders/o-1"))
+			Expect(response.Outputs.Res.Body).To(ContainSubstring(`"requestId":"a1b2c3d4-invocation"`))
+		})
+	})
+	When("the invocation has no http request", func() {
+		It("should be rejected", func() {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"Data": {"queueItem": "hello"}}`)))
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+})
@@ -0,0 +1,83 @@
+package toolkits
+
+import (
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+var _ = Describe("Batch", func() {
+	var rr *httptest.ResponseRecorder
+	var batch *toolkit.Batch
+
+	process := func(body string) []toolkit.BatchResponseEntry {
+		ctx := toolkit.FuncCtx(rr, httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body)))
+		ctx.ProcessBatch(batch)
+		var entries []toolkit.BatchResponseEntry
+		Expect(json.Unmarshal(rr.Body.Bytes(), &entries)).To(Succeed())
+		return entries
+	}
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		batch = toolkit.NewBatch().
+			Handle(http.MethodGet, "/orders", func(ctx toolkit.FunctionContext) {
+				ctx.OkResponseJson(toolkit.Json{"id": ctx.Request.URL.Query().Get("id")})
+			}).
+			Handle(http.MethodPost, "/orders", func(ctx toolkit.FunctionContext) {
+				ctx.FailResponse(http.StatusConflict, "already exists")
+			})
+	})
+	When("a batch is sent", func() {
+		It("should run every sub-request and return a multi-status response", func() {
+			entries := process(`[{"id":"a","method":"GET","path":"/orders?id=1"},{"id":"b","method":"POST","path":"/orders","body":{}}]`)
+			Expect(rr.Code).To(Equal(http.StatusMultiStatus))
+			Expect(entries).To(HaveLen(2))
+			Expect(entries[0].Id).To(Equal("a"))
+			Expect(entries[0].Status).To(Equal(http.StatusOK))
+			Expect(string(entries[0].Body)).To(ContainSubstring(`"id":"1"`))
+			Expect(entries[1].Status).To(Equal(http.StatusConflict))
+			Expect(entries[0].SpanId).ToNot(Equal(entries[1].SpanId))
+		})
+	})
+	When("a sub-request has no handler", func() {
+		It("should return a 404 entry", func() {
+			entries := process(`[{"id":"a","method":"DELETE","path":"/orders"}]`)
+			Expect(entries[0].Status).To(Equal(http.StatusNotFound))
+		})
+	})
+	When("a sub-request handler panics", func() {
+		It("should return a 500 entry and run the other sub-requests", func() {
+			toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+			defer toolkit.Configure(toolkit.WithLogWriter())
+			batch.Handle(http.MethodGet, "/panic", func(ctx toolkit.FunctionContext) {
+				panic("nil map")
+			}).Handle(http.MethodGet, "/partial", func(ctx toolkit.FunctionContext) {
+				ctx.OkResponseJson(toolkit.Json{"id": 1})
+				panic("after the response")
+			}).Handle(http.MethodGet, "/fatal", func(ctx toolkit.FunctionContext) {
+				ctx.Fatal("database unreachable")
+			})
+			entries := process(`[{"id":"a","method":"GET","path":"/panic"},{"id":"b","method":"GET","path":"/orders?id=1"},` +
+				`{"id":"c","method":"GET","path":"/partial"},{"id":"d","method":"GET","path":"/fatal"}]`)
+			Expect(rr.Code).To(Equal(http.StatusMultiStatus))
+			Expect(entries[0].Status).To(Equal(http.StatusInternalServerError))
+			Expect(entries[1].Status).To(Equal(http.StatusOK))
+			Expect(entries[2].Status).To(Equal(http.StatusInternalServerError))
+			Expect(entries[2].Body).To(BeEmpty())
+			Expect(entries[3].Status).To(Equal(http.StatusInternalServerError))
+		})
+	})
+	When("the body isn't an array", func() {
+		It("should send a 400 response", func() {
+			ctx := toolkit.FuncCtx(rr, httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(`{}`)))
+			ctx.ProcessBatch(batch)
+			Expect(rr.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+})
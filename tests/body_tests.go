@@ -0,0 +1,48 @@
+package toolkits
+
+import (
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+var _ = Describe("Body", func() {
+	var rr *httptest.ResponseRecorder
+	var ctx toolkit.FunctionContext
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+	})
+	When("the body is read more than once", func() {
+		BeforeEach(func() {
+			ctx = toolkit.FuncCtx(rr, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"foo"}`)))
+		})
+		It("should return the same bytes every time", func() {
+			first, err := ctx.RawBody()
+			Expect(err).ToNot(HaveOccurred())
+			second, err := ctx.WithCtx(ctx.Context).RawBody()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(second).To(Equal(first))
+			replayed, _ := io.ReadAll(ctx.Request.Body)
+			Expect(string(replayed)).To(Equal(`{"name":"foo"}`))
+		})
+		It("should still bind it to a struct", func() {
+			_, _ = ctx.RawBody()
+			var payload struct{ Name string }
+			Expect(ctx.BindJson(&payload)).To(BeTrue())
+			Expect(payload.Name).To(Equal("foo"))
+		})
+	})
+	When("the body isn't valid json", func() {
+		It("should send a 400 response", func() {
+			ctx = toolkit.FuncCtx(rr, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{`)))
+			var payload struct{ Name string }
+			Expect(ctx.BindJson(&payload)).To(BeFalse())
+			Expect(rr.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+})
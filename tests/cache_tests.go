@@ -0,0 +1,42 @@
+package toolkits
+
+import (
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+var _ = Describe("Cache headers", func() {
+	var rr *httptest.ResponseRecorder
+	var ctx toolkit.FunctionContext
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		ctx = toolkit.FuncCtx(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+	When("WithCacheControl is called", func() {
+		It("should set Cache-Control and Expires", func() {
+			ctx.WithCacheControl(5*time.Minute, true).OkResponseJson(nil)
+			Expect(rr.Header().Get("Cache-Control")).To(Equal("public, max-age=300"))
+			expires, err := http.ParseTime(rr.Header().Get("Expires"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(expires).To(BeTemporally("~", time.Now().Add(5*time.Minute), 2*time.Second))
+		})
+	})
+	When("WithNoStore is called after WithCacheControl", func() {
+		It("should replace the caching headers", func() {
+			ctx.WithCacheControl(time.Hour, false).WithNoStore().OkResponseJson(nil)
+			Expect(rr.Header().Get("Cache-Control")).To(Equal("no-store"))
+			Expect(rr.Header().Get("Expires")).To(BeEmpty())
+		})
+	})
+	When("WithVary is called more than once", func() {
+		It("should not duplicate header names", func() {
+			ctx.WithVary("Accept-Language", "Authorization").WithVary("authorization", "Origin")
+			Expect(rr.Header().Get("Vary")).To(Equal("Accept-Language, Authorization, Origin"))
+		})
+	})
+})
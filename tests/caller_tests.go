@@ -0,0 +1,51 @@
+package toolkits
+
+import (
+	"bytes"
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+)
+
+// logThroughHelper is a logging helper like the ones functions wrap around the ctx
+func logThroughHelper(ctx toolkit.FunctionContext, message string) {
+	ctx.WithCallerSkip(1).Info("helper: " + message)
+}
+
+var _ = Describe("Caller", func() {
+	var ctx toolkit.FunctionContext
+	var outBuffer bytes.Buffer
+
+	entry := func() map[string]interface{} {
+		var entry map[string]interface{}
+		Expect(json.Unmarshal(outBuffer.Bytes(), &entry)).To(Succeed())
+		return entry
+	}
+
+	BeforeEach(func() {
+		ctx = toolkit.FuncCtx(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		outBuffer.Reset()
+		logger := ctx.Logger.Output(&outBuffer)
+		ctx.Logger = &logger
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithCaller(true))
+	})
+	When("a message is logged through a helper with a caller skip", func() {
+		It("should be attributed to the code calling the helper", func() {
+			logThroughHelper(ctx, "Hello")
+			Expect(entry()["caller"]).To(MatchRegexp(`caller_tests.go:\d+$`))
+			Expect(entry()["caller"]).NotTo(HaveSuffix("caller_tests.go:15"))
+		})
+	})
+	When("the caller is disabled", func() {
+		It("should not add the caller field", func() {
+			toolkit.Configure(toolkit.WithCaller(false))
+			ctx.Info("Hello")
+			Expect(entry()).NotTo(HaveKey("caller"))
+		})
+	})
+})
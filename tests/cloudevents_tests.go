@@ -0,0 +1,93 @@
+package toolkits
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	toolkit "github.com/Platform48/function_toolkit"
+	"github.com/cloudevents/sdk-go/v2/event"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+)
+
+type orderCreated struct {
+	OrderId string `json:"orderId"`
+	Total   int    `json:"total"`
+}
+
+var _ = Describe("EventCtx", func() {
+	var e event.Event
+	var outBuffer bytes.Buffer
+
+	BeforeEach(func() {
+		e = event.New()
+		e.SetID("8403741263891245")
+		e.SetType("com.example.order.created")
+		e.SetSource("//orders/eu")
+		Expect(e.SetData(event.ApplicationJSON, orderCreated{OrderId: "o-1", Total: 1250})).To(Succeed())
+		outBuffer.Reset()
+		toolkit.Configure(toolkit.WithLogWriter(&outBuffer))
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+	When("a ctx is created for an event", func() {
+		It("should use the event's id as the span id and log the event's metadata", func() {
+			ctx := toolkit.EventCtx(context.Background(), e)
+			Expect(ctx.SpanId).To(Equal("8403741263891245"))
+			ctx.Info("Processing")
+			var entry map[string]interface{}
+			Expect(json.NewDecoder(&outBuffer).Decode(&entry)).To(Succeed())
+			Expect(entry["eventType"]).To(Equal("com.example.order.created"))
+			Expect(entry["eventSource"]).To(Equal("//orders/eu"))
+		})
+		It("should continue the trace of the event", func() {
+			e.SetExtension("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+			Expect(toolkit.EventCtx(context.Background(), e).TraceId).To(Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+		})
+		It("should bind the event's data", func() {
+			ctx := toolkit.EventCtx(context.Background(), e)
+			var data orderCreated
+			Expect(ctx.BindEvent(&data)).To(Succeed())
+			Expect(data).To(Equal(orderCreated{OrderId: "o-1", Total: 1250}))
+			received, ok := ctx.Event()
+			Expect(ok).To(BeTrue())
+			Expect(received.ID()).To(Equal(e.ID()))
+		})
+	})
+	When("the event is finished", func() {
+		var ctx toolkit.FunctionContext
+		var status int
+
+		BeforeEach(func() {
+			ctx = toolkit.EventCtx(context.Background(), e)
+			ctx.OnResponse(func(code int, bytes int, err error) {
+				status = code
+			})
+		})
+		It("should succeed when it's acknowledged", func() {
+			Expect(ctx.Ack()).To(Succeed())
+			Expect(status).To(Equal(http.StatusOK))
+		})
+		It("should return the error when it's not acknowledged, so it's retried", func() {
+			Expect(ctx.Nack(errors.New("database unavailable"))).To(MatchError("database unavailable"))
+			Expect(status).To(Equal(http.StatusInternalServerError))
+		})
+		It("should succeed when it's dropped, so it's not retried", func() {
+			Expect(ctx.Drop(errors.New("unknown order type"))).To(Succeed())
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(outBuffer.String()).To(ContainSubstring("unknown order type"))
+		})
+	})
+	When("the ctx was created for an http request", func() {
+		It("should have no event", func() {
+			ctx := toolkit.FuncCtx(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+			_, ok := ctx.Event()
+			Expect(ok).To(BeFalse())
+			Expect(ctx.BindEvent(&orderCreated{})).NotTo(Succeed())
+		})
+	})
+})
@@ -0,0 +1,62 @@
+package toolkits
+
+import (
+	"context"
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+)
+
+var _ = Describe("CloudMonitoringExporter", func() {
+	var server *httptest.Server
+	var authorization string
+	var body map[string]interface{}
+
+	BeforeEach(func() {
+		toolkit.ResetMetrics()
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, "/token") {
+				_, _ = w.Write([]byte(`{"access_token":"test-token","expires_in":3600}`))
+				return
+			}
+			authorization = r.Header.Get("Authorization")
+			body = nil
+			_ = json.NewDecoder(r.Body).Decode(&body)
+		}))
+		os.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(server.URL, "http://"))
+		os.Setenv("GOOGLE_CLOUD_PROJECT", "test-project")
+	})
+	AfterEach(func() {
+		os.Unsetenv("GCE_METADATA_HOST")
+		server.Close()
+	})
+	When("the metrics are exported", func() {
+		It("should write them as custom metric time series", func() {
+			toolkit.Counter("orders_created").With(toolkit.Labels{"plan": "pro"}).Add(2)
+			toolkit.Histogram("db_latency_ms", 10).Observe(4)
+			exporter := toolkit.NewCloudMonitoringExporter()
+			exporter.Endpoint = server.URL
+
+			Expect(exporter.ExportMetrics(context.Background(), toolkit.CollectMetrics())).To(Succeed())
+			Expect(authorization).To(Equal("Bearer test-token"))
+			series := body["timeSeries"].([]interface{})
+			Expect(series).To(HaveLen(2))
+
+			histogram := series[0].(map[string]interface{})
+			Expect(histogram["metric"]).To(HaveKeyWithValue("type", "custom.googleapis.com/db_latency_ms"))
+			Expect(histogram["valueType"]).To(Equal("DISTRIBUTION"))
+
+			counter := series[1].(map[string]interface{})
+			Expect(counter["metric"]).To(HaveKeyWithValue("labels", HaveKeyWithValue("plan", "pro")))
+			Expect(counter["metricKind"]).To(Equal("CUMULATIVE"))
+			Expect(counter["resource"]).To(HaveKeyWithValue("labels", HaveKeyWithValue("project_id", "test-project")))
+			point := counter["points"].([]interface{})[0].(map[string]interface{})
+			Expect(point["value"]).To(HaveKeyWithValue("doubleValue", 2.0))
+		})
+	})
+})
@@ -0,0 +1,115 @@
+package toolkits
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"time"
+)
+
+func taskRequest(queue string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("X-CloudTasks-QueueName", queue)
+	r.Header.Set("X-CloudTasks-TaskName", "7810962634195")
+	r.Header.Set("X-CloudTasks-TaskRetryCount", "2")
+	r.Header.Set("X-CloudTasks-TaskExecutionCount", "1")
+	r.Header.Set("X-CloudTasks-TaskETA", "1714557600.5")
+	r.Header.Set("X-CloudTasks-TaskPreviousResponse", "503")
+	r.Header.Set("X-CloudTasks-TaskRetryReason", "Service Unavailable")
+	return r
+}
+
+var _ = Describe("Cloud Tasks", func() {
+	When("a task is enqueued", func() {
+		var server *httptest.Server
+		var path string
+		var body map[string]interface{}
+
+		BeforeEach(func() {
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasSuffix(r.URL.Path, "/token") {
+					_, _ = w.Write([]byte(`{"access_token":"test-token","expires_in":3600}`))
+					return
+				}
+				path = r.URL.Path
+				body = nil
+				_ = json.NewDecoder(r.Body).Decode(&body)
+				_, _ = w.Write([]byte(`{"name":"projects/test-project/locations/europe-west1/queues/emails/tasks/welcome-7"}`))
+			}))
+			os.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(server.URL, "http://"))
+			os.Setenv("GOOGLE_CLOUD_PROJECT", "test-project")
+			toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+		})
+		AfterEach(func() {
+			os.Unsetenv("GCE_METADATA_HOST")
+			server.Close()
+			toolkit.Configure(toolkit.WithLogWriter())
+		})
+		It("should send the json payload with an OIDC token and the trace headers", func() {
+			queue := toolkit.NewTaskQueue("europe-west1", "emails")
+			queue.Endpoint = server.URL
+			queue.ServiceAccount = "tasks@test-project.iam.gserviceaccount.com"
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+			ctx := toolkit.FuncCtx(httptest.NewRecorder(), r)
+			at := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+			name, err := queue.Enqueue(ctx, toolkit.Task{Url: "https://emails.example.com/send", Payload: toolkit.Json{"to": "a@example.com"}, Name: "welcome-7", ScheduleTime: at})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(name).To(Equal("projects/test-project/locations/europe-west1/queues/emails/tasks/welcome-7"))
+			Expect(path).To(Equal("/v2/projects/test-project/locations/europe-west1/queues/emails/tasks"))
+
+			task := body["task"].(map[string]interface{})
+			Expect(task["name"]).To(Equal("projects/test-project/locations/europe-west1/queues/emails/tasks/welcome-7"))
+			Expect(task["scheduleTime"]).To(Equal("2024-05-01T10:00:00Z"))
+			request := task["httpRequest"].(map[string]interface{})
+			Expect(request["url"]).To(Equal("https://emails.example.com/send"))
+			payload, _ := base64.StdEncoding.DecodeString(request["body"].(string))
+			Expect(payload).To(MatchJSON(`{"to":"a@example.com"}`))
+			Expect(request["headers"]).To(HaveKeyWithValue("Traceparent", HavePrefix("00-4bf92f3577b34da6a3ce929d0e0e4736-")))
+			Expect(request["oidcToken"]).To(Equal(map[string]interface{}{"serviceAccountEmail": "tasks@test-project.iam.gserviceaccount.com", "audience": "https://emails.example.com/send"}))
+		})
+	})
+	When("a request is sent by Cloud Tasks", func() {
+		It("should expose the task's headers", func() {
+			ctx := toolkit.FuncCtx(httptest.NewRecorder(), taskRequest("emails"))
+			info, ok := ctx.TaskInfo()
+			Expect(ok).To(BeTrue())
+			Expect(info).To(Equal(toolkit.TaskInfo{
+				Queue:            "emails",
+				Name:             "7810962634195",
+				RetryCount:       2,
+				ExecutionCount:   1,
+				ETA:              time.Unix(1714557600, 500000000),
+				PreviousResponse: 503,
+				RetryReason:      "Service Unavailable",
+			}))
+		})
+		It("should only be accepted from the required queues", func() {
+			handler := toolkit.Chain(toolkit.RequireTask("emails")).Then(func(ctx toolkit.FunctionContext) error { return nil })
+			recorder := httptest.NewRecorder()
+			handler(recorder, taskRequest("emails"))
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			recorder = httptest.NewRecorder()
+			handler(recorder, taskRequest("invoices"))
+			Expect(recorder.Code).To(Equal(http.StatusForbidden))
+		})
+	})
+	When("a request isn't sent by Cloud Tasks", func() {
+		It("should have no task and be rejected by RequireTask", func() {
+			ctx := toolkit.FuncCtx(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+			_, ok := ctx.TaskInfo()
+			Expect(ok).To(BeFalse())
+			recorder := httptest.NewRecorder()
+			toolkit.Chain(toolkit.RequireTask()).Then(func(ctx toolkit.FunctionContext) error { return nil })(recorder, httptest.NewRequest(http.MethodPost, "/", nil))
+			Expect(recorder.Code).To(Equal(http.StatusForbidden))
+		})
+	})
+})
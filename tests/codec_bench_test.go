@@ -0,0 +1,79 @@
+package toolkits_test
+
+import (
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type benchCodec struct {
+	marshals   int
+	unmarshals int
+}
+
+func (this *benchCodec) Marshal(v any) ([]byte, error) {
+	this.marshals++
+	return json.Marshal(v)
+}
+
+func (this *benchCodec) Unmarshal(data []byte, v any) error {
+	this.unmarshals++
+	return json.Unmarshal(data, v)
+}
+
+var benchPayload = toolkit.Json{"id": "1", "items": []int{1, 2, 3, 4, 5}, "name": "benchmark"}
+
+func benchmarkOkResponseJson(b *testing.B) {
+	rq := httptest.NewRequest(http.MethodGet, "/", nil)
+	for i := 0; i < b.N; i++ {
+		rr := httptest.NewRecorder()
+		toolkit.FuncCtx(rr, rq).OkResponseJson(benchPayload)
+	}
+}
+
+func BenchmarkOkResponseJsonStdCodec(b *testing.B) {
+	toolkit.SetJSONCodec(toolkit.StdCodec{})
+	benchmarkOkResponseJson(b)
+}
+
+func BenchmarkOkResponseJsonInjectedCodec(b *testing.B) {
+	codec := &benchCodec{}
+	toolkit.SetJSONCodec(codec)
+	defer toolkit.SetJSONCodec(toolkit.StdCodec{})
+	benchmarkOkResponseJson(b)
+	if codec.marshals < b.N {
+		b.Fatalf("injected codec was used %v times for %v responses", codec.marshals, b.N)
+	}
+}
+
+func benchmarkLogging(b *testing.B) {
+	toolkit.Configure(toolkit.WithSlogHandler(slog.NewJSONHandler(io.Discard, nil)))
+	defer toolkit.Configure(toolkit.WithLogWriter())
+	toolkit.RedactFields("password")
+	defer toolkit.ResetRedaction()
+	ctx := toolkit.FuncCtx(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ctx.Logger.Info().Interface("payload", benchPayload).Str("password", "s3cret").Msg("Order created")
+	}
+}
+
+func BenchmarkLoggingStdCodec(b *testing.B) {
+	toolkit.SetJSONCodec(toolkit.StdCodec{})
+	benchmarkLogging(b)
+}
+
+// BenchmarkLoggingInjectedCodec checks that the payloads of log entries, and their redaction and conversion to slog records, use the injected codec
+func BenchmarkLoggingInjectedCodec(b *testing.B) {
+	codec := &benchCodec{}
+	toolkit.SetJSONCodec(codec)
+	defer toolkit.SetJSONCodec(toolkit.StdCodec{})
+	benchmarkLogging(b)
+	if codec.marshals < 2*b.N || codec.unmarshals < 2*b.N {
+		b.Fatalf("injected codec was used for %v marshals and %v unmarshals for %v log entries", codec.marshals, codec.unmarshals, b.N)
+	}
+}
@@ -0,0 +1,67 @@
+package toolkits
+
+import (
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+)
+
+// CountingCodec is a json codec which counts how many times it was used
+type CountingCodec struct {
+	Marshals   atomic.Int64
+	Unmarshals atomic.Int64
+}
+
+func (this *CountingCodec) Marshal(v any) ([]byte, error) {
+	this.Marshals.Add(1)
+	return json.Marshal(v)
+}
+
+func (this *CountingCodec) Unmarshal(data []byte, v any) error {
+	this.Unmarshals.Add(1)
+	return json.Unmarshal(data, v)
+}
+
+var _ = Describe("SetJSONCodec", func() {
+	var codec *CountingCodec
+	var rr *httptest.ResponseRecorder
+
+	BeforeEach(func() {
+		codec = &CountingCodec{}
+		toolkit.SetJSONCodec(codec)
+		//  The console writer also marshals some of the fields it prints with the codec
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+		rr = httptest.NewRecorder()
+	})
+	AfterEach(func() {
+		toolkit.SetJSONCodec(toolkit.StdCodec{})
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+	When("a json response is sent", func() {
+		It("should be serialized with the codec", func() {
+			toolkit.FuncCtx(rr, httptest.NewRequest(http.MethodGet, "/", nil)).OkResponseJson(toolkit.Json{"a": 1})
+			Expect(codec.Marshals.Load()).To(BeEquivalentTo(1))
+		})
+	})
+	When("a request body is bound", func() {
+		It("should be deserialized with the codec", func() {
+			var payload struct{ A int }
+			ctx := toolkit.FuncCtx(rr, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"A":1}`)))
+			Expect(ctx.BindJson(&payload)).To(BeTrue())
+			Expect(codec.Unmarshals.Load()).To(BeEquivalentTo(1))
+		})
+	})
+	When("an object is added to a log message", func() {
+		It("should be serialized with the codec", func() {
+			ctx := toolkit.FuncCtx(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+			ctx.Logger.Info().Interface("payload", toolkit.Json{"a": 1}).Msg("payload")
+			Expect(codec.Marshals.Load()).To(BeNumerically(">=", 1))
+		})
+	})
+})
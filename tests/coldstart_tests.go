@@ -0,0 +1,53 @@
+package toolkits
+
+import (
+	"bytes"
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("Cold start", func() {
+	var outBuffer bytes.Buffer
+
+	newCtx := func() toolkit.FunctionContext {
+		ctx := toolkit.FuncCtx(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		outBuffer.Reset()
+		logger := ctx.Logger.Output(&outBuffer)
+		ctx.Logger = &logger
+		return ctx
+	}
+
+	BeforeEach(func() {
+		toolkit.ResetMetrics()
+		toolkit.ResetColdStart()
+	})
+	When("the instance handles its first request", func() {
+		It("should annotate its logs and count the cold start", func() {
+			Expect(toolkit.IsColdStart()).To(BeTrue())
+			ctx := newCtx()
+			ctx.Info("first")
+			var entry map[string]interface{}
+			Expect(json.Unmarshal(outBuffer.Bytes(), &entry)).To(Succeed())
+			Expect(entry["coldStart"]).To(Equal(true))
+			Expect(entry).To(HaveKey("initDurationMs"))
+
+			ctx.NoContentResponse()
+			Expect(toolkit.IsColdStart()).To(BeFalse())
+			Expect(toolkit.CollectMetrics()[0].Name).To(Equal("cold_starts_total"))
+		})
+	})
+	When("the instance handles later requests", func() {
+		It("should not annotate their logs", func() {
+			newCtx().NoContentResponse()
+			ctx := newCtx()
+			ctx.Info("second")
+			var entry map[string]interface{}
+			Expect(json.Unmarshal(outBuffer.Bytes(), &entry)).To(Succeed())
+			Expect(entry).NotTo(HaveKey("coldStart"))
+		})
+	})
+})
@@ -0,0 +1,43 @@
+package toolkits
+
+import (
+	"bytes"
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("Component", func() {
+	var ctx toolkit.FunctionContext
+	var outBuffer bytes.Buffer
+
+	BeforeEach(func() {
+		ctx = toolkit.FuncCtx(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		outBuffer.Reset()
+		logger := ctx.Logger.Output(&outBuffer)
+		ctx.Logger = &logger
+	})
+	When("a component logs a message", func() {
+		It("should add the component field", func() {
+			ctx.Component("billing").Info("Charging")
+			var entry map[string]interface{}
+			Expect(json.Unmarshal(outBuffer.Bytes(), &entry)).To(Succeed())
+			Expect(entry["component"]).To(Equal("billing"))
+			Expect(entry["caller"]).To(ContainSubstring("component_tests.go"))
+		})
+	})
+	When("a component has its own level", func() {
+		It("should only drop the component's messages below it", func() {
+			billing := ctx.Component("billing", toolkit.LogLevelWarn)
+			billing.Info("hidden")
+			Expect(outBuffer.String()).To(BeEmpty())
+			billing.Warn("shown")
+			Expect(outBuffer.String()).To(ContainSubstring("shown"))
+			ctx.Info("also shown")
+			Expect(outBuffer.String()).To(ContainSubstring("also shown"))
+		})
+	})
+})
@@ -0,0 +1,66 @@
+package toolkits
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	"github.com/andybalholm/brotli"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+var _ = Describe("Compression", func() {
+	var rr *httptest.ResponseRecorder
+	var rq *http.Request
+	var data toolkit.Json
+
+	BeforeEach(func() {
+		toolkit.Configure(toolkit.WithCompression(100))
+		rr = httptest.NewRecorder()
+		rq = httptest.NewRequest(http.MethodGet, "/", nil)
+		data = toolkit.Json{"text": strings.Repeat("a", 500)}
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithoutCompression())
+	})
+	When("the client accepts gzip", func() {
+		It("should compress large responses", func() {
+			rq.Header.Set("Accept-Encoding", "gzip, deflate")
+			toolkit.FuncCtx(rr, rq).OkResponseJson(data)
+			Expect(rr.Header().Get("Content-Encoding")).To(Equal("gzip"))
+			reader, err := gzip.NewReader(rr.Body)
+			Expect(err).ToNot(HaveOccurred())
+			var res toolkit.SuccessResponseStruct
+			Expect(json.NewDecoder(reader).Decode(&res)).To(Succeed())
+			Expect(res.Data).To(Equal(data.AsMap()))
+		})
+		It("should not compress small responses", func() {
+			rq.Header.Set("Accept-Encoding", "gzip")
+			toolkit.FuncCtx(rr, rq).OkResponseJson(toolkit.Json{"a": 1})
+			Expect(rr.Header().Get("Content-Encoding")).To(BeEmpty())
+		})
+	})
+	When("the client prefers brotli", func() {
+		It("should compress streamed responses with brotli", func() {
+			rq.Header.Set("Accept-Encoding", "gzip;q=0.5, br")
+			stream, err := toolkit.FuncCtx(rr, rq).StreamResponseJson()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stream.Encode(data)).To(Succeed())
+			Expect(stream.Close()).To(Succeed())
+			Expect(rr.Header().Get("Content-Encoding")).To(Equal("br"))
+			body, err := io.ReadAll(brotli.NewReader(rr.Body))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(body)).To(HaveSuffix(`"data":[{"text":"` + strings.Repeat("a", 500) + `"}]}`))
+		})
+	})
+	When("the client doesn't accept compression", func() {
+		It("should send the response as it is", func() {
+			toolkit.FuncCtx(rr, rq).OkResponseJson(data)
+			Expect(rr.Header().Get("Content-Encoding")).To(BeEmpty())
+		})
+	})
+})
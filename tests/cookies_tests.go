@@ -0,0 +1,92 @@
+package toolkits
+
+import (
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+)
+
+var _ = Describe("Signed and encrypted cookies", func() {
+	BeforeEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard), toolkit.WithCookieSecrets("secret"))
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter(), toolkit.WithCookieSecrets())
+	})
+
+	set := func(setter func(ctx toolkit.FunctionContext) error) *http.Cookie {
+		rr := httptest.NewRecorder()
+		ctx := toolkit.FuncCtx(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		Expect(setter(ctx)).To(Succeed())
+		cookies := rr.Result().Cookies()
+		Expect(cookies).To(HaveLen(1))
+		return cookies[0]
+	}
+	get := func(cookie *http.Cookie) toolkit.FunctionContext {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.AddCookie(cookie)
+		return toolkit.FuncCtx(httptest.NewRecorder(), r)
+	}
+
+	It("should read back a signed cookie, and reject it once changed", func() {
+		cookie := set(func(ctx toolkit.FunctionContext) error {
+			return ctx.SetSignedCookie(http.Cookie{Name: "user", Value: "alice", MaxAge: 60})
+		})
+		Expect(cookie.Value).NotTo(Equal("alice"))
+		value, ok := get(cookie).GetSignedCookie("user")
+		Expect(ok).To(BeTrue())
+		Expect(value).To(Equal("alice"))
+		_, ok = get(cookie).GetSignedCookie("other")
+		Expect(ok).To(BeFalse())
+		tampered := *cookie
+		tampered.Value = "Ym9i" + cookie.Value[strings.IndexByte(cookie.Value, '.'):]
+		_, ok = get(&tampered).GetSignedCookie("user")
+		Expect(ok).To(BeFalse())
+	})
+	It("should reject expired cookies", func() {
+		cookie := set(func(ctx toolkit.FunctionContext) error {
+			return ctx.SetSignedCookie(http.Cookie{Name: "user", Value: "alice", Expires: time.Now().Add(-time.Minute)})
+		})
+		_, ok := get(cookie).GetSignedCookie("user")
+		Expect(ok).To(BeFalse())
+	})
+	It("should hide the value of encrypted cookies", func() {
+		cookie := set(func(ctx toolkit.FunctionContext) error {
+			return ctx.SetEncryptedCookie(http.Cookie{Name: "token", Value: "refresh-token"})
+		})
+		Expect(cookie.Value).NotTo(ContainSubstring("refresh"))
+		value, ok := get(cookie).GetEncryptedCookie("token")
+		Expect(ok).To(BeTrue())
+		Expect(value).To(Equal("refresh-token"))
+		_, ok = get(cookie).GetSignedCookie("token")
+		Expect(ok).To(BeFalse())
+	})
+	It("should accept the cookies of previous secrets", func() {
+		signed := set(func(ctx toolkit.FunctionContext) error {
+			return ctx.SetSignedCookie(http.Cookie{Name: "user", Value: "alice"})
+		})
+		encrypted := set(func(ctx toolkit.FunctionContext) error {
+			return ctx.SetEncryptedCookie(http.Cookie{Name: "token", Value: "refresh-token"})
+		})
+		toolkit.Configure(toolkit.WithCookieSecrets("new secret", "secret"))
+		_, ok := get(signed).GetSignedCookie("user")
+		Expect(ok).To(BeTrue())
+		_, ok = get(encrypted).GetEncryptedCookie("token")
+		Expect(ok).To(BeTrue())
+		toolkit.Configure(toolkit.WithCookieSecrets("new secret"))
+		_, ok = get(signed).GetSignedCookie("user")
+		Expect(ok).To(BeFalse())
+		_, ok = get(encrypted).GetEncryptedCookie("token")
+		Expect(ok).To(BeFalse())
+	})
+	It("should fail without a secret", func() {
+		toolkit.Configure(toolkit.WithCookieSecrets())
+		ctx := toolkit.FuncCtx(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		Expect(ctx.SetSignedCookie(http.Cookie{Name: "user", Value: "alice"})).NotTo(Succeed())
+	})
+})
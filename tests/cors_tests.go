@@ -0,0 +1,75 @@
+package toolkits
+
+import (
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+var _ = Describe("CORS", func() {
+	var rr *httptest.ResponseRecorder
+	var rq *http.Request
+
+	BeforeEach(func() {
+		toolkit.Configure(toolkit.WithCORS(toolkit.CORSConfig{
+			AllowedOrigins:   []string{"https://app.example.com", "https://*.preview.example.com"},
+			AllowedMethods:   []string{http.MethodGet, http.MethodPut},
+			AllowedHeaders:   []string{"Authorization", "Content-Type"},
+			AllowCredentials: true,
+			MaxAge:           time.Hour,
+		}))
+		rr = httptest.NewRecorder()
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithoutCORS())
+	})
+	When("a request comes from an allowed origin", func() {
+		It("should add the CORS headers to the response", func() {
+			rq = httptest.NewRequest(http.MethodGet, "/", nil)
+			rq.Header.Set("Origin", "https://pr-1.preview.example.com")
+			toolkit.FuncCtx(rr, rq).OkResponseJson(nil)
+			Expect(rr.Header().Get("Access-Control-Allow-Origin")).To(Equal("https://pr-1.preview.example.com"))
+			Expect(rr.Header().Get("Access-Control-Allow-Credentials")).To(Equal("true"))
+			Expect(rr.Header().Get("Vary")).To(ContainSubstring("Origin"))
+		})
+	})
+	When("a request comes from another origin", func() {
+		It("should not add the CORS headers", func() {
+			rq = httptest.NewRequest(http.MethodGet, "/", nil)
+			rq.Header.Set("Origin", "https://evil.com")
+			toolkit.FuncCtx(rr, rq).OkResponseJson(nil)
+			Expect(rr.Header().Get("Access-Control-Allow-Origin")).To(BeEmpty())
+		})
+	})
+	When("an allowed preflight request is sent", func() {
+		It("should answer it", func() {
+			rq = httptest.NewRequest(http.MethodOptions, "/", nil)
+			rq.Header.Set("Origin", "https://app.example.com")
+			rq.Header.Set("Access-Control-Request-Method", http.MethodPut)
+			rq.Header.Set("Access-Control-Request-Headers", "content-type")
+			Expect(toolkit.FuncCtx(rr, rq).HandlePreflight()).To(BeTrue())
+			Expect(rr.Code).To(Equal(http.StatusNoContent))
+			Expect(rr.Header().Get("Access-Control-Allow-Methods")).To(Equal("GET, PUT"))
+			Expect(rr.Header().Get("Access-Control-Allow-Headers")).To(Equal("content-type"))
+			Expect(rr.Header().Get("Access-Control-Max-Age")).To(Equal("3600"))
+		})
+	})
+	When("a preflight request asks for a method which isn't allowed", func() {
+		It("should reject it", func() {
+			rq = httptest.NewRequest(http.MethodOptions, "/", nil)
+			rq.Header.Set("Origin", "https://app.example.com")
+			rq.Header.Set("Access-Control-Request-Method", http.MethodDelete)
+			Expect(toolkit.FuncCtx(rr, rq).HandlePreflight()).To(BeTrue())
+			Expect(rr.Code).To(Equal(http.StatusForbidden))
+		})
+	})
+	When("the request isn't a preflight request", func() {
+		It("should do nothing", func() {
+			rq = httptest.NewRequest(http.MethodGet, "/", nil)
+			Expect(toolkit.FuncCtx(rr, rq).HandlePreflight()).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,51 @@
+package toolkits
+
+import (
+	"encoding/csv"
+	"errors"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("OkResponseCSV", func() {
+	var rr *httptest.ResponseRecorder
+	var ctx toolkit.FunctionContext
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		ctx = toolkit.FuncCtx(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+	When("the rows are written", func() {
+		It("should send a csv attachment", func() {
+			ctx.OkResponseCSVFile("orders.csv", []string{"id", "name"}, func(w *csv.Writer) error {
+				return w.Write([]string{"1", "foo, bar"})
+			})
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(rr.Header().Get("Content-Type")).To(Equal("text/csv; charset=utf-8"))
+			Expect(rr.Header().Get("Content-Disposition")).To(Equal("attachment; filename=orders.csv"))
+			Expect(rr.Body.String()).To(Equal("id,name\n1,\"foo, bar\"\n"))
+		})
+	})
+	When("no filename is given", func() {
+		It("should name the attachment DefaultCSVFilename", func() {
+			ctx.OkResponseCSV([]string{"id"}, func(w *csv.Writer) error {
+				return w.Write([]string{"1"})
+			})
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(rr.Header().Get("Content-Disposition")).To(Equal("attachment; filename=export.csv"))
+			Expect(rr.Body.String()).To(Equal("id\n1\n"))
+		})
+	})
+	When("writing the rows fails", func() {
+		It("should send an error response", func() {
+			ctx.OkResponseCSV([]string{"id"}, func(w *csv.Writer) error {
+				return errors.New("query failed")
+			})
+			Expect(rr.Code).To(Equal(http.StatusInternalServerError))
+			Expect(rr.Header().Get("Content-Disposition")).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,89 @@
+package toolkits
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+)
+
+var errOrderNotFound = errors.New("order not found")
+
+type validationError struct {
+	field string
+}
+
+func (this *validationError) Error() string { return "invalid field " + this.field }
+
+var _ = Describe("Error mappings", func() {
+	var rr *httptest.ResponseRecorder
+	var rq *http.Request
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		rq = httptest.NewRequest(http.MethodGet, "/", nil)
+		toolkit.ResetErrorMappings()
+		toolkit.MapError(errOrderNotFound, http.StatusNotFound, "Order not found")
+		toolkit.MapErrorType[*validationError](http.StatusBadRequest, "")
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+	})
+	AfterEach(func() {
+		toolkit.ResetErrorMappings()
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+	message := func() string {
+		var res toolkit.ErrorResponseStruct
+		Expect(json.Unmarshal(rr.Body.Bytes(), &res)).To(Succeed())
+		return res.Message
+	}
+	When("a handler returns a mapped error", func() {
+		It("should respond with the mapped status and message", func() {
+			toolkit.Handle(func(ctx toolkit.FunctionContext) error {
+				return fmt.Errorf("loading order 42: %w", errOrderNotFound)
+			}).ServeHTTP(rr, rq)
+			Expect(rr.Code).To(Equal(http.StatusNotFound))
+			Expect(message()).To(Equal("Order not found"))
+		})
+		It("should match errors by type", func() {
+			toolkit.Handle(func(ctx toolkit.FunctionContext) error {
+				return fmt.Errorf("decoding order: %w", &validationError{field: "quantity"})
+			}).ServeHTTP(rr, rq)
+			Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			Expect(message()).To(Equal("Bad Request"))
+		})
+	})
+	When("a handler returns a StatusError wrapping a mapped error", func() {
+		It("should prefer the StatusError", func() {
+			toolkit.Handle(func(ctx toolkit.FunctionContext) error {
+				return fmt.Errorf("%w: %w", notFoundError{id: "42"}, &validationError{field: "id"})
+			}).ServeHTTP(rr, rq)
+			Expect(rr.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+	When("ErrResponse is called with a 0 status", func() {
+		It("should use the mapping", func() {
+			toolkit.FuncCtx(rr, rq).ErrResponse(0, errOrderNotFound, "")
+			Expect(rr.Code).To(Equal(http.StatusNotFound))
+			Expect(message()).To(Equal("Order not found"))
+		})
+		It("should keep the given message", func() {
+			toolkit.FuncCtx(rr, rq).ErrResponse(0, errOrderNotFound, "No such order")
+			Expect(message()).To(Equal("No such order"))
+		})
+		It("should use a 500 status for unmapped errors", func() {
+			toolkit.FuncCtx(rr, rq).ErrResponse(0, errors.New("disk full"), "")
+			Expect(rr.Code).To(Equal(http.StatusInternalServerError))
+		})
+	})
+	When("ErrResponse is called with a status", func() {
+		It("should ignore the mapping", func() {
+			toolkit.FuncCtx(rr, rq).ErrResponse(http.StatusBadGateway, errOrderNotFound, "Upstream failed")
+			Expect(rr.Code).To(Equal(http.StatusBadGateway))
+		})
+	})
+})
@@ -0,0 +1,78 @@
+package toolkits
+
+import (
+	"context"
+	"errors"
+	toolkit "github.com/Platform48/function_toolkit"
+	"github.com/getsentry/sentry-go"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+type recordingReporter struct {
+	reports []toolkit.ErrorReport
+}
+
+func (this *recordingReporter) ReportError(ctx context.Context, report toolkit.ErrorReport) {
+	this.reports = append(this.reports, report)
+}
+
+type recordingTransport struct {
+	events []*sentry.Event
+}
+
+func (this *recordingTransport) Flush(timeout time.Duration) bool       { return true }
+func (this *recordingTransport) Configure(options sentry.ClientOptions) {}
+func (this *recordingTransport) SendEvent(event *sentry.Event) {
+	this.events = append(this.events, event)
+}
+
+var _ = Describe("ErrorReporter", func() {
+	var ctx toolkit.FunctionContext
+
+	BeforeEach(func() {
+		ctx = toolkit.FuncCtx(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders", nil))
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithoutErrorReporters())
+	})
+	When("a server error response is sent", func() {
+		It("should report the error with the request metadata", func() {
+			reporter := &recordingReporter{}
+			toolkit.Configure(toolkit.WithErrorReporter(reporter))
+			ctx.ErrResponse(http.StatusServiceUnavailable, errors.New("db down"), "Try again later")
+			Expect(reporter.reports).To(HaveLen(1))
+			report := reporter.reports[0]
+			Expect(report.Err).To(MatchError("db down"))
+			Expect(report.Message).To(Equal("Try again later"))
+			Expect(report.Status).To(Equal(http.StatusServiceUnavailable))
+			Expect(report.SpanId).To(Equal(ctx.SpanId))
+			Expect(report.Request.URL.Path).To(Equal("/orders"))
+		})
+	})
+	When("a client error response is sent", func() {
+		It("should not report it", func() {
+			reporter := &recordingReporter{}
+			toolkit.Configure(toolkit.WithErrorReporter(reporter))
+			ctx.ErrResponse(http.StatusBadRequest, errors.New("bad id"), "Invalid id")
+			Expect(reporter.reports).To(BeEmpty())
+		})
+	})
+	When("the Sentry reporter is used", func() {
+		It("should send the error to Sentry with the span id", func() {
+			transport := &recordingTransport{}
+			reporter, err := toolkit.NewSentryReporter(sentry.ClientOptions{Dsn: "https://key@sentry.example.com/1", Transport: transport})
+			Expect(err).NotTo(HaveOccurred())
+			toolkit.Configure(toolkit.WithErrorReporter(reporter))
+			ctx.ReportError(errors.New("db down"), "Failed to load orders")
+			Expect(transport.events).To(HaveLen(1))
+			event := transport.events[0]
+			Expect(event.Tags).To(HaveKeyWithValue("spanId", ctx.SpanId))
+			Expect(event.Exception[0].Value).To(Equal("db down"))
+			Expect(event.Request.URL).To(ContainSubstring("/orders"))
+		})
+	})
+})
@@ -0,0 +1,95 @@
+package toolkits
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+)
+
+var _ = Describe("Error Reporting", func() {
+	var ctx toolkit.FunctionContext
+	var outBuffer bytes.Buffer
+
+	firstEntry := func() map[string]interface{} {
+		var entry map[string]interface{}
+		Expect(json.Unmarshal([]byte(strings.Split(outBuffer.String(), "\n")[0]), &entry)).To(Succeed())
+		return entry
+	}
+
+	BeforeEach(func() {
+		toolkit.Configure(toolkit.WithGcpLogFormat(true))
+		ctx = toolkit.FuncCtx(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		outBuffer.Reset()
+		logger := ctx.Logger.Output(&outBuffer)
+		ctx.Logger = &logger
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithoutErrorReporting(), toolkit.WithGcpLogFormat(false))
+	})
+	When("errors are reported through the logs", func() {
+		BeforeEach(func() {
+			toolkit.Configure(toolkit.WithErrorReporting(toolkit.ErrorReportingConfig{Service: "orders", Version: "v2"}))
+		})
+		It("should add the Error Reporting fields to ERROR messages", func() {
+			ctx.Errorf("Failed to load order %v", 7)
+			entry := firstEntry()
+			Expect(entry["@type"]).To(Equal("type.googleapis.com/google.devtools.clouderrorreporting.v1beta1.ReportedErrorEvent"))
+			Expect(entry["serviceContext"]).To(Equal(map[string]interface{}{"service": "orders", "version": "v2"}))
+			Expect(entry["stack_trace"]).To(HavePrefix("Failed to load order 7\n\ngoroutine 1 [running]:\n"))
+			Expect(entry["stack_trace"]).To(ContainSubstring("errorreporting_tests.go"))
+		})
+		It("should report server errors of ErrResponse", func() {
+			ctx.ErrResponse(http.StatusBadGateway, errors.New("timeout"), "Upstream failed")
+			Expect(firstEntry()).To(HaveKey("stack_trace"))
+		})
+		It("should not report client errors of ErrResponse", func() {
+			ctx.ErrResponse(http.StatusBadRequest, errors.New("bad id"), "Invalid id")
+			Expect(firstEntry()).NotTo(HaveKey("stack_trace"))
+		})
+		It("should not report WARN messages", func() {
+			ctx.Warn("Slow")
+			Expect(firstEntry()).NotTo(HaveKey("@type"))
+		})
+	})
+	When("errors are reported through the API", func() {
+		var server *httptest.Server
+		var reports chan map[string]interface{}
+
+		BeforeEach(func() {
+			reports = make(chan map[string]interface{}, 1)
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasSuffix(r.URL.Path, "/token") {
+					_, _ = w.Write([]byte(`{"access_token":"test-token","expires_in":3600}`))
+					return
+				}
+				var report map[string]interface{}
+				_ = json.NewDecoder(r.Body).Decode(&report)
+				report["path"] = r.URL.Path
+				reports <- report
+			}))
+			os.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(server.URL, "http://"))
+			os.Setenv("GOOGLE_CLOUD_PROJECT", "test-project")
+			toolkit.Configure(toolkit.WithErrorReporting(toolkit.ErrorReportingConfig{Service: "orders", API: true, Endpoint: server.URL}))
+		})
+		AfterEach(func() {
+			os.Unsetenv("GCE_METADATA_HOST")
+			server.Close()
+		})
+		It("should send the error to the API", func() {
+			ctx.Error("Database unavailable")
+			var report map[string]interface{}
+			Eventually(reports).Should(Receive(&report))
+			Expect(report["path"]).To(Equal("/v1beta1/projects/test-project/events:report"))
+			Expect(report["message"]).To(HavePrefix("Database unavailable\n\ngoroutine 1 [running]:"))
+			Expect(report["serviceContext"]).To(HaveKeyWithValue("service", "orders"))
+			Expect(firstEntry()).NotTo(HaveKey("@type"))
+		})
+	})
+})
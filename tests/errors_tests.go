@@ -0,0 +1,61 @@
+package toolkits
+
+import (
+	"encoding/json"
+	"errors"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("Errors", func() {
+	var errs toolkit.Errors
+
+	BeforeEach(func() {
+		errs = toolkit.Errors{}
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+	When("no errors are appended", func() {
+		It("should be nil", func() {
+			errs.Append(nil)
+			errs.AppendField("items[0]", nil)
+			Expect(errs.Len()).To(Equal(0))
+			Expect(errs.ErrOrNil()).To(BeNil())
+		})
+	})
+	When("errors are appended", func() {
+		BeforeEach(func() {
+			errs.AppendField("items[1].quantity", toolkit.Unprocessable("must be positive"))
+			errs.AppendField("items[4]", toolkit.NotFound("Product not found").WithCause(errors.New("no rows in products")))
+			errs.Append(errors.New("dial tcp 10.0.0.3:5432: connection refused"))
+		})
+		It("should join their messages", func() {
+			Expect(errs.ErrOrNil()).To(MatchError("3 errors: items[1].quantity: must be positive; items[4]: Product not found: no rows in products; dial tcp 10.0.0.3:5432: connection refused"))
+		})
+		It("should match each of them", func() {
+			var responseErr *toolkit.ResponseError
+			Expect(errors.As(errs.ErrOrNil(), &responseErr)).To(BeTrue())
+			Expect(responseErr.Message).To(Equal("must be positive"))
+		})
+		It("should be sent as the details of the error response", func() {
+			rr := httptest.NewRecorder()
+			toolkit.FuncCtx(rr, httptest.NewRequest(http.MethodPost, "/import", nil)).ErrResponse(http.StatusUnprocessableEntity, errs.ErrOrNil(), "Import failed")
+			var res toolkit.ErrorResponseStruct
+			Expect(json.Unmarshal(rr.Body.Bytes(), &res)).To(Succeed())
+			Expect(rr.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(res.Message).To(Equal("Import failed"))
+			Expect(res.Details).To(Equal([]toolkit.ErrorDetail{
+				{Field: "items[1].quantity", Message: "must be positive"},
+				{Field: "items[4]", Message: "Product not found"},
+				{Message: "Internal Server Error"},
+			}))
+			Expect(rr.Body.String()).NotTo(ContainSubstring("10.0.0.3"))
+		})
+	})
+})
@@ -0,0 +1,54 @@
+package toolkits
+
+import (
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("ETag", func() {
+	var rr *httptest.ResponseRecorder
+	var rq *http.Request
+	var data toolkit.Json
+	var etag string
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		rq = httptest.NewRequest(http.MethodGet, "/", nil)
+		data = toolkit.Json{"id": "1"}
+		var err error
+		etag, err = toolkit.ETag(data)
+		Expect(err).ToNot(HaveOccurred())
+	})
+	When("the request has no If-None-Match header", func() {
+		It("should send the data with an ETag header", func() {
+			toolkit.FuncCtx(rr, rq).OkResponseJsonWithETag(data)
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(rr.Header().Get("ETag")).To(Equal(etag))
+			Expect(rr.Body.String()).To(ContainSubstring(`"id":"1"`))
+		})
+	})
+	When("the If-None-Match header matches", func() {
+		It("should send a 304 response without a body", func() {
+			rq.Header.Set("If-None-Match", "W/"+etag)
+			toolkit.FuncCtx(rr, rq).OkResponseJsonWithETag(data)
+			Expect(rr.Code).To(Equal(http.StatusNotModified))
+			Expect(rr.Body.Len()).To(BeZero())
+		})
+	})
+	When("the If-Match header doesn't match", func() {
+		It("should send a 412 response", func() {
+			rq.Header.Set("If-Match", `"stale"`)
+			Expect(toolkit.FuncCtx(rr, rq).CheckIfMatch(etag)).To(BeFalse())
+			Expect(rr.Code).To(Equal(http.StatusPreconditionFailed))
+		})
+	})
+	When("the If-Match header matches", func() {
+		It("should pass", func() {
+			rq.Header.Set("If-Match", etag)
+			Expect(toolkit.FuncCtx(rr, rq).CheckIfMatch(etag)).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,91 @@
+package toolkits
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	toolkit "github.com/Platform48/function_toolkit"
+	"github.com/cloudevents/sdk-go/v2/event"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func routedEvent(eventType string, source string) event.Event {
+	e := event.New()
+	e.SetID("8403741263891245")
+	e.SetType(eventType)
+	e.SetSource(source)
+	return e
+}
+
+var _ = Describe("EventRouter", func() {
+	var router *toolkit.EventRouter
+	var routed string
+	var outBuffer bytes.Buffer
+	route := func(name string, err error) toolkit.HandlerFunc {
+		return func(ctx toolkit.FunctionContext) error {
+			routed = name
+			return err
+		}
+	}
+
+	BeforeEach(func() {
+		routed = ""
+		outBuffer.Reset()
+		toolkit.Configure(toolkit.WithLogWriter(&outBuffer))
+		router = toolkit.NewEventRouter().
+			OnSource("google.cloud.storage.object.v1.finalized", "//storage.googleapis.com/projects/_/buckets/invoices", route("invoices", nil)).
+			On("google.cloud.storage.object.v1.finalized", route("uploads", nil)).
+			On("google.cloud.firestore.document.v1.*", route("firestore", nil))
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+	When("an event matches a route", func() {
+		It("should run the first matching route", func() {
+			Expect(router.Handle(context.Background(), routedEvent("google.cloud.storage.object.v1.finalized", "//storage.googleapis.com/projects/_/buckets/invoices"))).To(Succeed())
+			Expect(routed).To(Equal("invoices"))
+			Expect(router.Handle(context.Background(), routedEvent("google.cloud.storage.object.v1.finalized", "//storage.googleapis.com/projects/_/buckets/avatars"))).To(Succeed())
+			Expect(routed).To(Equal("uploads"))
+		})
+		It("should match types by prefix", func() {
+			Expect(router.Handle(context.Background(), routedEvent("google.cloud.firestore.document.v1.written", "//firestore.googleapis.com/projects/demo"))).To(Succeed())
+			Expect(routed).To(Equal("firestore"))
+		})
+	})
+	When("an event matches no route", func() {
+		It("should drop it", func() {
+			Expect(router.Handle(context.Background(), routedEvent("com.example.order.created", "//orders"))).To(Succeed())
+			Expect(routed).To(BeEmpty())
+			Expect(outBuffer.String()).To(ContainSubstring("no route for com.example.order.created events"))
+		})
+		It("should run the fallback handler if there's one", func() {
+			router.Otherwise(route("fallback", nil))
+			Expect(router.Handle(context.Background(), routedEvent("com.example.order.created", "//orders"))).To(Succeed())
+			Expect(routed).To(Equal("fallback"))
+		})
+	})
+	When("the handler fails", func() {
+		It("should return errors so the event is retried", func() {
+			router.On("com.example.order.created", route("orders", errors.New("database unavailable")))
+			Expect(router.Handle(context.Background(), routedEvent("com.example.order.created", "//orders"))).To(MatchError("database unavailable"))
+		})
+		It("should drop events failing with a 4xx status", func() {
+			router.On("com.example.order.created", route("orders", toolkit.Unprocessable("Unknown order type")))
+			Expect(router.Handle(context.Background(), routedEvent("com.example.order.created", "//orders"))).To(Succeed())
+			Expect(outBuffer.String()).To(ContainSubstring("Unknown order type"))
+		})
+		It("should return recovered panics as errors", func() {
+			router.On("com.example.order.created", func(ctx toolkit.FunctionContext) error {
+				panic("nil map")
+			})
+			Expect(router.Handle(context.Background(), routedEvent("com.example.order.created", "//orders"))).To(MatchError("nil map"))
+		})
+		It("should keep the result of the handler's own Drop", func() {
+			router.On("com.example.order.created", func(ctx toolkit.FunctionContext) error {
+				return ctx.Drop(errors.New("duplicate order"))
+			})
+			Expect(router.Handle(context.Background(), routedEvent("com.example.order.created", "//orders"))).To(Succeed())
+		})
+	})
+})
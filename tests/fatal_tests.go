@@ -0,0 +1,59 @@
+package toolkits
+
+import (
+	"bytes"
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+var _ = Describe("Fatal and Panic", func() {
+	var ctx toolkit.FunctionContext
+	var rr *httptest.ResponseRecorder
+	var outBuffer bytes.Buffer
+
+	firstEntry := func() map[string]interface{} {
+		var entry map[string]interface{}
+		Expect(json.Unmarshal([]byte(strings.Split(outBuffer.String(), "\n")[0]), &entry)).To(Succeed())
+		return entry
+	}
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		ctx = toolkit.FuncCtx(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		outBuffer.Reset()
+		logger := ctx.Logger.Output(&outBuffer)
+		ctx.Logger = &logger
+	})
+	When("Fatal is called", func() {
+		It("should log the message, send a 500 response and abort the handler", func() {
+			Expect(func() { ctx.Fatalf("Config %v is missing", "DB_URL") }).To(PanicWith(http.ErrAbortHandler))
+			Expect(rr.Code).To(Equal(http.StatusInternalServerError))
+			Expect(rr.Body.String()).NotTo(ContainSubstring("DB_URL"))
+			entry := firstEntry()
+			Expect(entry["level"]).To(Equal("fatal"))
+			Expect(entry["message"]).To(Equal("Config DB_URL is missing"))
+		})
+		It("should keep a response which has already been written", func() {
+			ctx.OkResponse("text/plain", []byte("ok"))
+			Expect(func() { ctx.Fatal("Too late") }).To(PanicWith(http.ErrAbortHandler))
+			Expect(rr.Code).To(Equal(http.StatusOK))
+		})
+	})
+	When("Panic is called", func() {
+		It("should log the message and panic with it", func() {
+			Expect(func() { ctx.Panic("Unreachable") }).To(PanicWith("Unreachable"))
+			Expect(firstEntry()["level"]).To(Equal("panic"))
+		})
+	})
+	When("Log is called with the FATAL level", func() {
+		It("should only log the message", func() {
+			Expect(func() { ctx.Log(toolkit.LogLevelFatal, "Only logged") }).NotTo(Panic())
+			Expect(firstEntry()["level"]).To(Equal("fatal"))
+		})
+	})
+})
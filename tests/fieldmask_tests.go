@@ -0,0 +1,59 @@
+package toolkits
+
+import (
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("Field masks", func() {
+	var rr *httptest.ResponseRecorder
+	var data toolkit.Json
+
+	respond := func(url string) toolkit.SuccessResponseStruct {
+		ctx := toolkit.FuncCtx(rr, httptest.NewRequest(http.MethodGet, url, nil))
+		ctx.OkResponseJson(data)
+		var res toolkit.SuccessResponseStruct
+		Expect(json.Unmarshal(rr.Body.Bytes(), &res)).To(Succeed())
+		return res
+	}
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		data = toolkit.Json{
+			"id":     "1",
+			"name":   "order",
+			"author": toolkit.Json{"email": "a@b.c", "phone": "123"},
+			"items":  []toolkit.Json{{"id": "i1", "title": "t1", "price": 1.}},
+		}
+	})
+	When("no fields are requested", func() {
+		It("should return the whole object", func() {
+			Expect(respond("/").Data).To(HaveLen(4))
+		})
+	})
+	When("top level fields are requested", func() {
+		It("should only return those fields", func() {
+			Expect(respond("/?fields=id,name").Data).To(Equal(toolkit.Json{"id": "1", "name": "order"}.AsMap()))
+		})
+	})
+	When("nested fields are requested", func() {
+		It("should filter sub-objects and arrays", func() {
+			res := respond("/?fields=author/email,items(id,title)")
+			Expect(res.Data).To(Equal(map[string]interface{}{
+				"author": map[string]interface{}{"email": "a@b.c"},
+				"items":  []interface{}{map[string]interface{}{"id": "i1", "title": "t1"}},
+			}))
+		})
+	})
+	When("the fields parameter is malformed", func() {
+		It("should send a 400 response", func() {
+			ctx := toolkit.FuncCtx(rr, httptest.NewRequest(http.MethodGet, "/?fields=items(id", nil))
+			ctx.OkResponseJson(data)
+			Expect(rr.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+})
@@ -0,0 +1,45 @@
+package toolkits
+
+import (
+	"bytes"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+var _ = Describe("FileResponse", func() {
+	var rr *httptest.ResponseRecorder
+	var rq *http.Request
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		rq = httptest.NewRequest(http.MethodGet, "/", nil)
+	})
+	When("the reader can seek", func() {
+		It("should send the file with its length", func() {
+			toolkit.FuncCtx(rr, rq).FileResponse(bytes.NewReader([]byte("0123456789")), "report.pdf", "application/pdf")
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(rr.Header().Get("Content-Disposition")).To(Equal("attachment; filename=report.pdf"))
+			Expect(rr.Header().Get("Content-Type")).To(Equal("application/pdf"))
+			Expect(rr.Header().Get("Content-Length")).To(Equal("10"))
+			Expect(rr.Body.String()).To(Equal("0123456789"))
+		})
+		It("should handle range requests", func() {
+			rq.Header.Set("Range", "bytes=2-4")
+			toolkit.FuncCtx(rr, rq).FileResponse(bytes.NewReader([]byte("0123456789")), "report.pdf", "application/pdf")
+			Expect(rr.Code).To(Equal(http.StatusPartialContent))
+			Expect(rr.Body.String()).To(Equal("234"))
+		})
+	})
+	When("the reader can't seek", func() {
+		It("should stream the contents", func() {
+			toolkit.FuncCtx(rr, rq).FileResponse(io.MultiReader(strings.NewReader("foo"), strings.NewReader("bar")), "data.txt", "text/plain")
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(rr.Body.String()).To(Equal("foobar"))
+		})
+	})
+})
@@ -0,0 +1,82 @@
+package toolkits
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+)
+
+func loggedFingerprints(buffer *bytes.Buffer) []string {
+	var fingerprints []string
+	decoder := json.NewDecoder(buffer)
+	for decoder.More() {
+		var entry map[string]interface{}
+		Expect(decoder.Decode(&entry)).To(Succeed())
+		fingerprint, _ := entry["fingerprint"].(string)
+		fingerprints = append(fingerprints, fingerprint)
+	}
+	return fingerprints
+}
+
+func failToLoadOrder(ctx toolkit.FunctionContext, id int) {
+	ctx.ErrorErr(fmt.Errorf("order %v: %w", id, errors.New("connection refused")), "Failed to load order")
+}
+
+var _ = Describe("Error fingerprints", func() {
+	var ctx toolkit.FunctionContext
+	var outBuffer bytes.Buffer
+
+	BeforeEach(func() {
+		ctx = toolkit.FuncCtx(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		outBuffer.Reset()
+		logger := ctx.Logger.Output(&outBuffer)
+		ctx.Logger = &logger
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithoutErrorReporters())
+	})
+	When("the same failure is logged again with different ids", func() {
+		It("should have the same fingerprint", func() {
+			failToLoadOrder(ctx, 1234)
+			failToLoadOrder(ctx, 5678)
+			for _, id := range []string{"3f2504e0-4f89-11d3-9a0c-0305e82c3301", "7c9e6679-7425-40de-944b-e07fc1f90ae7"} {
+				ctx.Errorf("Failed to load user \"%v\"", id)
+			}
+			fingerprints := loggedFingerprints(&outBuffer)
+			Expect(fingerprints).To(HaveLen(4))
+			Expect(fingerprints[0]).NotTo(BeEmpty())
+			Expect(fingerprints[1]).To(Equal(fingerprints[0]))
+			Expect(fingerprints[3]).To(Equal(fingerprints[2]))
+		})
+	})
+	When("different failures are logged", func() {
+		It("should have different fingerprints", func() {
+			ctx.Error("Failed to load order")
+			ctx.Error("Failed to save order")
+			ctx.ErrorErr(errors.New("timeout"), "Failed to load order")
+			fingerprints := loggedFingerprints(&outBuffer)
+			Expect(fingerprints[1]).NotTo(Equal(fingerprints[0]))
+			Expect(fingerprints[2]).NotTo(Equal(fingerprints[0]))
+		})
+	})
+	When("a message is logged below the ERROR level", func() {
+		It("should not have a fingerprint", func() {
+			ctx.Warn("Slow response")
+			Expect(loggedFingerprints(&outBuffer)).To(Equal([]string{""}))
+		})
+	})
+	When("an error response is reported", func() {
+		It("should send the logged fingerprint to the reporters", func() {
+			reporter := &recordingReporter{}
+			toolkit.Configure(toolkit.WithErrorReporter(reporter))
+			ctx.ErrResponse(http.StatusInternalServerError, errors.New("connection refused"), "Failed to load order")
+			Expect(reporter.reports[0].Fingerprint).To(Equal(loggedFingerprints(&outBuffer)[0]))
+		})
+	})
+})
@@ -0,0 +1,132 @@
+package toolkits
+
+import (
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var _ = Describe("RequireFirebaseAuth", func() {
+	var keys *httptest.Server
+	var identityToolkit *httptest.Server
+	var lookup string
+	var lookedUp map[string]interface{}
+	var config toolkit.FirebaseAuthConfig
+	var claims map[string]interface{}
+	var user toolkit.FirebaseUser
+	var authenticated bool
+
+	BeforeEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+		keys = keysServer()
+		lookup = `{"users":[{"localId":"uid-7","validSince":"1000"}]}`
+		identityToolkit = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, "/token") {
+				_, _ = w.Write([]byte(`{"access_token":"test-token","expires_in":3600}`))
+				return
+			}
+			Expect(r.URL.Path).To(Equal("/v1/projects/test-project/accounts:lookup"))
+			_ = json.NewDecoder(r.Body).Decode(&lookedUp)
+			_, _ = w.Write([]byte(lookup))
+		}))
+		os.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(identityToolkit.URL, "http://"))
+		os.Setenv("GOOGLE_CLOUD_PROJECT", "test-project")
+		config = toolkit.FirebaseAuthConfig{KeysUrl: keys.URL, Endpoint: identityToolkit.URL}
+		now := time.Now()
+		claims = map[string]interface{}{
+			"iss":            "https://securetoken.google.com/test-project",
+			"aud":            "test-project",
+			"sub":            "uid-7",
+			"iat":            now.Unix(),
+			"exp":            now.Add(time.Hour).Unix(),
+			"auth_time":      now.Add(-time.Hour).Unix(),
+			"email":          "ada@example.com",
+			"email_verified": true,
+			"name":           "Ada",
+			"role":           "admin",
+			"firebase":       map[string]interface{}{"sign_in_provider": "google.com", "identities": map[string]interface{}{}},
+		}
+		user, authenticated, lookedUp = toolkit.FirebaseUser{}, false, nil
+	})
+	AfterEach(func() {
+		os.Unsetenv("GCE_METADATA_HOST")
+		keys.Close()
+		identityToolkit.Close()
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+
+	request := func(token string) int {
+		handler := toolkit.Chain(toolkit.RequireFirebaseAuth(config)).Then(func(ctx toolkit.FunctionContext) error {
+			user, authenticated = ctx.User()
+			return nil
+		})
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, r)
+		return rr.Code
+	}
+
+	When("the ID token is valid", func() {
+		It("should expose the user with their custom claims", func() {
+			Expect(request(signToken(claims))).To(Equal(http.StatusOK))
+			Expect(authenticated).To(BeTrue())
+			Expect(user.Uid).To(Equal("uid-7"))
+			Expect(user.Email).To(Equal("ada@example.com"))
+			Expect(user.EmailVerified).To(BeTrue())
+			Expect(user.Name).To(Equal("Ada"))
+			Expect(user.SignInProvider).To(Equal("google.com"))
+			Expect(user.Claims).To(Equal(map[string]interface{}{"role": "admin"}))
+			Expect(lookedUp).To(BeNil())
+		})
+	})
+	When("the ID token is invalid", func() {
+		It("should reject tokens of another project", func() {
+			claims["aud"] = "other-project"
+			claims["iss"] = "https://securetoken.google.com/other-project"
+			Expect(request(signToken(claims))).To(Equal(http.StatusUnauthorized))
+			Expect(authenticated).To(BeFalse())
+		})
+		It("should reject tokens without a uid", func() {
+			delete(claims, "sub")
+			Expect(request(signToken(claims))).To(Equal(http.StatusUnauthorized))
+		})
+		It("should reject requests without a token", func() {
+			Expect(request("")).To(Equal(http.StatusUnauthorized))
+		})
+	})
+	When("revocation is checked", func() {
+		BeforeEach(func() {
+			config.CheckRevoked = true
+		})
+		It("should accept tokens issued after the tokens were revoked", func() {
+			Expect(request(signToken(claims))).To(Equal(http.StatusOK))
+			Expect(lookedUp).To(Equal(map[string]interface{}{"localId": []interface{}{"uid-7"}}))
+		})
+		It("should reject revoked tokens", func() {
+			lookup = `{"users":[{"localId":"uid-7","validSince":"` + strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10) + `"}]}`
+			Expect(request(signToken(claims))).To(Equal(http.StatusUnauthorized))
+		})
+		It("should reject disabled users", func() {
+			lookup = `{"users":[{"localId":"uid-7","disabled":true}]}`
+			Expect(request(signToken(claims))).To(Equal(http.StatusUnauthorized))
+		})
+	})
+	When("the request isn't authenticated with Firebase", func() {
+		It("should have no user", func() {
+			ctx := toolkit.FuncCtx(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil)).WithPrincipal("svc", map[string]interface{}{"sub": "svc"})
+			_, ok := ctx.User()
+			Expect(ok).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,108 @@
+package toolkits
+
+import (
+	"context"
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	"github.com/cloudevents/sdk-go/v2/event"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/protobuf/encoding/protowire"
+	"io"
+	"math"
+	"time"
+)
+
+func protoBytes(b []byte, number protowire.Number, value []byte) []byte {
+	return protowire.AppendBytes(protowire.AppendTag(b, number, protowire.BytesType), value)
+}
+
+func protoVarint(b []byte, number protowire.Number, value uint64) []byte {
+	return protowire.AppendVarint(protowire.AppendTag(b, number, protowire.VarintType), value)
+}
+
+// firestoreField encodes a map<string, Value> entry
+func firestoreField(name string, value []byte) []byte {
+	return protoBytes(protoBytes(nil, 1, []byte(name)), 2, value)
+}
+
+func firestoreEvent(contentType string, data []byte) event.Event {
+	e := event.New()
+	e.SetID("8403741263891245")
+	e.SetType("google.cloud.firestore.document.v1.updated")
+	e.SetSource("//firestore.googleapis.com/projects/demo/databases/(default)")
+	_ = e.SetData(contentType, data)
+	return e
+}
+
+var _ = Describe("Firestore events", func() {
+	BeforeEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+	When("a protobuf event is bound", func() {
+		It("should decode the old and new values of the document", func() {
+			createTime := protoVarint(nil, 1, 1714557600)
+			tags := protoBytes(nil, 9, protoBytes(protoBytes(nil, 1, protoBytes(nil, 17, []byte("vip"))), 1, protoVarint(nil, 1, 1)))
+			address := protoBytes(nil, 6, protoBytes(nil, 1, firestoreField("city", protoBytes(nil, 17, []byte("Lisbon")))))
+			location := protoBytes(nil, 8, protowire.AppendFixed64(protowire.AppendTag(nil, 1, protowire.Fixed64Type), math.Float64bits(38.7)))
+			value := protoBytes(nil, 1, []byte("projects/demo/databases/(default)/documents/users/u-1/orders/o-7"))
+			value = protoBytes(value, 2, firestoreField("total", protoVarint(nil, 2, 1250)))
+			value = protoBytes(value, 2, firestoreField("paid", protoVarint(nil, 1, 1)))
+			value = protoBytes(value, 2, firestoreField("tags", tags))
+			value = protoBytes(value, 2, firestoreField("address", address))
+			value = protoBytes(value, 2, firestoreField("location", location))
+			value = protoBytes(value, 2, firestoreField("note", protoVarint(nil, 11, 0)))
+			value = protoBytes(value, 3, createTime)
+			oldValue := protoBytes(nil, 1, []byte("projects/demo/databases/(default)/documents/users/u-1/orders/o-7"))
+			oldValue = protoBytes(oldValue, 2, firestoreField("paid", protoVarint(nil, 1, 0)))
+			data := protoBytes(nil, 1, value)
+			data = protoBytes(data, 2, oldValue)
+			data = protoBytes(data, 3, protoBytes(nil, 1, []byte("paid")))
+
+			ctx := toolkit.EventCtx(context.Background(), firestoreEvent("application/protobuf", data))
+			e, err := ctx.BindFirestoreEvent()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(e.Value.Path()).To(Equal([]string{"users", "u-1", "orders", "o-7"}))
+			Expect(e.Value.Id()).To(Equal("o-7"))
+			Expect(e.Value.CreateTime).To(Equal(time.Unix(1714557600, 0).UTC()))
+			Expect(e.Value.Fields).To(Equal(map[string]interface{}{
+				"total":    int64(1250),
+				"paid":     true,
+				"tags":     []interface{}{"vip", true},
+				"address":  map[string]interface{}{"city": "Lisbon"},
+				"location": toolkit.FirestoreGeoPoint{Latitude: 38.7},
+				"note":     nil,
+			}))
+			Expect(e.OldValue.Fields).To(Equal(map[string]interface{}{"paid": false}))
+			Expect(e.UpdateMask).To(Equal([]string{"paid"}))
+		})
+	})
+	When("a json event is bound", func() {
+		It("should decode the documents", func() {
+			data, _ := json.Marshal(map[string]interface{}{
+				"oldValue": map[string]interface{}{
+					"name":       "projects/demo/databases/(default)/documents/users/u-1",
+					"fields":     map[string]interface{}{"visits": map[string]interface{}{"integerValue": "41"}, "seen": map[string]interface{}{"timestampValue": "2024-05-01T10:00:00Z"}},
+					"createTime": "2024-05-01T09:00:00Z",
+				},
+			})
+			ctx := toolkit.EventCtx(context.Background(), firestoreEvent("application/json", data))
+			e, err := ctx.BindFirestoreEvent()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(e.Value).To(BeNil())
+			Expect(e.Document().Id()).To(Equal("u-1"))
+			Expect(e.OldValue.Fields).To(Equal(map[string]interface{}{"visits": int64(41), "seen": time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}))
+		})
+	})
+	When("the event isn't a Firestore event", func() {
+		It("should fail", func() {
+			e := event.New()
+			e.SetType("com.example.order.created")
+			_, err := toolkit.EventCtx(context.Background(), e).BindFirestoreEvent()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,45 @@
+package toolkits
+
+import (
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+)
+
+type versionedFormatter struct {
+	toolkit.DefaultResponseFormatter
+}
+
+func (this versionedFormatter) FormatSuccess(ctx toolkit.FunctionContext, data interface{}) interface{} {
+	return toolkit.Json{"traceId": ctx.SpanId, "apiVersion": "2", "result": data}
+}
+
+var _ = Describe("ResponseFormatter", func() {
+	var rr *httptest.ResponseRecorder
+	var ctx toolkit.FunctionContext
+
+	BeforeEach(func() {
+		toolkit.Configure(toolkit.WithResponseFormatter(versionedFormatter{}))
+		rr = httptest.NewRecorder()
+		ctx = toolkit.FuncCtx(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithResponseFormatter(toolkit.DefaultResponseFormatter{}))
+	})
+	When("a custom formatter is registered", func() {
+		It("should be used for success responses", func() {
+			ctx.OkResponseJson(toolkit.Json{"id": "1"})
+			Expect(rr.Body.String()).To(MatchJSON(`{"traceId":"` + ctx.SpanId + `","apiVersion":"2","result":{"id":"1"}}`))
+		})
+		It("should be used for page responses", func() {
+			ctx.OkResponsePage([]int{1, 2}, "next", 10)
+			Expect(rr.Body.String()).To(MatchJSON(`{"traceId":"` + ctx.SpanId + `","apiVersion":"2","result":[1,2],"nextPageToken":"next","total":10}`))
+		})
+		It("should fall back to the default error envelope", func() {
+			ctx.FailResponse(http.StatusBadRequest, "bad")
+			Expect(rr.Body.String()).To(MatchJSON(`{"spanId":"` + ctx.SpanId + `","message":"bad"}`))
+		})
+	})
+})
@@ -0,0 +1,162 @@
+package toolkits
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var _ = Describe("FunctionClient", func() {
+	var server *httptest.Server
+	var mutex sync.Mutex
+	var requests []*http.Request
+	var tokenRequests []string
+	var responses []func(w http.ResponseWriter)
+	var client *toolkit.FunctionClient
+	var ctx toolkit.FunctionContext
+
+	identityToken := func(audience string) string {
+		claims := fmt.Sprintf(`{"aud":%q,"exp":%v}`, audience, time.Now().Add(time.Hour).Unix())
+		return "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".c2ln"
+	}
+
+	BeforeEach(func() {
+		requests, tokenRequests, responses = nil, nil, nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if strings.HasSuffix(r.URL.Path, "/identity") {
+				tokenRequests = append(tokenRequests, r.URL.Query().Get("audience"))
+				_, _ = w.Write([]byte(identityToken(r.URL.Query().Get("audience"))))
+				return
+			}
+			requests = append(requests, r)
+			body, _ := io.ReadAll(r.Body)
+			r.Body = io.NopCloser(strings.NewReader(string(body)))
+			respond := func(w http.ResponseWriter) {
+				_, _ = w.Write([]byte(`{"spanId":"remote-span","data":{"id":"ord_1","total":42}}`))
+			}
+			if len(responses) > 0 {
+				respond, responses = responses[0], responses[1:]
+			}
+			respond(w)
+		}))
+		os.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(server.URL, "http://"))
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+		client = toolkit.NewFunctionClient(server.URL + "/orders")
+		client.Backoff = time.Millisecond
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		r.Header.Set("X-Request-ID", "req-123")
+		ctx = toolkit.FuncCtx(httptest.NewRecorder(), r)
+	})
+	AfterEach(func() {
+		os.Unsetenv("GCE_METADATA_HOST")
+		server.Close()
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+
+	failWith := func(status int, body string) func(w http.ResponseWriter) {
+		return func(w http.ResponseWriter) {
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(body))
+		}
+	}
+
+	When("the call succeeds", func() {
+		It("should send an identity token for the function and the trace headers", func() {
+			var order struct {
+				Id    string `json:"id"`
+				Total int    `json:"total"`
+			}
+			Expect(client.Post(ctx, "/ord_1", map[string]string{"status": "paid"}, &order)).To(Succeed())
+			Expect(order.Id).To(Equal("ord_1"))
+			Expect(order.Total).To(Equal(42))
+			Expect(requests).To(HaveLen(1))
+			Expect(requests[0].Method).To(Equal(http.MethodPost))
+			Expect(requests[0].URL.Path).To(Equal("/orders/ord_1"))
+			Expect(requests[0].Header.Get("Authorization")).To(Equal("Bearer " + identityToken(server.URL+"/orders")))
+			Expect(requests[0].Header.Get("Content-Type")).To(Equal("application/json"))
+			Expect(requests[0].Header.Get("traceparent")).To(HavePrefix("00-4bf92f3577b34da6a3ce929d0e0e4736-"))
+			Expect(requests[0].Header.Get("X-Request-ID")).To(Equal("req-123"))
+			body, _ := io.ReadAll(requests[0].Body)
+			Expect(string(body)).To(Equal(`{"status":"paid"}`))
+			Expect(tokenRequests).To(Equal([]string{server.URL + "/orders"}))
+		})
+		It("should cache the identity token", func() {
+			Expect(client.Get(ctx, "/ord_1", nil)).To(Succeed())
+			Expect(client.Get(ctx, "/ord_2", nil)).To(Succeed())
+			Expect(requests).To(HaveLen(2))
+			Expect(tokenRequests).To(HaveLen(1))
+		})
+		It("should decode bodies which aren't an envelope as they are", func() {
+			responses = append(responses, failWith(http.StatusOK, `["a","b"]`))
+			var items []string
+			Expect(client.Get(ctx, "", &items)).To(Succeed())
+			Expect(items).To(Equal([]string{"a", "b"}))
+		})
+	})
+	When("the function responds with an error", func() {
+		It("should retry 429 and 5xx responses with backoff", func() {
+			responses = append(responses, failWith(http.StatusServiceUnavailable, `{"spanId":"s1"}`), failWith(http.StatusTooManyRequests, `{"spanId":"s2"}`))
+			var order map[string]interface{}
+			Expect(client.Get(ctx, "/ord_1", &order)).To(Succeed())
+			Expect(requests).To(HaveLen(3))
+			Expect(order).To(HaveKeyWithValue("id", "ord_1"))
+		})
+		It("should give up after the maximum attempts", func() {
+			for i := 0; i < 3; i++ {
+				responses = append(responses, failWith(http.StatusInternalServerError, `{"spanId":"s1","retryable":true}`))
+			}
+			err := client.Get(ctx, "/ord_1", nil)
+			var callErr *toolkit.FunctionCallError
+			Expect(errors.As(err, &callErr)).To(BeTrue())
+			Expect(callErr.Status).To(Equal(http.StatusInternalServerError))
+			Expect(callErr.Retryable).To(BeTrue())
+			Expect(requests).To(HaveLen(3))
+		})
+		It("should return 4xx errors without retrying them", func() {
+			responses = append(responses, failWith(http.StatusNotFound, `{"spanId":"s404","message":"Order not found","details":[{"field":"id","code":"not_found"}]}`))
+			err := client.Get(ctx, "/ord_9", nil)
+			var callErr *toolkit.FunctionCallError
+			Expect(errors.As(err, &callErr)).To(BeTrue())
+			Expect(callErr.Status).To(Equal(http.StatusNotFound))
+			Expect(callErr.Message).To(Equal("Order not found"))
+			Expect(callErr.SpanId).To(Equal("s404"))
+			Expect(callErr.Details).To(Equal([]toolkit.ErrorDetail{{Field: "id", Code: "not_found"}}))
+			Expect(err.Error()).To(ContainSubstring("s404"))
+			Expect(requests).To(HaveLen(1))
+		})
+		It("should read problem details documents", func() {
+			responses = append(responses, failWith(http.StatusConflict, `{"type":"about:blank","title":"Conflict","status":409,"detail":"Order already paid","instance":"s409"}`))
+			var callErr *toolkit.FunctionCallError
+			Expect(errors.As(client.Post(ctx, "/ord_1/pay", nil, nil), &callErr)).To(BeTrue())
+			Expect(callErr.Message).To(Equal("Order already paid"))
+			Expect(callErr.SpanId).To(Equal("s409"))
+		})
+		It("should not wait for a retry past the deadline", func() {
+			responses = append(responses, func(w http.ResponseWriter) {
+				w.Header().Set("Retry-After", "30")
+				w.WriteHeader(http.StatusServiceUnavailable)
+			})
+			c, cancel := context.WithTimeout(ctx.Context, time.Second)
+			defer cancel()
+			ctx = ctx.WithCtx(c)
+			start := time.Now()
+			Expect(client.Get(ctx, "/ord_1", nil)).NotTo(Succeed())
+			Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+			Expect(requests).To(HaveLen(1))
+		})
+	})
+})
@@ -0,0 +1,118 @@
+package toolkits
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+)
+
+func gitHubSignature(secret string, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+var _ = Describe("RequireGitHubSignature", func() {
+	const body = `{"action":"opened","number":42,"pull_request":{"title":"Fix the build"},"repository":{"full_name":"octo/app"}}`
+	var handler http.HandlerFunc
+	var events []toolkit.GitHubEvent
+	var pullRequest struct {
+		Number      int `json:"number"`
+		PullRequest struct {
+			Title string `json:"title"`
+		} `json:"pull_request"`
+	}
+	var failure error
+
+	BeforeEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+		events, failure = nil, nil
+		handler = toolkit.Chain(toolkit.RequireGitHubSignature("gh-secret")).Then(func(ctx toolkit.FunctionContext) error {
+			event, err := ctx.GitHubEvent()
+			if err != nil {
+				return err
+			}
+			events = append(events, event)
+			if err := event.Bind(&pullRequest); err != nil {
+				return err
+			}
+			return failure
+		})
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+
+	request := func(delivery string, signature string, contentType string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		r.Header.Set("X-GitHub-Event", "pull_request")
+		r.Header.Set("X-GitHub-Delivery", delivery)
+		r.Header.Set("X-GitHub-Hook-ID", "1234")
+		if signature != "" {
+			r.Header.Set("X-Hub-Signature-256", signature)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, r)
+		return rr
+	}
+
+	When("the delivery is correctly signed", func() {
+		It("should run the handler with the typed event", func() {
+			Expect(request("d-1", gitHubSignature("gh-secret", body), "application/json", body).Code).To(Equal(http.StatusOK))
+			Expect(events).To(HaveLen(1))
+			Expect(events[0].Name).To(Equal("pull_request"))
+			Expect(events[0].DeliveryId).To(Equal("d-1"))
+			Expect(events[0].HookId).To(Equal("1234"))
+			Expect(events[0].Action).To(Equal("opened"))
+			Expect(pullRequest.Number).To(Equal(42))
+			Expect(pullRequest.PullRequest.Title).To(Equal("Fix the build"))
+		})
+		It("should read form encoded payloads", func() {
+			form := "payload=" + url.QueryEscape(body)
+			Expect(request("d-2", gitHubSignature("gh-secret", form), "application/x-www-form-urlencoded", form).Code).To(Equal(http.StatusOK))
+			Expect(events).To(HaveLen(1))
+			Expect(events[0].Action).To(Equal("opened"))
+			Expect(pullRequest.Number).To(Equal(42))
+		})
+	})
+	When("the delivery isn't correctly signed", func() {
+		It("should respond with a 401 status without running the handler", func() {
+			Expect(request("d-3", "", "application/json", body).Code).To(Equal(http.StatusUnauthorized))
+			Expect(request("d-3", gitHubSignature("other", body), "application/json", body).Code).To(Equal(http.StatusUnauthorized))
+			Expect(request("d-3", strings.TrimPrefix(gitHubSignature("gh-secret", body), "sha256="), "application/json", body).Code).To(Equal(http.StatusUnauthorized))
+			Expect(events).To(BeEmpty())
+		})
+	})
+	When("the secret is empty", func() {
+		It("should panic", func() {
+			Expect(func() { toolkit.RequireGitHubSignature(os.Getenv("UNSET_GITHUB_SECRET")) }).To(Panic())
+		})
+	})
+	When("a delivery is replayed", func() {
+		It("should acknowledge it without running the handler again", func() {
+			signature := gitHubSignature("gh-secret", body)
+			Expect(request("d-4", signature, "application/json", body).Code).To(Equal(http.StatusOK))
+			Expect(request("d-4", signature, "application/json", body).Code).To(Equal(http.StatusOK))
+			Expect(events).To(HaveLen(1))
+		})
+		It("should run the handler again if it failed", func() {
+			failure = errors.New("queue unavailable")
+			signature := gitHubSignature("gh-secret", body)
+			Expect(request("d-5", signature, "application/json", body).Code).To(Equal(http.StatusInternalServerError))
+			failure = nil
+			Expect(request("d-5", signature, "application/json", body).Code).To(Equal(http.StatusOK))
+			Expect(events).To(HaveLen(2))
+		})
+	})
+})
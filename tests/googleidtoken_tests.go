@@ -0,0 +1,114 @@
+package toolkits
+
+import (
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+var _ = Describe("RequireGoogleIDToken", func() {
+	var server *httptest.Server
+	var config toolkit.GoogleIDTokenConfig
+	var claims map[string]interface{}
+	var principal toolkit.Principal
+
+	BeforeEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+		server = keysServer()
+		config = toolkit.GoogleIDTokenConfig{
+			Audience:        "https://orders-abc123-ew.a.run.app",
+			ServiceAccounts: []string{"billing@test-project.iam.gserviceaccount.com"},
+			KeysUrl:         server.URL,
+		}
+		claims = map[string]interface{}{
+			"iss":            "https://accounts.google.com",
+			"aud":            "https://orders-abc123-ew.a.run.app",
+			"sub":            "1234567890",
+			"email":          "billing@test-project.iam.gserviceaccount.com",
+			"email_verified": true,
+			"exp":            time.Now().Add(time.Hour).Unix(),
+		}
+		principal = toolkit.Principal{}
+	})
+	AfterEach(func() {
+		server.Close()
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+
+	request := func(host string, token string) int {
+		handler := toolkit.Chain(toolkit.RequireGoogleIDToken(config)).Then(func(ctx toolkit.FunctionContext) error {
+			principal, _ = ctx.Principal()
+			return nil
+		})
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.Host = host
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, r)
+		return rr.Code
+	}
+
+	When("an allowed service account calls the function", func() {
+		It("should run the handler with the caller as the principal", func() {
+			Expect(request("orders-abc123-ew.a.run.app", signToken(claims))).To(Equal(http.StatusOK))
+			Expect(principal.Id).To(Equal("billing@test-project.iam.gserviceaccount.com"))
+			Expect(principal.Claim("sub")).To(Equal("1234567890"))
+		})
+		It("should ignore the request's host", func() {
+			Expect(request("other.example.com", signToken(claims))).To(Equal(http.StatusOK))
+			claims["aud"] = "https://other.example.com"
+			Expect(request("other.example.com", signToken(claims))).To(Equal(http.StatusUnauthorized))
+		})
+	})
+	When("the config is incomplete", func() {
+		It("should panic without an audience or service accounts", func() {
+			config.Audience = ""
+			Expect(func() { toolkit.RequireGoogleIDToken(config) }).To(Panic())
+			config.Audience, config.ServiceAccounts = "https://orders-abc123-ew.a.run.app", nil
+			Expect(func() { toolkit.RequireGoogleIDToken(config) }).To(Panic())
+		})
+		It("should accept any account when allowed to", func() {
+			config.ServiceAccounts, config.AllowAnyAccount = nil, true
+			claims["email"] = "someone@gmail.com"
+			Expect(request("orders-abc123-ew.a.run.app", signToken(claims))).To(Equal(http.StatusOK))
+			Expect(principal.Id).To(Equal("someone@gmail.com"))
+		})
+	})
+	When("another service account calls the function", func() {
+		It("should respond with a 403 status", func() {
+			claims["email"] = "reports@test-project.iam.gserviceaccount.com"
+			Expect(request("orders-abc123-ew.a.run.app", signToken(claims))).To(Equal(http.StatusForbidden))
+			Expect(principal.Id).To(BeEmpty())
+		})
+	})
+	When("the token isn't a valid Google ID token", func() {
+		It("should reject tokens for another audience", func() {
+			claims["aud"] = "https://billing-abc123-ew.a.run.app"
+			Expect(request("orders-abc123-ew.a.run.app", signToken(claims))).To(Equal(http.StatusUnauthorized))
+		})
+		It("should reject tokens of other issuers", func() {
+			claims["iss"] = "https://auth.example.com/"
+			Expect(request("orders-abc123-ew.a.run.app", signToken(claims))).To(Equal(http.StatusUnauthorized))
+		})
+		It("should reject unverified emails", func() {
+			claims["email_verified"] = false
+			Expect(request("orders-abc123-ew.a.run.app", signToken(claims))).To(Equal(http.StatusUnauthorized))
+		})
+		It("should reject every token without an audience", func() {
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			r.Host = "orders-abc123-ew.a.run.app"
+			r.Header.Set("Authorization", "Bearer "+signToken(claims))
+			_, err := toolkit.FuncCtx(httptest.NewRecorder(), r).VerifyGoogleIDToken("")
+			Expect(err).To(HaveOccurred())
+		})
+		It("should reject requests without a token", func() {
+			Expect(request("orders-abc123-ew.a.run.app", "")).To(Equal(http.StatusUnauthorized))
+		})
+	})
+})
@@ -0,0 +1,116 @@
+package toolkits
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	toolkit "github.com/Platform48/function_toolkit"
+	"github.com/graphql-go/graphql"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+)
+
+var _ = Describe("GraphQL", func() {
+	var logs bytes.Buffer
+	var handler http.HandlerFunc
+
+	BeforeEach(func() {
+		logs.Reset()
+		toolkit.Configure(toolkit.WithLogWriter(&logs))
+		schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"order": &graphql.Field{
+					Type: graphql.String,
+					Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.String}},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						ctx, ok := toolkit.ResolverCtx(p.Context)
+						if !ok {
+							return nil, errors.New("missing ctx")
+						}
+						switch p.Args["id"] {
+						case "missing":
+							return nil, toolkit.NotFound("Order not found")
+						case "broken":
+							return nil, errors.New("connection to 10.0.0.1 refused")
+						}
+						return "order " + p.Args["id"].(string) + " for " + ctx.RequestId, nil
+					},
+				},
+			},
+		})})
+		Expect(err).ToNot(HaveOccurred())
+		handler = toolkit.Handle(toolkit.GraphQL(schema))
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+
+	post := func(query string) (int, map[string]interface{}) {
+		body, _ := json.Marshal(map[string]interface{}{"query": query})
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set(toolkit.RequestIdHeader, "req-1")
+		handler(rr, r)
+		var response map[string]interface{}
+		Expect(json.Unmarshal(rr.Body.Bytes(), &response)).To(Succeed())
+		return rr.Code, response
+	}
+
+	When("the query succeeds", func() {
+		It("should respond with the data and log the resolver's timing", func() {
+			status, response := post(`{ order(id: "7") }`)
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(response["data"]).To(Equal(map[string]interface{}{"order": "order 7 for req-1"}))
+			Expect(response).ToNot(HaveKey("errors"))
+			Expect(logs.String()).To(ContainSubstring(`"resolver":"Query.order"`))
+		})
+		It("should accept GET requests", func() {
+			rr := httptest.NewRecorder()
+			handler(rr, httptest.NewRequest(http.MethodGet, "/graphql?query="+url.QueryEscape(`{ order(id: "8") }`), nil))
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(rr.Body.String()).To(ContainSubstring("order 8"))
+		})
+	})
+	When("a resolver fails", func() {
+		It("should send the status and client message of a StatusError", func() {
+			status, response := post(`{ order(id: "missing") }`)
+			Expect(status).To(Equal(http.StatusOK))
+			errs := response["errors"].([]interface{})
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0]).To(HaveKeyWithValue("message", "Order not found"))
+			Expect(errs[0]).To(HaveKeyWithValue("extensions", map[string]interface{}{"status": float64(404)}))
+			Expect(errs[0]).To(HaveKeyWithValue("path", []interface{}{"order"}))
+		})
+		It("should hide the message of internal errors and log them", func() {
+			_, response := post(`{ order(id: "broken") }`)
+			errs := response["errors"].([]interface{})
+			Expect(errs[0]).To(HaveKeyWithValue("message", "Internal Server Error"))
+			Expect(errs[0]).To(HaveKeyWithValue("extensions", map[string]interface{}{"status": float64(500)}))
+			Expect(logs.String()).To(ContainSubstring("Resolver of order failed"))
+			Expect(logs.String()).To(ContainSubstring("10.0.0.1"))
+		})
+	})
+	When("the query is invalid", func() {
+		It("should respond with a 400 status", func() {
+			status, response := post(`{ order(id: `)
+			Expect(status).To(Equal(http.StatusBadRequest))
+			Expect(response["errors"]).To(HaveLen(1))
+		})
+		It("should reject unknown fields", func() {
+			status, response := post(`{ customer }`)
+			Expect(status).To(Equal(http.StatusBadRequest))
+			Expect(response["errors"].([]interface{})[0]).To(HaveKeyWithValue("message", ContainSubstring("customer")))
+		})
+	})
+	When("the query is missing", func() {
+		It("should respond with a 400 status", func() {
+			status, _ := post("")
+			Expect(status).To(Equal(http.StatusBadRequest))
+		})
+	})
+})
@@ -0,0 +1,113 @@
+package toolkits
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	toolkit "github.com/Platform48/function_toolkit"
+	"github.com/Platform48/function_toolkit/grpcinterceptors"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// testServerStream is a stream with only a context
+type testServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (this *testServerStream) Context() context.Context {
+	return this.ctx
+}
+
+var _ = Describe("gRPC interceptors", func() {
+	var outBuffer bytes.Buffer
+	var incoming context.Context
+	info := &grpc.UnaryServerInfo{FullMethod: "/orders.Orders/GetOrder"}
+
+	BeforeEach(func() {
+		outBuffer.Reset()
+		toolkit.Configure(toolkit.WithLogWriter(&outBuffer))
+		incoming = metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			"traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			"x-request-id", "req-42",
+		))
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+	When("a unary RPC is handled", func() {
+		It("should give the handler a FunctionContext continuing the trace", func() {
+			var fctx toolkit.FunctionContext
+			response, err := grpcinterceptors.Unary()(incoming, "request", info, func(ctx context.Context, request interface{}) (interface{}, error) {
+				var ok bool
+				fctx, ok = grpcinterceptors.FromContext(ctx)
+				Expect(ok).To(BeTrue())
+				fctx.Info("Loading order")
+				return "response", nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(response).To(Equal("response"))
+			Expect(fctx.TraceId).To(Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+			Expect(fctx.RequestId).To(Equal("req-42"))
+			Expect(outBuffer.String()).To(ContainSubstring(`"requestId":"req-42"`))
+		})
+		It("should map errors of the toolkit to status codes", func() {
+			_, err := grpcinterceptors.Unary()(incoming, "request", info, func(ctx context.Context, request interface{}) (interface{}, error) {
+				return nil, toolkit.NotFound("Order not found").WithInternal("order o-7 is not in shard 3")
+			})
+			Expect(status.Code(err)).To(Equal(codes.NotFound))
+			Expect(status.Convert(err).Message()).To(Equal("Order not found"))
+			Expect(outBuffer.String()).To(ContainSubstring("order o-7 is not in shard 3"))
+		})
+		It("should not send the message of unknown errors", func() {
+			_, err := grpcinterceptors.Unary()(incoming, "request", info, func(ctx context.Context, request interface{}) (interface{}, error) {
+				return nil, errors.New("connection refused to 10.0.0.7")
+			})
+			Expect(status.Code(err)).To(Equal(codes.Internal))
+			Expect(status.Convert(err).Message()).NotTo(ContainSubstring("10.0.0.7"))
+		})
+		It("should keep status errors returned by the handler", func() {
+			_, err := grpcinterceptors.Unary()(incoming, "request", info, func(ctx context.Context, request interface{}) (interface{}, error) {
+				return nil, status.Error(codes.AlreadyExists, "Order exists")
+			})
+			Expect(status.Code(err)).To(Equal(codes.AlreadyExists))
+		})
+		It("should recover from panics of the handler", func() {
+			response, err := grpcinterceptors.Unary()(incoming, "request", info, func(ctx context.Context, request interface{}) (interface{}, error) {
+				var orders map[string]string
+				orders["o-7"] = "pending"
+				return "response", nil
+			})
+			Expect(response).To(BeNil())
+			Expect(status.Code(err)).To(Equal(codes.Internal))
+			Expect(outBuffer.String()).To(ContainSubstring("Recovered from panic"))
+			_, err = grpcinterceptors.Unary()(incoming, "request", info, func(ctx context.Context, request interface{}) (interface{}, error) {
+				fctx, _ := grpcinterceptors.FromContext(ctx)
+				fctx.Fatal("database unreachable")
+				return "response", nil
+			})
+			Expect(status.Code(err)).To(Equal(codes.Internal))
+		})
+	})
+	When("a streaming RPC panics", func() {
+		It("should recover and fail with the Internal code", func() {
+			err := grpcinterceptors.Stream()(nil, &testServerStream{ctx: incoming}, &grpc.StreamServerInfo{FullMethod: "/orders.Orders/WatchOrders"}, func(server interface{}, stream grpc.ServerStream) error {
+				panic("stream closed")
+			})
+			Expect(status.Code(err)).To(Equal(codes.Internal))
+			Expect(outBuffer.String()).To(ContainSubstring("stream closed"))
+		})
+	})
+	When("status codes are converted", func() {
+		It("should map them both ways", func() {
+			Expect(grpcinterceptors.Code(429)).To(Equal(codes.ResourceExhausted))
+			Expect(grpcinterceptors.HttpStatus(codes.Unavailable)).To(Equal(503))
+			Expect(grpcinterceptors.Code(grpcinterceptors.HttpStatus(codes.PermissionDenied))).To(Equal(codes.PermissionDenied))
+		})
+	})
+})
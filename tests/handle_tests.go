@@ -0,0 +1,75 @@
+package toolkits
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+)
+
+type notFoundError struct {
+	id string
+}
+
+func (this notFoundError) Error() string         { return "order " + this.id + " not found in orders table" }
+func (this notFoundError) StatusCode() int       { return http.StatusNotFound }
+func (this notFoundError) ClientMessage() string { return "Order not found" }
+
+var _ = Describe("Handle", func() {
+	var rr *httptest.ResponseRecorder
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+	serve := func(handler func(ctx toolkit.FunctionContext) error) toolkit.ErrorResponseStruct {
+		toolkit.Handle(handler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		var res toolkit.ErrorResponseStruct
+		_ = json.Unmarshal(rr.Body.Bytes(), &res)
+		return res
+	}
+	When("the handler returns an error", func() {
+		It("should send a 500 response without the error", func() {
+			res := serve(func(ctx toolkit.FunctionContext) error {
+				return errors.New("connection to 10.0.0.3 refused")
+			})
+			Expect(rr.Code).To(Equal(http.StatusInternalServerError))
+			Expect(res.Message).To(Equal("Internal Server Error"))
+			Expect(rr.Body.String()).NotTo(ContainSubstring("10.0.0.3"))
+		})
+	})
+	When("the handler returns a StatusError", func() {
+		It("should send its status and client message, even when it's wrapped", func() {
+			res := serve(func(ctx toolkit.FunctionContext) error {
+				return fmt.Errorf("loading order: %w", notFoundError{id: "42"})
+			})
+			Expect(rr.Code).To(Equal(http.StatusNotFound))
+			Expect(res.Message).To(Equal("Order not found"))
+		})
+	})
+	When("the handler returns nil without writing", func() {
+		It("should send a 200 response", func() {
+			serve(func(ctx toolkit.FunctionContext) error {
+				return nil
+			})
+			Expect(rr.Code).To(Equal(http.StatusOK))
+		})
+	})
+	When("the handler writes a response", func() {
+		It("should keep the response, even if an error is returned", func() {
+			serve(func(ctx toolkit.FunctionContext) error {
+				ctx.CreatedResponse("/orders/1", toolkit.Json{"id": 1})
+				return errors.New("failed to publish event")
+			})
+			Expect(rr.Code).To(Equal(http.StatusCreated))
+		})
+	})
+})
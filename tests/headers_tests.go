@@ -0,0 +1,70 @@
+package toolkits
+
+import (
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("Headers", func() {
+	var rq *http.Request
+	var rr *httptest.ResponseRecorder
+	var ctx toolkit.FunctionContext
+
+	BeforeEach(func() {
+		rq = httptest.NewRequest(http.MethodGet, "/", nil)
+		rr = httptest.NewRecorder()
+	})
+	When("a required header is present", func() {
+		BeforeEach(func() {
+			rq.Header.Set("X-Api-Version", "3")
+			ctx = toolkit.FuncCtx(rr, rq)
+		})
+		It("should return its value", func() {
+			value, ok := ctx.RequireHeader("X-Api-Version")
+			Expect(ok).To(BeTrue())
+			Expect(value).To(Equal("3"))
+			Expect(rr.Body.Len()).To(BeZero())
+		})
+		It("should parse it as an integer", func() {
+			value, ok := ctx.RequireHeaderInt("X-Api-Version")
+			Expect(ok).To(BeTrue())
+			Expect(value).To(Equal(3))
+		})
+	})
+	When("a required header is missing", func() {
+		BeforeEach(func() {
+			ctx = toolkit.FuncCtx(rr, rq)
+		})
+		It("should send a 400 response", func() {
+			_, ok := ctx.RequireHeader("X-Api-Version")
+			Expect(ok).To(BeFalse())
+			Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			Expect(rr.Body.String()).To(ContainSubstring("Missing required header X-Api-Version"))
+		})
+	})
+	When("a typed header is malformed", func() {
+		BeforeEach(func() {
+			rq.Header.Set("X-Dry-Run", "maybe")
+			ctx = toolkit.FuncCtx(rr, rq)
+		})
+		It("should send a 400 response", func() {
+			_, ok := ctx.HeaderBool("X-Dry-Run", false)
+			Expect(ok).To(BeFalse())
+			Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			Expect(rr.Body.String()).To(ContainSubstring("Header X-Dry-Run must be a boolean"))
+		})
+	})
+	When("an optional header is missing", func() {
+		BeforeEach(func() {
+			ctx = toolkit.FuncCtx(rr, rq)
+		})
+		It("should return the default value", func() {
+			value, ok := ctx.HeaderInt("X-Limit", 10)
+			Expect(ok).To(BeTrue())
+			Expect(value).To(Equal(10))
+		})
+	})
+})
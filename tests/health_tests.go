@@ -0,0 +1,87 @@
+package toolkits
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+var _ = Describe("HealthHandler", func() {
+	var rr *httptest.ResponseRecorder
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		toolkit.ResetHealthChecks()
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+	})
+	AfterEach(func() {
+		toolkit.ResetHealthChecks()
+		toolkit.ResetShutdown()
+		toolkit.HealthCheckTimeout = 5 * time.Second
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+	probe := func(path string) toolkit.HealthReport {
+		toolkit.HealthHandler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		var report toolkit.HealthReport
+		Expect(json.Unmarshal(rr.Body.Bytes(), &report)).To(Succeed())
+		return report
+	}
+	When("every check passes", func() {
+		It("should respond with a 200 status and the result of every check", func() {
+			toolkit.AddLivenessCheck("worker", func(ctx context.Context) error { return nil })
+			toolkit.AddReadinessCheck("database", func(ctx context.Context) error { return nil })
+			report := probe("/health/ready")
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(rr.Header().Get("Cache-Control")).To(Equal("no-store"))
+			Expect(report.Status).To(Equal("ok"))
+			Expect(report.Checks).To(HaveKey("worker"))
+			Expect(report.Checks["database"].Status).To(Equal("ok"))
+		})
+	})
+	When("a readiness check fails", func() {
+		BeforeEach(func() {
+			toolkit.AddReadinessCheck("database", func(ctx context.Context) error { return errors.New("dial tcp 10.0.0.3:5432: connection refused") })
+		})
+		It("should fail the readiness probe without exposing the error", func() {
+			report := probe("/health/ready")
+			Expect(rr.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(report.Status).To(Equal("fail"))
+			Expect(report.Checks["database"].Status).To(Equal("fail"))
+			Expect(rr.Body.String()).NotTo(ContainSubstring("10.0.0.3"))
+		})
+		It("should not fail the liveness probe", func() {
+			report := probe("/health/live")
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(report.Checks).NotTo(HaveKey("database"))
+		})
+	})
+	When("a check doesn't complete in time", func() {
+		It("should fail it", func() {
+			toolkit.HealthCheckTimeout = 20 * time.Millisecond
+			toolkit.AddReadinessCheck("pubsub", func(ctx context.Context) error {
+				time.Sleep(time.Second)
+				return nil
+			})
+			report := probe("/health")
+			Expect(rr.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(report.Checks["pubsub"].Status).To(Equal("fail"))
+		})
+	})
+	When("the instance is shutting down", func() {
+		It("should fail the readiness probe only", func() {
+			Expect(toolkit.Shutdown(context.Background())).To(Succeed())
+			Expect(probe("/health/ready").Status).To(Equal("shutting_down"))
+			Expect(rr.Code).To(Equal(http.StatusServiceUnavailable))
+			rr = httptest.NewRecorder()
+			probe("/health/livez")
+			Expect(rr.Code).To(Equal(http.StatusOK))
+		})
+	})
+})
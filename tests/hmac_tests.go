@@ -0,0 +1,154 @@
+package toolkits
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func hmacSum(secret string, payload string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+var _ = Describe("HMAC signatures", func() {
+	const body = `{"event":"order.paid","id":"ord_1"}`
+
+	BeforeEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+
+	verify := func(signature string) error {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		if signature != "" {
+			r.Header.Set("X-Signature", signature)
+		}
+		ctx := toolkit.FuncCtx(httptest.NewRecorder(), r)
+		return ctx.VerifyHMAC("X-Signature", "s3cret", sha256.New)
+	}
+
+	When("verifying a signature over the body", func() {
+		It("should accept hex and base64 signatures", func() {
+			Expect(verify(hex.EncodeToString(hmacSum("s3cret", body)))).To(Succeed())
+			Expect(verify(base64.StdEncoding.EncodeToString(hmacSum("s3cret", body)))).To(Succeed())
+			Expect(verify(base64.RawURLEncoding.EncodeToString(hmacSum("s3cret", body)))).To(Succeed())
+		})
+		It("should ignore a prefix naming the algorithm", func() {
+			Expect(verify("sha256=" + hex.EncodeToString(hmacSum("s3cret", body)))).To(Succeed())
+		})
+		It("should reject a wrong or missing signature with a 401 status", func() {
+			err := verify(hex.EncodeToString(hmacSum("other", body)))
+			status, message := toolkit.ErrorStatus(err)
+			Expect(status).To(Equal(http.StatusUnauthorized))
+			Expect(message).To(Equal("Invalid signature"))
+			status, message = toolkit.ErrorStatus(verify(""))
+			Expect(status).To(Equal(http.StatusUnauthorized))
+			Expect(message).To(Equal("Missing signature"))
+		})
+		It("should use the given hash function", func() {
+			mac := hmac.New(sha1.New, []byte("s3cret"))
+			mac.Write([]byte(body))
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+			r.Header.Set("X-Hub-Signature", "sha1="+hex.EncodeToString(mac.Sum(nil)))
+			ctx := toolkit.FuncCtx(httptest.NewRecorder(), r)
+			Expect(ctx.VerifyHMAC("X-Hub-Signature", "s3cret", sha1.New)).To(Succeed())
+			Expect(ctx.VerifyHMAC("X-Hub-Signature", "s3cret", sha256.New)).NotTo(Succeed())
+		})
+		It("should reject every request when the secret is empty", func() {
+			mac := hmac.New(sha256.New, nil)
+			mac.Write([]byte(body))
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+			r.Header.Set("X-Signature", hex.EncodeToString(mac.Sum(nil)))
+			err := toolkit.FuncCtx(httptest.NewRecorder(), r).VerifyHMAC("X-Signature", "", sha256.New)
+			var responseErr *toolkit.ResponseError
+			Expect(errors.As(err, &responseErr)).To(BeTrue())
+			Expect(responseErr.StatusCode()).To(Equal(http.StatusInternalServerError))
+		})
+	})
+
+	When("using the middleware", func() {
+		It("should panic without a secret", func() {
+			Expect(func() { toolkit.RequireHMAC(toolkit.HMACConfig{Header: "X-Signature"}) }).To(Panic())
+		})
+		var config toolkit.HMACConfig
+		var received map[string]string
+
+		BeforeEach(func() {
+			received = nil
+			config = toolkit.HMACConfig{
+				Header:          "X-Signature",
+				Secret:          "s3cret",
+				Algorithm:       sha256.New,
+				Prefix:          "v1=",
+				TimestampHeader: "X-Timestamp",
+				SignedPayload: func(timestamp string, body []byte) []byte {
+					return append([]byte(timestamp+"."), body...)
+				},
+			}
+		})
+
+		request := func(timestamp string, signature string) *httptest.ResponseRecorder {
+			handler := toolkit.Chain(toolkit.RequireHMAC(config)).Then(func(ctx toolkit.FunctionContext) error {
+				if !ctx.BindJson(&received) {
+					return nil
+				}
+				ctx.OkResponse("", nil)
+				return nil
+			})
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+			r.Header.Set("X-Timestamp", timestamp)
+			r.Header.Set("X-Signature", signature)
+			rr := httptest.NewRecorder()
+			handler(rr, r)
+			return rr
+		}
+		sign := func(timestamp string) string {
+			return "v1=" + hex.EncodeToString(hmacSum("s3cret", timestamp+"."+body))
+		}
+
+		It("should run the handler with the body still readable", func() {
+			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+			Expect(request(timestamp, sign(timestamp)).Code).To(Equal(http.StatusOK))
+			Expect(received).To(HaveKeyWithValue("id", "ord_1"))
+		})
+		It("should accept RFC 3339 timestamps", func() {
+			timestamp := time.Now().UTC().Format(time.RFC3339)
+			Expect(request(timestamp, sign(timestamp)).Code).To(Equal(http.StatusOK))
+		})
+		It("should reject stale, future and missing timestamps", func() {
+			stale := strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10)
+			Expect(request(stale, sign(stale)).Code).To(Equal(http.StatusUnauthorized))
+			future := strconv.FormatInt(time.Now().Add(10*time.Minute).Unix(), 10)
+			Expect(request(future, sign(future)).Code).To(Equal(http.StatusUnauthorized))
+			Expect(request("", sign("")).Code).To(Equal(http.StatusUnauthorized))
+			Expect(received).To(BeNil())
+		})
+		It("should accept older timestamps within a longer tolerance", func() {
+			config.Tolerance = time.Hour
+			stale := strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10)
+			Expect(request(stale, sign(stale)).Code).To(Equal(http.StatusOK))
+		})
+		It("should reject a signature over another timestamp or without the prefix", func() {
+			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+			earlier := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+			Expect(request(timestamp, sign(earlier)).Code).To(Equal(http.StatusUnauthorized))
+			Expect(request(timestamp, strings.TrimPrefix(sign(timestamp), "v1=")).Code).To(Equal(http.StatusUnauthorized))
+		})
+	})
+})
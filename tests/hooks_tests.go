@@ -0,0 +1,64 @@
+package toolkits
+
+import (
+	"errors"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("OnResponse", func() {
+	var rr *httptest.ResponseRecorder
+	var ctx toolkit.FunctionContext
+	var calls int
+	var status, written int
+	var hookErr error
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		ctx = toolkit.FuncCtx(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		calls = 0
+		ctx.OnResponse(func(s int, b int, err error) {
+			calls++
+			status, written, hookErr = s, b, err
+		})
+	})
+	When("a success response is sent", func() {
+		It("should call the hook with the status and size", func() {
+			ctx.OkResponse("text/plain", []byte("hello"))
+			Expect(calls).To(Equal(1))
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(written).To(Equal(5))
+			Expect(hookErr).ToNot(HaveOccurred())
+		})
+	})
+	When("an error response is sent", func() {
+		It("should call the hook with the error", func() {
+			ctx.WithCtx(ctx.Context).ErrResponse(http.StatusBadGateway, errors.New("upstream failed"), "failed")
+			Expect(calls).To(Equal(1))
+			Expect(status).To(Equal(http.StatusBadGateway))
+			Expect(hookErr).To(MatchError("upstream failed"))
+		})
+	})
+	When("a stream is closed", func() {
+		It("should call the hook once", func() {
+			stream, err := ctx.StreamResponseJson()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stream.Encode(1)).To(Succeed())
+			Expect(calls).To(Equal(0))
+			Expect(stream.Close()).To(Succeed())
+			Expect(stream.Close()).To(Succeed())
+			Expect(calls).To(Equal(1))
+		})
+	})
+	When("a hook panics", func() {
+		It("should still call the other hooks", func() {
+			ctx.OnResponse(func(int, int, error) { panic("boom") })
+			ctx.OnResponse(func(int, int, error) { calls++ })
+			ctx.NoContentResponse()
+			Expect(calls).To(Equal(2))
+		})
+	})
+})
@@ -0,0 +1,73 @@
+package toolkits
+
+import (
+	"bytes"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("IPFilter", func() {
+	var logs bytes.Buffer
+
+	BeforeEach(func() {
+		logs.Reset()
+		toolkit.Configure(toolkit.WithLogWriter(&logs))
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter(), toolkit.WithTrustedProxies())
+	})
+
+	request := func(filter toolkit.IPFilterConfig, forwardedFor string) int {
+		handler := toolkit.Chain(toolkit.IPFilter(filter)).Then(func(ctx toolkit.FunctionContext) error {
+			return nil
+		})
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-Forwarded-For", forwardedFor)
+		rr := httptest.NewRecorder()
+		handler(rr, r)
+		return rr.Code
+	}
+
+	When("only some ranges are allowed", func() {
+		filter := toolkit.IPFilterConfig{Allow: []string{"10.0.0.0/8", "203.0.113.7", "2001:db8::/32"}}
+
+		It("should let the addresses of the ranges through", func() {
+			Expect(request(filter, "10.20.30.40")).To(Equal(http.StatusOK))
+			Expect(request(filter, "203.0.113.7")).To(Equal(http.StatusOK))
+			Expect(request(filter, "2001:db8::5")).To(Equal(http.StatusOK))
+			Expect(request(filter, "::ffff:10.1.1.1")).To(Equal(http.StatusOK))
+		})
+		It("should reject other addresses with a 403 status and log them", func() {
+			Expect(request(filter, "198.51.100.4")).To(Equal(http.StatusForbidden))
+			Expect(logs.String()).To(ContainSubstring(`"clientIp":"198.51.100.4"`))
+			Expect(request(filter, "203.0.113.8")).To(Equal(http.StatusForbidden))
+			Expect(request(filter, "not-an-ip")).To(Equal(http.StatusForbidden))
+		})
+		It("should not trust addresses sent by the client before the one appended by Google", func() {
+			Expect(request(filter, "10.0.0.1, 198.51.100.4")).To(Equal(http.StatusForbidden))
+		})
+	})
+	When("ranges are denied", func() {
+		It("should reject their addresses even if they're allowed", func() {
+			filter := toolkit.IPFilterConfig{Allow: []string{"10.0.0.0/8"}, Deny: []string{"10.66.0.0/16"}}
+			Expect(request(filter, "10.66.1.2")).To(Equal(http.StatusForbidden))
+			Expect(request(filter, "10.67.1.2")).To(Equal(http.StatusOK))
+			Expect(request(toolkit.IPFilterConfig{Deny: []string{"198.51.100.0/24"}}, "203.0.113.7")).To(Equal(http.StatusOK))
+		})
+	})
+	When("the function is behind a trusted load balancer", func() {
+		It("should read the client's address before the load balancer's", func() {
+			toolkit.Configure(toolkit.WithTrustedProxies("34.120.1.1", "35.191.0.0/16"))
+			filter := toolkit.IPFilterConfig{Allow: []string{"203.0.113.0/24"}}
+			Expect(request(filter, "10.0.0.1, 203.0.113.7, 34.120.1.1, 35.191.4.5")).To(Equal(http.StatusOK))
+			Expect(request(filter, "203.0.113.7, 198.51.100.4, 34.120.1.1")).To(Equal(http.StatusForbidden))
+		})
+	})
+	It("should panic on invalid ranges", func() {
+		Expect(func() { toolkit.IPFilter(toolkit.IPFilterConfig{Allow: []string{"10.0.0.0/33"}}) }).To(Panic())
+		Expect(func() { toolkit.WithTrustedProxies("proxy") }).To(Panic())
+	})
+})
@@ -0,0 +1,90 @@
+package toolkits
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"os"
+)
+
+var _ = Describe("JobCtx", func() {
+	var outBuffer bytes.Buffer
+	var checkpoints int
+	checkpointed := func(job toolkit.HandlerFunc) toolkit.HandlerFunc {
+		return func(ctx toolkit.FunctionContext) error {
+			ctx.OnCheckpoint(func(ctx toolkit.FunctionContext) error {
+				checkpoints++
+				return nil
+			})
+			return job(ctx)
+		}
+	}
+
+	BeforeEach(func() {
+		checkpoints = 0
+		outBuffer.Reset()
+		toolkit.Configure(toolkit.WithLogWriter(&outBuffer))
+		os.Setenv("CLOUD_RUN_JOB", "orders-import")
+		os.Setenv("CLOUD_RUN_EXECUTION", "orders-import-x7k2p")
+		os.Setenv("CLOUD_RUN_TASK_INDEX", "3")
+		os.Setenv("CLOUD_RUN_TASK_COUNT", "10")
+		os.Setenv("CLOUD_RUN_TASK_ATTEMPT", "1")
+	})
+	AfterEach(func() {
+		for _, name := range []string{"CLOUD_RUN_JOB", "CLOUD_RUN_EXECUTION", "CLOUD_RUN_TASK_INDEX", "CLOUD_RUN_TASK_COUNT", "CLOUD_RUN_TASK_ATTEMPT"} {
+			os.Unsetenv(name)
+		}
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+	When("a job ctx is created", func() {
+		It("should read the task from the environment and log it", func() {
+			ctx := toolkit.JobCtx()
+			defer ctx.FinishJob(nil)
+			info, ok := ctx.JobInfo()
+			Expect(ok).To(BeTrue())
+			Expect(info).To(Equal(toolkit.JobInfo{Job: "orders-import", Execution: "orders-import-x7k2p", TaskIndex: 3, TaskCount: 10, TaskAttempt: 1}))
+			Expect(ctx.RequestId).To(Equal("orders-import-x7k2p"))
+			Expect(ctx.SpanId).To(Equal("orders-import-x7k2p-3-1"))
+
+			ctx.Info("Importing")
+			var entry map[string]interface{}
+			Expect(json.NewDecoder(&outBuffer).Decode(&entry)).To(Succeed())
+			Expect(entry).To(HaveKeyWithValue("job", "orders-import"))
+			Expect(entry).To(HaveKeyWithValue("taskIndex", 3.0))
+			Expect(entry).To(HaveKeyWithValue("taskAttempt", 1.0))
+		})
+	})
+	When("a job is run", func() {
+		It("should exit with 0 when it succeeds", func() {
+			Expect(toolkit.RunJob(checkpointed(func(ctx toolkit.FunctionContext) error { return nil }))).To(Equal(0))
+			Expect(checkpoints).To(Equal(0))
+		})
+		It("should checkpoint and exit with 1 when it fails", func() {
+			Expect(toolkit.RunJob(checkpointed(func(ctx toolkit.FunctionContext) error { return errors.New("database unavailable") }))).To(Equal(1))
+			Expect(checkpoints).To(Equal(1))
+			Expect(outBuffer.String()).To(ContainSubstring("Job task failed with exit code 1"))
+		})
+		It("should exit with the code of the error", func() {
+			Expect(toolkit.RunJob(func(ctx toolkit.FunctionContext) error {
+				return toolkit.WithExitCode(errors.New("invalid input file"), 3)
+			})).To(Equal(3))
+			Expect(toolkit.ExitCode(fmt.Errorf("stopped: %w", context.Canceled))).To(Equal(143))
+		})
+		It("should checkpoint and exit with 1 when it panics", func() {
+			Expect(toolkit.RunJob(checkpointed(func(ctx toolkit.FunctionContext) error { panic("nil map") }))).To(Equal(1))
+			Expect(checkpoints).To(Equal(1))
+			Expect(outBuffer.String()).To(ContainSubstring("Recovered from panic"))
+		})
+	})
+	When("the ctx wasn't created by JobCtx", func() {
+		It("should have no task", func() {
+			_, ok := toolkit.EventCtx(context.Background(), routedEvent("com.example.order.created", "//orders")).JobInfo()
+			Expect(ok).To(BeFalse())
+		})
+	})
+})
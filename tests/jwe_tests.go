@@ -0,0 +1,204 @@
+package toolkits
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+)
+
+// cbcToken encrypts the padded plaintext with A128CBC-HS256 and the shared-256 key, so tests control the padding and the header
+func cbcToken(header string, plaintext []byte, padding []byte) string {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	iv := make([]byte, aes.BlockSize)
+	block, _ := aes.NewCipher(key[16:])
+	ciphertext := append(append([]byte{}, plaintext...), padding...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, ciphertext)
+	aad := base64.RawURLEncoding.EncodeToString([]byte(header))
+	mac := hmac.New(sha256.New, key[:16])
+	mac.Write([]byte(aad))
+	mac.Write(iv)
+	mac.Write(ciphertext)
+	_ = binary.Write(mac, binary.BigEndian, uint64(len(aad)*8))
+	return aad + ".." + base64.RawURLEncoding.EncodeToString(iv) + "." + base64.RawURLEncoding.EncodeToString(ciphertext) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+var _ = Describe("JWE", func() {
+	var server *httptest.Server
+	var secrets map[string]string
+	var function, partner *toolkit.JWEConfig
+
+	privatePem := func(key *rsa.PrivateKey) string {
+		der, _ := x509.MarshalPKCS8PrivateKey(key)
+		return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	}
+	publicPem := func(key *rsa.PrivateKey) string {
+		der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	}
+	functionKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	partnerKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	BeforeEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+		secrets = map[string]string{
+			"function-private": privatePem(functionKey),
+			"function-public":  publicPem(functionKey),
+			"partner-private":  string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(partnerKey)})),
+			"partner-public":   publicPem(partnerKey),
+			"shared":           `{"kty":"oct","k":"GawgguFyGrWKav7AX4VKUg"}`,
+			"shared-256":       `{"kty":"oct","kid":"2024-06","k":"` + base64.RawURLEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef")) + `"}`,
+		}
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, "/token") {
+				_, _ = w.Write([]byte(`{"access_token":"test-token","expires_in":3600}`))
+				return
+			}
+			name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/projects/test-project/secrets/"), "/versions/latest:access")
+			secret, ok := secrets[name]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"payload": map[string]interface{}{"data": []byte(secret)}})
+		}))
+		os.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(server.URL, "http://"))
+		os.Setenv("GOOGLE_CLOUD_PROJECT", "test-project")
+		function = toolkit.NewJWEConfig("function-private", "partner-public")
+		function.Endpoint = server.URL
+		partner = toolkit.NewJWEConfig("partner-private", "function-public")
+		partner.Endpoint = server.URL
+	})
+	AfterEach(func() {
+		os.Unsetenv("GCE_METADATA_HOST")
+		server.Close()
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+
+	request := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r.Header.Set("Content-Type", toolkit.JWEContentType)
+		rr := httptest.NewRecorder()
+		toolkit.Chain(toolkit.RequireJWE(function)).Then(func(ctx toolkit.FunctionContext) error {
+			var order struct {
+				Id int `json:"id"`
+			}
+			if !ctx.BindJson(&order) {
+				return nil
+			}
+			ctx.OkResponseJWE(function, toolkit.Json{"id": order.Id, "status": "accepted"})
+			return nil
+		})(rr, r)
+		return rr
+	}
+	errorCode := func(rr *httptest.ResponseRecorder) string {
+		var body toolkit.ErrorResponseStruct
+		_ = json.Unmarshal(rr.Body.Bytes(), &body)
+		Expect(body.Details).To(HaveLen(1))
+		return body.Details[0].Code
+	}
+
+	It("should decrypt the RFC 7516 example", func() {
+		config := &toolkit.JWEConfig{DecryptionKey: "shared", KeyAlgorithms: []string{"A128KW"}, ContentAlgorithms: []string{"A128CBC-HS256"}, Endpoint: server.URL}
+		plaintext, err := config.Decrypt(context.Background(), "eyJhbGciOiJBMTI4S1ciLCJlbmMiOiJBMTI4Q0JDLUhTMjU2In0."+
+			"6KB707dM9YTIgHtLvtgWQ8mKwboJW3of9locizkDTHzBC2IlrT1oOQ.AxY8DCtDaGlsbGljb3RoZQ."+
+			"KDlTtXchhZTGufMYmOYGS4HffxPSUrfmqCHXaI9wOGY.U0m_YmjN04DJvceFICbCVQ")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(plaintext)).To(Equal("Live long and prosper."))
+	})
+	It("should decrypt requests and encrypt responses for the partner", func() {
+		encrypted, err := partner.Encrypt(context.Background(), []byte(`{"id":42}`))
+		Expect(err).NotTo(HaveOccurred())
+		rr := request(encrypted)
+		Expect(rr.Code).To(Equal(http.StatusOK))
+		Expect(rr.Header().Get("Content-Type")).To(Equal(toolkit.JWEContentType))
+		response, err := partner.Decrypt(context.Background(), rr.Body.String())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(response)).To(ContainSubstring(`"data":{"id":42,"status":"accepted"}`))
+	})
+	DescribeTable("should round trip every content algorithm",
+		func(keyAlgorithm string, contentAlgorithm string) {
+			config := &toolkit.JWEConfig{DecryptionKey: "shared-256", EncryptionKey: "shared-256", KeyAlgorithms: []string{keyAlgorithm}, ContentAlgorithms: []string{contentAlgorithm},
+				ResponseKeyAlgorithm: keyAlgorithm, ResponseContentAlgorithm: contentAlgorithm, Endpoint: server.URL}
+			encrypted, err := config.Encrypt(context.Background(), []byte("sixteen byte msg"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(encrypted).To(HavePrefix(base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"` + keyAlgorithm + `"`))))
+			plaintext, err := config.Decrypt(context.Background(), encrypted)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(plaintext)).To(Equal("sixteen byte msg"))
+		},
+		Entry("A256GCM with a wrapped key", "A256KW", "A256GCM"),
+		Entry("A128GCM with a wrapped key", "A256KW", "A128GCM"),
+		Entry("A128CBC-HS256 with a wrapped key", "A256KW", "A128CBC-HS256"),
+		Entry("A256CBC-HS512 with a wrapped key", "A256KW", "A256CBC-HS512"),
+		Entry("A256GCM with a direct key", "dir", "A256GCM"),
+	)
+	It("should reject algorithms which aren't allowed", func() {
+		partner.ResponseKeyAlgorithm = "RSA-OAEP"
+		encrypted, _ := partner.Encrypt(context.Background(), []byte(`{"id":42}`))
+		rr := request(encrypted)
+		Expect(rr.Code).To(Equal(http.StatusBadRequest))
+		Expect(errorCode(rr)).To(Equal("jwe.unsupported_algorithm"))
+		function.KeyAlgorithms = []string{"RSA-OAEP"}
+		Expect(request(encrypted).Code).To(Equal(http.StatusOK))
+	})
+	It("should reject payloads which can't be decrypted", func() {
+		encrypted, _ := partner.Encrypt(context.Background(), []byte(`{"id":42}`))
+		parts := strings.Split(encrypted, ".")
+		parts[3] = base64.RawURLEncoding.EncodeToString([]byte("tampered ciphertext"))
+		for _, body := range []string{strings.Join(parts, "."), `{"id":42}`} {
+			rr := request(body)
+			Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			Expect(errorCode(rr)).To(Equal("jwe.invalid"))
+		}
+		stranger := toolkit.NewJWEConfig("", "partner-public")
+		stranger.Endpoint = server.URL
+		encrypted, _ = stranger.Encrypt(context.Background(), []byte(`{"id":42}`))
+		Expect(request(encrypted).Code).To(Equal(http.StatusBadRequest))
+	})
+	It("should reject CBC payloads whose padding isn't uniform", func() {
+		config := &toolkit.JWEConfig{DecryptionKey: "shared-256", KeyAlgorithms: []string{"dir"}, ContentAlgorithms: []string{"A128CBC-HS256"}, Endpoint: server.URL}
+		plaintext, err := config.Decrypt(context.Background(), cbcToken(`{"alg":"dir","enc":"A128CBC-HS256"}`, []byte("fourteen bytes"), []byte{2, 2}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(plaintext)).To(Equal("fourteen bytes"))
+		_, err = config.Decrypt(context.Background(), cbcToken(`{"alg":"dir","enc":"A128CBC-HS256"}`, []byte("thirteen byte"), []byte{1, 9, 3}))
+		Expect(err).To(MatchError("invalid padding"))
+	})
+	It("should set the Content-Type of the request from the cty header", func() {
+		config := &toolkit.JWEConfig{DecryptionKey: "shared-256", KeyAlgorithms: []string{"dir"}, ContentAlgorithms: []string{"A128CBC-HS256"}, Endpoint: server.URL}
+		for cty, contentType := range map[string]string{"": "application/json; charset=utf-8", "text/csv": "text/csv", "jwt": "application/jwt"} {
+			header := `{"alg":"dir","enc":"A128CBC-HS256"}`
+			if cty != "" {
+				header = `{"alg":"dir","enc":"A128CBC-HS256","cty":"` + cty + `"}`
+			}
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(cbcToken(header, []byte("fourteen bytes"), []byte{2, 2})))
+			var received string
+			toolkit.Chain(toolkit.RequireJWE(config)).Then(func(ctx toolkit.FunctionContext) error {
+				received = ctx.Request.Header.Get("Content-Type")
+				return nil
+			})(httptest.NewRecorder(), r)
+			Expect(received).To(Equal(contentType))
+		}
+	})
+	It("should respond with a 503 status when the keys can't be read", func() {
+		delete(secrets, "function-private")
+		encrypted, _ := partner.Encrypt(context.Background(), []byte(`{"id":42}`))
+		Expect(request(encrypted).Code).To(Equal(http.StatusServiceUnavailable))
+	})
+})
@@ -0,0 +1,166 @@
+package toolkits
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var _ = Describe("RequireJWT", func() {
+	var server *httptest.Server
+	var fetches atomic.Int32
+	var handler http.HandlerFunc
+	var claims map[string]interface{}
+	var received map[string]interface{}
+	var principal toolkit.Principal
+
+	BeforeEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+		keys := keysServer()
+		fetches.Store(0)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fetches.Add(1)
+			w.Header().Set("Cache-Control", "public, max-age=600")
+			keys.Config.Handler.ServeHTTP(w, r)
+		}))
+		DeferCleanup(keys.Close)
+		received = nil
+		handler = toolkit.Chain(toolkit.RequireJWT(toolkit.JWTConfig{
+			KeysUrl:  server.URL,
+			Issuers:  []string{"https://auth.example.com/"},
+			Audience: "orders-api",
+		})).Then(func(ctx toolkit.FunctionContext) error {
+			received, _ = ctx.Claims()
+			principal, _ = ctx.Principal()
+			return nil
+		})
+		claims = map[string]interface{}{
+			"iss": "https://auth.example.com/",
+			"aud": []string{"orders-api", "billing-api"},
+			"sub": "user-7",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+	})
+	AfterEach(func() {
+		server.Close()
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+
+	request := func(token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, r)
+		return rr
+	}
+
+	When("the token is valid", func() {
+		It("should expose its claims and principal", func() {
+			Expect(request(signToken(claims)).Code).To(Equal(http.StatusOK))
+			Expect(received).To(HaveKeyWithValue("sub", "user-7"))
+			Expect(principal.Id).To(Equal("user-7"))
+		})
+		It("should cache the keys", func() {
+			Expect(request(signToken(claims)).Code).To(Equal(http.StatusOK))
+			Expect(request(signToken(claims)).Code).To(Equal(http.StatusOK))
+			Expect(fetches.Load()).To(Equal(int32(1)))
+		})
+	})
+	When("the token is signed with ES256", func() {
+		It("should verify it with the EC key", func() {
+			key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			ecServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+					"kid": "ec-key",
+					"kty": "EC",
+					"crv": "P-256",
+					"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+					"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+				}}})
+			}))
+			defer ecServer.Close()
+			handler = toolkit.Chain(toolkit.RequireJWT(toolkit.JWTConfig{KeysUrl: ecServer.URL, Issuers: []string{"https://auth.example.com/"}, Audience: "orders-api"})).Then(func(ctx toolkit.FunctionContext) error {
+				received, _ = ctx.Claims()
+				return nil
+			})
+
+			header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": "ec-key"})
+			payload, _ := json.Marshal(claims)
+			unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+			digest := sha256.Sum256([]byte(unsigned))
+			r, s, _ := ecdsa.Sign(rand.Reader, key, digest[:])
+			signature := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+			Expect(request(unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)).Code).To(Equal(http.StatusOK))
+			Expect(received).To(HaveKeyWithValue("sub", "user-7"))
+		})
+	})
+	When("the key set can't be fetched", func() {
+		It("should not fetch it again for every request", func() {
+			var failures atomic.Int32
+			failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				failures.Add(1)
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer failing.Close()
+			handler = toolkit.Chain(toolkit.RequireJWT(toolkit.JWTConfig{KeysUrl: failing.URL, Issuers: []string{"https://auth.example.com/"}, Audience: "orders-api"})).
+				Then(func(ctx toolkit.FunctionContext) error { return nil })
+			Expect(request(signToken(claims)).Code).To(Equal(http.StatusUnauthorized))
+			Expect(request(signToken(claims)).Code).To(Equal(http.StatusUnauthorized))
+			Expect(failures.Load()).To(Equal(int32(1)))
+		})
+	})
+	When("the issuers or audience aren't configured", func() {
+		It("should panic", func() {
+			Expect(func() { toolkit.RequireJWT(toolkit.JWTConfig{KeysUrl: server.URL, Audience: "orders-api"}) }).To(Panic())
+			Expect(func() {
+				toolkit.RequireJWT(toolkit.JWTConfig{KeysUrl: server.URL, Issuers: []string{"https://auth.example.com/"}})
+			}).To(Panic())
+		})
+	})
+	When("the token is missing", func() {
+		It("should respond with a 401 status and a challenge", func() {
+			rr := request("")
+			Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+			Expect(rr.Header().Get("WWW-Authenticate")).To(Equal("Bearer"))
+			Expect(received).To(BeNil())
+		})
+	})
+	When("the token is invalid", func() {
+		It("should reject expired tokens", func() {
+			claims["exp"] = time.Now().Add(-time.Hour).Unix()
+			rr := request(signToken(claims))
+			Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+			Expect(rr.Header().Get("WWW-Authenticate")).To(ContainSubstring("invalid_token"))
+		})
+		It("should reject other issuers", func() {
+			claims["iss"] = "https://evil.example.com/"
+			Expect(request(signToken(claims)).Code).To(Equal(http.StatusUnauthorized))
+		})
+		It("should reject other audiences", func() {
+			claims["aud"] = "billing-api"
+			Expect(request(signToken(claims)).Code).To(Equal(http.StatusUnauthorized))
+		})
+		It("should reject tampered tokens", func() {
+			parts := strings.Split(signToken(claims), ".")
+			claims["sub"] = "admin"
+			payload, _ := json.Marshal(claims)
+			parts[1] = base64.RawURLEncoding.EncodeToString(payload)
+			Expect(request(strings.Join(parts, ".")).Code).To(Equal(http.StatusUnauthorized))
+			Expect(received).To(BeNil())
+		})
+	})
+})
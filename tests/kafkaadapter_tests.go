@@ -0,0 +1,168 @@
+package toolkits
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	toolkit "github.com/Platform48/function_toolkit"
+	"github.com/Platform48/function_toolkit/kafkaadapter"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"time"
+)
+
+var _ = Describe("Kafka adapter", func() {
+	var logs bytes.Buffer
+	var handled []kafkaadapter.Record
+	var deadLettered []kafkaadapter.Record
+	var handler kafkaadapter.HandlerFunc
+	var deadLetter kafkaadapter.DeadLetterFunc
+
+	BeforeEach(func() {
+		logs.Reset()
+		toolkit.Configure(toolkit.WithLogWriter(&logs))
+		handled, deadLettered = nil, nil
+		handler = func(ctx toolkit.FunctionContext, record kafkaadapter.Record) error {
+			handled = append(handled, record)
+			switch string(record.Value) {
+			case "invalid":
+				return toolkit.BadRequest("Invalid order")
+			case "unavailable":
+				return errors.New("database unavailable")
+			case "panic":
+				panic("boom")
+			}
+			return nil
+		}
+		deadLetter = func(ctx toolkit.FunctionContext, record kafkaadapter.Record, err error) error {
+			deadLettered = append(deadLettered, record)
+			return nil
+		}
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+
+	deliver := func(body string, headers map[string]string) int {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		for name, value := range headers {
+			r.Header.Set(name, value)
+		}
+		rr := httptest.NewRecorder()
+		kafkaadapter.HandlerWithDeadLetter(handler, deadLetter)(rr, r)
+		return rr.Code
+	}
+
+	When("a KafkaSource delivers a record", func() {
+		It("should read the record from the CloudEvent", func() {
+			status := deliver(`{"orderId":"o-1"}`, map[string]string{
+				"Ce-Type":              "dev.knative.kafka.event",
+				"Ce-Source":            "/apis/v1/namespaces/default/kafkasources/orders-source#orders",
+				"Ce-Time":              "2024-05-01T10:00:00Z",
+				"Ce-Partition":         "3",
+				"Ce-Offset":            "42",
+				"Ce-Key":               "customer-7",
+				"Ce-Kafkaheadertenant": "acme",
+			})
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(handled).To(HaveLen(1))
+			Expect(handled[0].Topic).To(Equal("orders"))
+			Expect(handled[0].Partition).To(Equal(int32(3)))
+			Expect(handled[0].Offset).To(Equal(int64(42)))
+			Expect(string(handled[0].Key)).To(Equal("customer-7"))
+			Expect(handled[0].Headers).To(Equal(map[string]string{"tenant": "acme"}))
+			Expect(handled[0].Timestamp).To(Equal(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)))
+			var order map[string]string
+			Expect(handled[0].Bind(&order)).To(Succeed())
+			Expect(order).To(Equal(map[string]string{"orderId": "o-1"}))
+			Expect(logs.String()).To(ContainSubstring(`"offset":42`))
+		})
+	})
+	When("the HTTP Sink connector delivers a batch", func() {
+		It("should handle every record of the batch", func() {
+			status := deliver(`[
+				{"topic":"orders","partition":1,"offset":7,"key":"k-1","value":{"orderId":"o-1"},"timestamp":1714557600000},
+				{"topic":"orders","partition":1,"offset":8,"key":null,"value":"plain text","headers":{"tenant":"acme"}}
+			]`, nil)
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(handled).To(HaveLen(2))
+			Expect(string(handled[0].Value)).To(Equal(`{"orderId":"o-1"}`))
+			Expect(string(handled[0].Key)).To(Equal("k-1"))
+			Expect(handled[0].Timestamp).To(Equal(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)))
+			Expect(string(handled[1].Value)).To(Equal("plain text"))
+			Expect(handled[1].Key).To(BeNil())
+			Expect(handled[1].Headers).To(Equal(map[string]string{"tenant": "acme"}))
+		})
+		It("should read plain values with the fields added by the InsertField transform", func() {
+			Expect(deliver(`[{"orderId":"o-1","topic":"orders","partition":2,"offset":9}]`, nil)).To(Equal(http.StatusOK))
+			Expect(handled[0].Offset).To(Equal(int64(9)))
+			Expect(string(handled[0].Value)).To(Equal(`{"orderId":"o-1","topic":"orders","partition":2,"offset":9}`))
+		})
+		It("should reject invalid deliveries", func() {
+			Expect(deliver(`[{`, nil)).To(Equal(http.StatusBadRequest))
+			Expect(handled).To(BeEmpty())
+		})
+	})
+	When("a record can't be processed", func() {
+		It("should dead-letter it and continue with the batch", func() {
+			status := deliver(`[{"offset":1,"value":"invalid"},{"offset":2,"value":{"ok":true}}]`, nil)
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(handled).To(HaveLen(2))
+			Expect(deadLettered).To(HaveLen(1))
+			Expect(deadLettered[0].Offset).To(Equal(int64(1)))
+		})
+		It("should drop it without a dead letter function", func() {
+			deadLetter = nil
+			Expect(deliver(`[{"offset":1,"value":"invalid"}]`, nil)).To(Equal(http.StatusOK))
+			Expect(logs.String()).To(ContainSubstring("Dropping Kafka record"))
+		})
+		It("should fail the delivery if dead-lettering fails", func() {
+			deadLetter = func(ctx toolkit.FunctionContext, record kafkaadapter.Record, err error) error {
+				return errors.New("topic not found")
+			}
+			Expect(deliver(`[{"offset":1,"value":"invalid"}]`, nil)).To(Equal(http.StatusInternalServerError))
+		})
+	})
+	When("a record fails with a retryable error", func() {
+		It("should fail the delivery without processing the later records", func() {
+			status := deliver(`[{"offset":1,"value":"unavailable"},{"offset":2,"value":{"ok":true}}]`, nil)
+			Expect(status).To(Equal(http.StatusInternalServerError))
+			Expect(handled).To(HaveLen(1))
+			Expect(deadLettered).To(BeEmpty())
+		})
+		It("should fail the delivery when the handler panics", func() {
+			Expect(deliver(`[{"offset":1,"value":"panic"}]`, nil)).To(Equal(http.StatusInternalServerError))
+		})
+	})
+	When("records are dead-lettered to Pub/Sub", func() {
+		It("should publish them with their metadata as attributes", func() {
+			var published map[string]interface{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasSuffix(r.URL.Path, "/token") {
+					_, _ = w.Write([]byte(`{"access_token":"test-token","expires_in":3600}`))
+					return
+				}
+				_ = json.NewDecoder(r.Body).Decode(&published)
+				_, _ = w.Write([]byte(`{"messageIds":["1"]}`))
+			}))
+			defer server.Close()
+			os.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(server.URL, "http://"))
+			os.Setenv("GOOGLE_CLOUD_PROJECT", "test-project")
+			defer os.Unsetenv("GCE_METADATA_HOST")
+			publisher := toolkit.NewPublisher("orders-dead-letter")
+			publisher.Endpoint = server.URL
+			deadLetter = kafkaadapter.PublishDeadLetter(publisher)
+
+			Expect(deliver(`[{"topic":"orders","partition":1,"offset":5,"key":"k-1","value":"invalid"}]`, nil)).To(Equal(http.StatusOK))
+			message := published["messages"].([]interface{})[0].(map[string]interface{})
+			Expect(message["attributes"]).To(HaveKeyWithValue("kafkaTopic", "orders"))
+			Expect(message["attributes"]).To(HaveKeyWithValue("kafkaOffset", "5"))
+			Expect(message["attributes"]).To(HaveKeyWithValue("kafkaKey", "k-1"))
+			Expect(message["attributes"]).To(HaveKeyWithValue("error", ContainSubstring("Invalid order")))
+		})
+	})
+})
@@ -0,0 +1,155 @@
+package toolkits
+
+import (
+	"bytes"
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var _ = Describe("Encrypter", func() {
+	const key = "projects/test-project/locations/europe-west1/keyRings/payments/cryptoKeys/cards"
+	var server *httptest.Server
+	var calls []string
+	var callsMutex sync.Mutex
+	var delay atomic.Int64
+	var encrypter *toolkit.Encrypter
+	var ctx toolkit.FunctionContext
+
+	BeforeEach(func() {
+		calls = nil
+		delay.Store(0)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, "/token") {
+				_, _ = w.Write([]byte(`{"access_token":"test-token","expires_in":3600}`))
+				return
+			}
+			callsMutex.Lock()
+			calls = append(calls, r.URL.Path)
+			callsMutex.Unlock()
+			time.Sleep(time.Duration(delay.Load()))
+			var request struct {
+				Plaintext  []byte `json:"plaintext"`
+				Ciphertext []byte `json:"ciphertext"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&request)
+			// The fake KMS key wraps data keys by prefixing them
+			switch {
+			case strings.Contains(r.URL.Path, "missing"):
+				w.WriteHeader(http.StatusNotFound)
+			case strings.HasSuffix(r.URL.Path, ":encrypt"):
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"name": key + "/cryptoKeyVersions/1", "ciphertext": append([]byte("wrapped:"), request.Plaintext...)})
+			case strings.HasSuffix(r.URL.Path, ":decrypt") && bytes.HasPrefix(request.Ciphertext, []byte("wrapped:")):
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"plaintext": bytes.TrimPrefix(request.Ciphertext, []byte("wrapped:"))})
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		}))
+		os.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(server.URL, "http://"))
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+		encrypter = toolkit.NewEncrypter(key)
+		encrypter.Endpoint = server.URL
+		ctx = toolkit.FuncCtx(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+	AfterEach(func() {
+		os.Unsetenv("GCE_METADATA_HOST")
+		server.Close()
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+
+	It("should decrypt what it encrypted", func() {
+		ciphertext, err := encrypter.Encrypt(ctx, []byte("4242 4242 4242 4242"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(ciphertext)).NotTo(ContainSubstring("4242"))
+		plaintext, err := encrypter.Decrypt(ctx, ciphertext)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(plaintext)).To(Equal("4242 4242 4242 4242"))
+	})
+	It("should reuse the data key instead of calling KMS for every payload", func() {
+		first, _ := encrypter.Encrypt(ctx, []byte("first"))
+		second, _ := encrypter.Encrypt(ctx, []byte("second"))
+		Expect(first).NotTo(Equal(second))
+		_, _ = encrypter.Decrypt(ctx, first)
+		_, _ = encrypter.Decrypt(ctx, second)
+		Expect(calls).To(Equal([]string{"/v1/" + key + ":encrypt"}))
+	})
+	It("should decrypt the data keys of other instances with KMS once", func() {
+		other := toolkit.NewEncrypter(key)
+		other.Endpoint = server.URL
+		ciphertext, _ := other.Encrypt(ctx, []byte("payload"))
+		for i := 0; i < 2; i++ {
+			plaintext, err := encrypter.Decrypt(ctx, ciphertext)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(plaintext)).To(Equal("payload"))
+		}
+		Expect(calls).To(Equal([]string{"/v1/" + key + ":encrypt", "/v1/" + key + ":decrypt"}))
+	})
+	It("should generate a new data key once it expires", func() {
+		encrypter.KeyLifetime = time.Millisecond
+		_, _ = encrypter.Encrypt(ctx, []byte("first"))
+		time.Sleep(2 * time.Millisecond)
+		_, _ = encrypter.Encrypt(ctx, []byte("second"))
+		Expect(calls).To(HaveLen(2))
+	})
+	It("should reject tampered ciphertexts and ciphertexts of other keys", func() {
+		ciphertext, _ := encrypter.Encrypt(ctx, []byte("payload"))
+		var payload map[string]interface{}
+		Expect(json.Unmarshal(ciphertext, &payload)).To(Succeed())
+		payload["nonce"] = "AAAAAAAAAAAAAAAA"
+		tampered, _ := json.Marshal(payload)
+		_, err := encrypter.Decrypt(ctx, tampered)
+		Expect(err).To(HaveOccurred())
+		other := toolkit.NewEncrypter("projects/test-project/locations/europe-west1/keyRings/payments/cryptoKeys/other")
+		_, err = other.Decrypt(ctx, ciphertext)
+		Expect(err).To(MatchError(ContainSubstring("was encrypted with")))
+		_, err = encrypter.Decrypt(ctx, []byte("not a ciphertext"))
+		Expect(err).To(HaveOccurred())
+	})
+	It("should only decrypt ciphertexts of the expected key", func() {
+		ciphertext, _ := encrypter.Encrypt(ctx, []byte("payload"))
+		calls = nil
+		_, err := toolkit.Decrypt(ctx, "locations/europe-west1/keyRings/payments/cryptoKeys/other", ciphertext)
+		Expect(err).To(MatchError(ContainSubstring("was encrypted with " + key)))
+		Expect(calls).To(BeEmpty())
+	})
+	It("should share concurrent KMS calls without blocking the cached data keys", func() {
+		other := toolkit.NewEncrypter(key)
+		other.Endpoint = server.URL
+		ciphertext, _ := other.Encrypt(ctx, []byte("payload"))
+		cached, _ := encrypter.Encrypt(ctx, []byte("cached"))
+		delay.Store(int64(300 * time.Millisecond))
+		var wg sync.WaitGroup
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				plaintext, err := encrypter.Decrypt(ctx, ciphertext)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(plaintext)).To(Equal("payload"))
+			}()
+		}
+		time.Sleep(50 * time.Millisecond)
+		start := time.Now()
+		plaintext, err := encrypter.Decrypt(ctx, cached)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(plaintext)).To(Equal("cached"))
+		Expect(time.Since(start)).To(BeNumerically("<", 100*time.Millisecond))
+		wg.Wait()
+		Expect(calls).To(Equal([]string{"/v1/" + key + ":encrypt", "/v1/" + key + ":encrypt", "/v1/" + key + ":decrypt"}))
+	})
+	It("should return the error of KMS", func() {
+		encrypter.Key += "-missing"
+		_, err := encrypter.Encrypt(ctx, []byte("payload"))
+		Expect(err).To(HaveOccurred())
+	})
+})
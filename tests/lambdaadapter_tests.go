@@ -0,0 +1,101 @@
+package toolkits
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	"github.com/Platform48/function_toolkit/lambdaadapter"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+)
+
+var _ = Describe("Lambda adapter", func() {
+	var handler func(ctx context.Context, request lambdaadapter.Request) (lambdaadapter.Response, error)
+	var received *http.Request
+	var body []byte
+
+	BeforeEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+		handler = lambdaadapter.Handler(toolkit.Handle(func(ctx toolkit.FunctionContext) error {
+			received = ctx.Request
+			body, _ = io.ReadAll(ctx.Request.Body)
+			http.SetCookie(ctx.Response, &http.Cookie{Name: "session", Value: "abc"})
+			ctx.CreatedResponse("/orders/o-1", toolkit.Json{"requestId": ctx.RequestId})
+			return nil
+		}))
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+	decode := func(event string) lambdaadapter.Request {
+		var request lambdaadapter.Request
+		Expect(json.Unmarshal([]byte(event), &request)).To(Succeed())
+		return request
+	}
+	When("a Function URL or HTTP API request is handled", func() {
+		It("should convert the request and return the response in the 2.0 format", func() {
+			response, err := handler(context.Background(), decode(`{
+				"version": "2.0",
+				"rawPath": "/orders",
+				"rawQueryString": "dryRun=true",
+				"cookies": ["theme=dark"],
+				"headers": {"content-type": "application/json", "host": "abc.lambda-url.eu-west-1.on.aws"},
+				"body": "eyJ0b3RhbCI6MTI1MH0=",
+				"isBase64Encoded": true,
+				"requestContext": {"requestId": "c6af9ac6-7b61", "http": {"method": "POST", "sourceIp": "203.0.113.7"}}
+			}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(received.Method).To(Equal(http.MethodPost))
+			Expect(received.URL.Path).To(Equal("/orders"))
+			Expect(received.URL.Query().Get("dryRun")).To(Equal("true"))
+			Expect(received.Host).To(Equal("abc.lambda-url.eu-west-1.on.aws"))
+			Expect(received.Cookie("theme")).To(HaveField("Value", "dark"))
+			Expect(body).To(MatchJSON(`{"total":1250}`))
+
+			Expect(response.StatusCode).To(Equal(http.StatusCreated))
+			Expect(response.Headers).To(HaveKeyWithValue("Location", "/orders/o-1"))
+			Expect(response.Cookies).To(ConsistOf(HavePrefix("session=abc")))
+			Expect(response.IsBase64Encoded).To(BeFalse())
+			Expect(response.Body).To(ContainSubstring(`"requestId":"c6af9ac6-7b61"`))
+		})
+	})
+	When("a REST API request is handled", func() {
+		It("should return the response in the 1.0 format", func() {
+			response, err := handler(context.Background(), decode(`{
+				"httpMethod": "PUT",
+				"path": "/orders/o-1",
+				"multiValueHeaders": {"X-Tag": ["a", "b"]},
+				"multiValueQueryStringParameters": {"expand": ["items", "customer"]},
+				"body": "{}",
+				"requestContext": {"requestId": "rest-1", "identity": {"sourceIp": "203.0.113.7"}}
+			}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(received.Method).To(Equal(http.MethodPut))
+			Expect(received.Header.Values("X-Tag")).To(Equal([]string{"a", "b"}))
+			Expect(received.URL.Query()["expand"]).To(Equal([]string{"items", "customer"}))
+			Expect(response.MultiValueHeaders).To(HaveKeyWithValue("Set-Cookie", ConsistOf(HavePrefix("session=abc"))))
+			Expect(response.Headers).To(BeEmpty())
+		})
+	})
+	When("the response isn't text", func() {
+		It("should base64 encode it", func() {
+			handler = lambdaadapter.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "image/png")
+				_, _ = w.Write([]byte{0x89, 'P', 'N', 'G'})
+			}))
+			response, err := handler(context.Background(), decode(`{"version": "2.0", "rawPath": "/logo.png", "requestContext": {"http": {"method": "GET"}}}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(response.IsBase64Encoded).To(BeTrue())
+			Expect(response.Body).To(Equal(base64.StdEncoding.EncodeToString([]byte{0x89, 'P', 'N', 'G'})))
+		})
+	})
+	When("the event isn't an http request", func() {
+		It("should fail", func() {
+			_, err := handler(context.Background(), decode(`{"Records": []}`))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,59 @@
+package toolkits
+
+import (
+	"bytes"
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("Lazy logging", func() {
+	var ctx toolkit.FunctionContext
+	var outBuffer bytes.Buffer
+
+	withLevel := func(level zerolog.Level) {
+		logger := ctx.Logger.Output(&outBuffer).Level(level)
+		ctx.Logger = &logger
+	}
+
+	BeforeEach(func() {
+		ctx = toolkit.FuncCtx(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		outBuffer.Reset()
+	})
+	When("the level is disabled", func() {
+		It("should not build the message", func() {
+			withLevel(zerolog.InfoLevel)
+			called := false
+			ctx.DebugFn(func() string {
+				called = true
+				return "dump"
+			})
+			Expect(called).To(BeFalse())
+			Expect(outBuffer.String()).To(BeEmpty())
+			ctx.DebugEvent().Str("payload", "big").Msg("dump")
+			Expect(outBuffer.String()).To(BeEmpty())
+		})
+	})
+	When("the level is enabled", func() {
+		It("should log the built message", func() {
+			withLevel(zerolog.DebugLevel)
+			ctx.DebugFn(func() string { return "dump" })
+			var entry map[string]interface{}
+			Expect(json.Unmarshal(outBuffer.Bytes(), &entry)).To(Succeed())
+			Expect(entry["message"]).To(Equal("dump"))
+			Expect(entry["caller"]).To(ContainSubstring("lazylog_tests.go"))
+		})
+		It("should log events with their fields", func() {
+			withLevel(zerolog.DebugLevel)
+			ctx.InfoEvent().Int("count", 3).Msg("Loaded")
+			var entry map[string]interface{}
+			Expect(json.Unmarshal(outBuffer.Bytes(), &entry)).To(Succeed())
+			Expect(entry["count"]).To(Equal(3.0))
+			Expect(entry["caller"]).To(ContainSubstring("lazylog_tests.go"))
+		})
+	})
+})
@@ -0,0 +1,75 @@
+package toolkits
+
+import (
+	"errors"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+)
+
+var _ = Describe("Log buffering", func() {
+	var stdout *os.File
+	var output *os.File
+
+	newCtx := func() toolkit.FunctionContext {
+		return toolkit.FuncCtx(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	written := func() string {
+		data, err := os.ReadFile(output.Name())
+		Expect(err).NotTo(HaveOccurred())
+		return string(data)
+	}
+
+	BeforeEach(func() {
+		var err error
+		output, err = os.CreateTemp("", "logs")
+		Expect(err).NotTo(HaveOccurred())
+		stdout = os.Stdout
+		os.Stdout = output
+		toolkit.Configure(toolkit.WithLogBuffering(toolkit.LogBuffering{LatencyThreshold: time.Hour}))
+	})
+	AfterEach(func() {
+		os.Stdout = stdout
+		_ = output.Close()
+		_ = os.Remove(output.Name())
+		toolkit.Configure(toolkit.WithoutLogBuffering())
+	})
+	When("the request succeeds", func() {
+		It("should only write a summary line", func() {
+			ctx := newCtx()
+			ctx.Info("Loading user")
+			Expect(written()).To(BeEmpty())
+			ctx.NoContentResponse()
+			Expect(written()).NotTo(ContainSubstring("Loading user"))
+			Expect(written()).To(ContainSubstring("buffered log entries were not written"))
+		})
+		It("should write WARN messages immediately", func() {
+			ctx := newCtx()
+			ctx.Warn("Cache miss")
+			Expect(written()).To(ContainSubstring("Cache miss"))
+		})
+	})
+	When("the request fails", func() {
+		It("should write the buffered messages", func() {
+			ctx := newCtx()
+			ctx.Info("Loading user")
+			ctx.ErrResponse(http.StatusBadGateway, errors.New("timeout"), "Failed to load user")
+			Expect(written()).To(ContainSubstring("Loading user"))
+			Expect(written()).NotTo(ContainSubstring("buffered log entries"))
+		})
+	})
+	When("an ERROR message is logged", func() {
+		It("should write the buffered messages straight away", func() {
+			ctx := newCtx()
+			ctx.Debug("Loading user")
+			ctx.Error("Database unavailable")
+			Expect(written()).To(ContainSubstring("Loading user"))
+			ctx.Info("Retrying")
+			Expect(written()).To(ContainSubstring("Retrying"))
+		})
+	})
+})
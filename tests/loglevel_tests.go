@@ -0,0 +1,81 @@
+package toolkits
+
+import (
+	"bytes"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("LogLevelHandler", func() {
+	var handler http.Handler
+
+	call := func(method string, target string, token string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		rq := httptest.NewRequest(method, target, nil)
+		if token != "" {
+			rq.Header.Set("Authorization", "Bearer "+token)
+		}
+		handler.ServeHTTP(rr, rq)
+		return rr
+	}
+
+	BeforeEach(func() {
+		handler = toolkit.LogLevelHandler("secret")
+	})
+	AfterEach(func() {
+		zerolog.SetGlobalLevel(zerolog.TraceLevel)
+	})
+	When("the token is missing or wrong", func() {
+		It("should refuse the request", func() {
+			Expect(call(http.MethodGet, "/", "").Code).To(Equal(http.StatusUnauthorized))
+			Expect(call(http.MethodPost, "/?level=error", "wrong").Code).To(Equal(http.StatusUnauthorized))
+			Expect(zerolog.GlobalLevel()).To(Equal(zerolog.TraceLevel))
+		})
+	})
+	When("the Authorization header has no Bearer scheme", func() {
+		It("should refuse the request", func() {
+			for _, authorization := range []string{"secret", "Basic secret", "Bearersecret"} {
+				rr := httptest.NewRecorder()
+				rq := httptest.NewRequest(http.MethodGet, "/", nil)
+				rq.Header.Set("Authorization", authorization)
+				handler.ServeHTTP(rr, rq)
+				Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+			}
+			rr := httptest.NewRecorder()
+			rq := httptest.NewRequest(http.MethodGet, "/", nil)
+			rq.Header.Set("Authorization", "bearer secret")
+			handler.ServeHTTP(rr, rq)
+			Expect(rr.Code).To(Equal(http.StatusOK))
+		})
+	})
+	When("the level is changed", func() {
+		It("should apply to running loggers", func() {
+			ctx := toolkit.FuncCtx(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+			var outBuffer bytes.Buffer
+			logger := ctx.Logger.Output(&outBuffer)
+			ctx.Logger = &logger
+
+			rr := call(http.MethodPost, "/?level=warning", "secret")
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(rr.Body.String()).To(ContainSubstring(`"level":"warn"`))
+
+			ctx.Info("hidden")
+			Expect(outBuffer.String()).To(BeEmpty())
+			ctx.Warn("shown")
+			Expect(outBuffer.String()).To(ContainSubstring("shown"))
+		})
+		It("should reject unknown levels", func() {
+			Expect(call(http.MethodPost, "/?level=loud", "secret").Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+	When("the level is set in code", func() {
+		It("should change the global level", func() {
+			toolkit.SetLogLevel(toolkit.LogLevelError)
+			Expect(zerolog.GlobalLevel()).To(Equal(zerolog.ErrorLevel))
+		})
+	})
+})
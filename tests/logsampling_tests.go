@@ -0,0 +1,63 @@
+package toolkits
+
+import (
+	"bytes"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+var _ = Describe("Log sampling", func() {
+	var outBuffer bytes.Buffer
+
+	newCtx := func() toolkit.FunctionContext {
+		ctx := toolkit.FuncCtx(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		logger := ctx.Logger.Output(&outBuffer).Level(zerolog.DebugLevel)
+		ctx.Logger = &logger
+		return ctx
+	}
+	lines := func() int {
+		return strings.Count(outBuffer.String(), "\n")
+	}
+
+	BeforeEach(func() {
+		outBuffer.Reset()
+		toolkit.Configure(toolkit.WithLogSampling(toolkit.LogSampling{DebugEvery: 3, WarnBurst: 2}))
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithoutLogSampling())
+	})
+	When("DEBUG messages are sampled", func() {
+		It("should keep one in every N messages across requests", func() {
+			for i := 0; i < 3; i++ {
+				ctx := newCtx()
+				ctx.Debug("first")
+				ctx.Debug("second")
+			}
+			Expect(lines()).To(Equal(2))
+		})
+	})
+	When("the same WARN message is repeated", func() {
+		It("should only write it WarnBurst times", func() {
+			ctx := newCtx()
+			for i := 0; i < 5; i++ {
+				ctx.Warn("Cache miss")
+			}
+			ctx.Warn("Slow query")
+			Expect(lines()).To(Equal(3))
+		})
+	})
+	When("ERROR messages are logged", func() {
+		It("should never drop them", func() {
+			ctx := newCtx()
+			for i := 0; i < 5; i++ {
+				ctx.Error("Failed")
+			}
+			Expect(lines()).To(Equal(5))
+		})
+	})
+})
@@ -0,0 +1,38 @@
+package toolkits
+
+import (
+	"bytes"
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("WithLogWriter", func() {
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+	When("a writer is set", func() {
+		It("should write the logs to it as json", func() {
+			var outBuffer bytes.Buffer
+			toolkit.Configure(toolkit.WithLogWriter(&outBuffer))
+			ctx := toolkit.FuncCtx(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+			ctx.Info("Hello")
+			var entry map[string]interface{}
+			Expect(json.Unmarshal(outBuffer.Bytes(), &entry)).To(Succeed())
+			Expect(entry["message"]).To(Equal("Hello"))
+			Expect(entry["spanId"]).To(Equal("[" + ctx.SpanId + "]"))
+		})
+	})
+	When("several writers are set", func() {
+		It("should write every entry to each of them", func() {
+			var first, second bytes.Buffer
+			toolkit.Configure(toolkit.WithLogWriter(&first, &second))
+			toolkit.FuncCtx(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil)).Warn("Hello")
+			Expect(first.String()).To(ContainSubstring("Hello"))
+			Expect(second.String()).To(Equal(first.String()))
+		})
+	})
+})
@@ -0,0 +1,48 @@
+package toolkits
+
+import (
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+	"testing/fstest"
+)
+
+var _ = Describe("Localized messages", func() {
+	var rr *httptest.ResponseRecorder
+	var rq *http.Request
+
+	BeforeEach(func() {
+		Expect(toolkit.LoadMessages(fstest.MapFS{
+			"en.json": {Data: []byte(`{"order.not_found": "Order not found", "email.invalid": "Invalid email"}`)},
+			"pt.json": {Data: []byte(`{"order.not_found": "Pedido não encontrado"}`)},
+		}, "en")).To(Succeed())
+		rr = httptest.NewRecorder()
+		rq = httptest.NewRequest(http.MethodGet, "/", nil)
+	})
+	AfterEach(func() {
+		Expect(toolkit.LoadMessages(fstest.MapFS{}, "")).To(Succeed())
+	})
+	When("the client prefers a language in the catalog", func() {
+		It("should translate the error message", func() {
+			rq.Header.Set("Accept-Language", "de;q=0.9, pt-BR, en;q=0.5")
+			toolkit.FuncCtx(rr, rq).FailResponse(http.StatusNotFound, "order.not_found")
+			Expect(rr.Body.String()).To(ContainSubstring("Pedido não encontrado"))
+			Expect(rr.Header().Get("Content-Language")).To(Equal("pt"))
+		})
+		It("should fall back to the default language for missing messages", func() {
+			rq.Header.Set("Accept-Language", "pt")
+			toolkit.FuncCtx(rr, rq).ErrResponseDetails(http.StatusBadRequest, nil, "order.not_found", []toolkit.ErrorDetail{{Field: "email", Message: "email.invalid"}})
+			Expect(rr.Body.String()).To(ContainSubstring("Invalid email"))
+		})
+	})
+	When("the client doesn't send Accept-Language", func() {
+		It("should use the default language", func() {
+			ctx := toolkit.FuncCtx(rr, rq)
+			Expect(ctx.Language()).To(Equal("en"))
+			Expect(ctx.T("order.not_found")).To(Equal("Order not found"))
+			Expect(ctx.T("unknown")).To(Equal("unknown"))
+		})
+	})
+})
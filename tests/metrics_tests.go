@@ -0,0 +1,81 @@
+package toolkits
+
+import (
+	"context"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+)
+
+type recordingExporter struct {
+	points []toolkit.MetricPoint
+}
+
+func (this *recordingExporter) ExportMetrics(ctx context.Context, points []toolkit.MetricPoint) error {
+	this.points = points
+	return nil
+}
+
+var _ = Describe("Metrics", func() {
+	BeforeEach(func() {
+		toolkit.ResetMetrics()
+	})
+	When("a counter is incremented", func() {
+		It("should keep a total per set of labels", func() {
+			toolkit.Counter("orders_created").Inc()
+			toolkit.Counter("orders_created").With(toolkit.Labels{"plan": "pro"}).Add(2)
+			toolkit.Counter("orders_created").With(toolkit.Labels{"plan": "pro"}).Inc()
+
+			points := toolkit.CollectMetrics()
+			Expect(points).To(HaveLen(2))
+			Expect(points[0].Labels).To(BeEmpty())
+			Expect(points[0].Value).To(Equal(1.0))
+			Expect(points[1].Labels).To(Equal(toolkit.Labels{"plan": "pro"}))
+			Expect(points[1].Value).To(Equal(3.0))
+		})
+	})
+	When("values are observed in a histogram", func() {
+		It("should count them in their buckets", func() {
+			histogram := toolkit.Histogram("db_latency_ms", 10, 100)
+			histogram.Observe(5)
+			histogram.Observe(10)
+			histogram.Observe(50)
+			histogram.Observe(500)
+
+			points := toolkit.CollectMetrics()
+			Expect(points).To(HaveLen(1))
+			Expect(points[0].Kind).To(Equal(toolkit.MetricKindHistogram))
+			Expect(points[0].Count).To(Equal(uint64(4)))
+			Expect(points[0].Sum).To(Equal(565.0))
+			Expect(points[0].BucketCounts).To(Equal([]uint64{2, 1, 1}))
+		})
+	})
+	When("a response is written", func() {
+		It("should record the request count and latency", func() {
+			rr := httptest.NewRecorder()
+			rq := httptest.NewRequest(http.MethodPost, "/", nil)
+			toolkit.FuncCtx(rr, rq).FailResponse(http.StatusNotFound, "Not found")
+
+			//  The first request of the suite also records the cold start metrics
+			points := map[string]toolkit.MetricPoint{}
+			for _, point := range toolkit.CollectMetrics() {
+				points[point.Name] = point
+			}
+			Expect(points["request_duration_ms"].Count).To(Equal(uint64(1)))
+			Expect(points["requests_total"].Value).To(Equal(1.0))
+			Expect(points["requests_total"].Labels).To(Equal(toolkit.Labels{"method": "POST", "status": "4xx"}))
+		})
+	})
+	When("the metrics are flushed", func() {
+		It("should send them to the exporters", func() {
+			exporter := &recordingExporter{}
+			toolkit.Configure(toolkit.WithMetricExporter(exporter))
+			toolkit.Counter("orders_created").Inc()
+			Expect(toolkit.FlushMetrics(context.Background())).To(Succeed())
+			Expect(exporter.points).To(HaveLen(1))
+			Expect(exporter.points[0].Name).To(Equal("orders_created"))
+		})
+	})
+})
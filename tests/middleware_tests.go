@@ -0,0 +1,99 @@
+package toolkits
+
+import (
+	"errors"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+)
+
+func recordingMiddleware(name string, calls *[]string) toolkit.Middleware {
+	return func(next toolkit.HandlerFunc) toolkit.HandlerFunc {
+		return func(ctx toolkit.FunctionContext) error {
+			*calls = append(*calls, name+" before")
+			err := next(ctx)
+			*calls = append(*calls, name+" after")
+			return err
+		}
+	}
+}
+
+var _ = Describe("Middleware", func() {
+	var rr *httptest.ResponseRecorder
+	var rq *http.Request
+	var calls []string
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		rq = httptest.NewRequest(http.MethodGet, "/", nil)
+		calls = nil
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+	When("a chain wraps a handler", func() {
+		It("should run the middleware in order around the handler", func() {
+			chain := toolkit.Chain(recordingMiddleware("first", &calls), recordingMiddleware("second", &calls))
+			chain.Then(func(ctx toolkit.FunctionContext) error {
+				calls = append(calls, "handler")
+				return nil
+			}).ServeHTTP(rr, rq)
+			Expect(calls).To(Equal([]string{"first before", "second before", "handler", "second after", "first after"}))
+			Expect(rr.Code).To(Equal(http.StatusOK))
+		})
+		It("should let middleware change the ctx and respond to errors", func() {
+			auth := func(next toolkit.HandlerFunc) toolkit.HandlerFunc {
+				return func(ctx toolkit.FunctionContext) error {
+					if ctx.Request.Header.Get("Authorization") == "" {
+						ctx.FailResponse(http.StatusUnauthorized, "Missing credentials")
+						return nil
+					}
+					return next(ctx.WithPrincipal("user-1", nil))
+				}
+			}
+			handler := toolkit.Chain(auth).Then(func(ctx toolkit.FunctionContext) error {
+				principal, _ := ctx.Principal()
+				ctx.OkResponseJson(toolkit.Json{"user": principal.Id})
+				return nil
+			})
+			handler.ServeHTTP(rr, rq)
+			Expect(rr.Code).To(Equal(http.StatusUnauthorized))
+
+			rr = httptest.NewRecorder()
+			rq.Header.Set("Authorization", "Bearer token")
+			handler.ServeHTTP(rr, rq)
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(rr.Body.String()).To(ContainSubstring("user-1"))
+		})
+		It("should pass the handler's error out through the middleware", func() {
+			var seen error
+			observe := func(next toolkit.HandlerFunc) toolkit.HandlerFunc {
+				return func(ctx toolkit.FunctionContext) error {
+					seen = next(ctx)
+					return seen
+				}
+			}
+			toolkit.Chain(observe).Then(func(ctx toolkit.FunctionContext) error {
+				return errors.New("failed")
+			}).ServeHTTP(rr, rq)
+			Expect(seen).To(MatchError("failed"))
+			Expect(rr.Code).To(Equal(http.StatusInternalServerError))
+		})
+	})
+	When("a chain is appended to", func() {
+		It("should not change the original chain", func() {
+			base := toolkit.Chain(recordingMiddleware("base", &calls))
+			extended := base.Append(recordingMiddleware("extra", &calls))
+			handler := func(ctx toolkit.FunctionContext) error { return nil }
+			_ = base.Wrap(handler)(toolkit.FuncCtx(rr, rq))
+			Expect(calls).To(Equal([]string{"base before", "base after"}))
+			calls = nil
+			_ = extended.Wrap(handler)(toolkit.FuncCtx(httptest.NewRecorder(), rq))
+			Expect(calls).To(Equal([]string{"base before", "extra before", "extra after", "base after"}))
+		})
+	})
+})
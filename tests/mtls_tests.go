@@ -0,0 +1,158 @@
+package toolkits
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var _ = Describe("mTLS", func() {
+	var secretManager, server *httptest.Server
+	var mutex sync.Mutex
+	var secrets map[string]string
+	var accessed int
+	var mtls *toolkit.MTLSConfig
+
+	authorityKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	authorityTemplate := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "Partner Bank CA"}, NotBefore: time.Now().Add(-time.Hour),
+		NotAfter: time.Now().Add(time.Hour), IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}
+	authorityDer, _ := x509.CreateCertificate(rand.Reader, authorityTemplate, authorityTemplate, &authorityKey.PublicKey, authorityKey)
+	authority, _ := x509.ParseCertificate(authorityDer)
+	clientCertificate := func(name string, notAfter time.Time) (string, string) {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		template := &x509.Certificate{SerialNumber: big.NewInt(time.Now().UnixNano()), Subject: pkix.Name{CommonName: name}, NotBefore: time.Now().Add(-2 * time.Hour),
+			NotAfter: notAfter, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}
+		der, _ := x509.CreateCertificate(rand.Reader, template, authority, &key.PublicKey, authorityKey)
+		keyDer, _ := x509.MarshalPKCS8PrivateKey(key)
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})), string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}))
+	}
+	setSecret := func(name string, value string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		secrets[name] = value
+	}
+
+	BeforeEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+		secrets = map[string]string{}
+		accessed = 0
+		secretManager = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, "/token") {
+				_, _ = w.Write([]byte(`{"access_token":"test-token","expires_in":3600}`))
+				return
+			}
+			name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/projects/test-project/secrets/"), "/versions/latest:access")
+			mutex.Lock()
+			secret, ok := secrets[name]
+			accessed++
+			mutex.Unlock()
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"payload": map[string]interface{}{"data": []byte(secret)}})
+		}))
+		os.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(secretManager.URL, "http://"))
+		os.Setenv("GOOGLE_CLOUD_PROJECT", "test-project")
+		server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+		}))
+		clientAuthorities := x509.NewCertPool()
+		clientAuthorities.AddCert(authority)
+		server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientAuthorities}
+		server.StartTLS()
+		certificate, key := clientCertificate("function", time.Now().Add(time.Hour))
+		setSecret("client-certificate", certificate)
+		setSecret("client-key", key)
+		setSecret("bank-ca", string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})))
+		mtls = toolkit.NewMTLSConfig("client-certificate", "client-key")
+		mtls.CASecret = "bank-ca"
+		mtls.Endpoint = secretManager.URL
+	})
+	AfterEach(func() {
+		os.Unsetenv("GCE_METADATA_HOST")
+		server.Close()
+		secretManager.Close()
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+
+	get := func() (string, error) {
+		ctx := toolkit.FuncCtx(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		res, err := mtls.HTTPClient(ctx).Get(server.URL)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		return string(body), nil
+	}
+
+	It("should present the client certificate", func() {
+		Expect(get()).To(Equal("function"))
+	})
+	It("should read the key from the certificate secret", func() {
+		certificate, key := clientCertificate("combined", time.Now().Add(time.Hour))
+		setSecret("client-bundle", certificate+key)
+		mtls.CertificateSecret, mtls.KeySecret = "client-bundle", ""
+		Expect(get()).To(Equal("combined"))
+	})
+	It("should use the rotated certificate once the cache expires", func() {
+		mtls.RefreshInterval = 50 * time.Millisecond
+		Expect(get()).To(Equal("function"))
+		certificate, key := clientCertificate("rotated", time.Now().Add(time.Hour))
+		setSecret("client-certificate", certificate)
+		setSecret("client-key", key)
+		Expect(get()).To(Equal("function"))
+		time.Sleep(60 * time.Millisecond)
+		Expect(get()).To(Equal("rotated"))
+	})
+	It("should keep the certificate when the secrets can't be read anymore", func() {
+		mtls.RefreshInterval = 50 * time.Millisecond
+		Expect(get()).To(Equal("function"))
+		mutex.Lock()
+		delete(secrets, "client-key")
+		mutex.Unlock()
+		time.Sleep(60 * time.Millisecond)
+		Expect(get()).To(Equal("function"))
+		mutex.Lock()
+		failed := accessed
+		mutex.Unlock()
+		Expect(get()).To(Equal("function"))
+		mutex.Lock()
+		defer mutex.Unlock()
+		Expect(accessed).To(Equal(failed))
+	})
+	It("should fail when the certificate is expired", func() {
+		certificate, key := clientCertificate("function", time.Now().Add(-time.Hour))
+		setSecret("client-certificate", certificate)
+		setSecret("client-key", key)
+		_, err := get()
+		Expect(err).To(MatchError(ContainSubstring("is only valid from")))
+	})
+	It("should fail when a secret is missing", func() {
+		mtls.KeySecret = "missing-key"
+		_, err := get()
+		Expect(err).To(MatchError(ContainSubstring("failed to read the mTLS secret missing-key")))
+	})
+	It("should fail when the server isn't issued by the authorities", func() {
+		setSecret("bank-ca", string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: authorityDer})))
+		_, err := get()
+		Expect(err).To(MatchError(ContainSubstring("certificate")))
+	})
+})
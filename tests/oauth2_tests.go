@@ -0,0 +1,153 @@
+package toolkits
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var _ = Describe("OAuth2TokenSource", func() {
+	var server *httptest.Server
+	var mutex sync.Mutex
+	var forms []url.Values
+	var clientId, clientSecret string
+	var tokenResponse string
+
+	BeforeEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+		forms, tokenResponse = nil, ""
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/token" {
+				if r.Header.Get("Authorization") != "Bearer token-2" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				body, _ := io.ReadAll(r.Body)
+				_, _ = w.Write(append([]byte("ok "), body...))
+				return
+			}
+			_ = r.ParseForm()
+			mutex.Lock()
+			defer mutex.Unlock()
+			clientId, clientSecret, _ = r.BasicAuth()
+			forms = append(forms, r.PostForm)
+			if tokenResponse != "" {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(tokenResponse))
+				return
+			}
+			_, _ = fmt.Fprintf(w, `{"access_token":"token-%v","token_type":"Bearer","expires_in":3600}`, len(forms))
+		}))
+	})
+	AfterEach(func() {
+		server.Close()
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+	requests := func() int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(forms)
+	}
+
+	It("should get a token with the client credentials grant, and cache it", func() {
+		source := toolkit.NewClientCredentialsTokenSource(server.URL+"/token", "client", "s3cret", "orders.read", "orders.write")
+		token, err := source.Token(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token).To(Equal("token-1"))
+		Expect(clientId).To(Equal("client"))
+		Expect(clientSecret).To(Equal("s3cret"))
+		Expect(forms[0].Get("grant_type")).To(Equal("client_credentials"))
+		Expect(forms[0].Get("scope")).To(Equal("orders.read orders.write"))
+		token, err = source.Token(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token).To(Equal("token-1"))
+		Expect(requests()).To(Equal(1))
+	})
+	It("should send the client secret in the body when configured", func() {
+		source := toolkit.NewClientCredentialsTokenSource(server.URL+"/token", "client", "s3cret")
+		source.ClientSecretInBody = true
+		source.Params = url.Values{"audience": {"https://api.example.com"}}
+		_, err := source.Token(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clientId).To(BeEmpty())
+		Expect(forms[0].Get("client_id")).To(Equal("client"))
+		Expect(forms[0].Get("client_secret")).To(Equal("s3cret"))
+		Expect(forms[0].Get("audience")).To(Equal("https://api.example.com"))
+	})
+	It("should refresh a token which is about to expire in the background", func() {
+		source := toolkit.NewClientCredentialsTokenSource(server.URL+"/token", "client", "s3cret")
+		source.RefreshBefore = 2 * time.Hour
+		token, _ := source.Token(context.Background())
+		Expect(token).To(Equal("token-1"))
+		token, _ = source.Token(context.Background())
+		Expect(token).To(Equal("token-1"))
+		Eventually(requests).Should(Equal(2))
+		Eventually(func() string {
+			token, _ := source.Token(context.Background())
+			return token
+		}).Should(Equal("token-2"))
+	})
+	It("should sign the assertions of the JWT bearer grant", func() {
+		rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+		ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		for _, key := range []crypto.Signer{rsaKey, ecKey} {
+			forms = nil
+			source := toolkit.NewJwtBearerTokenSource(server.URL+"/token", "robot@example.com", key, "reports")
+			_, err := source.Token(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(forms[0].Get("grant_type")).To(Equal("urn:ietf:params:oauth:grant-type:jwt-bearer"))
+			parts := strings.Split(forms[0].Get("assertion"), ".")
+			Expect(parts).To(HaveLen(3))
+			claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+			var decoded map[string]interface{}
+			Expect(json.Unmarshal(claims, &decoded)).To(Succeed())
+			Expect(decoded).To(HaveKeyWithValue("iss", "robot@example.com"))
+			Expect(decoded).To(HaveKeyWithValue("aud", server.URL+"/token"))
+			digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+			signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+			switch key := key.(type) {
+			case *rsa.PrivateKey:
+				Expect(rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature)).To(Succeed())
+			case *ecdsa.PrivateKey:
+				Expect(signature).To(HaveLen(64))
+				Expect(ecdsa.Verify(&key.PublicKey, digest[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:]))).To(BeTrue())
+			}
+		}
+	})
+	It("should return the error of the token endpoint", func() {
+		tokenResponse = `{"error":"invalid_client","error_description":"Unknown client"}`
+		_, err := toolkit.NewClientCredentialsTokenSource(server.URL+"/token", "client", "wrong").Token(context.Background())
+		Expect(err).To(MatchError(ContainSubstring("invalid_client Unknown client")))
+	})
+	It("should authorize the requests of its HTTP client, replacing rejected tokens", func() {
+		source := toolkit.NewClientCredentialsTokenSource(server.URL+"/token", "client", "s3cret")
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		ctx := toolkit.FuncCtx(httptest.NewRecorder(), r)
+		res, err := source.HTTPClient(ctx).Post(server.URL+"/orders", "text/plain", strings.NewReader("order"))
+		Expect(err).NotTo(HaveOccurred())
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+		body, _ := io.ReadAll(res.Body)
+		Expect(string(body)).To(Equal("ok order"))
+		Expect(requests()).To(Equal(2))
+	})
+})
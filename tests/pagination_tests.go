@@ -0,0 +1,73 @@
+package toolkits
+
+import (
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("Pagination", func() {
+	var rr *httptest.ResponseRecorder
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+	})
+	When("no pagination parameters are sent", func() {
+		It("should return the default page size", func() {
+			ctx := toolkit.FuncCtx(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+			params, ok := ctx.PageParams()
+			Expect(ok).To(BeTrue())
+			Expect(params).To(Equal(toolkit.PageParams{Limit: toolkit.DefaultPageSize}))
+		})
+	})
+	When("the limit is too large", func() {
+		It("should clamp it", func() {
+			ctx := toolkit.FuncCtx(rr, httptest.NewRequest(http.MethodGet, "/?limit=100000&offset=40", nil))
+			params, ok := ctx.PageParams()
+			Expect(ok).To(BeTrue())
+			Expect(params.Limit).To(Equal(toolkit.MaxPageSize))
+			Expect(params.Offset).To(Equal(40))
+		})
+	})
+	When("a page token is sent", func() {
+		It("should return it as the cursor", func() {
+			ctx := toolkit.FuncCtx(rr, httptest.NewRequest(http.MethodGet, "/?pageToken=abc", nil))
+			params, ok := ctx.PageParams()
+			Expect(ok).To(BeTrue())
+			Expect(params.Cursor).To(Equal("abc"))
+		})
+	})
+	When("the offset is malformed", func() {
+		It("should send a 400 response", func() {
+			ctx := toolkit.FuncCtx(rr, httptest.NewRequest(http.MethodGet, "/?offset=-1", nil))
+			_, ok := ctx.PageParams()
+			Expect(ok).To(BeFalse())
+			Expect(rr.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+	When("OkResponsePage is called", func() {
+		It("should send the page envelope", func() {
+			ctx := toolkit.FuncCtx(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+			ctx.OkResponsePage([]int{1, 2}, "next", 10)
+			var res toolkit.PageResponseStruct
+			Expect(json.Unmarshal(rr.Body.Bytes(), &res)).To(Succeed())
+			Expect(res.SpanId).To(Equal(ctx.SpanId))
+			Expect(res.NextPageToken).To(Equal("next"))
+			Expect(res.Total).To(Equal(10))
+			Expect(res.Data).To(Equal([]interface{}{1., 2.}))
+		})
+		It("should include the response metadata", func() {
+			toolkit.Configure(toolkit.WithResponseMeta("1.2.3"))
+			defer toolkit.Configure(toolkit.WithoutResponseMeta())
+			ctx := toolkit.FuncCtx(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+			ctx.OkResponsePage([]int{1, 2}, "", 2)
+			var res toolkit.PageResponseStruct
+			Expect(json.Unmarshal(rr.Body.Bytes(), &res)).To(Succeed())
+			Expect(res.Meta).NotTo(BeNil())
+			Expect(res.Meta.AppVersion).To(Equal("1.2.3"))
+		})
+	})
+})
@@ -0,0 +1,64 @@
+package toolkits
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("WithPrincipal", func() {
+	var ctx toolkit.FunctionContext
+	var outBuffer bytes.Buffer
+
+	BeforeEach(func() {
+		ctx = toolkit.FuncCtx(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		outBuffer.Reset()
+		logger := ctx.Logger.Output(&outBuffer)
+		ctx.Logger = &logger
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithoutErrorReporters())
+	})
+	When("a principal is set", func() {
+		It("should add the principal field to the logs without the claims", func() {
+			ctx.WithPrincipal("user-1", map[string]interface{}{"email": "bob@example.com"}).Info("Hello")
+			var entry map[string]interface{}
+			Expect(json.Unmarshal(outBuffer.Bytes(), &entry)).To(Succeed())
+			Expect(entry["principal"]).To(Equal("user-1"))
+			Expect(outBuffer.String()).NotTo(ContainSubstring("bob@example.com"))
+		})
+		It("should expose the principal and its claims", func() {
+			authed := ctx.WithPrincipal("user-1", map[string]interface{}{"email": "bob@example.com", "roles": []interface{}{"admin", "billing"}, "scope": "read write"})
+			principal, ok := authed.Principal()
+			Expect(ok).To(BeTrue())
+			Expect(principal.Id).To(Equal("user-1"))
+			Expect(principal.Claim("email")).To(Equal("bob@example.com"))
+			Expect(principal.ClaimStrings("roles")).To(Equal([]string{"admin", "billing"}))
+			Expect(principal.ClaimStrings("scope")).To(Equal([]string{"read", "write"}))
+
+			fromContext, ok := toolkit.PrincipalFromContext(authed.Context)
+			Expect(ok).To(BeTrue())
+			Expect(fromContext.Id).To(Equal("user-1"))
+		})
+		It("should be sent to the error reporters", func() {
+			reporter := &recordingReporter{}
+			toolkit.Configure(toolkit.WithErrorReporter(reporter))
+			ctx.WithPrincipal("user-1", nil).ReportError(errors.New("failed"), "Failed")
+			Expect(reporter.reports[0].Principal.Id).To(Equal("user-1"))
+		})
+	})
+	When("no principal is set", func() {
+		It("should report that the request isn't authenticated", func() {
+			_, ok := ctx.Principal()
+			Expect(ok).To(BeFalse())
+			_, ok = toolkit.PrincipalFromContext(context.Background())
+			Expect(ok).To(BeFalse())
+		})
+	})
+})
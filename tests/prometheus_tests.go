@@ -0,0 +1,36 @@
+package toolkits
+
+import (
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("MetricsHandler", func() {
+	BeforeEach(func() {
+		toolkit.ResetMetrics()
+	})
+	When("the metrics are scraped", func() {
+		It("should serve them in the Prometheus text format", func() {
+			toolkit.Counter("orders_created").With(toolkit.Labels{"plan": `p"ro`}).Add(3)
+			histogram := toolkit.Histogram("db_latency_ms", 10, 100)
+			histogram.Observe(5)
+			histogram.Observe(50)
+
+			rr := httptest.NewRecorder()
+			toolkit.MetricsHandler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+			Expect(rr.Header().Get("Content-Type")).To(HavePrefix("text/plain; version=0.0.4"))
+			Expect(rr.Body.String()).To(Equal(`# TYPE db_latency_ms histogram
+db_latency_ms_bucket{le="10"} 1
+db_latency_ms_bucket{le="100"} 2
+db_latency_ms_bucket{le="+Inf"} 2
+db_latency_ms_sum 55
+db_latency_ms_count 2
+# TYPE orders_created counter
+orders_created{plan="p\"ro"} 3
+`))
+		})
+	})
+})
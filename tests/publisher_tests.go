@@ -0,0 +1,88 @@
+package toolkits
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+)
+
+var _ = Describe("Publisher", func() {
+	var server *httptest.Server
+	var path string
+	var body map[string]interface{}
+	var status int
+	var publisher *toolkit.Publisher
+	var outBuffer bytes.Buffer
+
+	BeforeEach(func() {
+		status = http.StatusOK
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, "/token") {
+				_, _ = w.Write([]byte(`{"access_token":"test-token","expires_in":3600}`))
+				return
+			}
+			path = r.URL.Path
+			body = nil
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(`{"messageIds":["3401925632"]}`))
+		}))
+		os.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(server.URL, "http://"))
+		os.Setenv("GOOGLE_CLOUD_PROJECT", "test-project")
+		publisher = toolkit.NewPublisher("orders")
+		publisher.Endpoint = server.URL
+		publisher.SchemaVersion = "2"
+		outBuffer.Reset()
+		toolkit.Configure(toolkit.WithLogWriter(&outBuffer))
+	})
+	AfterEach(func() {
+		os.Unsetenv("GCE_METADATA_HOST")
+		server.Close()
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+	When("a message is published", func() {
+		It("should send it to the topic with the trace and schema version attributes", func() {
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+			ctx := toolkit.FuncCtx(httptest.NewRecorder(), r)
+			id, err := publisher.Publish(ctx, toolkit.PubSubMessage{Data: []byte("hello"), Attributes: map[string]string{"region": "eu"}, OrderingKey: "customer-7"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(id).To(Equal("3401925632"))
+			Expect(path).To(Equal("/v1/projects/test-project/topics/orders:publish"))
+
+			message := body["messages"].([]interface{})[0].(map[string]interface{})
+			Expect(message["data"]).To(Equal(base64.StdEncoding.EncodeToString([]byte("hello"))))
+			Expect(message["orderingKey"]).To(Equal("customer-7"))
+			attributes := message["attributes"].(map[string]interface{})
+			Expect(attributes).To(HaveKeyWithValue("region", "eu"))
+			Expect(attributes).To(HaveKeyWithValue("spanId", ctx.SpanId))
+			Expect(attributes).To(HaveKeyWithValue("schemaVersion", "2"))
+			Expect(attributes["traceparent"]).To(HavePrefix("00-4bf92f3577b34da6a3ce929d0e0e4736-"))
+			Expect(outBuffer.String()).To(ContainSubstring("Published message 3401925632"))
+		})
+		It("should serialize json messages", func() {
+			ctx := toolkit.FuncCtx(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+			_, err := publisher.PublishJson(ctx, orderCreated{OrderId: "o-1", Total: 1250}, nil)
+			Expect(err).NotTo(HaveOccurred())
+			message := body["messages"].([]interface{})[0].(map[string]interface{})
+			data, _ := base64.StdEncoding.DecodeString(message["data"].(string))
+			Expect(data).To(MatchJSON(`{"orderId":"o-1","total":1250}`))
+		})
+	})
+	When("publishing fails", func() {
+		It("should return and log the error", func() {
+			status = http.StatusForbidden
+			ctx := toolkit.FuncCtx(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+			_, err := publisher.Publish(ctx, toolkit.PubSubMessage{Data: []byte("hello")})
+			Expect(err).To(HaveOccurred())
+			Expect(outBuffer.String()).To(ContainSubstring("Failed to publish message to projects/test-project/topics/orders"))
+		})
+	})
+})
@@ -0,0 +1,87 @@
+package toolkits
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+)
+
+func pubSubPushRequest(data string) *http.Request {
+	body := `{"message":{"data":"` + base64.StdEncoding.EncodeToString([]byte(data)) + `","attributes":{"region":"eu"},"messageId":"2070443601311540","publishTime":"2024-05-01T10:00:00.123Z","orderingKey":"customer-7"},"subscription":"projects/demo/subscriptions/orders","deliveryAttempt":3}`
+	return httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+}
+
+var _ = Describe("Pub/Sub push", func() {
+	var recorder *httptest.ResponseRecorder
+	var outBuffer bytes.Buffer
+
+	BeforeEach(func() {
+		recorder = httptest.NewRecorder()
+		outBuffer.Reset()
+		toolkit.Configure(toolkit.WithLogWriter(&outBuffer))
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter())
+		toolkit.ResetErrorMappings()
+	})
+	When("a push request is bound", func() {
+		It("should decode the message and its metadata", func() {
+			ctx := toolkit.FuncCtx(recorder, pubSubPushRequest(`{"orderId":"o-1","total":1250}`))
+			var order orderCreated
+			message, ok := ctx.BindPubSubPush(&order)
+			Expect(ok).To(BeTrue())
+			Expect(order).To(Equal(orderCreated{OrderId: "o-1", Total: 1250}))
+			Expect(message.MessageId).To(Equal("2070443601311540"))
+			Expect(message.Attributes).To(HaveKeyWithValue("region", "eu"))
+			Expect(message.OrderingKey).To(Equal("customer-7"))
+			Expect(message.PublishTime).To(Equal(time.Date(2024, 5, 1, 10, 0, 0, 123000000, time.UTC)))
+			Expect(message.Subscription).To(Equal("projects/demo/subscriptions/orders"))
+			Expect(message.DeliveryAttempt).To(Equal(3))
+		})
+		It("should reject requests without an envelope", func() {
+			ctx := toolkit.FuncCtx(recorder, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"orderId":"o-1"}`)))
+			_, ok := ctx.BindPubSubPush(&orderCreated{})
+			Expect(ok).To(BeFalse())
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+		})
+		It("should acknowledge messages whose data isn't json, so they're not delivered again", func() {
+			ctx := toolkit.FuncCtx(recorder, pubSubPushRequest("not json"))
+			message, ok := ctx.BindPubSubPush(&orderCreated{})
+			Expect(ok).To(BeFalse())
+			Expect(message.MessageId).To(Equal("2070443601311540"))
+			Expect(recorder.Code).To(Equal(http.StatusNoContent))
+			Expect(outBuffer.String()).To(ContainSubstring("Dropping Pub/Sub message"))
+		})
+	})
+	When("the message has been processed", func() {
+		var ctx toolkit.FunctionContext
+
+		BeforeEach(func() {
+			ctx = toolkit.FuncCtx(recorder, pubSubPushRequest(`{}`))
+		})
+		It("should acknowledge it when there's no error", func() {
+			ctx.PubSubResponse(nil)
+			Expect(recorder.Code).To(Equal(http.StatusNoContent))
+		})
+		It("should acknowledge it when the error has a 4xx status", func() {
+			ctx.PubSubResponse(toolkit.Unprocessable("Unknown order type"))
+			Expect(recorder.Code).To(Equal(http.StatusNoContent))
+			Expect(outBuffer.String()).To(ContainSubstring("Unknown order type"))
+		})
+		It("should not acknowledge it when the error is retryable", func() {
+			ctx.PubSubResponse(toolkit.Retryable(toolkit.Conflict("Order is locked"), time.Second))
+			Expect(recorder.Code).To(Equal(http.StatusServiceUnavailable))
+		})
+		It("should not acknowledge it for other errors, so it's delivered again", func() {
+			ctx.PubSubResponse(errors.New("database unavailable"))
+			Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+		})
+	})
+})
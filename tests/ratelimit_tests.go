@@ -0,0 +1,215 @@
+package toolkits
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Take(context.Context, string, toolkit.Rate) (toolkit.RateLimitResult, error) {
+	return toolkit.RateLimitResult{}, errors.New("store unavailable")
+}
+
+var _ = Describe("RateLimit", func() {
+	var config toolkit.RateLimitConfig
+
+	BeforeEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+		config = toolkit.RateLimitConfig{Rate: toolkit.Rate{Requests: 2, Period: time.Minute}}
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+
+	newHandler := func() http.HandlerFunc {
+		return toolkit.Chain(toolkit.RateLimit(config)).Then(func(ctx toolkit.FunctionContext) error {
+			return nil
+		})
+	}
+	request := func(handler http.HandlerFunc, ip string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-Forwarded-For", "10.0.0.1, "+ip)
+		rr := httptest.NewRecorder()
+		handler(rr, r)
+		return rr
+	}
+
+	When("the requests are kept in memory", func() {
+		It("should reject the requests of a client exceeding the rate with a 429 status", func() {
+			handler := newHandler()
+			rr := request(handler, "203.0.113.7")
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(rr.Header().Get("X-RateLimit-Limit")).To(Equal("2"))
+			Expect(rr.Header().Get("X-RateLimit-Remaining")).To(Equal("1"))
+			Expect(rr.Header().Get("X-RateLimit-Reset")).To(Equal("30"))
+			Expect(request(handler, "203.0.113.7").Code).To(Equal(http.StatusOK))
+			rr = request(handler, "203.0.113.7")
+			Expect(rr.Code).To(Equal(http.StatusTooManyRequests))
+			Expect(rr.Header().Get("Retry-After")).To(Equal("30"))
+			Expect(rr.Header().Get("X-RateLimit-Remaining")).To(Equal("0"))
+			Expect(rr.Body.String()).To(ContainSubstring(`"retryable":true`))
+		})
+		It("should count every client separately", func() {
+			handler := newHandler()
+			request(handler, "203.0.113.7")
+			request(handler, "203.0.113.7")
+			Expect(request(handler, "203.0.113.7").Code).To(Equal(http.StatusTooManyRequests))
+			Expect(request(handler, "198.51.100.4").Code).To(Equal(http.StatusOK))
+		})
+		It("should let requests through again once the bucket refills", func() {
+			config.Rate = toolkit.Rate{Requests: 1, Period: 20 * time.Millisecond}
+			handler := newHandler()
+			Expect(request(handler, "203.0.113.7").Code).To(Equal(http.StatusOK))
+			Expect(request(handler, "203.0.113.7").Code).To(Equal(http.StatusTooManyRequests))
+			time.Sleep(25 * time.Millisecond)
+			Expect(request(handler, "203.0.113.7").Code).To(Equal(http.StatusOK))
+		})
+		It("should count requests by the principal", func() {
+			config.Key = toolkit.RateLimitByPrincipal
+			handler := toolkit.Chain(func(next toolkit.HandlerFunc) toolkit.HandlerFunc {
+				return func(ctx toolkit.FunctionContext) error {
+					return next(ctx.WithPrincipal(ctx.Request.Header.Get("X-User"), nil))
+				}
+			}, toolkit.RateLimit(config)).Then(func(ctx toolkit.FunctionContext) error { return nil })
+			send := func(user string) int {
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				r.Header.Set("X-User", user)
+				rr := httptest.NewRecorder()
+				handler(rr, r)
+				return rr.Code
+			}
+			send("alice")
+			send("alice")
+			Expect(send("alice")).To(Equal(http.StatusTooManyRequests))
+			Expect(send("bob")).To(Equal(http.StatusOK))
+		})
+	})
+	When("the store fails", func() {
+		It("should respond with a 503 status, or let the request through if failing open", func() {
+			config.Store = failingRateLimitStore{}
+			Expect(request(newHandler(), "203.0.113.7").Code).To(Equal(http.StatusServiceUnavailable))
+			config.FailOpen = true
+			Expect(request(newHandler(), "203.0.113.7").Code).To(Equal(http.StatusOK))
+		})
+	})
+	When("the rate isn't positive", func() {
+		It("should panic, and the stores should refuse it", func() {
+			for _, rate := range []toolkit.Rate{{Requests: 0, Period: time.Minute}, {Requests: 10}, {Requests: 10, Period: time.Microsecond}} {
+				config.Rate = rate
+				Expect(func() { toolkit.RateLimit(config) }).To(Panic())
+				_, err := toolkit.NewMemoryRateLimitStore().Take(context.Background(), "alice", rate)
+				Expect(err).To(HaveOccurred())
+			}
+		})
+	})
+	When("limiters with different rates share a memory store", func() {
+		It("should keep the buckets of the longer periods", func() {
+			store := toolkit.NewMemoryRateLimitStore()
+			hourly := toolkit.Rate{Requests: 1, Period: time.Hour}
+			result, _ := store.Take(context.Background(), "hourly:alice", hourly)
+			Expect(result.Allowed).To(BeTrue())
+			time.Sleep(5 * time.Millisecond)
+			_, _ = store.Take(context.Background(), "fast:alice", toolkit.Rate{Requests: 1, Period: time.Millisecond})
+			result, _ = store.Take(context.Background(), "hourly:alice", hourly)
+			Expect(result.Allowed).To(BeFalse())
+		})
+	})
+	When("the requests are counted in Redis", func() {
+		It("should run the token bucket script for the key", func() {
+			var keys []string
+			var args []interface{}
+			tokens := "1"
+			config.Store = toolkit.NewRedisRateLimitStore(func(ctx context.Context, script string, k []string, a ...interface{}) (interface{}, error) {
+				Expect(script).To(ContainSubstring("HMGET"))
+				keys, args = k, a
+				if tokens == "0.25" {
+					return []interface{}{int64(0), tokens}, nil
+				}
+				return []interface{}{int64(1), tokens}, nil
+			})
+			handler := newHandler()
+			rr := request(handler, "203.0.113.7")
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(rr.Header().Get("X-RateLimit-Remaining")).To(Equal("1"))
+			Expect(keys).To(Equal([]string{"ratelimit:ip:203.0.113.7"}))
+			Expect(args[0]).To(Equal(2))
+			Expect(args[1]).To(Equal(strconv.FormatFloat(2.0/60000, 'g', -1, 64)))
+			tokens = "0.25"
+			rr = request(handler, "203.0.113.7")
+			Expect(rr.Code).To(Equal(http.StatusTooManyRequests))
+			Expect(rr.Header().Get("Retry-After")).To(Equal("23"))
+		})
+	})
+	When("the requests are counted in Firestore", func() {
+		var server *httptest.Server
+		var documents []string
+		var counts map[string]int
+
+		BeforeEach(func() {
+			documents, counts = nil, map[string]int{}
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasSuffix(r.URL.Path, "/token") {
+					_, _ = w.Write([]byte(`{"access_token":"test-token","expires_in":3600}`))
+					return
+				}
+				Expect(r.URL.Path).To(Equal("/v1/projects/test-project/databases/(default)/documents:commit"))
+				var commit struct {
+					Writes []struct {
+						Transform struct {
+							Document string `json:"document"`
+						} `json:"transform"`
+					} `json:"writes"`
+				}
+				_ = json.NewDecoder(r.Body).Decode(&commit)
+				document := commit.Writes[0].Transform.Document
+				documents = append(documents, document)
+				counts[document]++
+				_, _ = fmt.Fprintf(w, `{"writeResults":[{"transformResults":[{"integerValue":"%v"},{"timestampValue":"2024-06-01T00:00:00Z"}]}]}`, counts[document])
+			}))
+			os.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(server.URL, "http://"))
+			os.Setenv("GOOGLE_CLOUD_PROJECT", "test-project")
+			store := toolkit.NewFirestoreRateLimitStore("rateLimits")
+			store.Endpoint = server.URL
+			config.Store = store
+		})
+		AfterEach(func() {
+			os.Unsetenv("GCE_METADATA_HOST")
+			server.Close()
+		})
+
+		It("should count the requests of the key's window", func() {
+			handler := newHandler()
+			Expect(request(handler, "203.0.113.7").Code).To(Equal(http.StatusOK))
+			Expect(request(handler, "203.0.113.7").Code).To(Equal(http.StatusOK))
+			rr := request(handler, "203.0.113.7")
+			Expect(rr.Code).To(Equal(http.StatusTooManyRequests))
+			Expect(rr.Header().Get("Retry-After")).NotTo(BeEmpty())
+			Expect(documents[0]).To(HavePrefix("projects/test-project/databases/(default)/documents/rateLimits/"))
+			Expect(documents[0]).To(HaveSuffix(strconv.FormatInt(time.Now().Truncate(time.Minute).Unix(), 10)))
+			Expect(request(handler, "198.51.100.4").Code).To(Equal(http.StatusOK))
+		})
+	})
+})
+
+var _ = Describe("ClientIP", func() {
+	It("should read the address appended to X-Forwarded-For, or the connection's address", func() {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "169.254.1.1:4312"
+		Expect(toolkit.FuncCtx(httptest.NewRecorder(), r).ClientIP()).To(Equal("169.254.1.1"))
+		r.Header.Set("X-Forwarded-For", "1.2.3.4, 203.0.113.7")
+		Expect(toolkit.FuncCtx(httptest.NewRecorder(), r).ClientIP()).To(Equal("203.0.113.7"))
+	})
+})
@@ -0,0 +1,118 @@
+package toolkits
+
+import (
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+)
+
+var _ = Describe("RequireRecaptcha", func() {
+	var server *httptest.Server
+	var assessment string
+	var assessed map[string]map[string]interface{}
+	var config toolkit.RecaptchaConfig
+	var passed toolkit.RecaptchaAssessment
+
+	BeforeEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+		assessment = `{"name":"projects/123/assessments/abc","riskAnalysis":{"score":0.9,"reasons":[]},"tokenProperties":{"valid":true,"hostname":"www.example.com","action":"login"}}`
+		assessed, passed = nil, toolkit.RecaptchaAssessment{}
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, "/token") {
+				_, _ = w.Write([]byte(`{"access_token":"test-token","expires_in":3600}`))
+				return
+			}
+			if strings.HasPrefix(r.URL.Path, "/unavailable") {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			Expect(r.URL.Path).To(Equal("/v1/projects/test-project/assessments"))
+			_ = json.NewDecoder(r.Body).Decode(&assessed)
+			if assessed["event"]["token"] == "malformed" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_, _ = w.Write([]byte(assessment))
+		}))
+		os.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(server.URL, "http://"))
+		os.Setenv("GOOGLE_CLOUD_PROJECT", "test-project")
+		config = toolkit.RecaptchaConfig{SiteKey: "site-key", Action: "login", Endpoint: server.URL}
+	})
+	AfterEach(func() {
+		os.Unsetenv("GCE_METADATA_HOST")
+		server.Close()
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+
+	request := func(r *http.Request) (int, toolkit.ErrorResponseStruct) {
+		rr := httptest.NewRecorder()
+		toolkit.Chain(toolkit.RequireRecaptcha(config)).Then(func(ctx toolkit.FunctionContext) error {
+			passed, _ = ctx.RecaptchaAssessment()
+			return nil
+		})(rr, r)
+		var body toolkit.ErrorResponseStruct
+		_ = json.Unmarshal(rr.Body.Bytes(), &body)
+		return rr.Code, body
+	}
+	withToken := func(token string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.Header.Set("X-Recaptcha-Token", token)
+		r.Header.Set("User-Agent", "test-agent")
+		return r
+	}
+
+	It("should let requests with a good score through", func() {
+		status, _ := request(withToken("good-token"))
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(passed.Score).To(Equal(0.9))
+		Expect(passed.Name).To(Equal("projects/123/assessments/abc"))
+		Expect(assessed["event"]).To(HaveKeyWithValue("siteKey", "site-key"))
+		Expect(assessed["event"]).To(HaveKeyWithValue("expectedAction", "login"))
+		Expect(assessed["event"]).To(HaveKeyWithValue("userAgent", "test-agent"))
+	})
+	It("should read the token of form posts", func() {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(url.Values{"g-recaptcha-response": {"form-token"}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		status, _ := request(r)
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(assessed["event"]).To(HaveKeyWithValue("token", "form-token"))
+	})
+	DescribeTable("should deny requests with a detail of the reason",
+		func(token string, response string, status int, code string) {
+			if response != "" {
+				assessment = response
+			}
+			actual, body := request(withToken(token))
+			Expect(actual).To(Equal(status))
+			Expect(body.Details).To(HaveLen(1))
+			Expect(body.Details[0].Field).To(Equal("X-Recaptcha-Token"))
+			Expect(body.Details[0].Code).To(Equal(code))
+			Expect(passed.Name).To(BeEmpty())
+		},
+		Entry("without a token", "", "", http.StatusForbidden, "recaptcha.missing"),
+		Entry("with a malformed token", "malformed", "", http.StatusForbidden, "recaptcha.invalid"),
+		Entry("with an expired token", "expired", `{"tokenProperties":{"valid":false,"invalidReason":"EXPIRED"}}`, http.StatusForbidden, "recaptcha.invalid"),
+		Entry("with a token of another action", "signup", `{"riskAnalysis":{"score":0.9},"tokenProperties":{"valid":true,"action":"signup"}}`, http.StatusForbidden, "recaptcha.action_mismatch"),
+		Entry("with a low score", "bot", `{"riskAnalysis":{"score":0.1,"reasons":["AUTOMATION"]},"tokenProperties":{"valid":true,"action":"login"}}`, http.StatusForbidden, "recaptcha.low_score"),
+	)
+	It("should only accept the configured hostnames", func() {
+		config.Hostnames = []string{"admin.example.com"}
+		_, body := request(withToken("good-token"))
+		Expect(body.Details[0].Code).To(Equal("recaptcha.hostname_mismatch"))
+	})
+	It("should respond with a 503 status when the API fails", func() {
+		config.Endpoint = server.URL + "/unavailable"
+		status, _ := request(withToken("good-token"))
+		Expect(status).To(Equal(http.StatusServiceUnavailable))
+	})
+	It("should panic without a site key", func() {
+		Expect(func() { toolkit.RequireRecaptcha(toolkit.RecaptchaConfig{}) }).To(Panic())
+	})
+})
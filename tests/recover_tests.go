@@ -0,0 +1,96 @@
+package toolkits
+
+import (
+	"bytes"
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+)
+
+type panickingOrder struct {
+	Id string
+}
+
+var _ = Describe("Recover", func() {
+	var rr *httptest.ResponseRecorder
+	var rq *http.Request
+	var outBuffer bytes.Buffer
+	var reporter *recordingReporter
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		rq = httptest.NewRequest(http.MethodGet, "/", nil)
+		outBuffer.Reset()
+		reporter = &recordingReporter{}
+		toolkit.Configure(toolkit.WithLogWriter(&outBuffer), toolkit.WithErrorReporter(reporter))
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter(), toolkit.WithoutErrorReporters())
+	})
+	firstEntry := func() map[string]interface{} {
+		var entry map[string]interface{}
+		Expect(json.NewDecoder(&outBuffer).Decode(&entry)).To(Succeed())
+		return entry
+	}
+	When("a handler passed to Handle panics", func() {
+		It("should log the panic, report it and send a 500 response", func() {
+			toolkit.Handle(func(ctx toolkit.FunctionContext) error {
+				panic("database handle is closed")
+			}).ServeHTTP(rr, rq)
+
+			Expect(rr.Code).To(Equal(http.StatusInternalServerError))
+			var res toolkit.ErrorResponseStruct
+			Expect(json.Unmarshal(rr.Body.Bytes(), &res)).To(Succeed())
+			Expect(res.Message).To(Equal("Internal Server Error"))
+			Expect(rr.Body.String()).NotTo(ContainSubstring("database handle"))
+
+			entry := firstEntry()
+			Expect(entry["level"]).To(Equal("error"))
+			Expect(entry["error"]).To(Equal("database handle is closed"))
+			Expect(entry["caller"]).To(ContainSubstring("recover_tests.go"))
+			Expect(entry["stack"]).NotTo(BeEmpty())
+
+			Expect(reporter.reports).To(HaveLen(1))
+			Expect(reporter.reports[0].Panic).To(BeTrue())
+			Expect(reporter.reports[0].Status).To(Equal(http.StatusInternalServerError))
+			Expect(reporter.reports[0].Fingerprint).To(Equal(entry["fingerprint"]))
+		})
+	})
+	When("a handler panics with a runtime error", func() {
+		It("should attribute the panic to the handler", func() {
+			toolkit.Handle(func(ctx toolkit.FunctionContext) error {
+				var order *panickingOrder
+				ctx.Info(order.Id)
+				return nil
+			}).ServeHTTP(rr, rq)
+			Expect(rr.Code).To(Equal(http.StatusInternalServerError))
+			Expect(firstEntry()["caller"]).To(ContainSubstring("recover_tests.go"))
+		})
+	})
+	When("a handler panics after writing the response", func() {
+		It("should keep the response", func() {
+			func() {
+				ctx := toolkit.FuncCtx(rr, rq)
+				defer ctx.Recover()
+				ctx.CreatedResponse("/orders/1", toolkit.Json{"id": 1})
+				panic("failed to publish event")
+			}()
+			Expect(rr.Code).To(Equal(http.StatusCreated))
+			Expect(reporter.reports).To(HaveLen(1))
+		})
+	})
+	When("the handler is aborted by Fatal", func() {
+		It("should pass the panic on to the http server", func() {
+			Expect(func() {
+				toolkit.Handle(func(ctx toolkit.FunctionContext) error {
+					ctx.Fatal("Config is missing")
+					return nil
+				}).ServeHTTP(rr, rq)
+			}).To(PanicWith(http.ErrAbortHandler))
+			Expect(rr.Code).To(Equal(http.StatusInternalServerError))
+		})
+	})
+})
@@ -0,0 +1,51 @@
+package toolkits
+
+import (
+	"bytes"
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("Redaction", func() {
+	var ctx toolkit.FunctionContext
+	var outBuffer bytes.Buffer
+
+	BeforeEach(func() {
+		ctx = toolkit.FuncCtx(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		outBuffer.Reset()
+		logger := ctx.Logger.Output(toolkit.RedactingWriter(&outBuffer))
+		ctx.Logger = &logger
+	})
+	AfterEach(func() {
+		toolkit.ResetRedaction()
+	})
+	When("a field is redacted", func() {
+		It("should mask its value at any depth", func() {
+			toolkit.RedactFields("password")
+			ctx.WithField("user", map[string]interface{}{"name": "bob", "Password": "hunter2"}).Info("Signing in")
+			var entry map[string]interface{}
+			Expect(json.Unmarshal(outBuffer.Bytes(), &entry)).To(Succeed())
+			Expect(entry["user"]).To(Equal(map[string]interface{}{"name": "bob", "Password": toolkit.RedactedValue}))
+		})
+	})
+	When("patterns are redacted", func() {
+		It("should mask the matching parts of messages and fields", func() {
+			toolkit.RedactPatterns(toolkit.RedactEmails, toolkit.RedactCardNumbers, toolkit.RedactBearerTokens)
+			ctx.WithField("authorization", "Bearer abc.def").Infof("Charging %v with card %v", "bob@example.com", "4111 1111 1111 1111")
+			var entry map[string]interface{}
+			Expect(json.Unmarshal(outBuffer.Bytes(), &entry)).To(Succeed())
+			Expect(entry["message"]).To(Equal("Charging [REDACTED] with card [REDACTED]"))
+			Expect(entry["authorization"]).To(Equal(toolkit.RedactedValue))
+		})
+	})
+	When("nothing is registered", func() {
+		It("should write the entries unchanged", func() {
+			ctx.Info("bob@example.com")
+			Expect(outBuffer.String()).To(ContainSubstring("bob@example.com"))
+		})
+	})
+})
@@ -0,0 +1,55 @@
+package toolkits
+
+import (
+	"bytes"
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("Request id", func() {
+	var rr *httptest.ResponseRecorder
+	var rq *http.Request
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		rq = httptest.NewRequest(http.MethodGet, "/", nil)
+	})
+	When("the request has an X-Request-ID header", func() {
+		It("should keep the id separate from the span id", func() {
+			rq.Header.Set("X-Request-ID", "gateway-123")
+			ctx := toolkit.FuncCtx(rr, rq)
+			Expect(ctx.RequestId).To(Equal("gateway-123"))
+			Expect(ctx.SpanId).NotTo(Equal("gateway-123"))
+			Expect(rr.Header().Get("X-Request-ID")).To(Equal("gateway-123"))
+			Expect(ctx.OutgoingHeaders().Get("X-Request-ID")).To(Equal("gateway-123"))
+		})
+		It("should replace ids which aren't safe to log", func() {
+			rq.Header.Set("X-Request-ID", "bad\x01id")
+			Expect(toolkit.FuncCtx(rr, rq).RequestId).To(HaveLen(32))
+		})
+	})
+	When("the request has no X-Request-ID header", func() {
+		It("should generate an id", func() {
+			ctx := toolkit.FuncCtx(rr, rq)
+			Expect(ctx.RequestId).To(HaveLen(32))
+			Expect(rr.Header().Get("X-Request-ID")).To(Equal(ctx.RequestId))
+		})
+	})
+	When("a message is logged", func() {
+		It("should include the request id", func() {
+			rq.Header.Set("X-Request-ID", "gateway-123")
+			ctx := toolkit.FuncCtx(rr, rq)
+			var outBuffer bytes.Buffer
+			logger := ctx.Logger.Output(&outBuffer)
+			ctx.Logger = &logger
+			ctx.Info("Hello")
+			var entry map[string]interface{}
+			Expect(json.Unmarshal(outBuffer.Bytes(), &entry)).To(Succeed())
+			Expect(entry["requestId"]).To(Equal("gateway-123"))
+		})
+	})
+})
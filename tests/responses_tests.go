@@ -0,0 +1,160 @@
+package toolkits
+
+import (
+	"encoding/json"
+	"errors"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("Responses", func() {
+	var rq *http.Request
+	var rr *httptest.ResponseRecorder
+	var ctx toolkit.FunctionContext
+
+	BeforeEach(func() {
+		rq = httptest.NewRequest(http.MethodGet, "/", nil)
+		rr = httptest.NewRecorder()
+		ctx = toolkit.FuncCtx(rr, rq)
+	})
+	When("OkResponse is called", func() {
+		It("should write the body with the given content type", func() {
+			ctx.OkResponse("text/plain", []byte("hello"))
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(rr.Header().Get("Content-Type")).To(Equal("text/plain"))
+			Expect(rr.Body.String()).To(Equal("hello"))
+		})
+	})
+	When("OkResponseJson is called", func() {
+		It("should wrap the data in a success response", func() {
+			ctx.OkResponseJson(toolkit.Json{"Foo": "Bar", "Heh": 1234.})
+			var res toolkit.SuccessResponseStruct
+			Expect(json.Unmarshal(rr.Body.Bytes(), &res)).To(Succeed())
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(rr.Header().Get("Content-Type")).To(Equal("application/json; charset=utf-8"))
+			Expect(res.SpanId).To(Equal(ctx.SpanId))
+			Expect(res.Data).To(Equal(toolkit.Json{"Foo": "Bar", "Heh": 1234.}.AsMap()))
+		})
+	})
+	When("FailResponse is called", func() {
+		It("should send the message with the given status code", func() {
+			ctx.FailResponse(http.StatusBadRequest, "bad input")
+			var res toolkit.ErrorResponseStruct
+			Expect(json.Unmarshal(rr.Body.Bytes(), &res)).To(Succeed())
+			Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			Expect(res.SpanId).To(Equal(ctx.SpanId))
+			Expect(res.Message).To(Equal("bad input"))
+		})
+	})
+	When("ErrResponse is called", func() {
+		It("should send the message but not the error", func() {
+			ctx.ErrResponse(http.StatusInternalServerError, errors.New("secret failure"), "something went wrong")
+			Expect(rr.Code).To(Equal(http.StatusInternalServerError))
+			Expect(rr.Body.String()).To(ContainSubstring("something went wrong"))
+			Expect(rr.Body.String()).ToNot(ContainSubstring("secret failure"))
+		})
+	})
+	When("ErrResponseDetails is called", func() {
+		It("should send the details", func() {
+			ctx.ErrResponseDetails(http.StatusUnprocessableEntity, nil, "validation failed", []toolkit.ErrorDetail{{Field: "email", Code: "invalid_format", Message: "not an email"}})
+			var res toolkit.ErrorResponseStruct
+			Expect(json.Unmarshal(rr.Body.Bytes(), &res)).To(Succeed())
+			Expect(rr.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(res.Details).To(Equal([]toolkit.ErrorDetail{{Field: "email", Code: "invalid_format", Message: "not an email"}}))
+		})
+	})
+	When("SetResponseHeader is called", func() {
+		It("should add the header to the response", func() {
+			ctx.SetResponseHeader("X-Foo", "bar")
+			ctx.OkResponse("text/plain", nil)
+			Expect(rr.Header().Get("X-Foo")).To(Equal("bar"))
+		})
+	})
+	When("CreatedResponse is called", func() {
+		It("should send a 201 with the Location header", func() {
+			ctx.CreatedResponse("/orders/1", toolkit.Json{"id": "1"})
+			Expect(rr.Code).To(Equal(http.StatusCreated))
+			Expect(rr.Header().Get("Location")).To(Equal("/orders/1"))
+			Expect(rr.Body.String()).To(ContainSubstring(`"data":{"id":"1"}`))
+		})
+	})
+	When("AcceptedResponse is called", func() {
+		It("should send a 202 with the status url", func() {
+			ctx.AcceptedResponse("/operations/1")
+			Expect(rr.Code).To(Equal(http.StatusAccepted))
+			Expect(rr.Header().Get("Location")).To(Equal("/operations/1"))
+			Expect(rr.Body.String()).To(ContainSubstring(`"statusUrl":"/operations/1"`))
+		})
+	})
+	When("NoContentResponse is called", func() {
+		It("should send a 204 without a body", func() {
+			ctx.NoContentResponse()
+			Expect(rr.Code).To(Equal(http.StatusNoContent))
+			Expect(rr.Body.Len()).To(BeZero())
+		})
+	})
+	When("problem json is enabled", func() {
+		BeforeEach(func() {
+			toolkit.Configure(toolkit.WithProblemJson(true))
+		})
+		AfterEach(func() {
+			toolkit.Configure(toolkit.WithProblemJson(false))
+		})
+		It("should send error responses as RFC 7807 documents", func() {
+			ctx.FailResponse(http.StatusNotFound, "order not found")
+			var res toolkit.ProblemResponseStruct
+			Expect(json.Unmarshal(rr.Body.Bytes(), &res)).To(Succeed())
+			Expect(rr.Header().Get("Content-Type")).To(Equal("application/problem+json"))
+			Expect(res).To(Equal(toolkit.ProblemResponseStruct{Type: "about:blank", Title: "Not Found", Status: 404, Detail: "order not found", Instance: ctx.SpanId}))
+		})
+	})
+	When("Redirect is called", func() {
+		It("should set the Location header", func() {
+			ctx.Redirect(http.StatusFound, "https://example.com/login")
+			Expect(rr.Code).To(Equal(http.StatusFound))
+			Expect(rr.Header().Get("Location")).To(Equal("https://example.com/login"))
+		})
+		It("should reject urls containing line breaks", func() {
+			ctx.Redirect(http.StatusFound, "https://example.com/\r\nSet-Cookie: a=b")
+			Expect(rr.Code).To(Equal(http.StatusInternalServerError))
+			Expect(rr.Header().Get("Location")).To(BeEmpty())
+		})
+	})
+	When("response metadata is enabled", func() {
+		BeforeEach(func() {
+			toolkit.Configure(toolkit.WithResponseMeta("1.2.3"))
+		})
+		AfterEach(func() {
+			toolkit.Configure(toolkit.WithoutResponseMeta())
+		})
+		It("should add the meta object to success responses", func() {
+			ctx.OkResponseJson(toolkit.Json{"id": "1"})
+			var res toolkit.SuccessResponseStruct
+			Expect(json.Unmarshal(rr.Body.Bytes(), &res)).To(Succeed())
+			Expect(res.Meta).ToNot(BeNil())
+			Expect(res.Meta.AppVersion).To(Equal("1.2.3"))
+			Expect(res.Meta.DurationMs).To(BeNumerically(">=", 0))
+		})
+	})
+	When("the request method is HEAD", func() {
+		It("should only send the headers", func() {
+			ctx = toolkit.FuncCtx(rr, httptest.NewRequest(http.MethodHead, "/", nil))
+			ctx.OkResponse("text/plain", []byte("hello"))
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(rr.Header().Get("Content-Length")).To(Equal("5"))
+			Expect(rr.Header().Get("Content-Type")).To(Equal("text/plain"))
+			Expect(rr.Body.Len()).To(BeZero())
+		})
+		It("should skip the body of streamed responses", func() {
+			ctx = toolkit.FuncCtx(rr, httptest.NewRequest(http.MethodHead, "/", nil))
+			stream, err := ctx.StreamResponseJson()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stream.Encode(1)).To(Succeed())
+			Expect(stream.Close()).To(Succeed())
+			Expect(rr.Body.Len()).To(BeZero())
+		})
+	})
+})
@@ -0,0 +1,80 @@
+package toolkits
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+var _ = Describe("Retryable", func() {
+	var rr *httptest.ResponseRecorder
+	var ctx toolkit.FunctionContext
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+		ctx = toolkit.FuncCtx(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter(), toolkit.WithProblemJson(false))
+	})
+	response := func() toolkit.ErrorResponseStruct {
+		var res toolkit.ErrorResponseStruct
+		Expect(json.Unmarshal(rr.Body.Bytes(), &res)).To(Succeed())
+		return res
+	}
+	When("ErrResponse is called with a retryable error", func() {
+		It("should respond with a 503 status, a Retry-After header and the retryable flag", func() {
+			ctx.ErrResponse(http.StatusInternalServerError, toolkit.Retryable(errors.New("database is failing over"), 1500*time.Millisecond), "Try again later")
+			Expect(rr.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(rr.Header().Get("Retry-After")).To(Equal("2"))
+			Expect(response().Retryable).To(BeTrue())
+		})
+		It("should keep a 429 status", func() {
+			ctx.ErrResponse(http.StatusTooManyRequests, toolkit.Retryable(errors.New("quota exceeded"), time.Minute), "Slow down")
+			Expect(rr.Code).To(Equal(http.StatusTooManyRequests))
+			Expect(rr.Header().Get("Retry-After")).To(Equal("60"))
+		})
+		It("should add the flag to problem responses", func() {
+			toolkit.Configure(toolkit.WithProblemJson(true))
+			ctx.ErrResponse(http.StatusBadGateway, toolkit.Retryable(errors.New("upstream down"), 0), "Upstream down")
+			Expect(rr.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(rr.Header().Get("Retry-After")).To(BeEmpty())
+			Expect(rr.Body.String()).To(ContainSubstring(`"retryable":true`))
+		})
+	})
+	When("ErrResponse is called with an error which isn't retryable", func() {
+		It("should not add the flag", func() {
+			ctx.ErrResponse(http.StatusInternalServerError, errors.New("bug"), "Failed")
+			Expect(rr.Code).To(Equal(http.StatusInternalServerError))
+			Expect(rr.Header().Get("Retry-After")).To(BeEmpty())
+			Expect(response().Retryable).To(BeFalse())
+		})
+	})
+	When("a handler returns a wrapped retryable error", func() {
+		It("should respond with a 503 status", func() {
+			rr = httptest.NewRecorder()
+			toolkit.Handle(func(ctx toolkit.FunctionContext) error {
+				return fmt.Errorf("publishing: %w", toolkit.Retryable(errors.New("unavailable"), 10*time.Second))
+			}).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+			Expect(rr.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(rr.Header().Get("Retry-After")).To(Equal("10"))
+		})
+	})
+	When("the delay of an error is read", func() {
+		It("should find it through wrapping", func() {
+			after, ok := toolkit.RetryAfter(fmt.Errorf("x: %w", toolkit.Retryable(errors.New("y"), time.Second)))
+			Expect(ok).To(BeTrue())
+			Expect(after).To(Equal(time.Second))
+			_, ok = toolkit.RetryAfter(errors.New("y"))
+			Expect(ok).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,143 @@
+package toolkits
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+// testSigningKey signs the tokens of the tests, and is served as a JSON Web Key Set by keysServer
+var testSigningKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+
+// signToken creates an RS256 JWT with the given claims, signed by testSigningKey
+func signToken(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test-key", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, _ := rsa.SignPKCS1v15(rand.Reader, testSigningKey, crypto.SHA256, digest[:])
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// keysServer serves the public key of testSigningKey as a JSON Web Key Set
+func keysServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kid": "test-key",
+			"kty": "RSA",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(testSigningKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(testSigningKey.E)).Bytes()),
+		}}})
+	}))
+}
+
+var _ = Describe("RequireScheduler", func() {
+	var recorder *httptest.ResponseRecorder
+	var scheduled time.Time
+	ok := func(ctx toolkit.FunctionContext) error {
+		scheduled, _ = ctx.ScheduleTime()
+		return nil
+	}
+
+	BeforeEach(func() {
+		recorder = httptest.NewRecorder()
+		scheduled = time.Time{}
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+	When("the job sends an OIDC token", func() {
+		var server *httptest.Server
+		var handler http.HandlerFunc
+		var claims map[string]interface{}
+
+		BeforeEach(func() {
+			server = keysServer()
+			handler = toolkit.Chain(toolkit.RequireScheduler(toolkit.SchedulerConfig{
+				Audience:       "https://reports.example.com",
+				ServiceAccount: "scheduler@test-project.iam.gserviceaccount.com",
+				KeysUrl:        server.URL,
+			})).Then(ok)
+			claims = map[string]interface{}{
+				"iss":   "https://accounts.google.com",
+				"aud":   "https://reports.example.com",
+				"email": "scheduler@test-project.iam.gserviceaccount.com",
+				"exp":   time.Now().Add(time.Hour).Unix(),
+			}
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+		request := func(token string) *http.Request {
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			r.Header.Set("Authorization", "Bearer "+token)
+			r.Header.Set("X-CloudScheduler-ScheduleTime", "2024-05-01T06:00:00Z")
+			return r
+		}
+		It("should run the handler with the schedule time when the token is valid", func() {
+			handler(recorder, request(signToken(claims)))
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(scheduled).To(Equal(time.Date(2024, 5, 1, 6, 0, 0, 0, time.UTC)))
+		})
+		It("should reject tokens for another audience", func() {
+			claims["aud"] = "https://billing.example.com"
+			handler(recorder, request(signToken(claims)))
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+		})
+		It("should reject tokens of another service account", func() {
+			claims["email"] = "attacker@example.com"
+			handler(recorder, request(signToken(claims)))
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+		})
+		It("should reject expired tokens", func() {
+			claims["exp"] = time.Now().Add(-time.Hour).Unix()
+			handler(recorder, request(signToken(claims)))
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+		})
+		It("should reject tokens with an invalid signature", func() {
+			token := signToken(claims)
+			handler(recorder, request(token[:len(token)-4]+"AAAA"))
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+		})
+	})
+	When("the job sends a shared secret", func() {
+		var handler http.HandlerFunc
+
+		BeforeEach(func() {
+			handler = toolkit.Chain(toolkit.RequireScheduler(toolkit.SchedulerConfig{Secret: "s3cret"})).Then(ok)
+		})
+		It("should run the handler when the secret matches", func() {
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			r.Header.Set("X-Scheduler-Secret", "s3cret")
+			handler(recorder, r)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+		})
+		It("should reject requests without the secret", func() {
+			handler(recorder, httptest.NewRequest(http.MethodPost, "/", nil))
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+		})
+	})
+	When("neither an audience nor a secret is configured", func() {
+		It("should panic", func() {
+			Expect(func() { toolkit.RequireScheduler(toolkit.SchedulerConfig{}) }).To(Panic())
+		})
+	})
+	When("an audience is configured without a service account", func() {
+		It("should panic", func() {
+			Expect(func() { toolkit.RequireScheduler(toolkit.SchedulerConfig{Audience: "https://reports.example.com"}) }).To(Panic())
+		})
+	})
+})
@@ -0,0 +1,70 @@
+package toolkits
+
+import (
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("SecurityHeaders", func() {
+	BeforeEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+
+	request := func(security toolkit.SecurityHeadersConfig, path string, handler toolkit.HandlerFunc) http.Header {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		rr := httptest.NewRecorder()
+		toolkit.Chain(toolkit.SecurityHeaders(security)).Then(handler)(rr, r)
+		return rr.Header()
+	}
+	ok := func(ctx toolkit.FunctionContext) error {
+		ctx.OkResponseJson(toolkit.Json{"ok": true})
+		return nil
+	}
+
+	It("should add the default headers to every response", func() {
+		header := request(toolkit.DefaultSecurityHeaders(), "/", ok)
+		Expect(header.Get("Strict-Transport-Security")).To(Equal("max-age=63072000; includeSubDomains"))
+		Expect(header.Get("X-Content-Type-Options")).To(Equal("nosniff"))
+		Expect(header.Get("Content-Security-Policy")).To(Equal("default-src 'none'; frame-ancestors 'none'"))
+		Expect(header.Get("Referrer-Policy")).To(Equal("no-referrer"))
+		Expect(header.Get("X-Frame-Options")).To(Equal("DENY"))
+		header = request(toolkit.DefaultSecurityHeaders(), "/", func(ctx toolkit.FunctionContext) error {
+			return toolkit.NotFound("Order not found")
+		})
+		Expect(header.Get("X-Content-Type-Options")).To(Equal("nosniff"))
+	})
+	It("should skip the headers which aren't set", func() {
+		header := request(toolkit.SecurityHeadersConfig{ContentTypeOptions: "nosniff"}, "/", ok)
+		Expect(header.Get("X-Content-Type-Options")).To(Equal("nosniff"))
+		Expect(header).NotTo(HaveKey("Strict-Transport-Security"))
+		Expect(header).NotTo(HaveKey("X-Frame-Options"))
+	})
+	It("should use the headers of the longest matching route", func() {
+		security := toolkit.DefaultSecurityHeaders()
+		docs := toolkit.DefaultSecurityHeaders()
+		docs.ContentSecurityPolicy = "default-src 'self'; script-src 'self' cdn.example.com"
+		embed := docs
+		embed.FrameOptions = ""
+		security.Routes = map[string]toolkit.SecurityHeadersConfig{"/docs/": docs, "/docs/embed/": embed}
+		Expect(request(security, "/orders", ok).Get("Content-Security-Policy")).To(Equal("default-src 'none'; frame-ancestors 'none'"))
+		header := request(security, "/docs/index.html", ok)
+		Expect(header.Get("Content-Security-Policy")).To(Equal("default-src 'self'; script-src 'self' cdn.example.com"))
+		Expect(header.Get("X-Frame-Options")).To(Equal("DENY"))
+		header = request(security, "/docs/embed/widget", ok)
+		Expect(header).NotTo(HaveKey("X-Frame-Options"))
+	})
+	It("should let handlers change the headers", func() {
+		header := request(toolkit.DefaultSecurityHeaders(), "/", func(ctx toolkit.FunctionContext) error {
+			ctx.SetResponseHeader("X-Frame-Options", "SAMEORIGIN")
+			return ok(ctx)
+		})
+		Expect(header.Get("X-Frame-Options")).To(Equal("SAMEORIGIN"))
+	})
+})
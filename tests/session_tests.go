@@ -0,0 +1,236 @@
+package toolkits
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"time"
+)
+
+// memorySessionStore is a SessionStore keeping sessions in a map
+type memorySessionStore struct {
+	sessions map[string]map[string]interface{}
+	fail     bool
+}
+
+func (this *memorySessionStore) Load(_ context.Context, id string) (map[string]interface{}, error) {
+	if this.fail {
+		return nil, errors.New("store is down")
+	}
+	return this.sessions[id], nil
+}
+
+func (this *memorySessionStore) Save(_ context.Context, id string, values map[string]interface{}, _ time.Duration) error {
+	this.sessions[id] = values
+	return nil
+}
+
+func (this *memorySessionStore) Delete(_ context.Context, id string) error {
+	delete(this.sessions, id)
+	return nil
+}
+
+var _ = Describe("Sessions", func() {
+	var sessions toolkit.SessionConfig
+	var cookie *http.Cookie
+
+	BeforeEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard), toolkit.WithCookieSecrets("secret"))
+		sessions, cookie = toolkit.SessionConfig{}, nil
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter(), toolkit.WithCookieSecrets())
+	})
+
+	// request calls the handler with the cookie of the previous response, and keeps the cookie of its response
+	request := func(handler toolkit.HandlerFunc) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		toolkit.Chain(toolkit.Sessions(sessions)).Then(handler)(rr, r)
+		for _, c := range rr.Result().Cookies() {
+			cookie = c
+		}
+		return rr
+	}
+	login := func(ctx toolkit.FunctionContext) error {
+		ctx.Session().Set("user", "alice")
+		return nil
+	}
+	whoami := func(ctx toolkit.FunctionContext) error {
+		ctx.OkResponseJson(toolkit.Json{"user": ctx.Session().GetString("user")})
+		return nil
+	}
+	logout := func(ctx toolkit.FunctionContext) error {
+		ctx.Session().Destroy()
+		return nil
+	}
+
+	When("sessions are kept in a cookie", func() {
+		It("should keep the values of the session in an encrypted cookie", func() {
+			request(login)
+			Expect(cookie.Name).To(Equal("session"))
+			Expect(cookie.HttpOnly).To(BeTrue())
+			Expect(cookie.Secure).To(BeTrue())
+			Expect(cookie.SameSite).To(Equal(http.SameSiteLaxMode))
+			Expect(cookie.MaxAge).To(Equal(86400))
+			Expect(cookie.Value).NotTo(ContainSubstring("alice"))
+			Expect(request(whoami).Body.String()).To(ContainSubstring(`"user":"alice"`))
+		})
+		It("should only set the cookie when the session changed", func() {
+			rr := request(whoami)
+			Expect(rr.Result().Cookies()).To(BeEmpty())
+			Expect(rr.Body.String()).To(ContainSubstring(`"user":""`))
+		})
+		It("should expire the cookie of a destroyed session", func() {
+			request(login)
+			request(logout)
+			Expect(cookie.MaxAge).To(Equal(-1))
+		})
+	})
+	When("sessions are kept in a store", func() {
+		var store *memorySessionStore
+
+		BeforeEach(func() {
+			store = &memorySessionStore{sessions: map[string]map[string]interface{}{}}
+			sessions.Store = store
+		})
+
+		It("should keep the values in the store and the id in a signed cookie", func() {
+			request(login)
+			Expect(store.sessions).To(HaveLen(1))
+			for id, values := range store.sessions {
+				Expect(cookie.Value).To(HavePrefix(base64.RawURLEncoding.EncodeToString([]byte(id))))
+				Expect(values).To(HaveKeyWithValue("user", "alice"))
+			}
+			Expect(request(whoami).Body.String()).To(ContainSubstring(`"user":"alice"`))
+		})
+		It("should delete destroyed sessions", func() {
+			request(login)
+			request(logout)
+			Expect(store.sessions).To(BeEmpty())
+			Expect(request(whoami).Body.String()).To(ContainSubstring(`"user":""`))
+		})
+		It("should give a renewed session a new id", func() {
+			request(login)
+			previous := cookie.Value
+			request(func(ctx toolkit.FunctionContext) error {
+				ctx.Session().Renew()
+				return nil
+			})
+			Expect(cookie.Value).NotTo(Equal(previous))
+			Expect(store.sessions).To(HaveLen(1))
+			Expect(request(whoami).Body.String()).To(ContainSubstring(`"user":"alice"`))
+		})
+		It("should save the session when the handler writes its own response", func() {
+			request(func(ctx toolkit.FunctionContext) error {
+				ctx.Session().Set("user", "alice")
+				ctx.OkResponse("text/plain", []byte("Logged in"))
+				return nil
+			})
+			Expect(store.sessions).To(HaveLen(1))
+			Expect(cookie).NotTo(BeNil())
+		})
+		It("should respond with a 503 status when the store fails", func() {
+			request(login)
+			store.fail = true
+			Expect(request(whoami).Code).To(Equal(http.StatusServiceUnavailable))
+		})
+	})
+	When("sessions are kept in Redis", func() {
+		It("should get, set and delete the session's key", func() {
+			values := map[string]string{}
+			sessions.Store = toolkit.NewRedisSessionStore(func(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+				Expect(keys[0]).To(HavePrefix("session:"))
+				switch {
+				case strings.Contains(script, "'GET'"):
+					if value, ok := values[keys[0]]; ok {
+						return value, nil
+					}
+					return nil, errors.New("redis: nil")
+				case strings.Contains(script, "'SET'"):
+					Expect(args[1]).To(Equal(int64(86400000)))
+					values[keys[0]] = args[0].(string)
+				case strings.Contains(script, "'DEL'"):
+					delete(values, keys[0])
+				}
+				return "OK", nil
+			})
+			request(login)
+			Expect(values).To(HaveLen(1))
+			Expect(request(whoami).Body.String()).To(ContainSubstring(`"user":"alice"`))
+			request(logout)
+			Expect(values).To(BeEmpty())
+		})
+	})
+	When("sessions are kept in Firestore", func() {
+		var server *httptest.Server
+		var documents map[string]json.RawMessage
+
+		BeforeEach(func() {
+			documents = map[string]json.RawMessage{}
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasSuffix(r.URL.Path, "/token") {
+					_, _ = w.Write([]byte(`{"access_token":"test-token","expires_in":3600}`))
+					return
+				}
+				Expect(r.URL.Path).To(HavePrefix("/v1/projects/test-project/databases/(default)/documents/sessions/"))
+				switch r.Method {
+				case http.MethodGet:
+					document, ok := documents[r.URL.Path]
+					if !ok {
+						w.WriteHeader(http.StatusNotFound)
+						return
+					}
+					_, _ = w.Write(document)
+				case http.MethodPatch:
+					body, _ := io.ReadAll(r.Body)
+					documents[r.URL.Path] = body
+					_, _ = w.Write(body)
+				case http.MethodDelete:
+					delete(documents, r.URL.Path)
+					_, _ = w.Write([]byte(`{}`))
+				}
+			}))
+			os.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(server.URL, "http://"))
+			os.Setenv("GOOGLE_CLOUD_PROJECT", "test-project")
+			store := toolkit.NewFirestoreSessionStore("sessions")
+			store.Endpoint = server.URL
+			sessions.Store = store
+		})
+		AfterEach(func() {
+			os.Unsetenv("GCE_METADATA_HOST")
+			server.Close()
+		})
+
+		It("should keep every session in a document", func() {
+			request(login)
+			Expect(documents).To(HaveLen(1))
+			for _, document := range documents {
+				Expect(string(document)).To(ContainSubstring(`"expireAt":{"timestampValue"`))
+			}
+			Expect(request(whoami).Body.String()).To(ContainSubstring(`"user":"alice"`))
+			request(logout)
+			Expect(documents).To(BeEmpty())
+		})
+		It("should ignore expired sessions", func() {
+			request(login)
+			for path, document := range documents {
+				documents[path] = json.RawMessage(`{"fields":{"values":{"stringValue":"{\"user\":\"alice\"}"},"expireAt":{"timestampValue":"2024-06-01T00:00:00Z"}}}`)
+				Expect(document).NotTo(BeEmpty())
+			}
+			Expect(request(whoami).Body.String()).To(ContainSubstring(`"user":""`))
+		})
+	})
+})
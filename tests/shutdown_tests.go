@@ -0,0 +1,108 @@
+package toolkits
+
+import (
+	"context"
+	"errors"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+var _ = Describe("Shutdown", func() {
+	var rq *http.Request
+
+	BeforeEach(func() {
+		rq = httptest.NewRequest(http.MethodGet, "/", nil)
+		toolkit.ResetShutdown()
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+	})
+	AfterEach(func() {
+		toolkit.ResetShutdown()
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+	When("requests are handled", func() {
+		It("should count them as in flight until they respond", func() {
+			ctx := toolkit.FuncCtx(httptest.NewRecorder(), rq)
+			Expect(toolkit.InFlightRequests()).To(Equal(1))
+			ctx.NoContentResponse()
+			Expect(toolkit.InFlightRequests()).To(Equal(0))
+		})
+		It("should stop counting them when the server ends the request", func() {
+			requestContext, cancel := context.WithCancel(context.Background())
+			toolkit.FuncCtx(httptest.NewRecorder(), rq.WithContext(requestContext))
+			Expect(toolkit.InFlightRequests()).To(Equal(1))
+			cancel()
+			Eventually(toolkit.InFlightRequests).Should(Equal(0))
+		})
+	})
+	When("the instance shuts down", func() {
+		It("should wait for the requests in flight, then run the hooks in reverse order", func() {
+			var mutex sync.Mutex
+			var events []string
+			record := func(event string) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				events = append(events, event)
+			}
+			toolkit.OnShutdown(func(ctx context.Context) error {
+				record("close database")
+				return nil
+			})
+			toolkit.OnShutdown(func(ctx context.Context) error {
+				record("flush cache")
+				return nil
+			})
+			ctx := toolkit.FuncCtx(httptest.NewRecorder(), rq)
+			go func() {
+				time.Sleep(30 * time.Millisecond)
+				record("response")
+				ctx.NoContentResponse()
+			}()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			Expect(toolkit.Shutdown(shutdownCtx)).To(Succeed())
+			Expect(events).To(Equal([]string{"response", "flush cache", "close database"}))
+			Expect(toolkit.ShuttingDown()).To(BeTrue())
+		})
+		It("should give up on requests which don't complete within the grace period", func() {
+			toolkit.FuncCtx(httptest.NewRecorder(), rq)
+			hookRan := false
+			var hookErr error
+			toolkit.OnShutdown(func(ctx context.Context) error {
+				hookRan, hookErr = true, ctx.Err()
+				return nil
+			})
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+			defer cancel()
+			err := toolkit.Shutdown(shutdownCtx)
+			Expect(err).To(MatchError(ContainSubstring("1 requests still in flight")))
+			Expect(hookRan).To(BeTrue())
+			Expect(hookErr).NotTo(HaveOccurred())
+		})
+		It("should return the errors of the hooks", func() {
+			toolkit.OnShutdown(func(ctx context.Context) error {
+				return errors.New("connection already closed")
+			})
+			toolkit.OnShutdown(func(ctx context.Context) error {
+				panic("boom")
+			})
+			err := toolkit.Shutdown(context.Background())
+			Expect(err).To(MatchError(ContainSubstring("connection already closed")))
+			Expect(err).To(MatchError(ContainSubstring("shutdown hook panicked: boom")))
+		})
+		It("should refuse new requests", func() {
+			Expect(toolkit.Shutdown(context.Background())).To(Succeed())
+			rr := httptest.NewRecorder()
+			toolkit.Handle(func(ctx toolkit.FunctionContext) error {
+				Fail("the handler should not be called")
+				return nil
+			}).ServeHTTP(rr, rq)
+			Expect(rr.Code).To(Equal(http.StatusServiceUnavailable))
+		})
+	})
+})
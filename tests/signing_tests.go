@@ -0,0 +1,85 @@
+package toolkits
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+var _ = Describe("Request signing", func() {
+	var server *httptest.Server
+	var received *http.Request
+	var receivedBody string
+
+	BeforeEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			received, receivedBody = r, string(body)
+		}))
+	})
+	AfterEach(func() {
+		server.Close()
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+
+	When("signing with AWS Signature Version 4", func() {
+		signer := &toolkit.AWSSigner{AccessKeyId: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", Region: "us-east-1", Service: "service"}
+
+		It("should match the signature of the AWS test suite", func() {
+			rq, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+			rq.Header.Set("X-Amz-Date", "20150830T123600Z")
+			Expect(signer.Sign(rq, nil)).To(Succeed())
+			Expect(rq.Header.Get("Authorization")).To(Equal("AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"))
+		})
+		It("should sign the payload and session token of S3 requests", func() {
+			s3 := toolkit.NewAWSSigner("s3", "auto")
+			s3.AccessKeyId, s3.SecretAccessKey, s3.SessionToken = "AKIDEXAMPLE", "secret", "session"
+			ctx := toolkit.FuncCtx(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+			res, err := ctx.SignedHTTPClient(s3).Post(server.URL+"/bucket/my file.txt", "text/plain", strings.NewReader("contents"))
+			Expect(err).NotTo(HaveOccurred())
+			_ = res.Body.Close()
+			hash := sha256.Sum256([]byte("contents"))
+			Expect(received.Header.Get("X-Amz-Content-Sha256")).To(Equal(hex.EncodeToString(hash[:])))
+			Expect(received.Header.Get("X-Amz-Security-Token")).To(Equal("session"))
+			Expect(received.Header.Get("Authorization")).To(ContainSubstring("/auto/s3/aws4_request, SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date;x-amz-security-token, "))
+			Expect(received.Header.Get("traceparent")).NotTo(BeEmpty())
+			Expect(receivedBody).To(Equal("contents"))
+		})
+		It("should fail without credentials", func() {
+			rq, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+			Expect((&toolkit.AWSSigner{Region: "us-east-1", Service: "s3"}).Sign(rq, nil)).NotTo(Succeed())
+		})
+	})
+	When("signing with an HMAC", func() {
+		It("should sign requests which RequireHMAC accepts with the same config", func() {
+			hmacConfig := toolkit.HMACConfig{Header: "X-Signature", Secret: "partner-secret", Prefix: "sha256=", TimestampHeader: "X-Timestamp",
+				SignedPayload: func(timestamp string, body []byte) []byte { return append([]byte(timestamp+"."), body...) }}
+			var verified bool
+			verifier := httptest.NewServer(toolkit.Chain(toolkit.RequireHMAC(hmacConfig)).Then(func(ctx toolkit.FunctionContext) error {
+				verified = true
+				return nil
+			}))
+			defer verifier.Close()
+			ctx := toolkit.FuncCtx(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+			res, err := ctx.SignedHTTPClient(hmacConfig).Post(verifier.URL, "application/json", strings.NewReader(`{"id":1}`))
+			Expect(err).NotTo(HaveOccurred())
+			_ = res.Body.Close()
+			Expect(res.StatusCode).To(Equal(http.StatusOK))
+			Expect(verified).To(BeTrue())
+
+			hmacConfig.Secret = "other-secret"
+			res, err = ctx.SignedHTTPClient(hmacConfig).Post(verifier.URL, "application/json", strings.NewReader(`{"id":1}`))
+			Expect(err).NotTo(HaveOccurred())
+			_ = res.Body.Close()
+			Expect(res.StatusCode).To(Equal(http.StatusUnauthorized))
+		})
+	})
+})
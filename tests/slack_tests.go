@@ -0,0 +1,118 @@
+package toolkits
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var _ = Describe("RequireSlackSignature", func() {
+	const body = `{"type":"event_callback","team_id":"T1","api_app_id":"A1","event_id":"Ev1","event_time":1718000000,` +
+		`"event":{"type":"app_mention","user":"U1","text":"<@U0> deploy","channel":"C1"}}`
+	var handler http.HandlerFunc
+	var events []toolkit.SlackEvent
+	var mention struct {
+		User string `json:"user"`
+		Text string `json:"text"`
+	}
+	var command string
+
+	BeforeEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+		events, command = nil, ""
+		handler = toolkit.Chain(toolkit.RequireSlackSignature("slack-secret")).Then(func(ctx toolkit.FunctionContext) error {
+			if command = ctx.Request.PostFormValue("command"); command != "" {
+				return nil
+			}
+			event, err := ctx.SlackEvent()
+			if err != nil {
+				return err
+			}
+			events = append(events, event)
+			return event.Bind(&mention)
+		})
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+
+	sign := func(secret string, timestamp string, body string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		fmt.Fprintf(mac, "v0:%v:%v", timestamp, body)
+		return "v0=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	request := func(timestamp string, signature string, contentType string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		r.Header.Set("X-Slack-Request-Timestamp", timestamp)
+		r.Header.Set("X-Slack-Signature", signature)
+		rr := httptest.NewRecorder()
+		handler(rr, r)
+		return rr
+	}
+	now := func() string {
+		return strconv.FormatInt(time.Now().Unix(), 10)
+	}
+
+	When("the request is correctly signed", func() {
+		It("should run the handler with the typed event", func() {
+			timestamp := now()
+			Expect(request(timestamp, sign("slack-secret", timestamp, body), "application/json", body).Code).To(Equal(http.StatusOK))
+			Expect(events).To(HaveLen(1))
+			Expect(events[0].EventId).To(Equal("Ev1"))
+			Expect(events[0].EventType()).To(Equal("app_mention"))
+			Expect(mention.User).To(Equal("U1"))
+			Expect(mention.Text).To(Equal("<@U0> deploy"))
+		})
+		It("should let slash commands read their form fields", func() {
+			timestamp, form := now(), "command=%2Fdeploy&text=api&user_id=U1"
+			Expect(request(timestamp, sign("slack-secret", timestamp, form), "application/x-www-form-urlencoded", form).Code).To(Equal(http.StatusOK))
+			Expect(command).To(Equal("/deploy"))
+		})
+		It("should answer the URL verification challenge", func() {
+			timestamp, challenge := now(), `{"type":"url_verification","token":"t","challenge":"3eZbrw1aBm2rZgRNFdxV2595E9CY3gmdALWMmHkvFXO7tYXAYM8P"}`
+			rr := request(timestamp, sign("slack-secret", timestamp, challenge), "application/json", challenge)
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(rr.Body.String()).To(Equal("3eZbrw1aBm2rZgRNFdxV2595E9CY3gmdALWMmHkvFXO7tYXAYM8P"))
+			Expect(events).To(BeEmpty())
+		})
+	})
+	When("the request isn't correctly signed", func() {
+		It("should respond with a 401 status without running the handler", func() {
+			timestamp := now()
+			Expect(request(timestamp, sign("other", timestamp, body), "application/json", body).Code).To(Equal(http.StatusUnauthorized))
+			Expect(request(timestamp, "", "application/json", body).Code).To(Equal(http.StatusUnauthorized))
+			Expect(request(now(), sign("slack-secret", "1", body), "application/json", body).Code).To(Equal(http.StatusUnauthorized))
+			Expect(events).To(BeEmpty())
+		})
+		It("should reject requests signed too long ago", func() {
+			stale := strconv.FormatInt(time.Now().Add(-6*time.Minute).Unix(), 10)
+			Expect(request(stale, sign("slack-secret", stale, body), "application/json", body).Code).To(Equal(http.StatusUnauthorized))
+			Expect(events).To(BeEmpty())
+		})
+	})
+	When("the signing secret is empty", func() {
+		It("should panic", func() {
+			Expect(func() { toolkit.RequireSlackSignature("") }).To(Panic())
+		})
+	})
+	When("a request is replayed", func() {
+		It("should acknowledge it without running the handler again", func() {
+			timestamp := now()
+			signature := sign("slack-secret", timestamp, body)
+			Expect(request(timestamp, signature, "application/json", body).Code).To(Equal(http.StatusOK))
+			Expect(request(timestamp, signature, "application/json", body).Code).To(Equal(http.StatusOK))
+			Expect(events).To(HaveLen(1))
+		})
+	})
+})
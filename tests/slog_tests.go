@@ -0,0 +1,69 @@
+package toolkits
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+)
+
+type slogContextKey struct{}
+
+// contextHandler records the contexts it handles records with
+type contextHandler struct {
+	slog.Handler
+	contexts *[]context.Context
+}
+
+func (this contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	*this.contexts = append(*this.contexts, ctx)
+	return this.Handler.Handle(ctx, record)
+}
+
+var _ = Describe("WithSlogHandler", func() {
+	var outBuffer bytes.Buffer
+	var ctx toolkit.FunctionContext
+
+	BeforeEach(func() {
+		outBuffer.Reset()
+		toolkit.Configure(toolkit.WithSlogHandler(slog.NewJSONHandler(&outBuffer, &slog.HandlerOptions{Level: slog.LevelInfo})))
+		ctx = toolkit.FuncCtx(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+	When("a message is logged", func() {
+		It("should be handled by the slog handler with its fields as attributes", func() {
+			ctx.WithField("orderId", 42).Warnf("Order %v is late", 42)
+			var record map[string]interface{}
+			Expect(json.Unmarshal(outBuffer.Bytes(), &record)).To(Succeed())
+			Expect(record["level"]).To(Equal("WARN"))
+			Expect(record["msg"]).To(Equal("Order 42 is late"))
+			Expect(record["orderId"]).To(Equal(42.0))
+			Expect(record["spanId"]).To(Equal("[" + ctx.SpanId + "]"))
+			Expect(record["caller"]).To(ContainSubstring("slog_tests.go"))
+		})
+	})
+	When("a context aware handler is used", func() {
+		It("should get the context of the request", func() {
+			var contexts []context.Context
+			toolkit.Configure(toolkit.WithSlogHandler(contextHandler{Handler: slog.NewJSONHandler(&outBuffer, nil), contexts: &contexts}))
+			rq := httptest.NewRequest(http.MethodGet, "/", nil)
+			ctx = toolkit.FuncCtx(httptest.NewRecorder(), rq.WithContext(context.WithValue(rq.Context(), slogContextKey{}, "request")))
+			ctx.Info("handled")
+			Expect(contexts).To(HaveLen(1))
+			Expect(contexts[0].Value(slogContextKey{})).To(Equal("request"))
+		})
+	})
+	When("the level is disabled in the handler", func() {
+		It("should not be handled", func() {
+			ctx.Debug("hidden")
+			Expect(outBuffer.String()).To(BeEmpty())
+		})
+	})
+})
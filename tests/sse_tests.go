@@ -0,0 +1,74 @@
+package toolkits
+
+import (
+	"context"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+var _ = Describe("SSE", func() {
+	var rr *httptest.ResponseRecorder
+	var ctx toolkit.FunctionContext
+	var cancel context.CancelFunc
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		var rctx context.Context
+		rctx, cancel = context.WithCancel(context.Background())
+		ctx = toolkit.FuncCtx(rr, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(rctx))
+	})
+	AfterEach(func() {
+		cancel()
+	})
+	When("events are sent", func() {
+		It("should write them in the event stream format", func() {
+			stream, err := ctx.SSE()
+			Expect(err).ToNot(HaveOccurred())
+			defer stream.Close()
+			Expect(stream.Send("progress", toolkit.Json{"done": 1})).To(Succeed())
+			Expect(stream.Send("", "line 1\nline 2")).To(Succeed())
+			Expect(rr.Header().Get("Content-Type")).To(Equal("text/event-stream"))
+			Expect(rr.Body.String()).To(Equal("event: progress\ndata: {\"done\":1}\n\ndata: line 1\ndata: line 2\n\n"))
+			Expect(rr.Flushed).To(BeTrue())
+		})
+	})
+	When("the request is cancelled", func() {
+		It("should fail to send events", func() {
+			stream, err := ctx.SSE()
+			Expect(err).ToNot(HaveOccurred())
+			defer stream.Close()
+			cancel()
+			Expect(stream.Send("progress", "1")).ToNot(Succeed())
+		})
+	})
+	When("the handler returns without closing the stream", func() {
+		It("should stop the heartbeats", func() {
+			interval := toolkit.SSEHeartbeatInterval
+			toolkit.SSEHeartbeatInterval = time.Millisecond
+			defer func() { toolkit.SSEHeartbeatInterval = interval }()
+			var stream *toolkit.EventStream
+			toolkit.Handle(func(ctx toolkit.FunctionContext) error {
+				stream, _ = ctx.SSE()
+				time.Sleep(5 * time.Millisecond)
+				return nil
+			})(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+			written := rr.Body.String()
+			Expect(written).To(ContainSubstring(": heartbeat"))
+			time.Sleep(10 * time.Millisecond)
+			Expect(rr.Body.String()).To(Equal(written))
+			Expect(stream.Send("progress", "1")).ToNot(Succeed())
+		})
+	})
+	When("the stream is closed", func() {
+		It("should fail to send events", func() {
+			stream, err := ctx.SSE()
+			Expect(err).ToNot(HaveOccurred())
+			stream.Close()
+			Expect(stream.Send("progress", "1")).ToNot(Succeed())
+		})
+	})
+})
@@ -0,0 +1,113 @@
+package toolkits
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("Response errors", func() {
+	var rr *httptest.ResponseRecorder
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+	serve := func(err error) toolkit.ErrorResponseStruct {
+		toolkit.Handle(func(ctx toolkit.FunctionContext) error {
+			return err
+		}).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		var res toolkit.ErrorResponseStruct
+		Expect(json.Unmarshal(rr.Body.Bytes(), &res)).To(Succeed())
+		return res
+	}
+	When("a handler returns an error created by a constructor", func() {
+		It("should respond with its status and message", func() {
+			res := serve(toolkit.Conflict("Order already exists"))
+			Expect(rr.Code).To(Equal(http.StatusConflict))
+			Expect(res.Message).To(Equal("Order already exists"))
+		})
+		It("should send its details", func() {
+			res := serve(toolkit.BadRequest("Invalid order", toolkit.ErrorDetail{Field: "quantity", Code: "min", Message: "must be positive"}))
+			Expect(rr.Code).To(Equal(http.StatusBadRequest))
+			Expect(res.Details).To(Equal([]toolkit.ErrorDetail{{Field: "quantity", Code: "min", Message: "must be positive"}}))
+		})
+		It("should not send its cause", func() {
+			res := serve(toolkit.NotFound("Order not found").WithCause(errors.New("no rows in orders_v2")))
+			Expect(rr.Code).To(Equal(http.StatusNotFound))
+			Expect(res.Message).To(Equal("Order not found"))
+			Expect(rr.Body.String()).NotTo(ContainSubstring("orders_v2"))
+		})
+	})
+	When("an error is created", func() {
+		It("should default the message to the status text", func() {
+			Expect(toolkit.Unauthorized("").ClientMessage()).To(Equal("Unauthorized"))
+		})
+		It("should include and unwrap to its cause", func() {
+			cause := errors.New("connection refused")
+			err := fmt.Errorf("loading: %w", toolkit.Internal("Failed to load order", cause))
+			Expect(err.Error()).To(Equal("loading: Failed to load order: connection refused"))
+			Expect(errors.Is(err, cause)).To(BeTrue())
+			var responseErr *toolkit.ResponseError
+			Expect(errors.As(err, &responseErr)).To(BeTrue())
+			Expect(responseErr.StatusCode()).To(Equal(http.StatusInternalServerError))
+		})
+		It("should not change the original when a cause is added", func() {
+			base := toolkit.Forbidden("Not your order")
+			base.WithCause(errors.New("owner mismatch"))
+			Expect(base.Cause).To(BeNil())
+		})
+	})
+})
+
+var _ = Describe("Client messages", func() {
+	var outBuffer bytes.Buffer
+	var rr *httptest.ResponseRecorder
+
+	BeforeEach(func() {
+		outBuffer.Reset()
+		rr = httptest.NewRecorder()
+		toolkit.Configure(toolkit.WithLogWriter(&outBuffer))
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter())
+		toolkit.ResetErrorMappings()
+	})
+	When("an error has an internal message", func() {
+		It("should log the internal message and cause chain, and only send the client message", func() {
+			err := toolkit.NotFound("Order not found").
+				WithInternal("order %v is not in shard %v", 42, "db-3.internal").
+				WithCause(errors.New("sql: no rows in result set"))
+			toolkit.Handle(func(ctx toolkit.FunctionContext) error {
+				return err
+			}).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			Expect(rr.Body.String()).To(ContainSubstring("Order not found"))
+			Expect(rr.Body.String()).NotTo(ContainSubstring("db-3.internal"))
+			Expect(rr.Body.String()).NotTo(ContainSubstring("sql:"))
+
+			var entry map[string]interface{}
+			Expect(json.NewDecoder(&outBuffer).Decode(&entry)).To(Succeed())
+			Expect(entry["error"]).To(Equal("order 42 is not in shard db-3.internal: sql: no rows in result set"))
+			Expect(entry["errorChain"]).To(HaveLen(2))
+		})
+	})
+	When("the client message of an error is read", func() {
+		It("should only return messages which are safe to send", func() {
+			toolkit.MapError(errOrderNotFound, http.StatusNotFound, "Order not found")
+			Expect(toolkit.ClientMessage(toolkit.Conflict("Already exists").WithInternal("duplicate key orders_pkey"))).To(Equal("Already exists"))
+			Expect(toolkit.ClientMessage(fmt.Errorf("loading: %w", errOrderNotFound))).To(Equal("Order not found"))
+			Expect(toolkit.ClientMessage(errors.New("pq: relation orders does not exist"))).To(BeEmpty())
+		})
+	})
+})
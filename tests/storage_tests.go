@@ -0,0 +1,101 @@
+package toolkits
+
+import (
+	"context"
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	"github.com/cloudevents/sdk-go/v2/event"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"time"
+)
+
+const storageObjectJson = `{"bucket":"uploads","name":"invoices/2024/05.pdf","generation":"1714557600123456","metageneration":"1","contentType":"application/pdf","size":"5120","metadata":{"customer":"c-7"},"timeCreated":"2024-05-01T10:00:00.123Z","updated":"2024-05-01T10:00:00.123Z"}`
+
+var _ = Describe("Cloud Storage events", func() {
+	BeforeEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+	When("a CloudEvent is bound", func() {
+		It("should decode the object and the kind of event", func() {
+			e := event.New()
+			e.SetID("8403741263891245")
+			e.SetType("google.cloud.storage.object.v1.finalized")
+			e.SetSource("//storage.googleapis.com/projects/_/buckets/uploads")
+			Expect(e.SetData(event.ApplicationJSON, json.RawMessage(storageObjectJson))).To(Succeed())
+
+			object, kind, err := toolkit.EventCtx(context.Background(), e).BindStorageObject()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(kind).To(Equal(toolkit.StorageFinalized))
+			Expect(object.Bucket).To(Equal("uploads"))
+			Expect(object.Name).To(Equal("invoices/2024/05.pdf"))
+			Expect(object.Generation).To(Equal(int64(1714557600123456)))
+			Expect(object.Size).To(Equal(int64(5120)))
+			Expect(object.Metadata).To(HaveKeyWithValue("customer", "c-7"))
+			Expect(object.TimeCreated).To(Equal(time.Date(2024, 5, 1, 10, 0, 0, 123000000, time.UTC)))
+		})
+		It("should reject events of other types", func() {
+			e := event.New()
+			e.SetType("com.example.order.created")
+			_, _, err := toolkit.EventCtx(context.Background(), e).BindStorageObject()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	When("a legacy background event is decoded", func() {
+		It("should decode the object and the kind of event", func() {
+			var object toolkit.StorageObject
+			Expect(json.Unmarshal([]byte(storageObjectJson), &object)).To(Succeed())
+			Expect(object.Generation).To(Equal(int64(1714557600123456)))
+			Expect(toolkit.StorageEventKind("google.storage.object.delete")).To(Equal(toolkit.StorageDeleted))
+		})
+	})
+	When("the object is opened", func() {
+		var server *httptest.Server
+		var requested string
+
+		BeforeEach(func() {
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasSuffix(r.URL.Path, "/token") {
+					_, _ = w.Write([]byte(`{"access_token":"test-token","expires_in":3600}`))
+					return
+				}
+				requested = r.URL.RequestURI()
+				if r.URL.Query().Get("generation") != "1714557600123456" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				_, _ = w.Write([]byte("%PDF-1.7"))
+			}))
+			os.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(server.URL, "http://"))
+			os.Setenv("STORAGE_EMULATOR_HOST", strings.TrimPrefix(server.URL, "http://"))
+		})
+		AfterEach(func() {
+			os.Unsetenv("GCE_METADATA_HOST")
+			os.Unsetenv("STORAGE_EMULATOR_HOST")
+			server.Close()
+		})
+		It("should read the generation of the event", func() {
+			var object toolkit.StorageObject
+			Expect(json.Unmarshal([]byte(storageObjectJson), &object)).To(Succeed())
+			ctx := toolkit.FuncCtx(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+			reader, err := ctx.OpenObject(object)
+			Expect(err).NotTo(HaveOccurred())
+			defer reader.Close()
+			Expect(io.ReadAll(reader)).To(Equal([]byte("%PDF-1.7")))
+			Expect(requested).To(HavePrefix("/storage/v1/b/uploads/o/invoices%2F2024%2F05.pdf?"))
+		})
+		It("should fail when the generation no longer exists", func() {
+			ctx := toolkit.FuncCtx(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+			_, err := ctx.OpenObject(toolkit.StorageObject{Bucket: "uploads", Name: "invoices/2024/05.pdf", Generation: 1})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
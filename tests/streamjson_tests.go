@@ -0,0 +1,55 @@
+package toolkits
+
+import (
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("StreamResponseJson", func() {
+	var rr *httptest.ResponseRecorder
+	var ctx toolkit.FunctionContext
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		ctx = toolkit.FuncCtx(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+	When("elements are streamed", func() {
+		It("should write a success response containing the array", func() {
+			stream, err := ctx.StreamResponseJson()
+			Expect(err).ToNot(HaveOccurred())
+			for i := 0; i < 3; i++ {
+				Expect(stream.Encode(toolkit.Json{"n": i})).To(Succeed())
+			}
+			Expect(stream.Close()).To(Succeed())
+
+			var res toolkit.SuccessResponseStruct
+			Expect(json.Unmarshal(rr.Body.Bytes(), &res)).To(Succeed())
+			Expect(res.SpanId).To(Equal(ctx.SpanId))
+			Expect(res.Data).To(HaveLen(3))
+		})
+	})
+	When("a custom formatter is registered", func() {
+		It("should stream the array inside its envelope", func() {
+			toolkit.Configure(toolkit.WithResponseFormatter(versionedFormatter{}))
+			defer toolkit.Configure(toolkit.WithResponseFormatter(toolkit.DefaultResponseFormatter{}))
+			stream, err := ctx.StreamResponseJson()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stream.Encode(1)).To(Succeed())
+			Expect(stream.Encode(2)).To(Succeed())
+			Expect(stream.Close()).To(Succeed())
+			Expect(rr.Body.String()).To(MatchJSON(`{"traceId":"` + ctx.SpanId + `","apiVersion":"2","result":[1,2]}`))
+		})
+	})
+	When("no elements are streamed", func() {
+		It("should write an empty array", func() {
+			stream, err := ctx.StreamResponseJson()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stream.Close()).To(Succeed())
+			Expect(rr.Body.String()).To(HaveSuffix(`"data":[]}`))
+		})
+	})
+})
@@ -0,0 +1,140 @@
+package toolkits
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+)
+
+func stripeSignature(secret string, timestamp time.Time, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%v.%v", timestamp.Unix(), body)
+	return fmt.Sprintf("t=%v,v1=%v", timestamp.Unix(), hex.EncodeToString(mac.Sum(nil)))
+}
+
+var _ = Describe("StripeWebhook", func() {
+	const body = `{"id":"evt_1","type":"payment_intent.succeeded","api_version":"2024-06-20","created":1718000000,"livemode":false,` +
+		`"data":{"object":{"id":"pi_1","amount":2000,"currency":"eur"}},"request":{"id":"req_1","idempotency_key":"key_1"}}`
+	var webhook *toolkit.StripeWebhook
+	var handled []string
+	var intent struct {
+		Id     string `json:"id"`
+		Amount int    `json:"amount"`
+	}
+
+	BeforeEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+		handled = nil
+		webhook = toolkit.NewStripeWebhook("whsec_test").
+			On("payment_intent.succeeded", func(ctx toolkit.FunctionContext, event toolkit.StripeEvent) error {
+				handled = append(handled, "succeeded:"+event.Id)
+				return event.Bind(&intent)
+			}).
+			On("payment_intent.*", func(ctx toolkit.FunctionContext, event toolkit.StripeEvent) error {
+				handled = append(handled, "other:"+event.Type)
+				return nil
+			})
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter())
+	})
+
+	request := func(signature string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		if signature != "" {
+			r.Header.Set("Stripe-Signature", signature)
+		}
+		rr := httptest.NewRecorder()
+		toolkit.Handle(webhook.Handle)(rr, r)
+		return rr
+	}
+
+	When("the request is correctly signed", func() {
+		It("should dispatch the event to the handler of its type", func() {
+			rr := request(stripeSignature("whsec_test", time.Now(), body), body)
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(handled).To(Equal([]string{"succeeded:evt_1"}))
+			Expect(intent.Id).To(Equal("pi_1"))
+			Expect(intent.Amount).To(Equal(2000))
+		})
+		It("should match types with a wildcard", func() {
+			failed := strings.Replace(body, "payment_intent.succeeded", "payment_intent.payment_failed", 1)
+			Expect(request(stripeSignature("whsec_test", time.Now(), failed), failed).Code).To(Equal(http.StatusOK))
+			Expect(handled).To(Equal([]string{"other:payment_intent.payment_failed"}))
+		})
+		It("should acknowledge events without a handler", func() {
+			refund := strings.Replace(body, "payment_intent.succeeded", "charge.refunded", 1)
+			Expect(request(stripeSignature("whsec_test", time.Now(), refund), refund).Code).To(Equal(http.StatusOK))
+			Expect(handled).To(BeEmpty())
+		})
+		It("should run the otherwise handler for events without a route", func() {
+			webhook.Otherwise(func(ctx toolkit.FunctionContext, event toolkit.StripeEvent) error {
+				handled = append(handled, "otherwise:"+event.Type)
+				return nil
+			})
+			refund := strings.Replace(body, "payment_intent.succeeded", "charge.refunded", 1)
+			request(stripeSignature("whsec_test", time.Now(), refund), refund)
+			Expect(handled).To(Equal([]string{"otherwise:charge.refunded"}))
+		})
+		It("should accept any of the signatures while rolling the secret", func() {
+			webhook = toolkit.NewStripeWebhook("whsec_old", "whsec_new").On("*", func(toolkit.FunctionContext, toolkit.StripeEvent) error { return nil })
+			now := time.Now()
+			old, renewed := stripeSignature("whsec_other", now, body), stripeSignature("whsec_new", now, body)
+			_, v1, _ := strings.Cut(renewed, ",")
+			Expect(request(old+","+v1, body).Code).To(Equal(http.StatusOK))
+		})
+		It("should respond with the status of the handler's error so Stripe retries", func() {
+			webhook = toolkit.NewStripeWebhook("whsec_test").On("*", func(toolkit.FunctionContext, toolkit.StripeEvent) error {
+				return errors.New("database unavailable")
+			})
+			Expect(request(stripeSignature("whsec_test", time.Now(), body), body).Code).To(Equal(http.StatusInternalServerError))
+		})
+	})
+	When("the request isn't correctly signed", func() {
+		It("should respond with a 401 status without running a handler", func() {
+			Expect(request("", body).Code).To(Equal(http.StatusUnauthorized))
+			Expect(request(stripeSignature("whsec_other", time.Now(), body), body).Code).To(Equal(http.StatusUnauthorized))
+			tampered := strings.Replace(body, "2000", "1", 1)
+			Expect(request(stripeSignature("whsec_test", time.Now(), body), tampered).Code).To(Equal(http.StatusUnauthorized))
+			Expect(handled).To(BeEmpty())
+		})
+		It("should reject signatures outside the tolerance", func() {
+			Expect(request(stripeSignature("whsec_test", time.Now().Add(-10*time.Minute), body), body).Code).To(Equal(http.StatusUnauthorized))
+			webhook.WithTolerance(time.Hour)
+			Expect(request(stripeSignature("whsec_test", time.Now().Add(-10*time.Minute), body), body).Code).To(Equal(http.StatusOK))
+		})
+	})
+	When("a signing secret is missing", func() {
+		It("should panic", func() {
+			Expect(func() { toolkit.NewStripeWebhook() }).To(Panic())
+			Expect(func() { toolkit.NewStripeWebhook("whsec_test", "") }).To(Panic())
+		})
+		It("should reject requests verified without a secret", func() {
+			for _, secrets := range [][]string{nil, {""}, {"whsec_test", ""}} {
+				r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+				r.Header.Set("Stripe-Signature", stripeSignature("", time.Now(), body))
+				ctx := toolkit.FuncCtx(httptest.NewRecorder(), r)
+				_, err := ctx.VerifyStripeSignature(0, secrets...)
+				var responseErr *toolkit.ResponseError
+				Expect(errors.As(err, &responseErr)).To(BeTrue())
+				Expect(responseErr.Status).To(Equal(http.StatusInternalServerError))
+			}
+		})
+	})
+	When("the body isn't a Stripe event", func() {
+		It("should respond with a 400 status", func() {
+			Expect(request(stripeSignature("whsec_test", time.Now(), "[]"), "[]").Code).To(Equal(http.StatusBadRequest))
+			Expect(request(stripeSignature("whsec_test", time.Now(), "{}"), "{}").Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+})
@@ -0,0 +1,67 @@
+package toolkits
+
+import (
+	"bytes"
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("OpenTelemetry", func() {
+	var recorder *tracetest.SpanRecorder
+	var rr *httptest.ResponseRecorder
+	var rq *http.Request
+
+	BeforeEach(func() {
+		recorder = tracetest.NewSpanRecorder()
+		toolkit.Configure(toolkit.WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))))
+		rr = httptest.NewRecorder()
+		rq = httptest.NewRequest(http.MethodGet, "/orders", nil)
+		rq.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithTracerProvider(nil))
+	})
+	When("a request is handled", func() {
+		It("should record a server span continuing the incoming trace", func() {
+			ctx := toolkit.FuncCtx(rr, rq)
+			Expect(ctx.TraceId).To(Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+			ctx.OkResponseJson(nil)
+			spans := recorder.Ended()
+			Expect(spans).To(HaveLen(1))
+			Expect(spans[0].Name()).To(Equal("GET /orders"))
+			Expect(spans[0].SpanKind()).To(Equal(trace.SpanKindServer))
+			Expect(spans[0].Parent().SpanID().String()).To(Equal("00f067aa0ba902b7"))
+		})
+	})
+	When("a child span is started", func() {
+		It("should be a child of the server span and appear in the logs", func() {
+			ctx := toolkit.FuncCtx(rr, rq)
+			var outBuffer bytes.Buffer
+			logger := ctx.Logger.Output(&outBuffer)
+			ctx.Logger = &logger
+
+			child, span := ctx.StartSpan("load-user")
+			child.Info("loading")
+			span.End()
+			ctx.OkResponseJson(nil)
+
+			spans := recorder.Ended()
+			Expect(spans).To(HaveLen(2))
+			Expect(spans[0].Name()).To(Equal("load-user"))
+			Expect(spans[0].Parent().SpanID()).To(Equal(spans[1].SpanContext().SpanID()))
+
+			var entry map[string]interface{}
+			Expect(json.NewDecoder(&outBuffer).Decode(&entry)).To(Succeed())
+			Expect(entry["traceId"]).To(Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+			Expect(entry["otelSpanId"]).To(Equal(spans[0].SpanContext().SpanID().String()))
+			Expect(child.Traceparent()).To(ContainSubstring(spans[0].SpanContext().SpanID().String()))
+		})
+	})
+})
@@ -0,0 +1,45 @@
+package toolkits
+
+import (
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"net/http"
+	"net/http/httptest"
+	"testing/fstest"
+)
+
+var _ = Describe("HTMLResponse", func() {
+	var rr *httptest.ResponseRecorder
+	var ctx toolkit.FunctionContext
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		ctx = toolkit.FuncCtx(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		toolkit.Templates(fstest.MapFS{
+			"page.tmpl":           {Data: []byte(`{{template "header" .}}<p>{{.Name}}</p>`)},
+			"broken.tmpl":         {Data: []byte(`{{.Name.Field}}`)},
+			"layouts/header.tmpl": {Data: []byte(`{{define "header"}}<h1>{{.Title}}</h1>{{end}}`)},
+		}, "layouts/*.tmpl")
+	})
+	When("the template exists", func() {
+		It("should render it with escaped data", func() {
+			ctx.HTMLResponse(http.StatusOK, "page.tmpl", map[string]string{"Title": "Consent", "Name": "<script>"})
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(rr.Header().Get("Content-Type")).To(Equal("text/html; charset=utf-8"))
+			Expect(rr.Body.String()).To(Equal("<h1>Consent</h1><p>&lt;script&gt;</p>"))
+		})
+	})
+	When("the template doesn't exist", func() {
+		It("should send a 500 response", func() {
+			ctx.HTMLResponse(http.StatusOK, "missing.tmpl", nil)
+			Expect(rr.Code).To(Equal(http.StatusInternalServerError))
+		})
+	})
+	When("the template fails to render", func() {
+		It("should send a 500 response", func() {
+			ctx.HTMLResponse(http.StatusOK, "broken.tmpl", map[string]string{"Name": "foo"})
+			Expect(rr.Code).To(Equal(http.StatusInternalServerError))
+		})
+	})
+})
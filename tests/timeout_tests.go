@@ -0,0 +1,78 @@
+package toolkits
+
+import (
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+var _ = Describe("Timeouts", func() {
+	var rr *httptest.ResponseRecorder
+	var rq *http.Request
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		rq = httptest.NewRequest(http.MethodGet, "/", nil)
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard), toolkit.WithTimeout(50*time.Millisecond))
+	})
+	AfterEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter(), toolkit.WithoutTimeout())
+	})
+	When("a timeout is configured", func() {
+		It("should give the request's context a deadline", func() {
+			ctx := toolkit.FuncCtx(rr, rq)
+			_, ok := ctx.Context.Deadline()
+			Expect(ok).To(BeTrue())
+			Expect(ctx.RemainingTime()).To(BeNumerically("<=", 50*time.Millisecond))
+			Expect(ctx.RemainingTime()).To(BeNumerically(">", 0))
+		})
+	})
+	When("no timeout is configured", func() {
+		It("should have unlimited time remaining", func() {
+			toolkit.Configure(toolkit.WithoutTimeout())
+			Expect(toolkit.FuncCtx(rr, rq).RemainingTime()).To(Equal(time.Duration(math.MaxInt64)))
+		})
+	})
+	When("the handler responds before the deadline", func() {
+		It("should send its response with its headers", func() {
+			toolkit.Handle(func(ctx toolkit.FunctionContext) error {
+				ctx.SetResponseHeader("X-Order-Count", "3")
+				ctx.OkResponseJson(toolkit.Json{"count": 3})
+				return nil
+			}).ServeHTTP(rr, rq)
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(rr.Header().Get("X-Order-Count")).To(Equal("3"))
+			Expect(rr.Header().Get(toolkit.RequestIdHeader)).NotTo(BeEmpty())
+		})
+	})
+	When("the handler returns the deadline's error", func() {
+		It("should send a 504 response", func() {
+			toolkit.Handle(func(ctx toolkit.FunctionContext) error {
+				<-ctx.Context.Done()
+				return ctx.Context.Err()
+			}).ServeHTTP(rr, rq)
+			Expect(rr.Code).To(Equal(http.StatusGatewayTimeout))
+		})
+	})
+	When("the handler ignores the deadline", func() {
+		It("should send a 504 response at the deadline and discard the handler's response", func() {
+			toolkit.Handle(func(ctx toolkit.FunctionContext) error {
+				time.Sleep(100 * time.Millisecond)
+				ctx.SetResponseHeader("X-Late", "true")
+				ctx.OkResponseJson(toolkit.Json{"late": true})
+				return nil
+			}).ServeHTTP(rr, rq)
+			Expect(rr.Code).To(Equal(http.StatusGatewayTimeout))
+			Expect(rr.Header().Get("X-Late")).To(BeEmpty())
+			var res toolkit.ErrorResponseStruct
+			Expect(json.Unmarshal(rr.Body.Bytes(), &res)).To(Succeed())
+			Expect(res.Message).To(Equal("Request timed out"))
+		})
+	})
+})
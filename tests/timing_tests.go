@@ -0,0 +1,73 @@
+package toolkits
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("Time", func() {
+	var ctx toolkit.FunctionContext
+	var outBuffer bytes.Buffer
+
+	BeforeEach(func() {
+		rr := httptest.NewRecorder()
+		rq := httptest.NewRequest(http.MethodGet, "/", nil)
+		ctx = toolkit.FuncCtx(rr, rq)
+		outBuffer.Reset()
+		logger := ctx.Logger.Output(&outBuffer)
+		ctx.Logger = &logger
+	})
+	When("the operation succeeds", func() {
+		It("should log its duration at the INFO level", func() {
+			err := ctx.Time("load-user", func(cctx toolkit.FunctionContext) error {
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			var entry map[string]interface{}
+			Expect(json.Unmarshal(outBuffer.Bytes(), &entry)).To(Succeed())
+			Expect(entry["level"]).To(Equal("info"))
+			Expect(entry["operation"]).To(Equal("load-user"))
+			Expect(entry).To(HaveKey("duration"))
+			Expect(entry["caller"]).To(ContainSubstring("timing_tests.go"))
+		})
+	})
+	When("the operation fails", func() {
+		It("should return the error and log it at the ERROR level", func() {
+			err := ctx.Time("load-user", func(cctx toolkit.FunctionContext) error {
+				return errors.New("not found")
+			})
+			Expect(err).To(MatchError("not found"))
+			var entry map[string]interface{}
+			Expect(json.Unmarshal(outBuffer.Bytes(), &entry)).To(Succeed())
+			Expect(entry["level"]).To(Equal("error"))
+			Expect(entry["message"]).To(ContainSubstring("not found"))
+		})
+	})
+	When("OpenTelemetry is enabled", func() {
+		var recorder *tracetest.SpanRecorder
+		BeforeEach(func() {
+			recorder = tracetest.NewSpanRecorder()
+			toolkit.Configure(toolkit.WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))))
+		})
+		AfterEach(func() {
+			toolkit.Configure(toolkit.WithTracerProvider(nil))
+		})
+		It("should record the operation as a span", func() {
+			_ = ctx.Time("load-user", func(cctx toolkit.FunctionContext) error {
+				return errors.New("not found")
+			})
+			spans := recorder.Ended()
+			Expect(spans).To(HaveLen(1))
+			Expect(spans[0].Name()).To(Equal("load-user"))
+			Expect(spans[0].Status().Description).To(Equal("not found"))
+		})
+	})
+})
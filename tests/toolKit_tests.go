@@ -2,6 +2,9 @@ package toolkits
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	toolkit "github.com/Platform48/function_toolkit"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -9,6 +12,7 @@ import (
 	"github.com/stretchr/testify/mock"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 )
 
 type MockJson struct {
@@ -281,4 +285,67 @@ var _ = Describe("Toolkit", func() {
 			Expect(outBuffer.String()).To(ContainSubstring("msg"))
 		})
 	})
+	When("WithFields is called", func() {
+		BeforeEach(func() {
+			outBuffer = bytes.Buffer{}
+			ctx = toolkit.FuncCtx(rr, rq)
+			logger := zerolog.New(&outBuffer).With().Timestamp().Str("spanId", "["+"testSpanId"+"]").Logger()
+			ctx.Logger = &logger
+		})
+		It("should add the fields to every log message of the new ctx", func() {
+			newCtx = ctx.WithFields(map[string]interface{}{"userId": "u1"}).WithField("orderId", 42)
+			newCtx.Info("first")
+			newCtx.Warnf("second %v", 2)
+			Expect(outBuffer.String()).To(ContainSubstring(`"userId":"u1","orderId":42`))
+			Expect(strings.Count(outBuffer.String(), `"userId":"u1"`)).To(Equal(2))
+		})
+		It("should not change the original ctx", func() {
+			_ = ctx.WithField("orderId", 42)
+			ctx.Info("message")
+			Expect(outBuffer.String()).ToNot(ContainSubstring("orderId"))
+		})
+	})
+	When("ErrorErr is called", func() {
+		BeforeEach(func() {
+			outBuffer = bytes.Buffer{}
+			ctx = toolkit.FuncCtx(rr, rq)
+			logger := zerolog.New(&outBuffer).With().Timestamp().Str("spanId", "["+"testSpanId"+"]").Logger()
+			ctx.Logger = &logger
+		})
+		It("should log the error chain and stack trace", func() {
+			cause := errors.New("connection refused")
+			ctx.ErrorErr(fmt.Errorf("loading user: %w", cause), "request failed")
+			var entry map[string]interface{}
+			Expect(json.Unmarshal(outBuffer.Bytes(), &entry)).To(Succeed())
+			Expect(entry["level"]).To(Equal("error"))
+			Expect(entry["error"]).To(Equal("loading user: connection refused"))
+			Expect(entry["errorChain"]).To(Equal([]interface{}{
+				map[string]interface{}{"type": "*fmt.wrapError", "message": "loading user: connection refused"},
+				map[string]interface{}{"type": "*errors.errorString", "message": "connection refused"},
+			}))
+			Expect(entry["stack"]).ToNot(BeEmpty())
+			Expect(entry["stack"].([]interface{})[0]).To(ContainSubstring("toolKit_tests.go"))
+		})
+	})
+	When("the GCP log format is enabled", func() {
+		BeforeEach(func() {
+			toolkit.Configure(toolkit.WithGcpLogFormat(true))
+			outBuffer = bytes.Buffer{}
+			ctx = toolkit.FuncCtx(rr, rq)
+			logger := zerolog.New(&outBuffer).With().Timestamp().Str("spanId", "["+"testSpanId"+"]").Logger()
+			ctx.Logger = &logger
+		})
+		AfterEach(func() {
+			toolkit.Configure(toolkit.WithGcpLogFormat(false))
+		})
+		It("should write the severity and source location", func() {
+			ctx.Warn("careful")
+			var entry map[string]interface{}
+			Expect(json.Unmarshal(outBuffer.Bytes(), &entry)).To(Succeed())
+			Expect(entry["severity"]).To(Equal("WARNING"))
+			Expect(entry["message"]).To(HaveSuffix("careful"))
+			Expect(entry).ToNot(HaveKey("level"))
+			Expect(entry["logging.googleapis.com/sourceLocation"]).To(HaveKeyWithValue("file", ContainSubstring("toolKit_tests.go")))
+		})
+	})
 })
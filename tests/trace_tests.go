@@ -0,0 +1,99 @@
+package toolkits
+
+import (
+	"bytes"
+	"encoding/json"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+)
+
+var _ = Describe("Trace correlation", func() {
+	var rr *httptest.ResponseRecorder
+	var rq *http.Request
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		rq = httptest.NewRequest(http.MethodGet, "/", nil)
+	})
+	When("the request has a traceparent header", func() {
+		It("should expose the trace id", func() {
+			rq.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+			Expect(toolkit.FuncCtx(rr, rq).TraceId).To(Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+		})
+	})
+	When("the request has an invalid traceparent header", func() {
+		It("should fall back to X-Cloud-Trace-Context", func() {
+			rq.Header.Set("traceparent", "00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+			rq.Header.Set("X-Cloud-Trace-Context", "105445AA7843BC8BF206B12000100000/1;o=1")
+			Expect(toolkit.FuncCtx(rr, rq).TraceId).To(Equal("105445aa7843bc8bf206b12000100000"))
+		})
+	})
+	When("the GCP log format is enabled", func() {
+		var outBuffer bytes.Buffer
+		BeforeEach(func() {
+			os.Setenv("GOOGLE_CLOUD_PROJECT", "test-project")
+			toolkit.Configure(toolkit.WithGcpLogFormat(true))
+			outBuffer.Reset()
+		})
+		AfterEach(func() {
+			toolkit.Configure(toolkit.WithGcpLogFormat(false))
+		})
+		It("should add the trace fields to the logs", func() {
+			rq.Header.Set("X-Cloud-Trace-Context", "105445aa7843bc8bf206b12000100000/255;o=1")
+			ctx := toolkit.FuncCtx(rr, rq)
+			logger := ctx.Logger.Output(&outBuffer).Level(zerolog.DebugLevel)
+			ctx.Logger = &logger
+			ctx.Info("hello")
+			var entry map[string]interface{}
+			Expect(json.Unmarshal(outBuffer.Bytes(), &entry)).To(Succeed())
+			Expect(entry["logging.googleapis.com/trace"]).To(Equal("projects/test-project/traces/105445aa7843bc8bf206b12000100000"))
+			Expect(entry["logging.googleapis.com/spanId"]).To(Equal("00000000000000ff"))
+			Expect(entry["logging.googleapis.com/trace_sampled"]).To(BeTrue())
+			Expect(entry["message"]).To(Equal("hello"))
+		})
+	})
+	When("outbound requests are sent", func() {
+		var received http.Header
+		var server *httptest.Server
+
+		BeforeEach(func() {
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received = r.Header.Clone()
+			}))
+			rq.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+			rq.Header.Set("tracestate", "vendor=value")
+		})
+		AfterEach(func() {
+			server.Close()
+		})
+		It("should propagate the trace with the ctx's http client", func() {
+			ctx := toolkit.FuncCtx(rr, rq)
+			_, err := ctx.HTTPClient().Get(server.URL)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(received.Get("traceparent")).To(Equal(ctx.Traceparent()))
+			Expect(received.Get("traceparent")).To(HavePrefix("00-4bf92f3577b34da6a3ce929d0e0e4736-"))
+			Expect(received.Get("traceparent")).ToNot(ContainSubstring("00f067aa0ba902b7"))
+			Expect(received.Get("tracestate")).To(Equal("vendor=value"))
+		})
+		It("should propagate the trace with the tracing transport", func() {
+			ctx := toolkit.FuncCtx(rr, rq)
+			client := &http.Client{Transport: toolkit.NewTracingTransport(nil)}
+			outbound, _ := http.NewRequestWithContext(ctx.Context, http.MethodGet, server.URL, nil)
+			_, err := client.Do(outbound)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(received.Get("traceparent")).To(Equal(ctx.OutgoingHeaders().Get("traceparent")))
+		})
+	})
+	When("the request doesn't belong to a trace", func() {
+		It("should start a new one", func() {
+			ctx := toolkit.FuncCtx(rr, rq)
+			Expect(ctx.TraceId).To(HaveLen(32))
+			Expect(ctx.Traceparent()).To(MatchRegexp("^00-[0-9a-f]{32}-[0-9a-f]{16}-00$"))
+		})
+	})
+})
@@ -0,0 +1,82 @@
+package toolkits
+
+import (
+	"context"
+	"errors"
+	toolkit "github.com/Platform48/function_toolkit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"io"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Describe("Warmup", func() {
+	var rr *httptest.ResponseRecorder
+	var warmups int
+	var handlerCalls int
+	var handler http.HandlerFunc
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		warmups, handlerCalls = 0, 0
+		toolkit.ResetWarmup()
+		toolkit.OnWarmup(func(ctx context.Context) error {
+			warmups++
+			return nil
+		})
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard), toolkit.WithWarmup(toolkit.WarmupConfig{}))
+		handler = toolkit.Handle(func(ctx toolkit.FunctionContext) error {
+			handlerCalls++
+			return nil
+		})
+	})
+	AfterEach(func() {
+		toolkit.ResetWarmup()
+		toolkit.Configure(toolkit.WithLogWriter(), toolkit.WithoutWarmup())
+	})
+	When("a warmup request is received", func() {
+		It("should run the hooks once without calling the handler", func() {
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/_ah/warmup", nil))
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			rq := httptest.NewRequest(http.MethodGet, "/orders", nil)
+			rq.Header.Set("X-Warmup", "1")
+			handler.ServeHTTP(httptest.NewRecorder(), rq)
+			Expect(warmups).To(Equal(1))
+			Expect(handlerCalls).To(Equal(0))
+		})
+	})
+	When("a warmup hook fails", func() {
+		It("should respond with a 500 status and run the hooks again on the next warmup request", func() {
+			failures := 1
+			toolkit.OnWarmup(func(ctx context.Context) error {
+				if failures > 0 {
+					failures--
+					return errors.New("cache unavailable")
+				}
+				return nil
+			})
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/_ah/warmup", nil))
+			Expect(rr.Code).To(Equal(http.StatusInternalServerError))
+			rr = httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/_ah/warmup", nil))
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(warmups).To(Equal(2))
+		})
+	})
+	When("a regular request is received", func() {
+		It("should call the handler", func() {
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/orders", nil))
+			Expect(handlerCalls).To(Equal(1))
+			Expect(warmups).To(Equal(0))
+		})
+	})
+	When("warmup handling is disabled", func() {
+		It("should pass warmup requests to the handler", func() {
+			toolkit.Configure(toolkit.WithoutWarmup())
+			ctx := toolkit.FuncCtx(rr, httptest.NewRequest(http.MethodGet, "/_ah/warmup", nil))
+			Expect(ctx.IsWarmup()).To(BeFalse())
+			Expect(ctx.RespondToWarmup()).To(BeFalse())
+		})
+	})
+})
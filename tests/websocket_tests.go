@@ -0,0 +1,116 @@
+package toolkits
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	toolkit "github.com/Platform48/function_toolkit"
+	"github.com/gorilla/websocket"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WebSocket", func() {
+	var server *httptest.Server
+	var handler toolkit.HandlerFunc
+	var address string
+	var handlers sync.WaitGroup
+
+	BeforeEach(func() {
+		toolkit.Configure(toolkit.WithLogWriter(io.Discard))
+		handler = func(ctx toolkit.FunctionContext) error {
+			socket, err := ctx.UpgradeWebSocket()
+			if err != nil {
+				return nil
+			}
+			return socket.ReadLoop(func(kind int, data []byte) error {
+				if string(data) == "fail" {
+					return errors.New("handler failed")
+				}
+				return socket.WriteJson(toolkit.Json{"echo": string(data)})
+			})
+		}
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handlers.Add(1)
+			defer handlers.Done()
+			toolkit.Handle(handler)(w, r)
+		}))
+		address = "ws" + strings.TrimPrefix(server.URL, "http")
+	})
+	AfterEach(func() {
+		server.Close()
+		handlers.Wait()
+		toolkit.Configure(toolkit.WithLogWriter(), toolkit.WithoutCORS())
+	})
+	When("messages are sent", func() {
+		It("should echo them through the read loop", func() {
+			conn, _, err := websocket.DefaultDialer.Dial(address, nil)
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close()
+			Expect(conn.WriteMessage(websocket.TextMessage, []byte("hello"))).To(Succeed())
+			var reply map[string]string
+			Expect(conn.ReadJSON(&reply)).To(Succeed())
+			Expect(reply).To(Equal(map[string]string{"echo": "hello"}))
+			Expect(conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))).To(Succeed())
+		})
+	})
+	When("the handler fails", func() {
+		It("should close the connection with an internal error", func() {
+			conn, _, err := websocket.DefaultDialer.Dial(address, nil)
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close()
+			Expect(conn.WriteMessage(websocket.TextMessage, []byte("fail"))).To(Succeed())
+			_, _, err = conn.ReadMessage()
+			Expect(websocket.IsCloseError(err, websocket.CloseInternalServerErr)).To(BeTrue())
+		})
+	})
+	When("the request's context is done", func() {
+		It("should close the connection", func() {
+			handler = func(ctx toolkit.FunctionContext) error {
+				timeout, cancel := context.WithTimeout(ctx.Context, 50*time.Millisecond)
+				defer cancel()
+				ctx.Context = timeout
+				socket, err := ctx.UpgradeWebSocket()
+				if err != nil {
+					return nil
+				}
+				return socket.ReadLoop(func(kind int, data []byte) error {
+					return nil
+				})
+			}
+			conn, _, err := websocket.DefaultDialer.Dial(address, nil)
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close()
+			_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			_, _, err = conn.ReadMessage()
+			Expect(websocket.IsCloseError(err, websocket.CloseGoingAway)).To(BeTrue())
+		})
+	})
+	When("the request isn't a WebSocket handshake", func() {
+		It("should respond with a 400 status", func() {
+			res, err := http.Get(server.URL)
+			Expect(err).ToNot(HaveOccurred())
+			defer res.Body.Close()
+			Expect(res.StatusCode).To(Equal(http.StatusBadRequest))
+		})
+	})
+	When("the origin isn't allowed", func() {
+		It("should respond with a 403 status", func() {
+			_, res, err := websocket.DefaultDialer.Dial(address, http.Header{"Origin": {"https://evil.example.com"}})
+			Expect(err).To(HaveOccurred())
+			Expect(res.StatusCode).To(Equal(http.StatusForbidden))
+		})
+		It("should accept origins allowed by CORS", func() {
+			toolkit.Configure(toolkit.WithCORS(toolkit.CORSConfig{AllowedOrigins: []string{"https://app.example.com"}}))
+			conn, _, err := websocket.DefaultDialer.Dial(address, http.Header{"Origin": {"https://app.example.com"}})
+			Expect(err).ToNot(HaveOccurred())
+			conn.Close()
+		})
+	})
+})